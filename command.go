@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// What a command source does when the command exits non-zero
+const (
+	exitErrorFail   = "error"
+	exitErrorChange = "change"
+	exitErrorIgnore = "ignore"
+)
+
+const (
+	defaultCommandTimeout = 10
+	commandMaxOutput      = 1 << 20
+	// How many changed lines {{.ChangedLines}} holds
+	changedLinesShown = 10
+)
+
+func validCommandSource(source Source) error {
+	if len(source.Command) == 0 || source.Command[0] == "" {
+		return fmt.Errorf("a command source needs a command")
+	}
+	switch source.OnExitError {
+	case "", exitErrorFail, exitErrorChange, exitErrorIgnore:
+	default:
+		return fmt.Errorf("unknown on_exit_error: %s (use error, change or ignore)", source.OnExitError)
+	}
+	return nil
+}
+
+// commandRun is the outcome of one run of a command source's command
+type commandRun struct {
+	lines    []string
+	exitCode int
+}
+
+// runCommand runs argv with a timeout and splits its stdout into lines. A
+// non-zero exit is an error unless the source handles it otherwise
+func runCommand(parent context.Context, source Source) (commandRun, error) {
+	ctx, cancel := context.WithTimeout(parent, time.Duration(source.Timeout)*time.Second)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, source.Command[0], source.Command[1:]...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &limitedBuffer{buf: &stdout, limit: commandMaxOutput}
+	cmd.Stderr = &limitedBuffer{buf: &stderr, limit: commandMaxOutput}
+	err := cmd.Run()
+	if parent.Err() != nil {
+		return commandRun{}, parent.Err()
+	}
+	if ctx.Err() != nil {
+		return commandRun{}, fmt.Errorf("timed out after %ds", source.Timeout)
+	}
+	run := commandRun{lines: strings.Split(strings.TrimRight(stdout.String(), "\n"), "\n")}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		run.exitCode = exitErr.ExitCode()
+		if source.OnExitError == exitErrorFail {
+			detail := strings.TrimSpace(stderr.String())
+			if detail == "" {
+				return run, fmt.Errorf("exited with status %d", run.exitCode)
+			}
+			return run, fmt.Errorf("exited with status %d: %s", run.exitCode, detail)
+		}
+		return run, nil
+	}
+	return run, err
+}
+
+// limitedBuffer keeps the first limit bytes written to it and drops the
+// rest, so a runaway command can't fill memory
+type limitedBuffer struct {
+	buf   *bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.buf.Len(); room > 0 {
+		b.buf.Write(p[:min(len(p), room)])
+	}
+	return len(p), nil
+}
+
+// diffLines compares two runs' output as sets of lines, so reordered lines
+// don't count. It returns the lines gone and added, trimmed
+func diffLines(previous, current []string) (removed, added []string) {
+	counts := make(map[string]int)
+	for _, line := range previous {
+		counts[line]++
+	}
+	for _, line := range current {
+		if counts[line] > 0 {
+			counts[line]--
+			continue
+		}
+		added = append(added, strings.TrimSpace(line))
+	}
+	for _, line := range previous {
+		if counts[line] > 0 {
+			counts[line]--
+			removed = append(removed, strings.TrimSpace(line))
+		}
+	}
+	return removed, added
+}
+
+// changedLines renders the lines as "- gone" and "+ added", one per line
+func changedLines(removed, added []string) string {
+	var lines []string
+	for _, line := range removed {
+		lines = append(lines, "- "+line)
+	}
+	for _, line := range added {
+		lines = append(lines, "+ "+line)
+	}
+	if more := len(lines) - changedLinesShown; more > 0 {
+		lines = append(lines[:changedLinesShown], fmt.Sprintf("%d more", more))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// commandMonitor runs a command source's command every interval and counts
+// the lines of its output that changed since the previous run
+type commandMonitor struct {
+	monitorBase
+}
+
+func newCommandMonitor(source Source, status *monitorStatus) *commandMonitor {
+	return &commandMonitor{monitorBase: monitorBase{source: source, status: status}}
+}
+
+func (m *commandMonitor) Start(ctx context.Context) error {
+	source, status := m.source, m.status
+	logger := source.logger
+	config := source.NotificationConfig
+	interval := time.Duration(config.NotificationInterval) * time.Second
+	name := filepath.Base(source.Command[0])
+	if _, err := exec.LookPath(source.Command[0]); err != nil {
+		return fmt.Errorf("cannot run %s: %v", source.Command[0], err)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var previous commandRun
+	haveBaseline := false
+	failures := 0
+	failing := false
+	engine := newActivityEngine(source, status, "command", time.Now)
+
+	check := func() {
+		checkStart := time.Now()
+		if !engine.startInterval() {
+			// Run for a fresh baseline on resume instead of replaying
+			haveBaseline = false
+			return
+		}
+		if !acquireExec(ctx, interval) {
+			logger.Debug().Msg("No exec slot free within the interval, skipping this run")
+			return
+		}
+		run, err := runCommand(ctx, source)
+		releaseExec()
+		if ctx.Err() != nil {
+			// Killed because the monitor stopped, which is no failure
+			return
+		}
+		if err != nil {
+			// Failures are neither changes nor idle time
+			failures++
+			logger.Warn().Msgf("%s failed (%d in a row): %v", name, failures, err)
+			sourceFailed(source, status, err)
+			if failures >= source.FailureThreshold && !failing {
+				failing = true
+				notifySource(source, MessageData{
+					Source: source.Name,
+					Kind:   kindMissing,
+					Detail: fmt.Sprintf("%s failed %d times in a row: %v", name, failures, err),
+				}, true)
+			}
+			return
+		}
+		if failing {
+			notifySource(source, MessageData{
+				Source: source.Name,
+				Kind:   kindRecover,
+				Detail: fmt.Sprintf("%s works again", name),
+			}, true)
+		}
+		failures = 0
+		failing = false
+		sourceWorks(source, status)
+
+		if !haveBaseline {
+			previous = run
+			haveBaseline = true
+			logger.Info().Msgf("First run of %s: %d lines", name, len(run.lines))
+			return
+		}
+
+		removed, added := diffLines(previous.lines, run.lines)
+		changes := len(removed) + len(added)
+		// With on_exit_error change the exit status counts like a line
+		if source.OnExitError == exitErrorChange && run.exitCode != previous.exitCode {
+			removed = append(removed, fmt.Sprintf("exit status %d", previous.exitCode))
+			added = append(added, fmt.Sprintf("exit status %d", run.exitCode))
+			changes++
+		}
+		previous = run
+		engine.endInterval(changes)
+		if changes == 0 {
+			engine.idleInterval(checkStart)
+			return
+		}
+		logger.Info().Msgf("Output of %s changed: %d lines added, %d removed", name, len(added), len(removed))
+		engine.activity(changes)
+		engine.notifyChange(MessageData{
+			Source:       source.Name,
+			Kind:         kindChange,
+			Changes:      changes,
+			Added:        len(added),
+			Removed:      len(removed),
+			Minutes:      engine.intervalMinutes(),
+			Velocity:     engine.velocity(changes, "lines"),
+			ChangedLines: changedLines(removed, added),
+		})
+		recordEvent(eventRecord{Source: source.Name, Kind: kindChange, Events: changes, since: checkStart})
+	}
+
+	check()
+	status.markReady()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		check()
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+type controlResponse struct {
+	OK           bool          `json:"ok"`
+	Error        string        `json:"error,omitempty"`
+	SnoozedUntil *time.Time    `json:"snoozed_until,omitempty"`
+	Status       *statusReport `json:"status,omitempty"`
+}
+
+func defaultControlSocket() string {
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		return filepath.Join(runtimeDir, "minimon.sock")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("minimon-%d.sock", os.Getuid()))
+}
+
+func startControlSocket(props MonitorProps) (net.Listener, error) {
+	socketPath := props.ControlSocket
+	if socketPath == "" {
+		socketPath = defaultControlSocket()
+	}
+
+	// A stale socket from a previous run would make Listen fail
+	if conn, err := net.Dial("unix", socketPath); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("control socket %s is already in use", socketPath)
+	}
+	os.Remove(socketPath)
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not listen on control socket: %v", err)
+	}
+	if err := os.Chmod(socketPath, 0600); err != nil {
+		log.Warn().Err(err).Msg("Failed to restrict control socket permissions")
+	}
+
+	snoozeDuration := time.Duration(props.SnoozeDuration) * time.Second
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if errors.Is(err, net.ErrClosed) {
+					return
+				}
+				log.Error().Err(err).Msg("Control socket accept failed")
+				continue
+			}
+			go handleControlConn(conn, snoozeDuration)
+		}
+	}()
+
+	log.Info().Msgf("Control socket listening on %s", socketPath)
+	return listener, nil
+}
+
+func handleControlConn(conn net.Conn, snoozeDuration time.Duration) {
+	defer conn.Close()
+
+	scanner := bufio.NewScanner(conn)
+	encoder := json.NewEncoder(conn)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		log.Debug().Msgf("Control command: %s", strings.Join(fields, " "))
+		if err := encoder.Encode(handleControlCommand(fields, snoozeDuration)); err != nil {
+			return
+		}
+	}
+}
+
+func handleControlCommand(fields []string, snoozeDuration time.Duration) controlResponse {
+	switch fields[0] {
+	case "snooze":
+		d := snoozeDuration
+		if len(fields) > 1 {
+			parsed, err := time.ParseDuration(fields[1])
+			if err != nil || parsed <= 0 {
+				return controlResponse{Error: fmt.Sprintf("invalid snooze duration: %s", fields[1])}
+			}
+			d = parsed
+		}
+		until := snooze.Snooze(d)
+		return controlResponse{OK: true, SnoozedUntil: &until}
+	case "resume":
+		if len(fields) > 1 {
+			return pauseSource(fields[1], false)
+		}
+		snooze.Resume()
+		return controlResponse{OK: true}
+	case "pause":
+		if len(fields) < 2 {
+			return controlResponse{Error: "pause needs a source name"}
+		}
+		return pauseSource(fields[1], true)
+	case "status":
+		return controlResponse{OK: true, Status: currentStatus()}
+	default:
+		return controlResponse{Error: fmt.Sprintf("unknown command: %s", fields[0])}
+	}
+}
+
+func pauseSource(name string, pause bool) controlResponse {
+	status := registry.lookup(name)
+	if status == nil {
+		return controlResponse{Error: fmt.Sprintf("unknown source: %s", name)}
+	}
+	if pause {
+		status.pause()
+		log.Info().Msgf("Paused %s", name)
+	} else {
+		status.resume()
+		log.Info().Msgf("Resumed %s", name)
+	}
+	return controlResponse{OK: true}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// How often the dashboard redraws on a terminal
+const dashboardRefresh = time.Second
+
+// ANSI sequences for the dashboard. Every state cell is wrapped in a color
+// of the same length so tabwriter keeps the columns aligned
+const (
+	ansiClear   = "\x1b[H\x1b[2J"
+	ansiReset   = "\x1b[0m"
+	ansiDefault = "\x1b[39m"
+	ansiRed     = "\x1b[31m"
+	ansiGreen   = "\x1b[32m"
+	ansiYellow  = "\x1b[33m"
+	ansiCyan    = "\x1b[36m"
+)
+
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// dashboard renders the registry as a table on stdout: redrawn in place on
+// a terminal, or as plain lines every interval when piped
+type dashboard struct {
+	out      io.Writer
+	terminal bool
+	// samples holds each source's total changes over the last interval, so
+	// the table can show the changes of the current one
+	samples map[string][]changeSample
+}
+
+type changeSample struct {
+	at    time.Time
+	total int
+}
+
+func runDashboard(sources []Source) {
+	d := &dashboard{out: os.Stdout, terminal: isTerminal(os.Stdout), samples: make(map[string][]changeSample)}
+	refresh := dashboardRefresh
+	if !d.terminal {
+		// Plain output once per shortest interval is enough to follow
+		refresh = time.Minute
+		for _, source := range sources {
+			if interval := time.Duration(source.NotificationConfig.NotificationInterval) * time.Second; interval > 0 && interval < refresh {
+				refresh = interval
+			}
+		}
+	}
+
+	d.render(currentStatus())
+	for range time.Tick(refresh) {
+		d.render(currentStatus())
+	}
+}
+
+// intervalChanges returns how many changes the source saw within its last
+// notification interval
+func (d *dashboard) intervalChanges(source MonitorStats, now time.Time) int {
+	window := time.Duration(source.Interval) * time.Second
+	samples := append(d.samples[source.Name], changeSample{at: now, total: source.TotalChanges})
+	for len(samples) > 1 && now.Sub(samples[1].at) >= window {
+		samples = samples[1:]
+	}
+	d.samples[source.Name] = samples
+	return source.TotalChanges - samples[0].total
+}
+
+func (d *dashboard) render(report *statusReport) {
+	now := time.Now()
+	var buf bytes.Buffer
+	if d.terminal {
+		buf.WriteString(ansiClear)
+		fmt.Fprintf(&buf, "MiniMon  %s", now.Format("15:04:05"))
+		if report.Snoozed {
+			fmt.Fprintf(&buf, "  (snoozed until %s)", report.SnoozedUntil.Local().Format("15:04:05"))
+		}
+		buf.WriteString("\n\n")
+	}
+
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	if d.terminal {
+		fmt.Fprintf(w, "NAME\t%s\tCHANGES\tIDLE\tLAST NOTIFIED\n", d.color("STATE", ""))
+	}
+	for _, source := range report.Sources {
+		state := source.State
+		if !source.PausedSince.IsZero() || source.OffSchedule {
+			state = "paused"
+		}
+		lastNotified := "-"
+		if !source.LastNotified.IsZero() {
+			lastNotified = source.LastNotified.Local().Format("15:04:05")
+		}
+		changes := d.intervalChanges(source, now)
+		if d.terminal {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%.1fm\t%s\n", source.Name, d.color(state, state), changes, source.IdleMinutes, lastNotified)
+		} else {
+			fmt.Fprintf(&buf, "%s %s: %s, %d changes, idle %.1fm, last notified %s\n",
+				now.Format("15:04:05"), source.Name, state, changes, source.IdleMinutes, lastNotified)
+		}
+	}
+	w.Flush()
+	d.out.Write(buf.Bytes())
+}
+
+func (d *dashboard) color(text, state string) string {
+	if !d.terminal {
+		return text
+	}
+	color := ansiDefault
+	switch state {
+	case stateActive, stateOK:
+		color = ansiGreen
+	case stateIdle, stateStarting, stateWatching:
+		color = ansiYellow
+	case "paused":
+		color = ansiCyan
+	case stateInvalid, stateAlert:
+		color = ansiRed
+	}
+	return color + text + ansiReset
+}
@@ -0,0 +1,166 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+	"github.com/godbus/dbus/v5/prop"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	dbusName            = "org.minimon.Monitor"
+	dbusPath            = dbus.ObjectPath("/org/minimon/Monitor")
+	dbusInterface       = "org.minimon.Monitor"
+	dbusSourceInterface = "org.minimon.Monitor.Source"
+	// How often the source properties catch up with states that change
+	// between intervals, e.g. a pause
+	dbusRefresh = 5 * time.Second
+)
+
+// dbusService publishes interval results on the session bus: an Interval
+// signal on /org/minimon/Monitor and an object per source under it whose
+// properties follow the source's state
+type dbusService struct {
+	conn    *dbus.Conn
+	mu      sync.Mutex
+	sources map[string]*prop.Properties
+}
+
+// bus is set when monitor_props enables dbus
+var bus *dbusService
+
+func startDBus(sources []Source) (*dbusService, error) {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to the session bus: %v", err)
+	}
+	reply, err := conn.RequestName(dbusName, dbus.NameFlagDoNotQueue)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("cannot own %s: %v", dbusName, err)
+	}
+	if reply != dbus.RequestNameReplyPrimaryOwner {
+		conn.Close()
+		return nil, fmt.Errorf("%s is already owned, is another MiniMon running?", dbusName)
+	}
+
+	s := &dbusService{conn: conn, sources: make(map[string]*prop.Properties)}
+	root := &introspect.Node{
+		Name: string(dbusPath),
+		Interfaces: []introspect.Interface{introspect.IntrospectData, {
+			Name: dbusInterface,
+			Signals: []introspect.Signal{{
+				Name: "Interval",
+				Args: []introspect.Arg{
+					{Name: "source", Type: "s"},
+					{Name: "kind", Type: "s"},
+					{Name: "changes", Type: "i"},
+					{Name: "idle_minutes", Type: "d"},
+				},
+			}},
+		}},
+	}
+	for _, source := range sources {
+		path := dbusSourcePath(source.Name)
+		props, err := prop.Export(conn, path, prop.Map{dbusSourceInterface: {
+			"Name":         {Value: source.Name, Emit: prop.EmitConst},
+			"State":        {Value: stateStarting, Emit: prop.EmitTrue},
+			"Changes":      {Value: int32(0), Emit: prop.EmitTrue},
+			"IdleMinutes":  {Value: 0.0, Emit: prop.EmitTrue},
+			"LastInterval": {Value: "", Emit: prop.EmitTrue},
+		}})
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("cannot export %s: %v", path, err)
+		}
+		node := &introspect.Node{
+			Name: string(path),
+			Interfaces: []introspect.Interface{introspect.IntrospectData, prop.IntrospectData, {
+				Name:       dbusSourceInterface,
+				Properties: props.Introspection(dbusSourceInterface),
+			}},
+		}
+		conn.Export(introspect.NewIntrospectable(node), path, "org.freedesktop.DBus.Introspectable")
+		root.Children = append(root.Children, introspect.Node{Name: strings.TrimPrefix(string(path), string(dbusPath)+"/")})
+		s.sources[source.Name] = props
+	}
+	conn.Export(introspect.NewIntrospectable(root), dbusPath, "org.freedesktop.DBus.Introspectable")
+
+	log.Info().Msgf("Publishing source states on the session bus as %s", dbusName)
+	go s.run()
+	return s, nil
+}
+
+// dbusSourcePath escapes name into an object path element, which may only
+// hold letters, digits and underscores
+func dbusSourcePath(name string) dbus.ObjectPath {
+	var b strings.Builder
+	for _, c := range []byte(name) {
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "_%02x", c)
+		}
+	}
+	return dbusPath + "/" + dbus.ObjectPath(b.String())
+}
+
+func (s *dbusService) run() {
+	for range time.Tick(dbusRefresh) {
+		for _, stats := range registry.snapshot() {
+			s.update(stats.Name, func(props *prop.Properties) {
+				setChanged(props, "State", stats.State)
+				setChanged(props, "IdleMinutes", stats.IdleMinutes)
+			})
+		}
+	}
+}
+
+func (s *dbusService) update(source string, set func(*prop.Properties)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if props := s.sources[source]; props != nil {
+		set(props)
+	}
+}
+
+// setChanged only sets, and so signals, values that differ
+func setChanged(props *prop.Properties, name string, value any) {
+	if props.GetMust(dbusSourceInterface, name) != value {
+		props.SetMust(dbusSourceInterface, name, value)
+	}
+}
+
+// interval emits the Interval signal for a monitor's interval result and
+// updates the source's properties
+func (s *dbusService) interval(record eventRecord) {
+	if record.Session != nil {
+		return
+	}
+	if err := s.conn.Emit(dbusPath, dbusInterface+".Interval", record.Source, record.Kind, int32(record.Events), record.IdleMinutes); err != nil {
+		log.Debug().Msgf("Failed to emit D-Bus signal for %s: %v", record.Source, err)
+	}
+	state := ""
+	if status := registry.lookup(record.Source); status != nil {
+		state = status.snapshot().State
+	}
+	s.update(record.Source, func(props *prop.Properties) {
+		if state != "" {
+			setChanged(props, "State", state)
+		}
+		setChanged(props, "Changes", int32(record.Events))
+		setChanged(props, "IdleMinutes", record.IdleMinutes)
+		setChanged(props, "LastInterval", record.Timestamp.Format(time.RFC3339))
+	})
+}
+
+func (s *dbusService) Close() {
+	s.conn.Close()
+}
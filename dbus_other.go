@@ -0,0 +1,19 @@
+//go:build !linux
+
+package main
+
+import "github.com/rs/zerolog/log"
+
+// dbusService only exists on Linux
+type dbusService struct{}
+
+var bus *dbusService
+
+func startDBus(sources []Source) (*dbusService, error) {
+	log.Warn().Msg("Warning: dbus is only supported on Linux. Skipping D-Bus signals.")
+	return nil, nil
+}
+
+func (*dbusService) interval(record eventRecord) {}
+
+func (*dbusService) Close() {}
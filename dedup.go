@@ -0,0 +1,70 @@
+package main
+
+import (
+	"crypto/sha256"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+var dedupNumbers = regexp.MustCompile(`\d+(\.\d+)?`)
+
+// deduplicator suppresses a message that was already delivered through the
+// same channel within the window, e.g. several near-identical entries or an
+// idle reminder repeating unchanged
+type deduplicator struct {
+	mu            sync.Mutex
+	window        time.Duration
+	ignoreNumbers bool
+	lastDelivered map[[sha256.Size]byte]time.Time
+}
+
+var dedup = &deduplicator{lastDelivered: make(map[[sha256.Size]byte]time.Time)}
+
+func (d *deduplicator) configure(props MonitorProps) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.window = time.Duration(props.DedupWindow) * time.Second
+	d.ignoreNumbers = props.DedupIgnoreNumbers
+}
+
+func (d *deduplicator) key(channel, source, title, message string) [sha256.Size]byte {
+	if d.ignoreNumbers {
+		// Idle minutes grow every interval, so compare the wording only
+		message = dedupNumbers.ReplaceAllString(message, "#")
+	}
+	return sha256.Sum256([]byte(channel + "\x00" + source + "\x00" + title + "\x00" + message))
+}
+
+// duplicate reports whether the message was delivered recently and should
+// be skipped
+func (d *deduplicator) duplicate(channel, source, title, message string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.window <= 0 {
+		return false
+	}
+	last, ok := d.lastDelivered[d.key(channel, source, title, message)]
+	if ok && time.Since(last) < d.window {
+		log.Debug().Msgf("Suppressing duplicate notification on %s: %s", channel, message)
+		return true
+	}
+	return false
+}
+
+func (d *deduplicator) delivered(channel, source, title, message string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.window <= 0 {
+		return
+	}
+	now := time.Now()
+	for key, last := range d.lastDelivered {
+		if now.Sub(last) >= d.window {
+			delete(d.lastDelivered, key)
+		}
+	}
+	d.lastDelivered[d.key(channel, source, title, message)] = now
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os/exec"
+	"strings"
+
+	"github.com/gen2brain/beeep"
+	"github.com/godbus/dbus/v5"
+)
+
+// Values of the freedesktop notification "urgency" hint
+var urgencyHints = map[string]byte{
+	urgencyLow:      0,
+	urgencyNormal:   1,
+	urgencyCritical: 2,
+}
+
+// desktopNotify talks to the notification daemon directly for low and
+// critical messages, since beeep can't pass the urgency hint. Without a
+// session bus it falls back to beeep. beep adds beeep's alert sound
+func desktopNotify(title, message, urgency, icon string, beep bool) error {
+	if urgency == urgencyLow || urgency == urgencyCritical {
+		if conn, err := dbus.SessionBus(); err == nil {
+			hints := map[string]dbus.Variant{"urgency": dbus.MakeVariant(urgencyHints[urgency])}
+			call := conn.Object("org.freedesktop.Notifications", "/org/freedesktop/Notifications").
+				Call("org.freedesktop.Notifications.Notify", 0, "MiniMon", uint32(0), icon, title, message, []string{}, hints, int32(-1))
+			if call.Err == nil {
+				if beep {
+					beeep.Beep(beeep.DefaultFreq, beeep.DefaultDuration)
+				}
+				return nil
+			}
+		}
+	}
+	if beep {
+		return beeep.Alert(title, message, icon)
+	}
+	return beeep.Notify(title, message, icon)
+}
+
+// desktopBlocked reports why a desktop notification shouldn't be shown
+// now: a locked screen or do-not-disturb. Anything that can't be queried
+// counts as available
+func desktopBlocked() string {
+	if session, err := dbus.SessionBus(); err == nil {
+		for _, name := range []string{"org.freedesktop.ScreenSaver", "org.gnome.ScreenSaver"} {
+			path := dbus.ObjectPath("/" + strings.ReplaceAll(name, ".", "/"))
+			var active bool
+			if err := session.Object(name, path).Call(name+".GetActive", 0).Store(&active); err == nil && active {
+				return "screen locked"
+			}
+		}
+		// KDE and others expose do-not-disturb as Inhibited
+		inhibited, err := session.Object("org.freedesktop.Notifications", "/org/freedesktop/Notifications").
+			GetProperty("org.freedesktop.Notifications.Inhibited")
+		if value, ok := inhibited.Value().(bool); err == nil && ok && value {
+			return "do not disturb"
+		}
+	}
+	if system, err := dbus.SystemBus(); err == nil {
+		locked, err := system.Object("org.freedesktop.login1", "/org/freedesktop/login1/session/auto").
+			GetProperty("org.freedesktop.login1.Session.LockedHint")
+		if value, ok := locked.Value().(bool); err == nil && ok && value {
+			return "screen locked"
+		}
+	}
+	// GNOME keeps do-not-disturb in its settings rather than on the bus
+	if _, err := exec.LookPath("gsettings"); err == nil {
+		out, err := exec.Command("gsettings", "get", "org.gnome.desktop.notifications", "show-banners").Output()
+		if err == nil && strings.TrimSpace(string(out)) == "false" {
+			return "do not disturb"
+		}
+	}
+	return ""
+}
@@ -0,0 +1,18 @@
+//go:build !linux
+
+package main
+
+import "github.com/gen2brain/beeep"
+
+// desktopBlocked always allows delivery, lock and do-not-disturb state are
+// only detected on Linux
+func desktopBlocked() string {
+	return ""
+}
+
+func desktopNotify(title, message, urgency, icon string, beep bool) error {
+	if beep {
+		return beeep.Alert(title, message, icon)
+	}
+	return beeep.Notify(title, message, icon)
+}
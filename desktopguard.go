@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Seconds a desktop notification may take before it counts as failed
+const defaultDesktopTimeout = 5
+
+var desktopTimeout = defaultDesktopTimeout * time.Second
+
+// desktopSlot lets one desktop call run at a time. A call that timed out
+// keeps it until it returns, so a hung daemon can't pile up goroutines
+var desktopSlot = make(chan struct{}, 1)
+
+// errDesktopPending is returned when the slot stayed taken for all of
+// desktop_timeout. The call holding it already counts as the failure
+var errDesktopPending = errors.New("an earlier desktop notification is still pending")
+
+// guardDesktop runs a call into the notification library in its own
+// goroutine, so a daemon that doesn't answer holds up the source for at
+// most desktop_timeout and a panic in the library is a failed delivery
+// rather than a crash. A call that comes while another one runs waits up
+// to desktop_timeout for its turn. Failures go on to the fallback and
+// retry logic
+func guardDesktop(call func() error) error {
+	wait := time.NewTimer(desktopTimeout)
+	defer wait.Stop()
+	select {
+	case desktopSlot <- struct{}{}:
+	case <-wait.C:
+		return errDesktopPending
+	}
+	done := make(chan error, 1)
+	go func() {
+		defer func() { <-desktopSlot }()
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("desktop notification panicked: %v", r)
+			}
+		}()
+		done <- call()
+	}()
+
+	timer := time.NewTimer(desktopTimeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		return fmt.Errorf("desktop notification timed out after %s", formatDuration(desktopTimeout))
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConcurrentDesktopNotify(t *testing.T) {
+	savedSend, savedState, savedTimeout := sendDesktop, desktopState, desktopTimeout
+	t.Cleanup(func() { sendDesktop, desktopState, desktopTimeout = savedSend, savedState, savedTimeout })
+	desktopTimeout = 2 * time.Second
+
+	tests := []struct {
+		name  string
+		delay time.Duration
+		want  error
+	}{
+		{"slow daemon", 20 * time.Millisecond, nil},
+		{"stuck daemon", time.Second, errDesktopPending},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			desktopState = &desktopHealth{}
+			if tt.want != nil {
+				desktopTimeout = 50 * time.Millisecond
+			}
+			release := make(chan struct{})
+			sendDesktop = func(title, message, urgency, icon string, beep bool) error {
+				select {
+				case <-time.After(tt.delay):
+				case <-release:
+				}
+				return nil
+			}
+			data := MessageData{Source: "thesis", whenLocked: whenLockedSend}
+
+			// The first call takes the slot, the others come while it runs
+			first := make(chan error, 1)
+			go func() { first <- desktopNotifier{}.Notify("MiniMon", "first", data) }()
+			time.Sleep(10 * time.Millisecond)
+			const calls = 5
+			errs := make(chan error, calls)
+			var wg sync.WaitGroup
+			for range calls {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					errs <- desktopNotifier{}.Notify("MiniMon", "concurrent", data)
+				}()
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				if !errors.Is(err, tt.want) {
+					t.Errorf("concurrent Notify = %v, want %v", err, tt.want)
+				}
+			}
+			close(release)
+			<-first
+			// Let a timed out call hand back the slot
+			desktopSlot <- struct{}{}
+			<-desktopSlot
+
+			if !desktopState.available() {
+				t.Errorf("desktop notifications backed off after concurrent calls")
+			}
+			wantFailures := 0
+			if tt.want != nil {
+				// Only the stuck call itself timed out
+				wantFailures = 1
+			}
+			if desktopState.failures != wantFailures {
+				t.Errorf("failures = %d, want %d", desktopState.failures, wantFailures)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// How many directory entries countEntries reads at a time
+const dirCountBatch = 1000
+
+func validDirCountSource(source Source) error {
+	if source.MaxFiles <= 0 {
+		return fmt.Errorf("dir_count source needs max_files")
+	}
+	if _, err := filepath.Match(source.Pattern, ""); err != nil {
+		return fmt.Errorf("invalid pattern: %s", source.Pattern)
+	}
+	if source.Hysteresis != "" {
+		if _, err := parseByteThreshold(source.Hysteresis); err != nil {
+			return fmt.Errorf("invalid hysteresis: %v", err)
+		}
+	}
+	return nil
+}
+
+// countEntries counts the entries of dir whose name matches pattern, or all
+// of them without one. The directory is read in batches and nothing is
+// stat'ed, so a spool with a million files stays cheap
+func countEntries(dir, pattern string) (int, error) {
+	file, err := os.Open(dir)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	count := 0
+	for {
+		entries, err := file.ReadDir(dirCountBatch)
+		for _, entry := range entries {
+			if pattern == "" {
+				count++
+			} else if ok, _ := filepath.Match(pattern, entry.Name()); ok {
+				count++
+			}
+		}
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return count, err
+		}
+	}
+}
+
+// dirCountMonitor warns when a directory holds more than max_files
+// entries, e.g. a spool whose consumer is stuck
+type dirCountMonitor struct {
+	monitorBase
+}
+
+func newDirCountMonitor(source Source, status *monitorStatus) *dirCountMonitor {
+	return &dirCountMonitor{monitorBase: monitorBase{source: source, status: status}}
+}
+
+func (m *dirCountMonitor) Start(ctx context.Context) error {
+	source, status := m.source, m.status
+	logger := source.logger
+	config := source.NotificationConfig
+	limit := source.MaxFiles
+	// Recovery needs the count to drop a margin below max_files, so a
+	// directory hovering around it doesn't flap
+	margin := limit / 20
+	if source.Hysteresis != "" {
+		hysteresis, _ := parseByteThreshold(source.Hysteresis)
+		margin = int(hysteresis.resolve(int64(limit)))
+	}
+
+	if _, err := countEntries(source.Path, source.Pattern); err != nil {
+		return fmt.Errorf("cannot count entries: %v", err)
+	}
+
+	ticker := time.NewTicker(time.Duration(config.NotificationInterval) * time.Second)
+	defer ticker.Stop()
+
+	over := false
+	check := func() {
+		count, err := countEntries(source.Path, source.Pattern)
+		if err != nil {
+			logger.Error().Err(err).Msgf("Failed to count the entries of %s", source.Path)
+			return
+		}
+		logger.Debug().Msgf("%s holds %d entries (max_files %d)", source.Path, count, limit)
+
+		data := MessageData{
+			Source:    source.Name,
+			Path:      source.Path,
+			Count:     count,
+			Threshold: limit,
+		}
+		switch {
+		case !over && count > limit:
+			over = true
+			status.setState(stateAlert)
+			status.recordChange(1)
+			logger.Warn().Msgf("%s holds more than %d entries", source.Path, limit)
+			data.Kind = kindChange
+			data.Changes = 1
+			data.Detail = fmt.Sprintf("%s holds %d files, more than %d", source.Path, count, limit)
+			notifySource(source, data, true)
+		case over && count <= limit-margin:
+			over = false
+			status.setState(stateOK)
+			logger.Info().Msgf("%s is back to %d entries", source.Path, count)
+			data.Kind = kindRecover
+			data.Detail = fmt.Sprintf("%s is back to %d files", source.Path, count)
+			notifySource(source, data, true)
+		case !over:
+			status.setState(stateOK)
+		}
+	}
+
+	check()
+	status.markReady()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		check()
+	}
+}
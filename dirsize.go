@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const defaultSizeRescanInterval = 1800
+
+// dirSizeTracker keeps a running total of a directory tree's size, adjusted
+// from watcher events and corrected by an occasional full walk
+type dirSizeTracker struct {
+	root     string
+	sizes    map[string]int64
+	total    int64
+	lastScan time.Time
+}
+
+func newDirSizeTracker(root string) (*dirSizeTracker, error) {
+	t := &dirSizeTracker{root: root}
+	if err := t.rescan(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// newDirSizeTrackerFromSnapshot reuses the startup scan instead of walking
+// the tree a second time
+func newDirSizeTrackerFromSnapshot(root string, snapshot dirSnapshot) *dirSizeTracker {
+	return &dirSizeTracker{root: root, sizes: snapshot.sizes, total: snapshot.Size, lastScan: snapshot.Taken}
+}
+
+func (t *dirSizeTracker) rescan() error {
+	sizes, total, err := scanSizes(t.root)
+	if err != nil {
+		return err
+	}
+	t.replace(sizes, total)
+	return nil
+}
+
+// scanSizes walks root for the size of every file. It doesn't touch a
+// tracker, so the walk can run while the tracker is kept up to date
+func scanSizes(root string) (map[string]int64, int64, error) {
+	sizes := make(map[string]int64)
+	var total int64
+	err := walkFiles(root, func(path string, info fs.FileInfo) {
+		sizes[path] = info.Size()
+		total += info.Size()
+	})
+	return sizes, total, err
+}
+
+// replace takes the result of a full walk
+func (t *dirSizeTracker) replace(sizes map[string]int64, total int64) {
+	t.sizes = sizes
+	t.total = total
+	t.lastScan = time.Now()
+}
+
+// walkFiles calls visit for every regular file under root
+func walkFiles(root string, visit func(path string, info fs.FileInfo)) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Files vanishing mid-walk are expected in busy directories
+			if os.IsNotExist(err) || os.IsPermission(err) {
+				return nil
+			}
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		visit(path, info)
+		return nil
+	})
+}
+
+// dirSnapshot summarizes a directory tree when its monitor starts
+type dirSnapshot struct {
+	Taken  time.Time
+	Files  int
+	Size   int64
+	Newest time.Time
+	sizes  map[string]int64
+}
+
+func takeDirSnapshot(root string) (dirSnapshot, error) {
+	snapshot := dirSnapshot{Taken: time.Now(), sizes: make(map[string]int64)}
+	err := walkFiles(root, func(path string, info fs.FileInfo) {
+		snapshot.Files++
+		snapshot.Size += info.Size()
+		snapshot.sizes[path] = info.Size()
+		if info.ModTime().After(snapshot.Newest) {
+			snapshot.Newest = info.ModTime()
+		}
+	})
+	return snapshot, err
+}
+
+// modifiedSince lists files under root written after t
+func modifiedSince(root string, t time.Time) ([]string, error) {
+	var paths []string
+	err := walkFiles(root, func(path string, info fs.FileInfo) {
+		if info.ModTime().After(t) {
+			paths = append(paths, path)
+		}
+	})
+	return paths, err
+}
+
+// update adjusts the total for a single path reported by the watcher
+func (t *dirSizeTracker) update(path string) {
+	var size int64
+	info, err := os.Lstat(path)
+	if err == nil && !info.Mode().IsRegular() {
+		return
+	}
+	if err == nil {
+		size = info.Size()
+	}
+
+	previous, known := t.sizes[path]
+	t.total += size - previous
+	if err != nil {
+		if known {
+			delete(t.sizes, path)
+		}
+		return
+	}
+	t.sizes[path] = size
+}
+
+func (t *dirSizeTracker) rescanDue(interval time.Duration) bool {
+	return time.Since(t.lastScan) >= interval
+}
+
+func formatBytes(n int64) string {
+	const unit = 1000
+	if n < unit && n > -unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	value := float64(n)
+	exp := 0
+	for value >= unit*unit || value <= -unit*unit {
+		value /= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", value/unit, "kMGTPE"[exp])
+}
+
+func formatBytesDelta(n int64) string {
+	if n >= 0 {
+		return "+" + formatBytes(n)
+	}
+	return formatBytes(n)
+}
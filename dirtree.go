@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog"
+)
+
+func validDirTree(source Source) error {
+	if source.MaxDepth < 0 || source.MaxWatchedDirs < 0 {
+		return fmt.Errorf("max_depth and max_watched_dirs must not be negative")
+	}
+	if !source.Recursive && (source.MaxDepth > 0 || source.MaxWatchedDirs > 0) {
+		return fmt.Errorf("max_depth and max_watched_dirs need recursive")
+	}
+	return nil
+}
+
+// dirTree watches the subdirectories of a recursive dir source, breadth
+// first so the limits cut off the deepest subtrees, and follows
+// directories as they are created and removed
+type dirTree struct {
+	mu       sync.Mutex
+	root     string
+	maxDepth int
+	maxDirs  int
+	watches  *watchSet
+	status   *monitorStatus
+	logger   zerolog.Logger
+	watched  map[string]bool
+	excluded map[string]bool
+}
+
+func newDirTree(source Source, watches *watchSet, status *monitorStatus) *dirTree {
+	return &dirTree{
+		root:     source.Path,
+		maxDepth: source.MaxDepth,
+		maxDirs:  source.MaxWatchedDirs,
+		watches:  watches,
+		status:   status,
+		logger:   source.logger,
+		watched:  make(map[string]bool),
+		excluded: make(map[string]bool),
+	}
+}
+
+// depth is 0 for the root, 1 for its subdirectories and so on
+func (t *dirTree) depth(dir string) int {
+	rel, err := filepath.Rel(t.root, dir)
+	if err != nil || rel == "." {
+		return 0
+	}
+	return strings.Count(filepath.ToSlash(rel), "/") + 1
+}
+
+// add watches dir and the directories below it within the limits. Only a
+// failure to watch the root itself is an error
+func (t *dirTree) add(dir string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var excluded []string
+	queue := []string{dir}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		if t.watched[current] {
+			continue
+		}
+		limit := ""
+		if t.maxDepth > 0 && t.depth(current) > t.maxDepth {
+			limit = fmt.Sprintf("max_depth %d", t.maxDepth)
+		} else if t.maxDirs > 0 && len(t.watched) >= t.maxDirs {
+			limit = fmt.Sprintf("max_watched_dirs %d", t.maxDirs)
+		}
+		if limit != "" {
+			if !t.excluded[current] {
+				t.excluded[current] = true
+				excluded = append(excluded, current)
+				t.logger.Info().Msgf("Not watching %s and below (%s)", current, limit)
+			}
+			continue
+		}
+		if err := t.watches.add(current); err != nil {
+			if current == t.root {
+				return err
+			}
+			t.logger.Warn().Err(err).Msgf("Cannot watch %s", current)
+			continue
+		}
+		t.watched[current] = true
+		delete(t.excluded, current)
+
+		entries, err := os.ReadDir(current)
+		if err != nil {
+			t.logger.Warn().Err(err).Msgf("Cannot list %s, its subdirectories are not watched", current)
+			continue
+		}
+		for _, entry := range entries {
+			// Symlinked directories are not followed
+			if entry.IsDir() {
+				queue = append(queue, filepath.Join(current, entry.Name()))
+			}
+		}
+	}
+	if len(excluded) > 0 {
+		t.logger.Warn().Msgf("Watching %d directories of %s, %d subtrees left out by the limits", len(t.watched), t.root, len(excluded))
+	}
+	t.status.setTruncated(t.excludedPaths())
+	return nil
+}
+
+// rewatch starts over from the root, e.g. after its filesystem was
+// unmounted and mounted again
+func (t *dirTree) rewatch() error {
+	t.mu.Lock()
+	clear(t.watched)
+	clear(t.excluded)
+	t.mu.Unlock()
+	return t.add(t.root)
+}
+
+// created watches a new directory, along with anything already below it
+func (t *dirTree) created(path string) {
+	info, err := os.Lstat(path)
+	if err != nil || !info.IsDir() {
+		return
+	}
+	if err := t.add(path); err != nil {
+		t.logger.Warn().Err(err).Msgf("Cannot watch %s", path)
+	}
+}
+
+// removed forgets a directory that was deleted or moved away, and
+// everything below it. The watcher drops their watches by itself
+func (t *dirTree) removed(path string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	prefix := path + string(filepath.Separator)
+	changed := false
+	for dir := range t.watched {
+		if dir == path || strings.HasPrefix(dir, prefix) {
+			delete(t.watched, dir)
+		}
+	}
+	for dir := range t.excluded {
+		if dir == path || strings.HasPrefix(dir, prefix) {
+			delete(t.excluded, dir)
+			changed = true
+		}
+	}
+	if changed {
+		t.status.setTruncated(t.excludedPaths())
+	}
+}
+
+func (t *dirTree) excludedPaths() []string {
+	paths := make([]string, 0, len(t.excluded))
+	for path := range t.excluded {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
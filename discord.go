@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	defaultDiscordTimeout = 10
+	// How often a rate-limited message is retried before giving up
+	discordRetries = 3
+)
+
+// Embed limits from the Discord API documentation
+const (
+	discordTitleLimit       = 256
+	discordDescriptionLimit = 4096
+	discordFieldValueLimit  = 1024
+	discordEmbedLimit       = 6000
+)
+
+// Embed colors by notification kind
+var discordColors = map[string]int{
+	kindChange:   0x2ecc71,
+	kindResume:   0x2ecc71,
+	kindRecover:  0x2ecc71,
+	kindIdle:     0xe67e22,
+	kindMissing:  0xe74c3c,
+	kindConflict: 0xe74c3c,
+	kindUpstream: 0xf1c40f,
+	kindSummary:  0x3498db,
+	kindSession:  0x3498db,
+}
+
+const (
+	discordDefaultColor  = 0x95a5a6
+	discordCriticalColor = 0xe74c3c
+)
+
+type DiscordConfig struct {
+	URL      string `json:"url"`
+	Username string `json:"username"`
+	Timeout  int    `json:"timeout"`
+}
+
+type discordNotifier struct {
+	config DiscordConfig
+	client *http.Client
+}
+
+type discordField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+type discordEmbed struct {
+	Title       string         `json:"title"`
+	Description string         `json:"description"`
+	Color       int            `json:"color"`
+	Fields      []discordField `json:"fields,omitempty"`
+	Timestamp   time.Time      `json:"timestamp"`
+}
+
+func newDiscordNotifier(config DiscordConfig) (*discordNotifier, error) {
+	if config.URL == "" {
+		return nil, fmt.Errorf("discord requires a webhook url")
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaultDiscordTimeout
+	}
+	return &discordNotifier{
+		config: config,
+		client: &http.Client{Timeout: time.Duration(config.Timeout) * time.Second},
+	}, nil
+}
+
+func (d *discordNotifier) Name() string {
+	return "discord"
+}
+
+// truncateRunes shortens text to at most limit characters, marking the cut
+func truncateRunes(text string, limit int) string {
+	if utf8.RuneCountInString(text) <= limit {
+		return text
+	}
+	runes := []rune(text)
+	return string(runes[:limit-1]) + "…"
+}
+
+// discordEmbedFor puts the source in the title and the figures of data in
+// fields, within Discord's embed limits
+func discordEmbedFor(message string, data MessageData) discordEmbed {
+	color, ok := discordColors[data.Kind]
+	if !ok {
+		color = discordDefaultColor
+	}
+	if data.Urgency == urgencyCritical {
+		color = discordCriticalColor
+	}
+
+	var fields []discordField
+	add := func(name, value string) {
+		if value != "" {
+			fields = append(fields, discordField{Name: name, Value: truncateRunes(value, discordFieldValueLimit), Inline: true})
+		}
+	}
+	if data.Changes > 0 {
+		add("Changes", strconv.Itoa(data.Changes))
+	}
+	if data.Files > 0 {
+		add("Files", strconv.Itoa(data.Files))
+	}
+	if data.Added > 0 || data.Removed > 0 {
+		add("Lines", fmt.Sprintf("+%d -%d", data.Added, data.Removed))
+	}
+	if data.Minutes > 0 {
+		add("Idle", formatMinutes(data.Minutes))
+	}
+	add("Velocity", data.Velocity)
+	add("Top files", data.TopFiles)
+
+	embed := discordEmbed{
+		Title:       truncateRunes(data.Source, discordTitleLimit),
+		Description: truncateRunes(strings.TrimSpace(message), discordDescriptionLimit),
+		Color:       color,
+		Fields:      fields,
+		Timestamp:   time.Now(),
+	}
+	// The fields are short, so the description gives way if the total
+	// is over
+	used := utf8.RuneCountInString(embed.Title)
+	for _, field := range fields {
+		used += utf8.RuneCountInString(field.Name) + utf8.RuneCountInString(field.Value)
+	}
+	if room := discordEmbedLimit - used; utf8.RuneCountInString(embed.Description) > room {
+		embed.Description = truncateRunes(embed.Description, max(room, 1))
+	}
+	return embed
+}
+
+func (d *discordNotifier) Notify(title, message string, data MessageData) error {
+	payload, err := json.Marshal(map[string]any{
+		"username": d.config.Username,
+		"embeds":   []discordEmbed{discordEmbedFor(message, data)},
+	})
+	if err != nil {
+		return err
+	}
+
+	for attempt := 1; ; attempt++ {
+		wait, err := d.post(payload)
+		if err == nil {
+			return nil
+		}
+		if wait == 0 || attempt == discordRetries {
+			return err
+		}
+		time.Sleep(wait)
+	}
+}
+
+// post sends one webhook request. When Discord rate limits it, the error
+// comes with how long to wait before retrying
+func (d *discordNotifier) post(payload []byte) (time.Duration, error) {
+	req, err := http.NewRequest(http.MethodPost, d.config.URL, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode == http.StatusTooManyRequests {
+		var limit struct {
+			RetryAfter float64 `json:"retry_after"`
+		}
+		if json.Unmarshal(body, &limit) != nil || limit.RetryAfter <= 0 {
+			limit.RetryAfter, _ = strconv.ParseFloat(resp.Header.Get("Retry-After"), 64)
+		}
+		wait := time.Duration(limit.RetryAfter * float64(time.Second))
+		err := fmt.Errorf("discord rate limited for %s", wait.Round(time.Millisecond))
+		// Waiting longer than a request may take would hold up the
+		// other channels
+		if wait <= 0 || wait > d.client.Timeout {
+			return 0, err
+		}
+		return wait, err
+	}
+	if resp.StatusCode >= 300 {
+		return 0, fmt.Errorf("discord returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return 0, nil
+}
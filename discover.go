@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// How many subdirectories a discover source starts at most by default
+const defaultMaxSources = 50
+
+func validDiscoverSource(source Source) error {
+	if _, err := filepath.Match(source.Pattern, ""); err != nil {
+		return fmt.Errorf("invalid pattern: %s", source.Pattern)
+	}
+	for _, exclude := range source.Exclude {
+		if _, err := filepath.Match(exclude, ""); err != nil {
+			return fmt.Errorf("invalid exclude: %s", exclude)
+		}
+	}
+	if source.MaxSources < 0 {
+		return fmt.Errorf("max_sources must not be negative")
+	}
+	// Children come and go, so none of them could be waited for
+	if source.ExitOnMaxIdle {
+		return fmt.Errorf("exit_on_max_idle is not supported for discover sources")
+	}
+	return nil
+}
+
+// discovers reports whether name is a subdirectory the source should
+// monitor. Hidden directories never are
+func (s Source) discovers(name string) bool {
+	if strings.HasPrefix(name, ".") {
+		return false
+	}
+	if s.Pattern != "" {
+		if ok, _ := filepath.Match(s.Pattern, name); !ok {
+			return false
+		}
+	}
+	for _, exclude := range s.Exclude {
+		if ok, _ := filepath.Match(exclude, name); ok {
+			return false
+		}
+	}
+	return true
+}
+
+// discoveredSource is a running child of a discover source
+type discoveredSource struct {
+	name string
+	stop context.CancelFunc
+}
+
+// discoverMonitor runs a dir source for every immediate subdirectory of
+// its path, e.g. each project under ~/projects, with the discover source's
+// settings. Subdirectories created later are picked up, removed ones
+// stopped
+type discoverMonitor struct {
+	monitorBase
+	children map[string]*discoveredSource
+	// skipped are the subdirectories left out by max_sources, warned
+	// about once
+	skipped map[string]bool
+}
+
+func newDiscoverMonitor(source Source, status *monitorStatus) *discoverMonitor {
+	return &discoverMonitor{
+		monitorBase: monitorBase{source: source, status: status},
+		children:    make(map[string]*discoveredSource),
+		skipped:     make(map[string]bool),
+	}
+}
+
+func (m *discoverMonitor) Start(ctx context.Context) error {
+	parent := m.source.Path
+	logger := m.source.logger
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create watcher: %v", err)
+	}
+	defer watcher.Close()
+	if err := watcher.Add(parent); err != nil {
+		return fmt.Errorf("failed to watch %s: %v", parent, err)
+	}
+
+	entries, err := os.ReadDir(parent)
+	if err != nil {
+		return err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	for _, entry := range entries {
+		m.start(ctx, filepath.Join(parent, entry.Name()))
+	}
+	logger.Info().Msgf("Discovered %d sources in %s", len(m.children), parent)
+	m.status.setState(stateWatching)
+	m.status.markReady()
+
+	defer func() {
+		for path := range m.children {
+			m.stop(path)
+		}
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if filepath.Dir(event.Name) != parent {
+				continue
+			}
+			switch {
+			case event.Has(fsnotify.Create):
+				m.start(ctx, event.Name)
+			case event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename):
+				m.stop(event.Name)
+				m.startSkipped(ctx)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			logger.Error().Err(err).Msgf("Watcher error on %s", parent)
+		}
+	}
+}
+
+// start begins monitoring path if it is a subdirectory to discover
+func (m *discoverMonitor) start(ctx context.Context, path string) {
+	logger := m.source.logger
+	name := filepath.Base(path)
+	if _, running := m.children[path]; running || !m.source.discovers(name) {
+		return
+	}
+	if info, err := os.Stat(path); err != nil || !info.IsDir() {
+		delete(m.skipped, path)
+		return
+	}
+	if len(m.children) >= m.source.MaxSources {
+		if !m.skipped[path] {
+			logger.Warn().Msgf("Warning: max_sources (%d) reached. Skipping %s.", m.source.MaxSources, path)
+			m.skipped[path] = true
+		}
+		return
+	}
+	delete(m.skipped, path)
+
+	child := m.source
+	child.SourceType = "dir"
+	child.Path = path
+	child.configuredPath = path
+	child.Name = name
+	for n := 2; registry.lookup(child.Name) != nil; n++ {
+		child.Name = fmt.Sprintf("%s-%d", name, n)
+	}
+	child.logger = logs.forSource(child)
+	status := registry.register(child)
+	if child.schedule != nil {
+		startSchedule(child, status)
+	}
+
+	childCtx, stop := context.WithCancel(ctx)
+	m.children[path] = &discoveredSource{name: child.Name, stop: stop}
+	logger.Info().Msgf("Monitoring %s as %s", path, child.Name)
+	startMonitor(childCtx, dirSourceMonitor(child, status), status)
+}
+
+// startSkipped fills the room a stopped source left with the
+// subdirectories max_sources skipped
+func (m *discoverMonitor) startSkipped(ctx context.Context) {
+	paths := slices.Sorted(maps.Keys(m.skipped))
+	for _, path := range paths {
+		m.start(ctx, path)
+	}
+}
+
+// stop ends the monitor of a subdirectory that was removed or renamed
+func (m *discoverMonitor) stop(path string) {
+	child, ok := m.children[path]
+	delete(m.skipped, path)
+	if !ok {
+		return
+	}
+	child.stop()
+	delete(m.children, path)
+	registry.unregister(child.name)
+	m.source.logger.Info().Msgf("Stopped monitoring %s (%s)", child.name, path)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// byteThreshold is either an absolute byte count or a percentage of the
+// filesystem size, as written in min_free ("5G", "500M", "10%")
+type byteThreshold struct {
+	bytes   int64
+	percent float64
+}
+
+func parseByteThreshold(value string) (byteThreshold, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return byteThreshold{}, fmt.Errorf("empty size")
+	}
+
+	if number, ok := strings.CutSuffix(value, "%"); ok {
+		percent, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+		if err != nil || percent < 0 || percent > 100 {
+			return byteThreshold{}, fmt.Errorf("invalid percentage: %s", value)
+		}
+		return byteThreshold{percent: percent}, nil
+	}
+
+	bytes, err := parseByteSize(value)
+	if err != nil {
+		return byteThreshold{}, err
+	}
+	return byteThreshold{bytes: bytes}, nil
+}
+
+// parseByteSize accepts plain byte counts and k/M/G/T suffixes (optionally
+// followed by B), using the same decimal units formatBytes prints
+func parseByteSize(value string) (int64, error) {
+	upper := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(value)), "B")
+	multiplier := int64(1)
+	for i, suffix := range []string{"K", "M", "G", "T"} {
+		if number, ok := strings.CutSuffix(upper, suffix); ok {
+			upper = number
+			multiplier = 1
+			for range i + 1 {
+				multiplier *= 1000
+			}
+			break
+		}
+	}
+
+	number, err := strconv.ParseFloat(strings.TrimSpace(upper), 64)
+	if err != nil || number < 0 {
+		return 0, fmt.Errorf("invalid size: %s", value)
+	}
+	return int64(number * float64(multiplier)), nil
+}
+
+func (t byteThreshold) resolve(total int64) int64 {
+	if t.percent > 0 {
+		return int64(float64(total) * t.percent / 100)
+	}
+	return t.bytes
+}
+
+func (t byteThreshold) String() string {
+	if t.percent > 0 {
+		return fmt.Sprintf("%g%%", t.percent)
+	}
+	return formatBytes(t.bytes)
+}
+
+// diskSpaceMonitor warns when the free space of the filesystem holding
+// path drops below min_free
+type diskSpaceMonitor struct {
+	monitorBase
+}
+
+func newDiskSpaceMonitor(source Source, status *monitorStatus) *diskSpaceMonitor {
+	return &diskSpaceMonitor{monitorBase: monitorBase{source: source, status: status}}
+}
+
+func (m *diskSpaceMonitor) Start(ctx context.Context) error {
+	source, status := m.source, m.status
+	logger := source.logger
+	config := source.NotificationConfig
+	threshold, _ := parseByteThreshold(source.MinFree)
+	var hysteresis byteThreshold
+	if source.Hysteresis != "" {
+		hysteresis, _ = parseByteThreshold(source.Hysteresis)
+	}
+
+	if _, _, err := diskUsage(source.Path); err != nil {
+		return fmt.Errorf("cannot read disk usage of %s: %v", source.Path, err)
+	}
+
+	ticker := time.NewTicker(time.Duration(config.NotificationInterval) * time.Second)
+	defer ticker.Stop()
+
+	low := false
+	check := func() {
+		free, total, err := diskUsage(source.Path)
+		if err != nil {
+			logger.Error().Err(err).Msgf("Failed to read disk usage for %s", source.Path)
+			return
+		}
+
+		limit := threshold.resolve(total)
+		// Recovery needs free space to clear the threshold by a margin, so a
+		// filesystem hovering around it doesn't flap
+		margin := limit / 20
+		if source.Hysteresis != "" {
+			margin = hysteresis.resolve(total)
+		}
+		logger.Debug().Msgf("Free space on %s: %s of %s (threshold %s)", source.Path, formatBytes(free), formatBytes(total), formatBytes(limit))
+
+		data := MessageData{
+			Source: source.Name,
+			Path:   source.Path,
+			Free:   formatBytes(free),
+			Limit:  formatBytes(limit),
+		}
+		switch {
+		case !low && free < limit:
+			low = true
+			status.setState(stateAlert)
+			status.recordChange(1)
+			logger.Warn().Msgf("Free space on %s dropped below %s", source.Path, threshold)
+			data.Kind = kindChange
+			data.Changes = 1
+			data.Detail = fmt.Sprintf("free space on %s is %s, below %s", source.Path, data.Free, data.Limit)
+			notifySource(source, data, true)
+		case low && free >= limit+margin:
+			low = false
+			status.setState(stateOK)
+			logger.Info().Msgf("Free space on %s recovered above %s", source.Path, threshold)
+			data.Kind = kindRecover
+			data.Detail = fmt.Sprintf("free space on %s recovered to %s", source.Path, data.Free)
+			notifySource(source, data, true)
+		case !low:
+			status.setState(stateOK)
+		}
+	}
+
+	check()
+	status.markReady()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		check()
+	}
+}
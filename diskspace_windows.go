@@ -0,0 +1,17 @@
+//go:build windows
+
+package main
+
+import "golang.org/x/sys/windows"
+
+func diskUsage(path string) (free, total int64, err error) {
+	pathPtr, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	var freeToCaller, totalBytes, totalFree uint64
+	if err := windows.GetDiskFreeSpaceEx(pathPtr, &freeToCaller, &totalBytes, &totalFree); err != nil {
+		return 0, 0, err
+	}
+	return int64(freeToCaller), int64(totalBytes), nil
+}
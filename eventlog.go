@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const eventLogSyncInterval = 10 * time.Second
+
+// eventRecord is one line of the JSONL event history
+type eventRecord struct {
+	Timestamp   time.Time `json:"ts"`
+	Source      string    `json:"source"`
+	Kind        string    `json:"kind"`
+	Events      int       `json:"events"`
+	Files       int       `json:"files"`
+	IdleMinutes float64   `json:"idle_minutes"`
+	Notified    bool      `json:"notified"`
+	// Session is only set on the record written at shutdown
+	Session *SessionReport `json:"session,omitempty"`
+	// since is when the interval started; notifications delivered after it
+	// fill in Notified, channels and message
+	since    time.Time
+	channels []string
+	message  string
+}
+
+// eventLog serializes records from every monitor through one goroutine so
+// lines never interleave, and starts a new file each local day
+type eventLog struct {
+	path    string
+	records chan eventRecord
+	flush   chan chan struct{}
+	day     string
+	file    *os.File
+	writer  *bufio.Writer
+}
+
+var events *eventLog
+
+func startEventLog(path string) (*eventLog, error) {
+	if _, err := os.Stat(filepath.Dir(path)); err != nil {
+		return nil, fmt.Errorf("event log directory does not exist: %s", filepath.Dir(path))
+	}
+	l := &eventLog{
+		path:    path,
+		records: make(chan eventRecord, 256),
+		flush:   make(chan chan struct{}),
+	}
+	go l.run()
+	log.Info().Msgf("Recording events to %s", l.fileFor(time.Now()))
+	return l, nil
+}
+
+// recordEvent is a no-op unless event_log, history_store, the output
+// stream, D-Bus or StatsD is configured
+func recordEvent(record eventRecord) {
+	if events == nil && history == nil && stream == nil && bus == nil && statsd == nil {
+		return
+	}
+	if record.Timestamp.IsZero() {
+		record.Timestamp = time.Now()
+	}
+	if status := registry.lookup(record.Source); status != nil && !record.since.IsZero() {
+		record.channels, record.message = status.notificationsSince(record.since)
+		record.Notified = len(record.channels) > 0
+	}
+	// The session summary is not an interval result
+	if stream != nil && record.Session == nil {
+		stream.write(record)
+	}
+	if bus != nil {
+		bus.interval(record)
+	}
+	if statsd != nil {
+		statsd.interval(record)
+	}
+	if events != nil {
+		events.records <- record
+	}
+	if history != nil && record.Session == nil {
+		history.add(record)
+	}
+}
+
+// fileFor inserts the date before the extension: events.jsonl becomes
+// events-2024-05-01.jsonl
+func (l *eventLog) fileFor(t time.Time) string {
+	ext := filepath.Ext(l.path)
+	return fmt.Sprintf("%s-%s%s", strings.TrimSuffix(l.path, ext), t.Format("2006-01-02"), ext)
+}
+
+func (l *eventLog) run() {
+	ticker := time.NewTicker(eventLogSyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case record := <-l.records:
+			if err := l.write(record); err != nil {
+				log.Error().Err(err).Msg("Failed to write event log")
+			}
+		case <-ticker.C:
+			l.sync()
+		case done := <-l.flush:
+			for len(l.records) > 0 {
+				if err := l.write(<-l.records); err != nil {
+					log.Error().Err(err).Msg("Failed to write event log")
+				}
+			}
+			l.closeFile()
+			close(done)
+		}
+	}
+}
+
+func (l *eventLog) write(record eventRecord) error {
+	day := record.Timestamp.Local().Format("2006-01-02")
+	if day != l.day || l.file == nil {
+		l.closeFile()
+		file, err := os.OpenFile(l.fileFor(record.Timestamp.Local()), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		l.day = day
+		l.file = file
+		l.writer = bufio.NewWriter(file)
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	_, err = l.writer.Write(append(line, '\n'))
+	return err
+}
+
+func (l *eventLog) sync() {
+	if l.file == nil {
+		return
+	}
+	if err := l.writer.Flush(); err != nil {
+		log.Error().Err(err).Msg("Failed to flush event log")
+		return
+	}
+	l.file.Sync()
+}
+
+func (l *eventLog) closeFile() {
+	if l.file == nil {
+		return
+	}
+	l.sync()
+	l.file.Close()
+	l.file = nil
+}
+
+// Close writes out buffered records and closes the current file. Monitors
+// may still be running, so a later record just reopens it
+func (l *eventLog) Close() {
+	done := make(chan struct{})
+	l.flush <- done
+	<-done
+}
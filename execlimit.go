@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// How many git and other commands the monitors run at once by default
+const defaultMaxConcurrentExecs = 4
+
+// execSlots bounds the commands the monitors run at once, so many sources
+// on short intervals don't fork a burst of processes on every tick. Sized
+// from max_concurrent_execs in main
+var execSlots = make(chan struct{}, defaultMaxConcurrentExecs)
+
+// execWaiting is how many monitors are waiting for a slot
+var execWaiting atomic.Int64
+
+// acquireExec takes a slot, waiting at most wait for one, or until ctx is
+// done with a wait of 0. A monitor that gets none skips its check rather
+// than queueing up behind the others
+func acquireExec(ctx context.Context, wait time.Duration) bool {
+	select {
+	case execSlots <- struct{}{}:
+		return true
+	default:
+	}
+	execWaiting.Add(1)
+	defer execWaiting.Add(-1)
+	var deadline <-chan time.Time
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+	select {
+	case execSlots <- struct{}{}:
+		return true
+	case <-deadline:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func releaseExec() {
+	<-execSlots
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// After this many desktop failures in a row the desktop channel is skipped
+// for desktopBackoffTime, and entries go straight to their fallback
+const (
+	desktopFailureLimit = 3
+	desktopBackoffTime  = 5 * time.Minute
+)
+
+var errDesktopBackoff = errors.New("desktop notifications are backed off after repeated failures")
+
+// desktopHealth tracks consecutive desktop failures, e.g. while no
+// notification daemon is running yet after login
+type desktopHealth struct {
+	mu       sync.Mutex
+	failures int
+	until    time.Time
+}
+
+var desktopState = &desktopHealth{}
+
+func (h *desktopHealth) available() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return time.Now().After(h.until)
+}
+
+// record counts a delivery result. Only the start of a back-off and the
+// recovery are logged, not every failed attempt
+func (h *desktopHealth) record(err error) {
+	if errors.Is(err, errDesktopPending) {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err == nil {
+		if h.failures >= desktopFailureLimit {
+			log.Info().Msg("Desktop notifications working again")
+		}
+		h.failures = 0
+		return
+	}
+	h.failures++
+	if h.failures%desktopFailureLimit == 0 {
+		h.until = time.Now().Add(desktopBackoffTime)
+		log.Warn().Msgf("Warning: desktop notifications failed %d times in a row (%v). Skipping them for %s.", h.failures, err, formatDuration(desktopBackoffTime))
+	}
+}
+
+// consoleNotifier rings the terminal bell and prints the message on stdout.
+// It is always available as the "console" channel, mainly as a fallback
+type consoleNotifier struct{}
+
+func (consoleNotifier) Name() string {
+	return "console"
+}
+
+func (consoleNotifier) Notify(title, message string, data MessageData) error {
+	_, err := fmt.Fprintf(os.Stdout, "\a%s %s: %s\n", time.Now().Format("15:04:05"), data.Source, message)
+	return err
+}
+
+// deliverFallback tries the entry's fallback channels in order after the
+// failed channel could not deliver and returns the one that did, or "" if
+// none did
+func deliverFallback(notification Notification, failed string, data MessageData, message string) string {
+	for _, name := range notification.Fallback {
+		notifier, ok := channels[name]
+		if !ok || name == failed {
+			continue
+		}
+		if _, ok := notifier.(desktopNotifier); ok {
+			continue
+		}
+		err := notifier.Notify(notificationTitle, fitMessage(name, notification, data, message), data)
+		auditDelivery(name, data, message, err)
+		if err == nil {
+			return name
+		}
+		log.Debug().Msgf("Fallback channel %s failed: %v", name, err)
+	}
+	return ""
+}
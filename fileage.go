@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+func validFileAgeSource(source Source) error {
+	if source.MaxAge == "" {
+		return fmt.Errorf("file_age source needs max_age")
+	}
+	maxAge, err := time.ParseDuration(source.MaxAge)
+	if err != nil || maxAge <= 0 {
+		return fmt.Errorf("invalid max_age: %s", source.MaxAge)
+	}
+	return nil
+}
+
+// fileAgeMonitor warns when the file at path hasn't been modified for
+// max_age, e.g. a heartbeat another process should touch regularly. A
+// missing file counts as stale
+type fileAgeMonitor struct {
+	monitorBase
+}
+
+func newFileAgeMonitor(source Source, status *monitorStatus) *fileAgeMonitor {
+	return &fileAgeMonitor{monitorBase: monitorBase{source: source, status: status}}
+}
+
+func (m *fileAgeMonitor) Start(ctx context.Context) error {
+	source, status := m.source, m.status
+	logger := source.logger
+	config := source.NotificationConfig
+	maxAge, _ := time.ParseDuration(source.MaxAge)
+
+	ticker := time.NewTicker(time.Duration(config.NotificationInterval) * time.Second)
+	defer ticker.Stop()
+
+	stale := false
+	check := func() {
+		data := MessageData{Source: source.Name, Path: source.Path}
+		info, err := os.Stat(source.Path)
+		switch {
+		case os.IsNotExist(err):
+			data.Detail = fmt.Sprintf("%s is missing", source.Path)
+		case err != nil:
+			logger.Error().Err(err).Msgf("Failed to stat %s", source.Path)
+			return
+		default:
+			age := max(time.Since(info.ModTime()), 0)
+			data.Age = formatDuration(age)
+			logger.Debug().Msgf("%s was modified %s ago (max_age %s)", source.Path, data.Age, maxAge)
+			if age <= maxAge {
+				if stale {
+					stale = false
+					status.setState(stateOK)
+					logger.Info().Msgf("%s is fresh again", source.Path)
+					data.Kind = kindRecover
+					data.Detail = fmt.Sprintf("%s was updated %s ago", source.Path, data.Age)
+					notifySource(source, data, true)
+				} else {
+					status.setState(stateOK)
+				}
+				return
+			}
+			data.Detail = fmt.Sprintf("%s has not been updated for %s", source.Path, data.Age)
+		}
+
+		if stale && !source.Repeat {
+			return
+		}
+		if !stale {
+			logger.Warn().Msgf("%s is stale: %s", source.Path, data.Detail)
+		}
+		stale = true
+		status.setState(stateAlert)
+		status.recordChange(1)
+		data.Kind = kindChange
+		data.Changes = 1
+		notifySource(source, data, true)
+	}
+
+	check()
+	status.markReady()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		check()
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// What a file_appear monitor does after the file shows up
+const (
+	afterHitContinue = "continue"
+	afterHitStop     = "stop"
+	afterHitExit     = "exit"
+)
+
+const fileAppearPollInterval = 2 * time.Second
+
+func validAfterHit(afterHit string) error {
+	switch afterHit {
+	case "", afterHitContinue, afterHitStop, afterHitExit:
+		return nil
+	}
+	return fmt.Errorf("unknown after_hit: %s", afterHit)
+}
+
+// fileAppearMonitor notifies when the file at path appears, or is created
+// again after it was removed
+type fileAppearMonitor struct {
+	monitorBase
+}
+
+func newFileAppearMonitor(source Source, status *monitorStatus) *fileAppearMonitor {
+	return &fileAppearMonitor{monitorBase: monitorBase{source: source, status: status}}
+}
+
+func (m *fileAppearMonitor) Start(ctx context.Context) error {
+	source, status := m.source, m.status
+	logger := source.logger
+	target := filepath.Clean(source.Path)
+	parent := filepath.Dir(target)
+	settle := time.Duration(source.SettleTime) * time.Second
+	started := time.Now()
+
+	// Without a watcher the poll ticker alone finds the file, a little later
+	var events <-chan fsnotify.Event
+	var errors <-chan error
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		logger.Warn().Err(err).Msgf("Failed to create watcher, polling for %s every %s", target, fileAppearPollInterval)
+	} else {
+		defer watcher.Close()
+		events, errors = watcher.Events, watcher.Errors
+	}
+
+	ticker := time.NewTicker(fileAppearPollInterval)
+	defer ticker.Stop()
+
+	watching := false
+	limited := false
+	present := false
+	pending := false
+	var pendingSize int64
+	var pendingSince time.Time
+
+	if _, err := os.Stat(target); err == nil {
+		present = true
+		logger.Info().Msgf("%s already exists, waiting for it to be recreated", target)
+	} else {
+		logger.Info().Msgf("Waiting for %s to appear", target)
+	}
+	status.setState(stateIdle)
+	status.markReady()
+
+	// check decides whether the target now counts as having appeared
+	check := func() bool {
+		info, err := os.Stat(target)
+		if err != nil {
+			pending = false
+			present = false
+			return false
+		}
+		if present {
+			return false
+		}
+		if settle <= 0 {
+			return true
+		}
+		if !pending || info.Size() != pendingSize {
+			pending = true
+			pendingSize = info.Size()
+			pendingSince = time.Now()
+			return false
+		}
+		return time.Since(pendingSince) >= settle
+	}
+
+	hit := func() bool {
+		present = true
+		pending = false
+		status.recordChange(1)
+		logger.Info().Msgf("%s appeared", target)
+
+		data := MessageData{
+			Source:  source.Name,
+			Kind:    kindChange,
+			Changes: 1,
+			Minutes: time.Since(started).Minutes(),
+			Path:    target,
+			Detail:  fmt.Sprintf("%s appeared", target),
+		}
+		notifySource(source, data, true)
+
+		switch source.AfterHit {
+		case afterHitStop:
+			logger.Info().Msgf("Stopping monitor for %s after first hit", target)
+			return true
+		case afterHitExit:
+			requestShutdown(fmt.Sprintf("%s appeared", target))
+			return true
+		}
+		return false
+	}
+
+	for {
+		if !watching && watcher != nil {
+			if err := watcher.Add(parent); err == nil {
+				watching = true
+				logger.Debug().Msgf("Watching %s for %s", parent, filepath.Base(target))
+				// The file may have been created before the watch existed
+				if check() && hit() {
+					return nil
+				}
+			} else if isWatchLimitError(err) && !limited {
+				// Polling keeps working, the limit only costs latency
+				limited = true
+				logWatchLimit(logger, parent)
+			}
+		}
+
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return nil
+			}
+			if filepath.Clean(event.Name) == target {
+				if event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+					if present {
+						logger.Info().Msgf("%s was removed, waiting for it to appear again", target)
+					}
+				}
+				if check() && hit() {
+					return nil
+				}
+			} else if filepath.Clean(event.Name) == parent && (event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename)) {
+				watching = false
+			}
+		case err, ok := <-errors:
+			if !ok {
+				return nil
+			}
+			logger.Error().Err(err).Msg("Watcher error")
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			// Covers a missing parent directory and the settle period
+			if (!watching || pending) && check() && hit() {
+				return nil
+			}
+		}
+	}
+}
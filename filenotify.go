@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+type FileNotifierConfig struct {
+	Path string `json:"path"`
+	// Audit records the deliveries of every other channel too
+	Audit bool `json:"audit"`
+}
+
+// fileNotifier appends one line per notification to a plain text file.
+// Monitors deliver concurrently, so writes go through mu
+type fileNotifier struct {
+	name   string
+	config FileNotifierConfig
+	mu     sync.Mutex
+	file   *logFile
+}
+
+// auditLogs are the file notifiers with "audit" set
+var auditLogs []*fileNotifier
+
+func newFileNotifier(name string, config FileNotifierConfig) (*fileNotifier, error) {
+	if config.Path == "" {
+		return nil, fmt.Errorf("file notifier requires a path")
+	}
+	config.Path = expandPath(config.Path)
+	// Like log_file, relative paths live in log_dir
+	if !filepath.IsAbs(config.Path) && logs.logDir != "" {
+		config.Path = filepath.Join(logs.logDir, config.Path)
+	}
+	file, err := logs.open(config.Path)
+	if err != nil {
+		return nil, err
+	}
+	return &fileNotifier{name: name, config: config, file: file}, nil
+}
+
+func (f *fileNotifier) Name() string {
+	return "file"
+}
+
+func (f *fileNotifier) Notify(title, message string, data MessageData) error {
+	return f.record(f.name, data.Source, message, nil)
+}
+
+// record writes one delivery; err marks it as failed
+func (f *fileNotifier) record(channel, source, message string, err error) error {
+	line := fmt.Sprintf("%s %s", time.Now().Format("2006-01-02 15:04:05"), channel)
+	if err != nil {
+		line += " FAILED"
+	}
+	line += fmt.Sprintf(" %s: %s", source, strings.ReplaceAll(strings.TrimSpace(message), "\n", " | "))
+	if err != nil {
+		line += fmt.Sprintf(" (%v)", err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, writeErr := f.file.WriteString(line + "\n")
+	return writeErr
+}
+
+// auditDelivery records a delivery attempt on channel in every audit log
+func auditDelivery(channel string, data MessageData, message string, err error) {
+	for _, audit := range auditLogs {
+		if audit.name == channel {
+			// The channel wrote the line itself
+			continue
+		}
+		if writeErr := audit.record(channel, data.Source, message, err); writeErr != nil {
+			log.Error().Err(writeErr).Msgf("Failed to write notification audit log %s", audit.config.Path)
+		}
+	}
+}
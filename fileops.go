@@ -0,0 +1,260 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// opCounts breaks the files changed in an interval down by what happened
+// to them
+type opCounts struct {
+	Created  int
+	Modified int
+	Deleted  int
+	Renamed  int
+	// Chmod counts files whose permissions changed and nothing else, with
+	// watch_chmod
+	Chmod int
+	// transient counts files created and removed again within the interval
+	transient int
+}
+
+func (c opCounts) empty() bool {
+	return c == opCounts{}
+}
+
+// files is how many files changed, each counted once however many events
+// it took, so a file created and renamed is one change on its final name
+func (c opCounts) files() int {
+	return c.Created + c.Modified + c.Deleted + c.Renamed + c.Chmod + c.transient
+}
+
+// fileOps is what the watcher reported for one path
+type fileOps struct {
+	created bool
+	written bool
+	removed bool
+	renamed bool
+	chmod   bool
+	// artifact marks an editor's temporary file, which only helps
+	// classify the files saved through it
+	artifact bool
+	// mode is the file's mode after its last permission change
+	mode os.FileMode
+	// createdAt and renamedAt are when the path last appeared or was
+	// renamed away, to pair the two halves of a move
+	createdAt time.Time
+	renamedAt time.Time
+}
+
+// fileMove is a file renamed or moved within the watched tree
+type fileMove struct {
+	from string
+	to   string
+}
+
+// How many files {{.Permissions}} and {{.Moved}} name
+const permissionFilesShown = 3
+
+// How far apart a path being renamed away and another appearing may be for
+// the two to count as one move. fsnotify doesn't pass on the kernel's
+// rename cookies, so this and the names are all there is to go by
+const moveWindow = 2 * time.Second
+
+// opTracker collects per-path events until the interval ends and then
+// classifies each path once, so a save that writes a temporary file and
+// renames it over the original counts as one modification rather than a
+// create and a delete
+type opTracker struct {
+	paths map[string]*fileOps
+	// chmod records permission changes, for watch_chmod
+	chmod bool
+	now   func() time.Time
+}
+
+func newOpTracker(chmod bool, now func() time.Time) *opTracker {
+	return &opTracker{paths: make(map[string]*fileOps), chmod: chmod, now: now}
+}
+
+func (t *opTracker) observe(event fsnotify.Event) {
+	ops := t.paths[event.Name]
+	if ops == nil {
+		ops = &fileOps{}
+		t.paths[event.Name] = ops
+	}
+	ops.created = ops.created || event.Has(fsnotify.Create)
+	ops.written = ops.written || event.Has(fsnotify.Write)
+	ops.removed = ops.removed || event.Has(fsnotify.Remove)
+	ops.renamed = ops.renamed || event.Has(fsnotify.Rename)
+	if event.Has(fsnotify.Create) {
+		ops.createdAt = t.now()
+	}
+	if event.Has(fsnotify.Rename) {
+		ops.renamedAt = t.now()
+	}
+	if t.chmod && event.Has(fsnotify.Chmod) {
+		if info, err := os.Lstat(event.Name); err == nil {
+			ops.chmod = true
+			ops.mode = info.Mode()
+		}
+	}
+}
+
+// observeArtifact records an event on an editor's temporary file
+func (t *opTracker) observeArtifact(event fsnotify.Event) {
+	t.observe(event)
+	t.paths[event.Name].artifact = true
+}
+
+func (t *opTracker) reset() {
+	clear(t.paths)
+}
+
+// counts classifies the paths seen so far by whether they exist now
+func (t *opTracker) counts() opCounts {
+	counts, _ := t.classify()
+	return counts
+}
+
+// classify counts the paths by what happened to them and pairs the files
+// renamed away with the ones that appeared into moves
+func (t *opTracker) classify() (opCounts, []fileMove) {
+	var counts opCounts
+	// Temporary files renamed away per directory, to pair with files that
+	// appeared there, and pre-existing files renamed away
+	tempRenames := make(map[string]int)
+	var movedAway, appeared []string
+	existing := make(map[string]bool, len(t.paths))
+	for path, ops := range t.paths {
+		_, err := os.Lstat(path)
+		existing[path] = err == nil
+		if existing[path] || !ops.renamed {
+			continue
+		}
+		if ops.created {
+			tempRenames[filepath.Dir(path)]++
+		} else if !ops.artifact {
+			movedAway = append(movedAway, path)
+		}
+	}
+
+	for path, ops := range t.paths {
+		if ops.artifact {
+			continue
+		}
+		dir := filepath.Dir(path)
+		switch {
+		case !existing[path] && ops.created && ops.renamed:
+			// Created and renamed, counted under the name it ended up with
+		case !existing[path] && ops.created:
+			// Came and went within the interval
+			counts.transient++
+		case !existing[path] && ops.renamed:
+			// Renamed away, paired below or counted as deleted
+		case !existing[path]:
+			counts.Deleted++
+		case ops.created && (ops.removed || ops.renamed):
+			// Replaced in place, e.g. a backup-rename save
+			counts.Modified++
+		case ops.created && tempRenames[dir] > 0:
+			// A temporary file renamed over this one
+			tempRenames[dir]--
+			counts.Modified++
+		case ops.created && !ops.written:
+			// Moved here, paired below or counted as created
+			appeared = append(appeared, path)
+		case ops.created:
+			counts.Created++
+		case ops.written:
+			counts.Modified++
+		case ops.chmod:
+			// An editor that restores the mode on save also wrote the
+			// file, so only a bare permission change ends up here
+			counts.Chmod++
+		}
+	}
+	moves := t.pairMoves(movedAway, appeared)
+	counts.Renamed = len(moves)
+	counts.Deleted += len(movedAway) - len(moves)
+	counts.Created += len(appeared) - len(moves)
+	return counts, moves
+}
+
+// pairMoves matches files renamed away with files that appeared within
+// moveWindow of them: by name first, a move to another directory, then by
+// directory, a rename
+func (t *opTracker) pairMoves(away, appeared []string) []fileMove {
+	sort.Strings(away)
+	sort.Strings(appeared)
+	paired := make(map[string]bool)
+	var moves []fileMove
+	match := func(related func(from, to string) bool) {
+		for _, from := range away {
+			if paired[from] {
+				continue
+			}
+			for _, to := range appeared {
+				gap := t.paths[to].createdAt.Sub(t.paths[from].renamedAt)
+				if paired[to] || gap.Abs() > moveWindow || !related(from, to) {
+					continue
+				}
+				paired[from], paired[to] = true, true
+				moves = append(moves, fileMove{from: from, to: to})
+				break
+			}
+		}
+	}
+	match(func(from, to string) bool { return filepath.Base(from) == filepath.Base(to) })
+	match(func(from, to string) bool { return filepath.Dir(from) == filepath.Dir(to) })
+	return moves
+}
+
+// moves names the files moved or renamed, e.g. "a.txt → b.txt,
+// drafts/x.md → posts/x.md". Paths are relative to root
+func (t *opTracker) moves(root string) string {
+	_, moves := t.classify()
+	var parts []string
+	for _, move := range moves[:min(len(moves), permissionFilesShown)] {
+		parts = append(parts, relativeName(root, move.from)+" → "+relativeName(root, move.to))
+	}
+	if more := len(moves) - permissionFilesShown; more > 0 {
+		parts = append(parts, fmt.Sprintf("%d more", more))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func relativeName(root, path string) string {
+	if rel, err := filepath.Rel(root, path); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return path
+}
+
+// permissionChanges names the files whose permissions alone changed, with
+// their new mode, e.g. "deploy.sh (now 0777)". Paths are relative to root
+func (t *opTracker) permissionChanges(root string) string {
+	var changed []string
+	for path, ops := range t.paths {
+		if ops.chmod && !ops.artifact && !ops.created && !ops.written && !ops.removed && !ops.renamed {
+			changed = append(changed, path)
+		}
+	}
+	if len(changed) == 0 {
+		return ""
+	}
+	sort.Strings(changed)
+	var parts []string
+	for _, path := range changed[:min(len(changed), permissionFilesShown)] {
+		parts = append(parts, fmt.Sprintf("%s (now %04o)", relativeName(root, path), t.paths[path].mode.Perm()))
+	}
+	if more := len(changed) - permissionFilesShown; more > 0 {
+		parts = append(parts, fmt.Sprintf("%d more", more))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+func TestOpTrackerClassify(t *testing.T) {
+	type event struct {
+		name string
+		op   fsnotify.Op
+	}
+	tests := []struct {
+		name   string
+		exists []string // files on disk at the end of the interval
+		events []event
+		want   opCounts
+		files  int
+		moved  string
+	}{
+		{"created", []string{"a.txt"},
+			[]event{{"a.txt", fsnotify.Create}, {"a.txt", fsnotify.Write}},
+			opCounts{Created: 1}, 1, ""},
+		{"written twice", []string{"a.txt"},
+			[]event{{"a.txt", fsnotify.Write}, {"a.txt", fsnotify.Write}},
+			opCounts{Modified: 1}, 1, ""},
+		{"created and renamed", []string{"final.txt"},
+			[]event{{"draft.txt", fsnotify.Create}, {"draft.txt", fsnotify.Write}, {"draft.txt", fsnotify.Rename}, {"final.txt", fsnotify.Create}},
+			opCounts{Modified: 1}, 1, ""},
+		{"renamed", []string{"new.txt"},
+			[]event{{"old.txt", fsnotify.Rename}, {"new.txt", fsnotify.Create}},
+			opCounts{Renamed: 1}, 1, "old.txt → new.txt"},
+		{"moved to another directory", []string{"sub/a.txt"},
+			[]event{{"a.txt", fsnotify.Rename}, {"sub/a.txt", fsnotify.Create}},
+			opCounts{Renamed: 1}, 1, "a.txt → sub/a.txt"},
+		{"renamed away", nil,
+			[]event{{"a.txt", fsnotify.Rename}},
+			opCounts{Deleted: 1}, 1, ""},
+		{"came and went", nil,
+			[]event{{"lock", fsnotify.Create}, {"lock", fsnotify.Remove}},
+			opCounts{transient: 1}, 1, ""},
+		{"deleted", nil,
+			[]event{{"a.txt", fsnotify.Write}, {"a.txt", fsnotify.Remove}},
+			opCounts{Deleted: 1}, 1, ""},
+		{"replaced in place", []string{"a.txt"},
+			[]event{{"a.txt", fsnotify.Rename}, {"a.txt", fsnotify.Create}},
+			opCounts{Modified: 1}, 1, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, name := range tt.exists {
+				path := filepath.Join(dir, filepath.FromSlash(name))
+				if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, nil, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			clock := &fakeClock{t: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)}
+			tracker := newOpTracker(false, clock.now)
+			for _, e := range tt.events {
+				tracker.observe(fsnotify.Event{Name: filepath.Join(dir, filepath.FromSlash(e.name)), Op: e.op})
+				clock.advance(100 * time.Millisecond)
+			}
+			counts := tracker.counts()
+			if counts != tt.want {
+				t.Errorf("counts = %+v, want %+v", counts, tt.want)
+			}
+			if counts.files() != tt.files {
+				t.Errorf("files = %d, want %d", counts.files(), tt.files)
+			}
+			if moved := tracker.moves(dir); moved != tt.moved {
+				t.Errorf("moves = %q, want %q", moved, tt.moved)
+			}
+		})
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+func validFilesSource(source Source) error {
+	if len(source.Paths) == 0 {
+		return fmt.Errorf("a files source needs paths")
+	}
+	if source.Path != "" {
+		return fmt.Errorf("a files source takes paths, not path")
+	}
+	seen := make(map[string]bool)
+	for _, path := range source.Paths {
+		if seen[path] {
+			return fmt.Errorf("duplicate path: %s", path)
+		}
+		seen[path] = true
+	}
+	return nil
+}
+
+// fileLabels names each file by its base name, or by its whole path when
+// another of the files has the same name
+func fileLabels(paths []string) map[string]string {
+	bases := make(map[string]int)
+	for _, path := range paths {
+		bases[filepath.Base(path)]++
+	}
+	labels := make(map[string]string, len(paths))
+	for _, path := range paths {
+		labels[path] = filepath.Base(path)
+		if bases[labels[path]] > 1 {
+			labels[path] = path
+		}
+	}
+	return labels
+}
+
+// filesMonitor counts the changes to a list of files as one source, e.g. a
+// handful of config files in different places. It watches their
+// directories, so a file that is replaced on save, removed or created
+// later keeps being counted, and events on other files there are ignored
+type filesMonitor struct {
+	monitorBase
+}
+
+func newFilesMonitor(source Source, status *monitorStatus) *filesMonitor {
+	return &filesMonitor{monitorBase: monitorBase{source: source, status: status}}
+}
+
+func (m *filesMonitor) Start(ctx context.Context) error {
+	source, status := m.source, m.status
+	logger := source.logger
+	config := source.NotificationConfig
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create watcher: %v", err)
+	}
+	defer watcher.Close()
+	labels := fileLabels(source.Paths)
+	dirs := make(map[string]bool)
+	for _, path := range source.Paths {
+		dir := filepath.Dir(path)
+		if _, done := dirs[dir]; done {
+			continue
+		}
+		dirs[dir] = true
+		if err := watcher.Add(dir); err != nil {
+			logger.Warn().Msgf("Warning: cannot watch %s (%v). Skipping the files in it.", dir, err)
+			dirs[dir] = false
+		}
+	}
+	watched := 0
+	for _, path := range source.Paths {
+		if !dirs[filepath.Dir(path)] {
+			delete(labels, path)
+			continue
+		}
+		watched++
+		if _, err := os.Stat(path); err != nil {
+			logger.Info().Msgf("%s does not exist, counting its changes once it does", path)
+		}
+	}
+	if watched == 0 {
+		return fmt.Errorf("none of the files can be watched")
+	}
+
+	// Counting runs apart from delivery like in dirMonitor. mu guards the
+	// interval's changes per file, pending and the watcher errors
+	var mu sync.Mutex
+	changed := make(map[string]int)
+	pending := 0
+	watchErrors := 0
+	activitySignal := make(chan struct{}, 1)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				label, ok := labels[event.Name]
+				if !ok || event.Op == fsnotify.Chmod || status.paused() {
+					continue
+				}
+				mu.Lock()
+				changed[label]++
+				pending++
+				mu.Unlock()
+				select {
+				case activitySignal <- struct{}{}:
+				default:
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				logger.Error().Err(err).Msg("Watcher error")
+				mu.Lock()
+				watchErrors++
+				mu.Unlock()
+				sourceFailed(source, status, err)
+			}
+		}
+	}()
+
+	engine := newActivityEngine(source, status, "files", time.Now)
+	takeActivity := func() {
+		mu.Lock()
+		changes := pending
+		pending = 0
+		mu.Unlock()
+		if changes > 0 {
+			engine.activity(changes)
+		}
+	}
+	totalChangeCount := 0
+	ticker := time.NewTicker(time.Duration(config.NotificationInterval) * time.Second)
+	defer ticker.Stop()
+	logger.Info().Msgf("Watching %d files in %d directories", watched, len(dirs))
+	status.markReady()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-activitySignal:
+			takeActivity()
+		case <-ticker.C:
+			tickStart := time.Now()
+			takeActivity()
+			mu.Lock()
+			interval := changed
+			changed = make(map[string]int)
+			healthy := watchErrors == 0
+			watchErrors = 0
+			mu.Unlock()
+			if healthy {
+				sourceWorks(source, status)
+			}
+			if !engine.startInterval() {
+				continue
+			}
+			changeCount := 0
+			for _, count := range interval {
+				changeCount += count
+			}
+			engine.endInterval(changeCount)
+			if changeCount == 0 {
+				engine.idleInterval(tickStart)
+				continue
+			}
+			totalChangeCount += changeCount
+			status.recordFileChanges(interval)
+			names := changedFileNames(interval)
+			logger.Info().Msgf("File changes this interval: %d changes in %s, total changes: %d", changeCount, names, totalChangeCount)
+			engine.notifyChange(MessageData{
+				Source:       source.Name,
+				Kind:         kindChange,
+				Changes:      len(interval),
+				Events:       changeCount,
+				Files:        len(interval),
+				Minutes:      engine.intervalMinutes(),
+				Velocity:     engine.velocity(len(interval), "files"),
+				ChangedFiles: names,
+			})
+			recordEvent(eventRecord{Source: source.Name, Kind: kindChange, Events: changeCount, Files: len(interval), since: tickStart})
+		}
+	}
+}
+
+// changedFileNames lists the files changed in an interval by name, e.g.
+// "nginx.conf, .zshrc"
+func changedFileNames(changed map[string]int) string {
+	names := make([]string, 0, len(changed))
+	for name := range changed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
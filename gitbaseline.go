@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// How old a saved git baseline may be and still be continued from
+const gitBaselineMaxAge = time.Hour
+
+// gitBaseline is the diff a git_file source last saw and the commit HEAD
+// was at then. With state_file it is kept across restarts, so changes made
+// while MiniMon was down are counted on the first tick
+type gitBaseline struct {
+	Path      string                `json:"path"`
+	Head      string                `json:"head"`
+	Base      string                `json:"base"`
+	Added     int                   `json:"added"`
+	Removed   int                   `json:"removed"`
+	Untracked int                   `json:"untracked"`
+	Files     map[string]lineCounts `json:"files,omitempty"`
+	Saved     time.Time             `json:"saved"`
+}
+
+func newGitBaseline(path, head, base string, stat diffStat, now time.Time) gitBaseline {
+	return gitBaseline{Path: path, Head: head, Base: base, Added: stat.Added, Removed: stat.Removed, Untracked: stat.Untracked, Files: stat.Files, Saved: now}
+}
+
+func (b gitBaseline) stat() diffStat {
+	return diffStat{Added: b.Added, Removed: b.Removed, Untracked: b.Untracked, Files: b.Files}
+}
+
+// invalidatedBy says why the saved baseline can't be continued from at
+// current, or nothing when it can. A commit, checkout or other base makes
+// the diff jump without anything being edited, which would otherwise be
+// reported as a huge change on the first tick
+func (b gitBaseline) invalidatedBy(current gitBaseline) string {
+	switch {
+	case b.Path != current.Path || b.Base != current.Base:
+		return "the path or git_base changed"
+	case b.Head != current.Head:
+		return fmt.Sprintf("HEAD moved from %s to %s", shortSHA(b.Head), shortSHA(current.Head))
+	case current.Saved.Sub(b.Saved) > gitBaselineMaxAge:
+		return fmt.Sprintf("it is %s old", formatDuration(current.Saved.Sub(b.Saved)))
+	}
+	return ""
+}
+
+func shortSHA(sha string) string {
+	return sha[:min(len(sha), 7)]
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGitBaselineInvalidatedBy(t *testing.T) {
+	saved := time.Date(2024, 5, 1, 14, 0, 0, 0, time.UTC)
+	head := "4f2a9c1d8e7b6a5f4e3d2c1b0a9f8e7d6c5b4a3f"
+	baseline := newGitBaseline("/work/repo", head, "", diffStat{Added: 12, Removed: 3}, saved)
+	tests := []struct {
+		name    string
+		path    string
+		head    string
+		base    string
+		elapsed time.Duration
+		want    string
+	}{
+		{"unchanged", "/work/repo", head, "", 10 * time.Minute, ""},
+		{"just under the max age", "/work/repo", head, "", gitBaselineMaxAge, ""},
+		{"too old", "/work/repo", head, "", 90 * time.Minute, "it is 1h 30m old"},
+		{"committed", "/work/repo", "9e8d7c6b5a4f3e2d1c0b9a8f7e6d5c4b3a2f1e0d", "", time.Minute, "HEAD moved from 4f2a9c1 to 9e8d7c6"},
+		{"other path", "/work/other", head, "", time.Minute, "the path or git_base changed"},
+		{"other base", "/work/repo", head, "main", time.Minute, "the path or git_base changed"},
+		// The path or base explains a moved HEAD, so it is named first
+		{"other base and head", "/work/repo", "9e8d7c6", "main", time.Minute, "the path or git_base changed"},
+		{"short head", "/work/repo", "abc", "", time.Minute, "HEAD moved from 4f2a9c1 to abc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current := newGitBaseline(tt.path, tt.head, tt.base, diffStat{}, saved.Add(tt.elapsed))
+			if got := baseline.invalidatedBy(current); got != tt.want {
+				t.Errorf("invalidatedBy = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGitBaselineStat(t *testing.T) {
+	stat := diffStat{Added: 7, Removed: 2, Untracked: 1, Files: map[string]lineCounts{"main.go": {Added: 7, Removed: 2}}}
+	baseline := newGitBaseline("/work/repo", "abc", "", stat, time.Now())
+	if got := baseline.stat(); !reflect.DeepEqual(got, stat) {
+		t.Errorf("stat() = %+v, want %+v", got, stat)
+	}
+}
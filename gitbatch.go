@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"maps"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How old a repository's diff may be for another source to use it. Sources
+// on the same interval tick within milliseconds of each other
+const gitBatchWindow = time.Second
+
+// gitBatchKey is what sources must share for one diff to serve them all
+type gitBatchKey struct {
+	root             string
+	base             string
+	ignoreWhitespace bool
+	includeUntracked bool
+	filter           string
+}
+
+// gitRunner runs git in dir and returns what it wrote to stdout
+type gitRunner func(dir string, args ...string) ([]byte, error)
+
+func execGit(dir string, args ...string) ([]byte, error) {
+	cmd := gitCommand(dir, args...)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	err := cmd.Run()
+	return out.Bytes(), err
+}
+
+// gitBatch runs git for all the git_file sources in one repository with
+// the same diff settings: one diff over all their paths per tick instead of
+// a rev-parse and a diff per source, split up per source afterwards
+type gitBatch struct {
+	key    gitBatchKey
+	filter []string
+	// git runs the diffs, execGit unless a test counts or fakes them
+	git gitRunner
+	mu  sync.Mutex
+	// members maps each source's path to its prefix relative to the root,
+	// "" for the whole repository
+	members map[string]string
+	// The last diff, when it ran and the paths it covered
+	at        time.Time
+	covered   map[string]bool
+	tracked   diffStat
+	untracked diffStat
+}
+
+var gitBatches = struct {
+	sync.Mutex
+	batches map[gitBatchKey]*gitBatch
+}{batches: make(map[gitBatchKey]*gitBatch)}
+
+// joinGitBatch adds the source's path to the batch of its repository,
+// starting one if it is the first
+func joinGitBatch(source Source, base string) (*gitBatch, error) {
+	root, err := gitRepoRoot(source.Path, nil)
+	if err != nil {
+		return nil, err
+	}
+	key := gitBatchKey{
+		root:             root,
+		base:             base,
+		ignoreWhitespace: source.IgnoreWhitespace,
+		includeUntracked: source.IncludeUntracked,
+		filter:           strings.Join(source.DiffFilter, "\x00"),
+	}
+	gitBatches.Lock()
+	defer gitBatches.Unlock()
+	batch := gitBatches.batches[key]
+	if batch == nil {
+		batch = &gitBatch{key: key, filter: source.DiffFilter, git: execGit, members: make(map[string]string)}
+		gitBatches.batches[key] = batch
+	}
+	batch.mu.Lock()
+	batch.members[source.Path] = repoPrefix(root, source.Path)
+	batch.mu.Unlock()
+	return batch, nil
+}
+
+// leave removes a stopped source's path, and the batch with its last one
+func (b *gitBatch) leave(path string) {
+	gitBatches.Lock()
+	defer gitBatches.Unlock()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.members, path)
+	if len(b.members) == 0 {
+		delete(gitBatches.batches, b.key)
+	}
+}
+
+// repoPrefix returns path relative to the repository root as numstat
+// prints it. The root git reports has its symlinks resolved, so path may
+// need them resolved too
+func repoPrefix(root, path string) string {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		if dir, err := filepath.EvalSymlinks(filepath.Dir(path)); err == nil {
+			rel, _ = filepath.Rel(root, filepath.Join(dir, filepath.Base(path)))
+		}
+	}
+	if rel == "." {
+		return ""
+	}
+	return filepath.ToSlash(rel)
+}
+
+// stat returns the counts for the member at path, from the last diff when
+// it is recent and covered path, or from a new one
+func (b *gitBatch) stat(path string, now time.Time) (diffStat, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if now.Sub(b.at) >= gitBatchWindow || !b.covered[path] {
+		if err := b.run(); err != nil {
+			b.at = time.Time{}
+			return diffStat{}, err
+		}
+		b.at = now
+	}
+	prefix := b.members[path]
+	var stat diffStat
+	for file, counts := range b.tracked.Files {
+		if inPrefix(prefix, file) {
+			stat.addFile(file, counts.Added, counts.Removed)
+		}
+	}
+	for file, counts := range b.untracked.Files {
+		if inPrefix(prefix, file) {
+			stat.addFile(file, counts.Added, counts.Removed)
+			stat.Untracked++
+		}
+	}
+	return stat, nil
+}
+
+func inPrefix(prefix, file string) bool {
+	return prefix == "" || file == prefix || strings.HasPrefix(file, prefix+"/")
+}
+
+// run diffs all the members' paths at once
+func (b *gitBatch) run() error {
+	paths := slices.Sorted(maps.Keys(b.members))
+	covered := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		covered[path] = true
+	}
+	args := []string{"diff", "--numstat"}
+	if b.key.ignoreWhitespace {
+		args = append(args, "-w", "--ignore-blank-lines")
+	}
+	args = append(append(args, b.key.base, "--"), paths...)
+	// Pathspecs in diff_filter are relative to the repository root
+	out, err := b.git(b.key.root, append(args, b.filter...)...)
+	// Exit status 1 only means there are differences
+	var exitError *exec.ExitError
+	if err != nil && !(errors.As(err, &exitError) && exitError.ExitCode() == 1) {
+		return err
+	}
+	b.tracked = parseNumstat(string(out))
+	b.untracked = diffStat{}
+	if b.key.includeUntracked {
+		untracked, err := untrackedStat(b.git, b.key.root, paths, b.filter)
+		if err != nil {
+			return err
+		}
+		b.untracked = untracked
+	}
+	b.covered = covered
+	return nil
+}
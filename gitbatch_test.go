@@ -0,0 +1,122 @@
+package main
+
+import (
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGitBatchDiffOptions(t *testing.T) {
+	tests := []struct {
+		name             string
+		ignoreWhitespace bool
+		filter           []string
+		added, removed   int
+	}{
+		{"all changes", false, nil, 4, 1},
+		{"ignore whitespace", true, nil, 3, 0},
+		{"filter", false, []string{":!docs"}, 3, 1},
+		{"ignore whitespace and filter", true, []string{":(exclude)docs"}, 2, 0},
+	}
+	dir := initTestRepo(t)
+	writeTestFile(t, dir, "main.go", "package main\n\nfunc main() {\n}\n")
+	writeTestFile(t, dir, "docs/notes.md", "# Notes\n")
+	commitTestRepo(t, dir)
+	// A whitespace-only edit, and a new line with a blank one after it.
+	// A blank line inside a hunk counts even with -w --ignore-blank-lines
+	writeTestFile(t, dir, "main.go", "package  main\n\nfunc main() {\n\tprintln()\n}\n\n")
+	writeTestFile(t, dir, "docs/notes.md", "# Notes\nmore\n")
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := Source{Path: dir, IgnoreWhitespace: tt.ignoreWhitespace, DiffFilter: tt.filter}
+			batch, err := joinGitBatch(source, "HEAD")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer batch.leave(dir)
+			stat, err := batch.stat(dir, time.Now())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stat.Added != tt.added || stat.Removed != tt.removed {
+				t.Errorf("stat = +%d -%d, want +%d -%d (%v)", stat.Added, stat.Removed, tt.added, tt.removed, stat.Files)
+			}
+		})
+	}
+}
+
+// TestGitBatchSharesDiff counts the git runs: sources in one repository
+// share a diff within gitBatchWindow, and untracked files take one more
+func TestGitBatchSharesDiff(t *testing.T) {
+	tests := []struct {
+		name             string
+		includeUntracked bool
+		runsPerDiff      int64
+	}{
+		{"tracked", false, 1},
+		{"untracked", true, 2},
+	}
+	dir := initTestRepo(t)
+	writeTestFile(t, dir, "a/main.go", "package main\n")
+	writeTestFile(t, dir, "b/notes.md", "# Notes\n")
+	commitTestRepo(t, dir)
+	writeTestFile(t, dir, "a/main.go", "package main\n\nfunc main() {}\n")
+	writeTestFile(t, dir, "b/notes.md", "# Notes\nmore\n")
+	writeTestFile(t, dir, "b/todo.md", "one\ntwo\n")
+	a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var runs atomic.Int64
+			var batch *gitBatch
+			for _, path := range []string{a, b} {
+				joined, err := joinGitBatch(Source{Path: path, IncludeUntracked: tt.includeUntracked}, "HEAD")
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer joined.leave(path)
+				if batch != nil && joined != batch {
+					t.Fatal("sources in one repository got different batches")
+				}
+				batch = joined
+			}
+			batch.git = func(dir string, args ...string) ([]byte, error) {
+				runs.Add(1)
+				return execGit(dir, args...)
+			}
+
+			now := time.Now()
+			statA, err := batch.stat(a, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			statB, err := batch.stat(b, now.Add(gitBatchWindow/2))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := runs.Load(); got != tt.runsPerDiff {
+				t.Errorf("%d git runs for two sources, want %d", got, tt.runsPerDiff)
+			}
+			if statA.Added != 2 || statA.Removed != 0 {
+				t.Errorf("a: +%d -%d, want +2 -0", statA.Added, statA.Removed)
+			}
+			wantB := 1
+			if tt.includeUntracked {
+				wantB += 2
+			}
+			if statB.Added != wantB {
+				t.Errorf("b: +%d, want +%d (%v)", statB.Added, wantB, statB.Files)
+			}
+
+			// The next tick diffs again
+			if _, err := batch.stat(a, now.Add(gitBatchWindow)); err != nil {
+				t.Fatal(err)
+			}
+			if got := runs.Load(); got != 2*tt.runsPerDiff {
+				t.Errorf("%d git runs after the window, want %d", got, 2*tt.runsPerDiff)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// cleanWatch notices the working tree going from dirty to clean, for
+// on_clean. A tree that is clean at startup has nothing to report until it
+// has been dirty
+type cleanWatch struct {
+	source     Source
+	dirtySince time.Time
+	// atStartup means the tree was already dirty when monitoring began, so
+	// the real dirty time is longer than measured
+	atStartup bool
+}
+
+func newCleanWatch(source Source, initial diffStat, now time.Time) *cleanWatch {
+	w := &cleanWatch{source: source}
+	if initial.dirty() {
+		w.dirtySince = now
+		w.atStartup = true
+	}
+	return w
+}
+
+func (s diffStat) dirty() bool {
+	return s.Added+s.Removed+s.Untracked > 0
+}
+
+// check records when the tree got dirty and notifies once it is clean again.
+// notify is false while the source is paused, which still moves the state on
+func (w *cleanWatch) check(stat diffStat, now time.Time, notify bool) {
+	switch {
+	case stat.dirty() && w.dirtySince.IsZero():
+		w.dirtySince = now
+		w.atStartup = false
+	case !stat.dirty() && !w.dirtySince.IsZero():
+		dirty := now.Sub(w.dirtySince)
+		detail := fmt.Sprintf("working tree clean after being dirty for %s", formatDuration(dirty))
+		if w.atStartup {
+			detail = fmt.Sprintf("working tree clean after being dirty for at least %s", formatDuration(dirty))
+		}
+		w.dirtySince = time.Time{}
+		w.source.logger.Info().Msgf("Git: %s", detail)
+		if notify {
+			notifySource(w.source, MessageData{
+				Source:  w.source.Name,
+				Kind:    kindClean,
+				Path:    w.source.Path,
+				Minutes: dirty.Minutes(),
+				Detail:  detail,
+			}, false)
+		}
+	}
+}
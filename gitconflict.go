@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Seconds between reminders while a conflict stays unresolved
+const defaultConflictReminder = 1800
+
+// conflictMarkers are what git leaves in its directory while an operation
+// waits for conflicts to be resolved
+var conflictMarkers = []struct{ name, operation string }{
+	{"rebase-merge", "rebase"},
+	{"rebase-apply", "rebase"},
+	{"MERGE_HEAD", "merge"},
+	{"CHERRY_PICK_HEAD", "cherry-pick"},
+	{"REVERT_HEAD", "revert"},
+}
+
+// gitDir returns the git directory of the worktree at root, following the
+// .git file of linked worktrees and submodules
+func gitDir(root string) string {
+	dotGit := filepath.Join(root, ".git")
+	content, err := os.ReadFile(dotGit)
+	if err != nil {
+		return dotGit
+	}
+	dir, ok := strings.CutPrefix(strings.TrimSpace(string(content)), "gitdir: ")
+	if !ok {
+		return dotGit
+	}
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(root, dir)
+	}
+	return dir
+}
+
+// conflictState describes an unfinished merge, rebase, cherry-pick or
+// revert and the unmerged files in the repository at root, or returns ""
+// when there is nothing to resolve
+func conflictState(root string, native *nativeRepo) (string, error) {
+	operation := ""
+	dir := gitDir(root)
+	for _, marker := range conflictMarkers {
+		if _, err := os.Stat(filepath.Join(dir, marker.name)); err == nil {
+			operation = marker.operation
+			break
+		}
+	}
+
+	unmerged, err := unmergedFiles(root, native)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case operation != "" && unmerged > 0:
+		return fmt.Sprintf("%s in progress with %d unmerged files", operation, unmerged), nil
+	case operation != "":
+		return fmt.Sprintf("%s in progress", operation), nil
+	case unmerged > 0:
+		return fmt.Sprintf("%d unmerged files", unmerged), nil
+	}
+	return "", nil
+}
+
+func unmergedFiles(root string, native *nativeRepo) (int, error) {
+	if native != nil {
+		idx, err := native.repo.Storer.Index()
+		if err != nil {
+			return 0, err
+		}
+		unmerged := make(map[string]bool)
+		for _, entry := range idx.Entries {
+			// Unmerged files have their versions in stages 1 to 3. go-git's
+			// index.Merged is 1 too, so compare with 0 directly
+			if entry.Stage > 0 {
+				unmerged[entry.Name] = true
+			}
+		}
+		return len(unmerged), nil
+	}
+	cmd := gitCommand(root, "diff", "--name-only", "--diff-filter=U")
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	if err := cmd.Run(); err != nil {
+		return 0, err
+	}
+	return len(strings.Fields(out.String())), nil
+}
+
+// conflictWatch notifies on_conflict entries when the repository enters a
+// conflict state, reminds them while it lasts and reports when it clears.
+// It runs alongside the change counting without affecting it
+type conflictWatch struct {
+	source       Source
+	root         string
+	native       *nativeRepo
+	reminder     time.Duration
+	state        string
+	since        time.Time
+	lastNotified time.Time
+}
+
+func wantsConflicts(source Source) bool {
+	for _, notification := range source.NotificationConfig.NotificationSet {
+		if notification.OnConflict != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func newConflictWatch(source Source, native *nativeRepo) (*conflictWatch, error) {
+	w := &conflictWatch{source: source, native: native, reminder: defaultConflictReminder * time.Second}
+	if source.ConflictReminder > 0 {
+		w.reminder = time.Duration(source.ConflictReminder) * time.Second
+	}
+	root, err := gitRepoRoot(source.Path, native)
+	if err != nil {
+		return nil, err
+	}
+	w.root = root
+	return w, nil
+}
+
+// gitRepoRoot returns the top of the worktree path belongs to
+func gitRepoRoot(path string, native *nativeRepo) (string, error) {
+	if native != nil {
+		return native.root, nil
+	}
+	dir := path
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		dir = filepath.Dir(dir)
+	}
+	cmd := gitCommand(dir, "rev-parse", "--show-toplevel")
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%s is not inside a git repository: %v", dir, err)
+	}
+	return strings.TrimSpace(out.String()), nil
+}
+
+func (w *conflictWatch) check(now time.Time) {
+	logger := w.source.logger
+	state, err := conflictState(w.root, w.native)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to check for merge conflicts")
+		return
+	}
+	data := MessageData{Source: w.source.Name, Kind: kindConflict, Path: w.root}
+	switch {
+	case state != "" && w.state == "":
+		logger.Warn().Msgf("Conflict in %s: %s", w.root, state)
+		w.since = now
+		data.Detail = state
+	case state != "" && now.Sub(w.lastNotified) >= w.reminder:
+		data.Detail = fmt.Sprintf("%s, unresolved for %s", state, formatDuration(now.Sub(w.since)))
+	case state == "" && w.state != "":
+		logger.Info().Msgf("Conflict in %s resolved after %s", w.root, formatDuration(now.Sub(w.since)))
+		w.state = ""
+		notifySource(w.source, MessageData{
+			Source: w.source.Name,
+			Kind:   kindRecover,
+			Path:   w.root,
+			Detail: fmt.Sprintf("conflict resolved after %s", formatDuration(now.Sub(w.since))),
+		}, true)
+		return
+	default:
+		w.state = state
+		return
+	}
+	w.state = state
+	w.lastNotified = now
+	notifySource(w.source, data, false)
+}
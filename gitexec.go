@@ -0,0 +1,44 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+)
+
+// Git settings from monitor_props shared by every git invocation
+var (
+	gitBinary       = "git"
+	gitEnvAllowlist []string
+)
+
+func configureGit(props MonitorProps) {
+	if props.GitBinary != "" {
+		gitBinary = props.GitBinary
+	}
+	gitEnvAllowlist = props.GitEnvAllowlist
+}
+
+// gitCommand runs git in dir with an environment that can't redirect it:
+// inherited GIT_* variables such as GIT_DIR or GIT_WORK_TREE are dropped
+// unless allowlisted, and optional locks are disabled so background diffs
+// don't block interactive git commands
+func gitCommand(dir string, args ...string) *exec.Cmd {
+	cmd := exec.Command(gitBinary, args...)
+	cmd.Dir = dir
+	cmd.Env = gitEnv(os.Environ())
+	return cmd
+}
+
+func gitEnv(environ []string) []string {
+	env := make([]string, 0, len(environ)+1)
+	for _, entry := range environ {
+		name, _, _ := strings.Cut(entry, "=")
+		if strings.HasPrefix(name, "GIT_") && !slices.Contains(gitEnvAllowlist, name) {
+			continue
+		}
+		env = append(env, entry)
+	}
+	return append(env, "GIT_OPTIONAL_LOCKS=0")
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGitEnv(t *testing.T) {
+	tests := []struct {
+		name      string
+		allowlist []string
+		environ   []string
+		want      []string
+	}{
+		{
+			"drops git variables",
+			nil,
+			[]string{"HOME=/home/me", "GIT_DIR=/elsewhere/.git", "GIT_WORK_TREE=/elsewhere", "PATH=/usr/bin"},
+			[]string{"HOME=/home/me", "PATH=/usr/bin", "GIT_OPTIONAL_LOCKS=0"},
+		},
+		{
+			"keeps allowlisted",
+			[]string{"GIT_SSH_COMMAND"},
+			[]string{"GIT_SSH_COMMAND=ssh -i key", "GIT_INDEX_FILE=/tmp/index"},
+			[]string{"GIT_SSH_COMMAND=ssh -i key", "GIT_OPTIONAL_LOCKS=0"},
+		},
+		{
+			"overrides inherited optional locks",
+			nil,
+			[]string{"GIT_OPTIONAL_LOCKS=1"},
+			[]string{"GIT_OPTIONAL_LOCKS=0"},
+		},
+		{
+			"only the GIT_ prefix",
+			nil,
+			[]string{"GITHUB_TOKEN=x", "MY_GIT_DIR=y"},
+			[]string{"GITHUB_TOKEN=x", "MY_GIT_DIR=y", "GIT_OPTIONAL_LOCKS=0"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func(saved []string) { gitEnvAllowlist = saved }(gitEnvAllowlist)
+			gitEnvAllowlist = tt.allowlist
+			if got := gitEnv(tt.environ); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("gitEnv = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGitCommandIgnoresInheritedRepository(t *testing.T) {
+	dir := initTestRepo(t)
+	// Pointing git elsewhere would make it diff the wrong repository
+	t.Setenv("GIT_DIR", t.TempDir())
+	cmd := gitCommand(dir, "rev-parse", "--show-toplevel")
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(out); got != dir+"\n" {
+		t.Errorf("git ran in %q, want %q", got, dir)
+	}
+	if cmd.Dir != dir {
+		t.Errorf("cmd.Dir = %q, want %q", cmd.Dir, dir)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// How many files {{.TopFiles}} names
+const topFilesCount = 3
+
+// lineCounts are one file's lines in the diff
+type lineCounts struct {
+	Added   int `json:"added"`
+	Removed int `json:"removed"`
+}
+
+// addFile counts a file's lines into the totals and keeps them per file,
+// keyed by the path relative to the repository root
+func (s *diffStat) addFile(path string, added, removed int) {
+	s.Added += added
+	s.Removed += removed
+	if s.Files == nil {
+		s.Files = make(map[string]lineCounts)
+	}
+	counts := s.Files[path]
+	counts.Added += added
+	counts.Removed += removed
+	s.Files[path] = counts
+}
+
+// numstatPath returns the new name of a renamed file in numstat output,
+// given as "old => new" or "dir/{old => new}/file"
+func numstatPath(path string) string {
+	if open := strings.Index(path, "{"); open >= 0 {
+		if end := strings.Index(path[open:], "}"); end >= 0 {
+			end += open
+			if _, renamed, ok := strings.Cut(path[open+1:end], " => "); ok {
+				// "{ => dir}/file" and "dir/{old => }/file" leave a double slash
+				return strings.ReplaceAll(path[:open]+renamed+path[end+1:], "//", "/")
+			}
+		}
+	}
+	if _, renamed, ok := strings.Cut(path, " => "); ok {
+		return renamed
+	}
+	return path
+}
+
+// topFiles lists the files that changed most between previous and s, by
+// lines added plus removed in the interval, as "src/main.go (+40 -3)"
+func (s diffStat) topFiles(previous diffStat) string {
+	type fileChange struct {
+		path           string
+		added, removed int
+	}
+	var changes []fileChange
+	for path, counts := range s.Files {
+		before := previous.Files[path]
+		added, removed := max(counts.Added-before.Added, 0), max(counts.Removed-before.Removed, 0)
+		if added+removed > 0 {
+			changes = append(changes, fileChange{path, added, removed})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		a, b := changes[i], changes[j]
+		if a.added+a.removed != b.added+b.removed {
+			return a.added+a.removed > b.added+b.removed
+		}
+		return a.path < b.path
+	})
+
+	var parts []string
+	for _, change := range changes[:min(len(changes), topFilesCount)] {
+		parts = append(parts, fmt.Sprintf("%s (+%d -%d)", change.path, change.added, change.removed))
+	}
+	return strings.Join(parts, ", ")
+}
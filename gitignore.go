@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// gitIgnoreCacheSize bounds the answers kept per checker. A long-running
+// source sees an endless stream of new paths (build outputs, temp files),
+// so the cache is dropped once full instead of growing forever
+const gitIgnoreCacheSize = 4096
+
+// gitIgnoreChecker answers "is this path ignored?" through a long-running
+// `git check-ignore --stdin` process, so nested .gitignore files, the global
+// excludes file and .git/info/exclude are all honored exactly as git does
+type gitIgnoreChecker struct {
+	repoRoot string
+	cmd      *exec.Cmd
+	stdin    io.WriteCloser
+	stdout   *bufio.Reader
+	cache    map[string]bool
+}
+
+func newGitIgnoreChecker(dir string) (*gitIgnoreChecker, error) {
+	cmd := gitCommand(dir, "rev-parse", "--show-toplevel")
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s is not inside a git repository: %v", dir, err)
+	}
+
+	c := &gitIgnoreChecker{repoRoot: strings.TrimSpace(out.String())}
+	if err := c.start(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *gitIgnoreChecker) start() error {
+	cmd := gitCommand(c.repoRoot, "check-ignore", "--stdin", "-z", "--non-matching", "--verbose")
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("could not start git check-ignore: %v", err)
+	}
+
+	c.cmd = cmd
+	c.stdin = stdin
+	c.stdout = bufio.NewReader(stdout)
+	c.cache = make(map[string]bool)
+	return nil
+}
+
+// Reload restarts git so edited ignore files are picked up
+func (c *gitIgnoreChecker) Reload() error {
+	c.Close()
+	return c.start()
+}
+
+func (c *gitIgnoreChecker) Close() {
+	if c.cmd == nil {
+		return
+	}
+	c.stdin.Close()
+	c.cmd.Wait()
+	c.cmd = nil
+}
+
+func (c *gitIgnoreChecker) Ignored(path string) (bool, error) {
+	if ignored, ok := c.cache[path]; ok {
+		return ignored, nil
+	}
+	if c.cmd == nil {
+		return false, fmt.Errorf("git check-ignore is not running")
+	}
+
+	// Paths outside the work tree make git exit, so never ask about them
+	if rel, err := filepath.Rel(c.repoRoot, path); err != nil || strings.HasPrefix(rel, "..") {
+		return false, nil
+	}
+
+	if _, err := io.WriteString(c.stdin, path+"\x00"); err != nil {
+		return false, err
+	}
+
+	// Verbose output is <source> NUL <linenum> NUL <pattern> NUL <path> NUL,
+	// with empty source/pattern for paths that match nothing
+	var fields [4]string
+	for i := range fields {
+		field, err := c.stdout.ReadString(0)
+		if err != nil {
+			return false, err
+		}
+		fields[i] = strings.TrimSuffix(field, "\x00")
+	}
+
+	// A matching negated pattern (!foo) means the path is explicitly kept
+	ignored := fields[0] != "" && !strings.HasPrefix(fields[2], "!")
+	if len(c.cache) >= gitIgnoreCacheSize {
+		c.cache = make(map[string]bool)
+	}
+	c.cache[path] = ignored
+	return ignored, nil
+}
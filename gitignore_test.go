@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGitIgnoreChecker(t *testing.T) {
+	dir := initTestRepo(t)
+	if err := os.WriteFile(filepath.Join(dir, ".gitignore"), []byte("*.log\n!keep.log\nbuild/\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	checker, err := newGitIgnoreChecker(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer checker.Close()
+
+	tests := []struct {
+		path    string
+		ignored bool
+	}{
+		{"main.go", false},
+		{"debug.log", true},
+		{"keep.log", false},
+		{"build/out.bin", true},
+		{"sub/trace.log", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			ignored, err := checker.Ignored(filepath.Join(dir, tt.path))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ignored != tt.ignored {
+				t.Errorf("Ignored = %v, want %v", ignored, tt.ignored)
+			}
+		})
+	}
+}
+
+func TestGitIgnoreCacheBounded(t *testing.T) {
+	dir := initTestRepo(t)
+	checker, err := newGitIgnoreChecker(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer checker.Close()
+
+	for i := 0; i < gitIgnoreCacheSize+10; i++ {
+		if _, err := checker.Ignored(filepath.Join(dir, fmt.Sprintf("file%d.txt", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(checker.cache) > gitIgnoreCacheSize {
+		t.Errorf("cache holds %d paths, want at most %d", len(checker.cache), gitIgnoreCacheSize)
+	}
+}
+
+// initTestRepo creates an empty git repository to run git-backed code on
+func initTestRepo(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	// Resolved, since git reports the real path of the work tree
+	dir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runTestGit(t, dir, "init", "-q")
+	return dir
+}
+
+func runTestGit(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := gitCommand(dir, append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, out)
+	}
+}
+
+func writeTestFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// commitTestRepo commits everything in the work tree
+func commitTestRepo(t *testing.T, dir string) {
+	t.Helper()
+	runTestGit(t, dir, "add", "-A")
+	runTestGit(t, dir, "commit", "-q", "-m", "fixture")
+}
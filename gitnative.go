@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/utils/diff"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// How git_file sources read the repository. go-git needs no git binary and
+// no fork per tick; exec covers repositories using features go-git lacks,
+// such as sparse checkouts
+const (
+	gitBackendGoGit = "go-git"
+	gitBackendExec  = "exec"
+)
+
+func validGitBackend(backend string) error {
+	switch backend {
+	case "", gitBackendGoGit, gitBackendExec:
+		return nil
+	}
+	return fmt.Errorf("unknown git_backend: %s", backend)
+}
+
+// nativeRepo is a repository opened once through go-git
+type nativeRepo struct {
+	repo     *git.Repository
+	worktree *git.Worktree
+	root     string
+}
+
+func openNativeRepo(path string) (*nativeRepo, error) {
+	dir := path
+	if info, err := os.Stat(path); err != nil || !info.IsDir() {
+		dir = filepath.Dir(path)
+	}
+	repo, err := git.PlainOpenWithOptions(dir, &git.PlainOpenOptions{DetectDotGit: true, EnableDotGitCommonDir: true})
+	if err != nil {
+		return nil, fmt.Errorf("%s is not inside a git repository: %v", path, err)
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return nil, err
+	}
+	return &nativeRepo{repo: repo, worktree: worktree, root: worktree.Filesystem.Root()}, nil
+}
+
+// resolve returns the commit rev points to, peeling annotated tags
+func (r *nativeRepo) resolve(rev string) (*object.Commit, error) {
+	hash, err := r.repo.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return nil, fmt.Errorf("git ref %q does not exist in %s", rev, r.root)
+	}
+	if commit, err := r.repo.CommitObject(*hash); err == nil {
+		return commit, nil
+	}
+	tag, err := r.repo.TagObject(*hash)
+	if err != nil {
+		return nil, fmt.Errorf("git ref %q is not a commit", rev)
+	}
+	return tag.Commit()
+}
+
+// diffStat mirrors `git diff --numstat <base> -- path <filter...>` plus the
+// untracked files `git status` reports, comparing the base commit with the
+// files on disk
+func (r *nativeRepo) diffStat(base, path string, filter []string, ignoreWhitespace, includeUntracked bool) (diffStat, error) {
+	specs, err := r.pathspecs(path, filter)
+	if err != nil {
+		return diffStat{}, err
+	}
+	baseCommit, err := r.resolve(base)
+	if err != nil {
+		return diffStat{}, err
+	}
+	baseTree, err := baseCommit.Tree()
+	if err != nil {
+		return diffStat{}, err
+	}
+	status, err := r.worktree.Status()
+	if err != nil {
+		return diffStat{}, err
+	}
+
+	// The worktree is HEAD plus what status reports, so only those paths
+	// and the ones committed since base can differ from base
+	candidates := make(map[string]bool)
+	var untracked []string
+	for file, fileStatus := range status {
+		if fileStatus.Worktree == git.Untracked {
+			untracked = append(untracked, file)
+			continue
+		}
+		candidates[file] = true
+	}
+	if head, err := r.repo.Head(); err == nil && head.Hash() != baseCommit.Hash {
+		headCommit, err := r.repo.CommitObject(head.Hash())
+		if err != nil {
+			return diffStat{}, err
+		}
+		headTree, err := headCommit.Tree()
+		if err != nil {
+			return diffStat{}, err
+		}
+		changes, err := object.DiffTree(baseTree, headTree)
+		if err != nil {
+			return diffStat{}, err
+		}
+		for _, change := range changes {
+			candidates[change.From.Name] = true
+			candidates[change.To.Name] = true
+		}
+	}
+
+	var stat diffStat
+	for file := range candidates {
+		if file == "" || !matchPathspecs(specs, file) {
+			continue
+		}
+		old, ok, err := r.committedContent(baseTree, file)
+		if err != nil {
+			return diffStat{}, err
+		}
+		if !ok {
+			continue
+		}
+		current, ok := r.worktreeContent(file)
+		if !ok || bytes.Equal(old, current) || isBinary(old) || isBinary(current) {
+			// Binary files have no line counts, like "-" in numstat
+			continue
+		}
+		added, removed := countLineChanges(old, current, ignoreWhitespace)
+		stat.addFile(file, added, removed)
+	}
+
+	if includeUntracked {
+		for _, file := range untracked {
+			if matchPathspecs(specs, file) {
+				stat.Untracked++
+				stat.addFile(file, countLines(filepath.Join(r.root, filepath.FromSlash(file))), 0)
+			}
+		}
+	}
+	return stat, nil
+}
+
+// committedContent returns file as stored in tree, empty when it isn't
+// there. Submodules are reported as not comparable
+func (r *nativeRepo) committedContent(tree *object.Tree, file string) ([]byte, bool, error) {
+	entry, err := tree.File(file)
+	if errors.Is(err, object.ErrFileNotFound) {
+		return nil, true, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if entry.Mode == filemode.Submodule {
+		return nil, false, nil
+	}
+	contents, err := entry.Contents()
+	if err != nil {
+		return nil, false, err
+	}
+	return []byte(contents), true, nil
+}
+
+// worktreeContent returns file as on disk, empty when deleted. Symlinks
+// compare by target like git does
+func (r *nativeRepo) worktreeContent(file string) ([]byte, bool) {
+	path := filepath.Join(r.root, filepath.FromSlash(file))
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil, true
+	}
+	if err != nil || info.IsDir() {
+		return nil, false
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(path)
+		return []byte(filepath.ToSlash(target)), err == nil
+	}
+	content, err := os.ReadFile(path)
+	return content, err == nil
+}
+
+func isBinary(content []byte) bool {
+	return bytes.IndexByte(content[:min(len(content), 8000)], 0) >= 0
+}
+
+// countLineChanges counts added and removed lines between two versions.
+// ignoreWhitespace approximates `git diff -w --ignore-blank-lines` by
+// comparing lines with their whitespace removed and dropping blank ones
+func countLineChanges(old, current []byte, ignoreWhitespace bool) (added, removed int) {
+	oldText, currentText := string(old), string(current)
+	if ignoreWhitespace {
+		oldText, currentText = stripWhitespace(oldText), stripWhitespace(currentText)
+	}
+	for _, d := range diff.Do(oldText, currentText) {
+		lines := strings.Count(d.Text, "\n")
+		if !strings.HasSuffix(d.Text, "\n") {
+			lines++
+		}
+		switch d.Type {
+		case diffmatchpatch.DiffInsert:
+			added += lines
+		case diffmatchpatch.DiffDelete:
+			removed += lines
+		}
+	}
+	return added, removed
+}
+
+func stripWhitespace(text string) string {
+	var b strings.Builder
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.Join(strings.Fields(line), "")
+		if line != "" {
+			b.WriteString(line)
+			b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
+
+// pathspec is one git pathspec relative to the repository root, as used
+// for the source path and diff_filter
+type pathspec struct {
+	prefix  string
+	pattern *regexp.Regexp
+	exclude bool
+}
+
+func (r *nativeRepo) pathspecs(path string, filter []string) ([]pathspec, error) {
+	rel, err := filepath.Rel(r.root, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return nil, fmt.Errorf("%s is outside the repository at %s", path, r.root)
+	}
+	specs := []pathspec{{prefix: filepath.ToSlash(rel)}}
+	for _, spec := range filter {
+		parsed, err := parsePathspec(spec)
+		if err != nil {
+			return nil, err
+		}
+		specs = append(specs, parsed)
+	}
+	return specs, nil
+}
+
+// parsePathspec supports plain paths, wildcards and the exclude magic
+// (":!", ":^", ":(exclude)"); anything else needs the exec backend
+func parsePathspec(spec string) (pathspec, error) {
+	var p pathspec
+	switch {
+	case strings.HasPrefix(spec, ":!"), strings.HasPrefix(spec, ":^"):
+		p.exclude = true
+		spec = spec[2:]
+	case strings.HasPrefix(spec, ":(exclude)"):
+		p.exclude = true
+		spec = strings.TrimPrefix(spec, ":(exclude)")
+	case strings.HasPrefix(spec, ":/"):
+		spec = spec[2:]
+	case strings.HasPrefix(spec, ":"):
+		return p, fmt.Errorf("pathspec %q is not supported by the go-git backend, use \"git_backend\": \"exec\"", spec)
+	}
+	p.prefix = strings.TrimSuffix(spec, "/")
+	if strings.ContainsAny(spec, "*?") {
+		// Like git, wildcards match across directory separators
+		var expr strings.Builder
+		for _, part := range strings.SplitAfter(spec, "*") {
+			literal := strings.TrimSuffix(part, "*")
+			expr.WriteString(strings.ReplaceAll(regexp.QuoteMeta(literal), `\?`, "."))
+			if strings.HasSuffix(part, "*") {
+				expr.WriteString(".*")
+			}
+		}
+		pattern, err := regexp.Compile("^" + expr.String() + "$")
+		if err != nil {
+			return p, fmt.Errorf("invalid pathspec %q: %v", spec, err)
+		}
+		p.pattern = pattern
+	}
+	return p, nil
+}
+
+func (p pathspec) match(file string) bool {
+	if p.prefix == "" || p.prefix == "." || file == p.prefix || strings.HasPrefix(file, p.prefix+"/") {
+		return true
+	}
+	return p.pattern != nil && p.pattern.MatchString(file)
+}
+
+// matchPathspecs reports whether file matches any included spec and no
+// excluded one
+func matchPathspecs(specs []pathspec, file string) bool {
+	included := false
+	for _, spec := range specs {
+		if !spec.match(file) {
+			continue
+		}
+		if spec.exclude {
+			return false
+		}
+		included = true
+	}
+	return included
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestNativeDiffStatMatchesExec runs both backends on the same fixture
+// repository, the exec one being the reference
+func TestNativeDiffStatMatchesExec(t *testing.T) {
+	dir := initTestRepo(t)
+	writeTestFile(t, dir, "main.go", "package main\n\nfunc main() {\n}\n")
+	writeTestFile(t, dir, "old.txt", "one\ntwo\nthree\n")
+	writeTestFile(t, dir, "docs/guide.md", "# Guide\n")
+	writeTestFile(t, dir, "logo.png", "\x89PNG\x00\x00")
+	commitTestRepo(t, dir)
+	// Committed after the base
+	writeTestFile(t, dir, "added.go", "package main\n\nvar x = 1\n")
+	writeTestFile(t, dir, "docs/guide.md", "# Guide\n\nIntro\n")
+	commitTestRepo(t, dir)
+	// And in the work tree
+	writeTestFile(t, dir, "main.go", "package main\n\nfunc main() {\n\tprintln(1)\n}\n")
+	writeTestFile(t, dir, "logo.png", "\x89PNG\x00\x01")
+	writeTestFile(t, dir, "docs/api.md", "# API\nGET /\n")
+	writeTestFile(t, dir, "notes.txt", "no newline at the end")
+	runTestGit(t, dir, "rm", "-q", "old.txt")
+
+	tests := []struct {
+		name             string
+		base             string
+		path             string
+		filter           []string
+		includeUntracked bool
+	}{
+		{"work tree", "HEAD", "", nil, false},
+		{"since older base", "HEAD~1", "", nil, false},
+		{"untracked", "HEAD", "", nil, true},
+		{"subdirectory", "HEAD~1", "docs", nil, true},
+		{"exclude", "HEAD~1", "", []string{":!docs"}, true},
+		{"wildcard", "HEAD~1", "", []string{"*.go"}, false},
+	}
+	repo, err := openNativeRepo(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := dir
+			if tt.path != "" {
+				path = dir + "/" + tt.path
+			}
+			native, err := repo.diffStat(tt.base, path, tt.filter, false, tt.includeUntracked)
+			if err != nil {
+				t.Fatal(err)
+			}
+			batch, err := joinGitBatch(Source{Path: path, DiffFilter: tt.filter, IncludeUntracked: tt.includeUntracked}, tt.base)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer batch.leave(path)
+			exec, err := batch.stat(path, time.Now())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if native.Added != exec.Added || native.Removed != exec.Removed || native.Untracked != exec.Untracked || !reflect.DeepEqual(native.Files, exec.Files) {
+				t.Errorf("go-git: +%d -%d %d untracked %v\nexec:   +%d -%d %d untracked %v",
+					native.Added, native.Removed, native.Untracked, native.Files, exec.Added, exec.Removed, exec.Untracked, exec.Files)
+			}
+		})
+	}
+}
+
+func TestCountLineChanges(t *testing.T) {
+	tests := []struct {
+		name             string
+		old, current     string
+		ignoreWhitespace bool
+		added, removed   int
+	}{
+		{"append", "a\nb\n", "a\nb\nc\n", false, 1, 0},
+		{"delete", "a\nb\nc\n", "a\nc\n", false, 0, 1},
+		{"modify", "a\nb\nc\n", "a\nB\nc\n", false, 1, 1},
+		{"missing final newline", "a\n", "a\nb", false, 1, 0},
+		{"reindent", "if x {\ny()\n}\n", "if x {\n\ty()\n}\n", false, 1, 1},
+		{"reindent ignored", "if x {\ny()\n}\n", "if x {\n\ty()\n}\n", true, 0, 0},
+		{"blank lines ignored", "a\nb\n", "a\n\n\nb\n", true, 0, 0},
+		{"real change with whitespace ignored", "a b\n", "a c\n", true, 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			added, removed := countLineChanges([]byte(tt.old), []byte(tt.current), tt.ignoreWhitespace)
+			if added != tt.added || removed != tt.removed {
+				t.Errorf("countLineChanges = +%d -%d, want +%d -%d", added, removed, tt.added, tt.removed)
+			}
+		})
+	}
+}
+
+func TestPathspecs(t *testing.T) {
+	tests := []struct {
+		spec    string
+		matches []string
+		misses  []string
+		exclude bool
+		err     bool
+	}{
+		{spec: "docs", matches: []string{"docs", "docs/a.md", "docs/sub/b.md"}, misses: []string{"docsite/a.md"}},
+		{spec: "docs/", matches: []string{"docs/a.md"}},
+		{spec: "*.go", matches: []string{"main.go", "cmd/tool/main.go"}, misses: []string{"main.go.orig"}},
+		{spec: "file?.txt", matches: []string{"file1.txt"}, misses: []string{"file10.txt"}},
+		{spec: ":!vendor", matches: []string{"vendor/x.go"}, exclude: true},
+		{spec: ":^vendor", matches: []string{"vendor/x.go"}, exclude: true},
+		{spec: ":(exclude)*.lock", matches: []string{"yarn.lock"}, exclude: true},
+		{spec: ":/src", matches: []string{"src/a.go"}},
+		{spec: ":(icase)README", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			spec, err := parsePathspec(tt.spec)
+			if tt.err {
+				if err == nil {
+					t.Error("unsupported pathspec accepted")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if spec.exclude != tt.exclude {
+				t.Errorf("exclude = %v, want %v", spec.exclude, tt.exclude)
+			}
+			for _, file := range tt.matches {
+				if !spec.match(file) {
+					t.Errorf("%s not matched", file)
+				}
+			}
+			for _, file := range tt.misses {
+				if spec.match(file) {
+					t.Errorf("%s matched", file)
+				}
+			}
+		})
+	}
+}
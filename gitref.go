@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// gitBaseSessionStart pins the diff base to HEAD as it was when the monitor
+// started
+const gitBaseSessionStart = "session-start"
+
+// resolveGitRef returns the commit sha ref points to in the repository
+// containing path
+func resolveGitRef(path, ref string) (string, error) {
+	cmd := gitCommand(filepath.Dir(path), "rev-parse", "--verify", "--quiet", ref+"^{commit}")
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git ref %q does not exist in the repository of %s", ref, path)
+	}
+	return strings.TrimSpace(out.String()), nil
+}
+
+// headCommit returns the commit HEAD points at
+func headCommit(path string, native *nativeRepo) (string, error) {
+	if native == nil {
+		return resolveGitRef(path, "HEAD")
+	}
+	commit, err := native.resolve("HEAD")
+	if err != nil {
+		return "", err
+	}
+	return commit.Hash.String(), nil
+}
+
+// resolveGitBase turns a git_base setting into the revision to diff against.
+// Without one the diff follows HEAD as before. native is nil when the
+// source uses the exec backend
+func resolveGitBase(path, base string, native *nativeRepo) (string, error) {
+	switch base {
+	case "":
+		return "HEAD", nil
+	case gitBaseSessionStart:
+		base = "HEAD"
+	}
+	if native == nil {
+		return resolveGitRef(path, base)
+	}
+	commit, err := native.resolve(base)
+	if err != nil {
+		return "", err
+	}
+	return commit.Hash.String(), nil
+}
+
+// openGitBackend opens the repository of a git_file source through go-git
+// unless the exec backend was chosen, falling back to exec when go-git
+// can't read it
+func openGitBackend(source Source) (*nativeRepo, error) {
+	if source.GitBackend == gitBackendExec {
+		return nil, nil
+	}
+	return openNativeRepo(source.Path)
+}
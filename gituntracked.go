@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// untrackedStat counts files git doesn't know about yet under paths, each
+// contributing its line count as added lines. Unchanged untracked files give
+// the same figure every time, so only real edits show up as deltas
+func untrackedStat(git gitRunner, repoRoot string, paths, filter []string) (diffStat, error) {
+	args := append([]string{"status", "--porcelain", "-z", "--untracked-files=all", "--"}, paths...)
+	out, err := git(repoRoot, append(args, filter...)...)
+	if err != nil {
+		return diffStat{}, err
+	}
+
+	var stat diffStat
+	entries := strings.Split(string(out), "\x00")
+	for i := 0; i < len(entries); i++ {
+		entry := entries[i]
+		if len(entry) < 4 {
+			continue
+		}
+		// Renames and copies are followed by their original path
+		if entry[0] == 'R' || entry[0] == 'C' {
+			i++
+			continue
+		}
+		if !strings.HasPrefix(entry, "?? ") {
+			continue
+		}
+		stat.Untracked++
+		stat.addFile(entry[3:], countLines(filepath.Join(repoRoot, entry[3:])), 0)
+	}
+	return stat, nil
+}
+
+// countLines counts lines the way git diff would for a new file; binary and
+// empty files count as one so their creation still registers
+func countLines(path string) int {
+	content, err := os.ReadFile(path)
+	if err != nil || len(content) == 0 {
+		return 1
+	}
+	if bytes.IndexByte(content[:min(len(content), 8000)], 0) >= 0 {
+		return 1
+	}
+	lines := bytes.Count(content, []byte{'\n'})
+	if content[len(content)-1] != '\n' {
+		lines++
+	}
+	return lines
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultUpstreamEvery = 10
+	upstreamFetchTimeout = time.Minute
+)
+
+// UpstreamConfig compares a git source's branch with its upstream every
+// Every intervals and notifies when it is more than MaxAhead commits ahead
+// or, with Fetch, behind at all
+type UpstreamConfig struct {
+	Every    int  `json:"every"`
+	MaxAhead int  `json:"max_ahead"`
+	Fetch    bool `json:"fetch"`
+}
+
+func validUpstream(config *UpstreamConfig) error {
+	if config.Every < 0 {
+		return fmt.Errorf("upstream.every must not be negative")
+	}
+	if config.MaxAhead < 0 {
+		return fmt.Errorf("upstream.max_ahead must not be negative")
+	}
+	if config.Every == 0 {
+		config.Every = defaultUpstreamEvery
+	}
+	return nil
+}
+
+type upstreamWatch struct {
+	source Source
+	root   string
+	config UpstreamConfig
+}
+
+// upstreamStatus is where HEAD stands relative to its upstream branch
+type upstreamStatus struct {
+	upstream string
+	ahead    int
+	behind   int
+	// oldestUnpushed is the commit time of the oldest commit not pushed yet
+	oldestUnpushed time.Time
+}
+
+func (w *upstreamWatch) git(args ...string) (string, error) {
+	cmd := gitCommand(w.root, args...)
+	var out, stderr bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return "", fmt.Errorf("%v: %s", err, message)
+		}
+		return "", err
+	}
+	return strings.TrimSpace(out.String()), nil
+}
+
+// fetch updates the remote-tracking branches with whatever credentials are
+// around (ssh-agent, credential helpers) and fails rather than prompting
+func (w *upstreamWatch) fetch() error {
+	cmd := gitCommand(w.root, "fetch", "--quiet")
+	cmd.Env = append(cmd.Env, "GIT_TERMINAL_PROMPT=0")
+	if !hasEnv(cmd.Env, "GIT_SSH_COMMAND") {
+		cmd.Env = append(cmd.Env, "GIT_SSH_COMMAND=ssh -o BatchMode=yes")
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	timer := time.AfterFunc(upstreamFetchTimeout, func() { cmd.Process.Kill() })
+	defer timer.Stop()
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("git fetch: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+func hasEnv(env []string, name string) bool {
+	for _, entry := range env {
+		if strings.HasPrefix(entry, name+"=") {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *upstreamWatch) status() (upstreamStatus, error) {
+	var status upstreamStatus
+	upstream, err := w.git("rev-parse", "--abbrev-ref", "--symbolic-full-name", "@{upstream}")
+	if err != nil {
+		return status, err
+	}
+	status.upstream = upstream
+	counts, err := w.git("rev-list", "--left-right", "--count", "@{upstream}...HEAD")
+	if err != nil {
+		return status, err
+	}
+	fields := strings.Fields(counts)
+	if len(fields) != 2 {
+		return status, fmt.Errorf("unexpected rev-list output: %q", counts)
+	}
+	status.behind, _ = strconv.Atoi(fields[0])
+	status.ahead, _ = strconv.Atoi(fields[1])
+	if status.ahead > 0 {
+		oldest, err := w.git("log", "--reverse", "--format=%ct", "@{upstream}..HEAD")
+		if err == nil {
+			first, _, _ := strings.Cut(oldest, "\n")
+			if seconds, err := strconv.ParseInt(first, 10, 64); err == nil {
+				status.oldestUnpushed = time.Unix(seconds, 0)
+			}
+		}
+	}
+	return status, nil
+}
+
+// run checks the branch every interval until ctx is done. Without an
+// upstream it warns once and stops
+func (w *upstreamWatch) run(ctx context.Context, interval time.Duration) {
+	logger := w.source.logger
+	if _, err := w.git("rev-parse", "--abbrev-ref", "@{upstream}"); err != nil {
+		logger.Warn().Msgf("Warning: %s has no upstream branch (%v). Skipping ahead/behind checks.", w.root, err)
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if !acquireExec(ctx, interval) {
+			logger.Debug().Msg("No exec slot free within the interval, skipping the ahead/behind check")
+			continue
+		}
+		w.check()
+		releaseExec()
+	}
+}
+
+func (w *upstreamWatch) check() {
+	logger := w.source.logger
+	if w.config.Fetch {
+		if err := w.fetch(); err != nil {
+			logger.Warn().Msgf("Warning: %v. Comparing with the last fetched state.", err)
+		}
+	}
+	status, err := w.status()
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to compare with the upstream branch")
+		return
+	}
+	logger.Debug().Msgf("%d commits ahead of and %d behind %s", status.ahead, status.behind, status.upstream)
+
+	var parts []string
+	if status.ahead > w.config.MaxAhead {
+		part := fmt.Sprintf("%d commits ahead of %s", status.ahead, status.upstream)
+		if !status.oldestUnpushed.IsZero() {
+			part += fmt.Sprintf(", oldest unpushed from %s ago", formatDuration(time.Since(status.oldestUnpushed)))
+		}
+		parts = append(parts, part)
+	}
+	if w.config.Fetch && status.behind > 0 {
+		parts = append(parts, fmt.Sprintf("%d commits behind %s", status.behind, status.upstream))
+	}
+	if len(parts) == 0 {
+		return
+	}
+	notifySource(w.source, MessageData{
+		Source: w.source.Name,
+		Kind:   kindUpstream,
+		Path:   w.root,
+		Detail: strings.Join(parts, "; "),
+	}, true)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	defaultGotifyTimeout          = 10
+	defaultGotifyChangePriority   = 2
+	defaultGotifyIdlePriority     = 5
+	defaultGotifyCriticalPriority = 8
+)
+
+type GotifyConfig struct {
+	URL              string `json:"url"`
+	Token            string `json:"token"`
+	Timeout          int    `json:"timeout"`
+	ChangePriority   int    `json:"change_priority"`
+	IdlePriority     int    `json:"idle_priority"`
+	CriticalPriority int    `json:"critical_priority"`
+}
+
+type gotifyNotifier struct {
+	config GotifyConfig
+	client *http.Client
+}
+
+func newGotifyNotifier(config GotifyConfig) (*gotifyNotifier, error) {
+	if config.URL == "" || config.Token == "" {
+		return nil, fmt.Errorf("gotify requires both url and token")
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaultGotifyTimeout
+	}
+	if config.ChangePriority == 0 {
+		config.ChangePriority = defaultGotifyChangePriority
+	}
+	if config.IdlePriority == 0 {
+		config.IdlePriority = defaultGotifyIdlePriority
+	}
+	if config.CriticalPriority == 0 {
+		config.CriticalPriority = defaultGotifyCriticalPriority
+	}
+
+	return &gotifyNotifier{
+		config: config,
+		client: &http.Client{Timeout: time.Duration(config.Timeout) * time.Second},
+	}, nil
+}
+
+func (g *gotifyNotifier) Name() string {
+	return "gotify"
+}
+
+func (g *gotifyNotifier) Notify(title, message string, data MessageData) error {
+	priority := g.config.ChangePriority
+	if data.Kind == kindIdle {
+		priority = g.config.IdlePriority
+	}
+	if data.Urgency == urgencyCritical {
+		priority = max(priority, g.config.CriticalPriority)
+	}
+
+	payload, err := json.Marshal(map[string]any{
+		"title":    title,
+		"message":  message,
+		"priority": priority,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, strings.TrimRight(g.config.URL, "/")+"/message", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gotify-Key", g.config.Token)
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("gotify returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var result struct {
+		ID int `json:"id"`
+	}
+	if err := json.Unmarshal(body, &result); err == nil {
+		log.Debug().Msgf("Gotify accepted message %d", result.ID)
+	}
+	return nil
+}
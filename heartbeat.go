@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	defaultHeartbeatInterval = 60
+	heartbeatTimeout         = 10 * time.Second
+)
+
+// HeartbeatConfig lets an external watchdog notice when MiniMon stops: File
+// is touched and URL (e.g. a healthchecks.io ping URL) is fetched every
+// Interval seconds. Either may be left out
+type HeartbeatConfig struct {
+	File     string `json:"file"`
+	URL      string `json:"url"`
+	Interval int    `json:"interval"`
+}
+
+func runHeartbeat(config HeartbeatConfig) {
+	if config.Interval <= 0 {
+		config.Interval = defaultHeartbeatInterval
+	}
+	client := &http.Client{Timeout: heartbeatTimeout}
+	failing := false
+
+	beat := func() {
+		var errs []string
+		if config.File != "" {
+			if err := touchFile(config.File); err != nil {
+				errs = append(errs, err.Error())
+			}
+		}
+		if config.URL != "" {
+			if err := pingURL(client, config.URL); err != nil {
+				errs = append(errs, err.Error())
+			}
+		}
+		// Only the first failure and the recovery are worth a log line
+		if len(errs) > 0 && !failing {
+			log.Warn().Msgf("Warning: heartbeat failed: %s", strings.Join(errs, "; "))
+		} else if len(errs) == 0 && failing {
+			log.Info().Msg("Heartbeat working again")
+		}
+		failing = len(errs) > 0
+	}
+
+	log.Info().Msgf("Sending a heartbeat every %ds", config.Interval)
+	beat()
+	for range time.Tick(time.Duration(config.Interval) * time.Second) {
+		beat()
+	}
+}
+
+func touchFile(path string) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	file.Close()
+	now := time.Now()
+	return os.Chtimes(path, now, now)
+}
+
+func pingURL(client *http.Client, url string) error {
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Default bucket bounds: intervals with 0, 1-5, 6-20 and more changes, and
+// idle streaks up to 5m, 15m, 1h, 4h and longer
+var (
+	defaultChangeBounds     = []float64{0, 5, 20}
+	defaultIdleStreakBounds = []float64{5, 15, 60, 240}
+)
+
+// HistogramConfig sets the upper bounds of the histogram buckets. Each
+// bucket holds the values up to its bound, and one more bucket the rest
+type HistogramConfig struct {
+	Changes     []float64 `json:"changes"`
+	IdleMinutes []float64 `json:"idle_minutes"`
+}
+
+func (c *HistogramConfig) withDefaults() (HistogramConfig, error) {
+	config := HistogramConfig{Changes: defaultChangeBounds, IdleMinutes: defaultIdleStreakBounds}
+	if c == nil {
+		return config, nil
+	}
+	if len(c.Changes) > 0 {
+		config.Changes = c.Changes
+	}
+	if len(c.IdleMinutes) > 0 {
+		config.IdleMinutes = c.IdleMinutes
+	}
+	for name, bounds := range map[string][]float64{"changes": config.Changes, "idle_minutes": config.IdleMinutes} {
+		for i := 1; i < len(bounds); i++ {
+			if bounds[i] <= bounds[i-1] {
+				return config, fmt.Errorf("histograms: %s bounds must be increasing", name)
+			}
+		}
+	}
+	return config, nil
+}
+
+// histogramBounds applies to every source, set from monitor_props
+var histogramBounds = HistogramConfig{Changes: defaultChangeBounds, IdleMinutes: defaultIdleStreakBounds}
+
+// histogram counts values per bucket. Counts has one entry per bound plus
+// the one above the last
+type histogram struct {
+	Bounds []float64 `json:"bounds"`
+	Counts []int     `json:"counts"`
+	Sum    float64   `json:"sum"`
+}
+
+func newHistogram(bounds []float64) histogram {
+	return histogram{Bounds: bounds, Counts: make([]int, len(bounds)+1)}
+}
+
+func (h *histogram) observe(value float64) {
+	h.Counts[sort.SearchFloat64s(h.Bounds, value)]++
+	h.Sum += value
+}
+
+func (h histogram) count() int {
+	total := 0
+	for _, count := range h.Counts {
+		total += count
+	}
+	return total
+}
+
+// summary renders the non-empty buckets, e.g. "0: 12, 1-5: 30, 21+: 1".
+// unit formats a bound
+func (h histogram) summary(integer bool, unit func(float64) string) string {
+	var parts []string
+	for i, count := range h.Counts {
+		if count == 0 {
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%s: %d", h.label(i, integer, unit), count))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// label names bucket i. Integer values such as changes don't fall between
+// bounds, so their buckets read "1-5" rather than "over 0 up to 5"
+func (h histogram) label(i int, integer bool, unit func(float64) string) string {
+	switch {
+	case i == len(h.Bounds) && integer:
+		return fmt.Sprintf("%s+", unit(h.Bounds[i-1]+1))
+	case i == len(h.Bounds):
+		return "over " + unit(h.Bounds[i-1])
+	case i == 0:
+		if integer && h.Bounds[0] <= 0 {
+			return unit(h.Bounds[0])
+		}
+		return "up to " + unit(h.Bounds[0])
+	case integer && h.Bounds[i-1]+1 == h.Bounds[i]:
+		return unit(h.Bounds[i])
+	case integer:
+		return unit(h.Bounds[i-1]+1) + "-" + unit(h.Bounds[i])
+	}
+	return unit(h.Bounds[i-1]) + "-" + unit(h.Bounds[i])
+}
+
+// activityHistograms are a source's changes per interval and the lengths
+// of its idle streaks, in minutes, for one local day. An idle streak is
+// counted once it ends
+type activityHistograms struct {
+	Day         string    `json:"day"`
+	Changes     histogram `json:"changes"`
+	IdleStreaks histogram `json:"idle_streak_minutes"`
+}
+
+func newActivityHistograms(now time.Time) activityHistograms {
+	return activityHistograms{
+		Day:         now.Format(time.DateOnly),
+		Changes:     newHistogram(histogramBounds.Changes),
+		IdleStreaks: newHistogram(histogramBounds.IdleMinutes),
+	}
+}
+
+// restoreHistograms picks up the day's histograms from the state file,
+// unless they are from another day or the bounds changed since
+func restoreHistograms(saved activityHistograms, now time.Time) activityHistograms {
+	fresh := newActivityHistograms(now)
+	if saved.Day != fresh.Day || !slices.Equal(saved.Changes.Bounds, fresh.Changes.Bounds) ||
+		!slices.Equal(saved.IdleStreaks.Bounds, fresh.IdleStreaks.Bounds) ||
+		len(saved.Changes.Counts) != len(fresh.Changes.Counts) || len(saved.IdleStreaks.Counts) != len(fresh.IdleStreaks.Counts) {
+		return fresh
+	}
+	return saved
+}
+
+// rollover starts the histograms over on a new day
+func (h *activityHistograms) rollover(now time.Time) {
+	if day := now.Format(time.DateOnly); day != h.Day {
+		*h = newActivityHistograms(now)
+	}
+}
+
+func (h activityHistograms) clone() activityHistograms {
+	h.Changes.Counts = slices.Clone(h.Changes.Counts)
+	h.IdleStreaks.Counts = slices.Clone(h.IdleStreaks.Counts)
+	return h
+}
+
+// summary is the daily summary's view, e.g. "intervals by changes 0: 12,
+// 1-5: 30; idle streaks up to 5m: 3, 1h-4h: 1"
+func (h activityHistograms) summary() string {
+	var parts []string
+	if h.Changes.count() > 0 {
+		parts = append(parts, "intervals by changes "+h.Changes.summary(true, func(v float64) string { return fmt.Sprintf("%g", v) }))
+	}
+	if h.IdleStreaks.count() > 0 {
+		parts = append(parts, "idle streaks "+h.IdleStreaks.summary(false, formatMinutes))
+	}
+	return strings.Join(parts, "; ")
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Periods history can group by
+var historyGroups = map[string]string{
+	"hour": "2006-01-02 15:00",
+	"day":  "2006-01-02",
+	"week": "",
+}
+
+// historyRow sums the intervals of one source within one period
+type historyRow struct {
+	Period    string `json:"period"`
+	Source    string `json:"source"`
+	Changes   int    `json:"changes"`
+	Files     int    `json:"files"`
+	Intervals int    `json:"intervals"`
+	Active    int    `json:"active"`
+	Notified  int    `json:"notified"`
+}
+
+// parseSince accepts a number of days like 7d, a duration like 12h or a
+// date, and returns the earliest time to include
+func parseSince(value string, now time.Time) (time.Time, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return time.Time{}, fmt.Errorf("invalid since: %s", value)
+		}
+		midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+		return midnight.AddDate(0, 0, -n), nil
+	}
+	if duration, err := time.ParseDuration(value); err == nil && duration >= 0 {
+		return now.Add(-duration), nil
+	}
+	if date, err := time.ParseInLocation("2006-01-02", value, now.Location()); err == nil {
+		return date, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid since: %s (expected e.g. 7d, 12h or 2024-05-01)", value)
+}
+
+// historyPeriod names the period t falls into
+func historyPeriod(t time.Time, groupBy string) string {
+	t = t.Local()
+	if groupBy == "week" {
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	}
+	return t.Format(historyGroups[groupBy])
+}
+
+// eventLogFiles returns the daily files of the event log from since on
+func eventLogFiles(path string, since time.Time) ([]string, error) {
+	ext := filepath.Ext(path)
+	prefix := strings.TrimSuffix(path, ext) + "-"
+	matches, err := filepath.Glob(prefix + "*" + ext)
+	if err != nil {
+		return nil, err
+	}
+	first := since.Local().Format("2006-01-02")
+	var files []string
+	for _, match := range matches {
+		day := strings.TrimSuffix(strings.TrimPrefix(match, prefix), ext)
+		if _, err := time.Parse("2006-01-02", day); err != nil || day < first {
+			continue
+		}
+		files = append(files, match)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// historySums adds up interval records per period and source
+type historySums struct {
+	groupBy string
+	byKey   map[[2]string]*historyRow
+}
+
+func newHistorySums(groupBy string) *historySums {
+	return &historySums{groupBy: groupBy, byKey: make(map[[2]string]*historyRow)}
+}
+
+func (h *historySums) add(record eventRecord) {
+	key := [2]string{historyPeriod(record.Timestamp, h.groupBy), record.Source}
+	row := h.byKey[key]
+	if row == nil {
+		row = &historyRow{Period: key[0], Source: key[1]}
+		h.byKey[key] = row
+	}
+	row.Intervals++
+	row.Changes += record.Events
+	row.Files += record.Files
+	if record.Kind == kindChange {
+		row.Active++
+	}
+	if record.Notified {
+		row.Notified++
+	}
+}
+
+// rows sorts by period, then source
+func (h *historySums) rows() []historyRow {
+	result := make([]historyRow, 0, len(h.byKey))
+	for _, row := range h.byKey {
+		result = append(result, *row)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Period != result[j].Period {
+			return result[i].Period < result[j].Period
+		}
+		return result[i].Source < result[j].Source
+	})
+	return result
+}
+
+// errNoHistory is returned when neither history_store nor event_log is set
+var errNoHistory = errors.New("no history: set history_store or event_log in monitor_props to record it")
+
+// intervalKinds are the kinds of the records monitors write once per
+// interval, which is what history, report and the weekly report sum
+var intervalKinds = map[string]bool{kindChange: true, kindIdle: true}
+
+// forEachRecord passes fn the interval records of source, or of every
+// source when it is empty, from since up to until (no end when zero), in
+// time order per source. They come from the history store when it is
+// configured and from the event log files otherwise
+func forEachRecord(props MonitorProps, source string, since, until time.Time, fn func(eventRecord)) error {
+	keep := func(record eventRecord) {
+		if !intervalKinds[record.Kind] || record.Session != nil || record.Timestamp.Before(since) ||
+			(!until.IsZero() && !record.Timestamp.Before(until)) || (source != "" && record.Source != source) {
+			return
+		}
+		fn(record)
+	}
+	switch {
+	case props.HistoryStore != nil:
+		// loadConfig already checked there is a path
+		path, _ := historyStorePath(props)
+		return queryRecords(path, source, since, until, keep)
+	case props.EventLog != "":
+		files, err := eventLogFiles(props.EventLog, since)
+		if err != nil {
+			return err
+		}
+		if !until.IsZero() {
+			// Files from until on would only be read to be filtered out
+			end := until.Add(-time.Nanosecond).Local().Format(time.DateOnly)
+			files = slices.DeleteFunc(files, func(path string) bool {
+				name := strings.TrimSuffix(path, filepath.Ext(path))
+				return name[len(name)-len(time.DateOnly):] > end
+			})
+		}
+		return readEventLog(files, keep)
+	}
+	return errNoHistory
+}
+
+// readEventLog passes fn every record of the given files. A line that
+// isn't a record, e.g. one cut short by a crash, is skipped with a warning
+func readEventLog(files []string, fn func(eventRecord)) error {
+	for _, path := range files {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		scanner := bufio.NewScanner(file)
+		for line := 1; scanner.Scan(); line++ {
+			var record eventRecord
+			if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %s:%d: %v. Skipping the line.\n", path, line, err)
+				continue
+			}
+			fn(record)
+		}
+		file.Close()
+		if err := scanner.Err(); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	return nil
+}
+
+// readHistory sums the interval records of source from since on
+func readHistory(props MonitorProps, source string, since time.Time, groupBy string) ([]historyRow, error) {
+	sums := newHistorySums(groupBy)
+	if err := forEachRecord(props, source, since, time.Time{}, sums.add); err != nil {
+		return nil, err
+	}
+	return sums.rows(), nil
+}
+
+// runHistory answers questions like "changes per day last week" from the
+// history store, or else the files of event_log
+func runHistory(configPath string, args []string) int {
+	flags := flag.NewFlagSet("history", flag.ContinueOnError)
+	source := flags.String("source", "", "only this source")
+	sinceFlag := flags.String("since", "7d", "how far back: days like 7d, a duration like 12h or a date")
+	groupBy := flags.String("group-by", "day", "period to sum over: hour, day or week")
+	asJSON := flags.Bool("json", false, "print the rows as JSON")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if _, ok := historyGroups[*groupBy]; !ok {
+		fmt.Fprintf(os.Stderr, "invalid group-by: %s (expected hour, day or week)\n", *groupBy)
+		return 2
+	}
+	since, err := parseSince(*sinceFlag, time.Now())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	config, err := loadConfig(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config %s: %v\n", configPath, err)
+		return 1
+	}
+	rows, err := readHistory(config.MonitorProps, *source, since, *groupBy)
+	if errors.Is(err, errNoHistory) {
+		fmt.Fprintln(os.Stderr, "No history: set history_store or event_log in monitor_props to record it")
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading history: %v\n", err)
+		return 1
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(rows)
+		return 0
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PERIOD\tSOURCE\tCHANGES\tFILES\tACTIVE\tINTERVALS\tNOTIFIED")
+	for _, row := range rows {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%d\t%d\n", row.Period, row.Source, row.Changes, row.Files, row.Active, row.Intervals, row.Notified)
+	}
+	w.Flush()
+	return 0
+}
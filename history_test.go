@@ -0,0 +1,36 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReadHistorySkipsMalformedLines(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "events-2024-05-01.jsonl")
+	lines := `{"ts":"2024-05-01T10:00:00Z","source":"thesis","kind":"change","events":3,"files":2,"notified":true}
+not json
+{"ts":"2024-05-01T10:05:00Z","source":"thesis","kind":"idle","events":0,"files":0}
+{"ts":"2024-05-01T10:10:00Z","source":"thesis","kind":"cha
+{"ts":"2024-05-01T10:15:00Z","source":"logs","kind":"change","events":1,"files":1}
+`
+	if err := os.WriteFile(path, []byte(lines), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := readHistory(MonitorProps{EventLog: filepath.Join(dir, "events.jsonl")}, "", time.Time{}, "day")
+	if err != nil {
+		t.Fatalf("readHistory: %v", err)
+	}
+	day := historyPeriod(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC), "day")
+	want := []historyRow{
+		{Period: day, Source: "logs", Changes: 1, Files: 1, Intervals: 1, Active: 1},
+		{Period: day, Source: "thesis", Changes: 3, Files: 2, Intervals: 2, Active: 1, Notified: 1},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows = %+v, want %+v", rows, want)
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	_ "modernc.org/sqlite"
+)
+
+const (
+	historyBatchSize     = 200
+	historyFlushInterval = 2 * time.Second
+	// Records beyond this many waiting are dropped rather than slowing
+	// down the monitors
+	historyQueueSize = 4096
+)
+
+// HistoryStoreConfig keeps the interval records in SQLite, which
+// minimon history queries instead of reading the event log files
+type HistoryStoreConfig struct {
+	// Path defaults to minimon-history.db next to state_file
+	Path string `json:"path,omitempty"`
+}
+
+// historyMigrations bring the schema up to date on open; PRAGMA
+// user_version holds how many have been applied. Only ever append
+var historyMigrations = []string{
+	`CREATE TABLE intervals (
+		time INTEGER NOT NULL,
+		source TEXT NOT NULL,
+		kind TEXT NOT NULL,
+		events INTEGER NOT NULL,
+		files INTEGER NOT NULL,
+		idle_minutes REAL NOT NULL,
+		notified INTEGER NOT NULL
+	)`,
+	`CREATE INDEX intervals_time ON intervals (time);
+	CREATE INDEX intervals_source_time ON intervals (source, time)`,
+}
+
+// historyStorePath is the configured path, or minimon-history.db in the
+// directory of the state file
+func historyStorePath(props MonitorProps) (string, error) {
+	if props.HistoryStore.Path != "" {
+		return props.HistoryStore.Path, nil
+	}
+	if props.StateFile == "" {
+		return "", fmt.Errorf("history_store needs a path when there is no state_file")
+	}
+	return filepath.Join(filepath.Dir(props.StateFile), "minimon-history.db"), nil
+}
+
+func openHistoryDB(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, err
+	}
+	if err := migrateHistory(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return db, nil
+}
+
+func migrateHistory(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	if version > len(historyMigrations) {
+		return fmt.Errorf("schema version %d is newer than this MiniMon knows (%d)", version, len(historyMigrations))
+	}
+	for ; version < len(historyMigrations); version++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(historyMigrations[version]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %v", version+1, err)
+		}
+		// PRAGMA doesn't take parameters
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version+1)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %v", version+1, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("migration %d: %v", version+1, err)
+		}
+	}
+	return nil
+}
+
+// historyStore writes the interval records from recordEvent in batches,
+// one transaction each, on its own goroutine
+type historyStore struct {
+	db      *sql.DB
+	records chan eventRecord
+	flush   chan chan struct{}
+	// dropped counts the records lost to a full queue until the writer
+	// catches up again
+	dropped atomic.Int64
+}
+
+var history *historyStore
+
+func startHistoryStore(path string) (*historyStore, error) {
+	db, err := openHistoryDB(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &historyStore{
+		db:      db,
+		records: make(chan eventRecord, historyQueueSize),
+		flush:   make(chan chan struct{}),
+	}
+	go s.run()
+	log.Info().Msgf("Recording history to %s", path)
+	return s, nil
+}
+
+// add never blocks: a monitor tick must not wait on the disk
+func (s *historyStore) add(record eventRecord) {
+	select {
+	case s.records <- record:
+	default:
+		if s.dropped.Add(1) == 1 {
+			log.Warn().Msgf("Warning: history store is %d records behind. Dropping records until it catches up.", historyQueueSize)
+		}
+	}
+}
+
+func (s *historyStore) run() {
+	ticker := time.NewTicker(historyFlushInterval)
+	defer ticker.Stop()
+
+	var batch []eventRecord
+	for {
+		select {
+		case record := <-s.records:
+			batch = append(batch, record)
+			if len(batch) >= historyBatchSize {
+				batch = s.write(batch)
+			}
+		case <-ticker.C:
+			batch = s.write(batch)
+		case done := <-s.flush:
+			for len(s.records) > 0 {
+				batch = append(batch, <-s.records)
+			}
+			s.write(batch)
+			s.db.Close()
+			close(done)
+			return
+		}
+	}
+}
+
+// write inserts batch in one transaction and returns it emptied. A batch
+// that fails is logged and dropped, so one bad write doesn't pile up
+func (s *historyStore) write(batch []eventRecord) []eventRecord {
+	if len(batch) == 0 {
+		return batch
+	}
+	if err := insertHistory(s.db, batch); err != nil {
+		log.Error().Err(err).Msgf("Failed to write %d records to the history store", len(batch))
+	}
+	if dropped := s.dropped.Swap(0); dropped > 0 {
+		log.Warn().Msgf("Warning: history store dropped %d records.", dropped)
+	}
+	return batch[:0]
+}
+
+func insertHistory(db *sql.DB, records []eventRecord) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare("INSERT INTO intervals (time, source, kind, events, files, idle_minutes, notified) VALUES (?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+	for _, r := range records {
+		if _, err := stmt.Exec(r.Timestamp.UnixMilli(), r.Source, r.Kind, r.Events, r.Files, r.IdleMinutes, r.Notified); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Close writes what is still queued and closes the database
+func (s *historyStore) Close() {
+	done := make(chan struct{})
+	s.flush <- done
+	<-done
+}
+
+// queryRecords passes fn the stored records of source, or of every source
+// when it is empty, from since up to until (no end when zero) in time order
+func queryRecords(path, source string, since, until time.Time, fn func(eventRecord)) error {
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("no history store at %s", path)
+	}
+	db, err := openHistoryDB(path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	query := "SELECT time, source, kind, events, files, idle_minutes, notified FROM intervals WHERE time >= ?"
+	args := []any{since.UnixMilli()}
+	if !until.IsZero() {
+		query += " AND time < ?"
+		args = append(args, until.UnixMilli())
+	}
+	if source != "" {
+		query += " AND source = ?"
+		args = append(args, source)
+	}
+	rows, err := db.Query(query+" ORDER BY time", args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var record eventRecord
+		var millis int64
+		if err := rows.Scan(&millis, &record.Source, &record.Kind, &record.Events, &record.Files, &record.IdleMinutes, &record.Notified); err != nil {
+			return err
+		}
+		record.Timestamp = time.UnixMilli(millis)
+		fn(record)
+	}
+	return rows.Err()
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestHistoryMigrations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	// Opening again must not apply anything twice
+	for range 2 {
+		db, err := openHistoryDB(path)
+		if err != nil {
+			t.Fatalf("openHistoryDB: %v", err)
+		}
+		var version int
+		if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+			t.Fatal(err)
+		}
+		if version != len(historyMigrations) {
+			t.Errorf("user_version = %d, want %d", version, len(historyMigrations))
+		}
+		var mode string
+		if err := db.QueryRow("PRAGMA journal_mode").Scan(&mode); err != nil {
+			t.Fatal(err)
+		}
+		if mode != "wal" {
+			t.Errorf("journal_mode = %q, want wal", mode)
+		}
+		db.Close()
+	}
+
+	db, err := openHistoryDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("PRAGMA user_version = 99"); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	if _, err := openHistoryDB(path); err == nil {
+		t.Error("opening a newer schema succeeded")
+	}
+}
+
+func TestHistoryStorePath(t *testing.T) {
+	tests := []struct {
+		name    string
+		props   MonitorProps
+		want    string
+		wantErr bool
+	}{
+		{"explicit path", MonitorProps{HistoryStore: &HistoryStoreConfig{Path: "/data/h.db"}, StateFile: "/state/state.json"}, "/data/h.db", false},
+		{"next to the state file", MonitorProps{HistoryStore: &HistoryStoreConfig{}, StateFile: "/state/state.json"}, filepath.Join("/state", "minimon-history.db"), false},
+		{"no path and no state file", MonitorProps{HistoryStore: &HistoryStoreConfig{}}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := historyStorePath(tt.props)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("path = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHistoryStoreQuery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	store, err := startHistoryStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.Local)
+	// More than one batch, all written by Close
+	for i := range historyBatchSize + 50 {
+		record := eventRecord{Timestamp: start.Add(time.Duration(i) * time.Minute), Source: "thesis", Kind: kindIdle}
+		if i%2 == 0 {
+			record.Kind, record.Events, record.Files = kindChange, 2, 1
+		}
+		store.add(record)
+	}
+	store.add(eventRecord{Timestamp: start, Source: "logs", Kind: kindChange, Events: 5, Files: 3, Notified: true})
+	store.Close()
+
+	props := MonitorProps{HistoryStore: &HistoryStoreConfig{Path: path}}
+	rows, err := readHistory(props, "", start, "day")
+	if err != nil {
+		t.Fatalf("readHistory: %v", err)
+	}
+	day := historyPeriod(start, "day")
+	want := []historyRow{
+		{Period: day, Source: "logs", Changes: 5, Files: 3, Intervals: 1, Active: 1, Notified: 1},
+		{Period: day, Source: "thesis", Changes: 250, Files: 125, Intervals: 250, Active: 125},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows = %+v, want %+v", rows, want)
+	}
+
+	rows, err = readHistory(props, "logs", start.Add(time.Minute), "day")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 0 {
+		t.Errorf("rows after the logs record = %+v, want none", rows)
+	}
+
+	missing := MonitorProps{HistoryStore: &HistoryStoreConfig{Path: filepath.Join(t.TempDir(), "missing.db")}}
+	if _, err := readHistory(missing, "", start, "day"); err == nil {
+		t.Error("querying a missing store succeeded")
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const builtinIconPrefix = "builtin:"
+
+//go:embed icons/*.png
+var builtinIcons embed.FS
+
+// Notification daemons need a file path, so built-in icons are written to
+// the cache dir the first time they are used
+var (
+	iconPathsMu sync.Mutex
+	iconPaths   = make(map[string]string)
+)
+
+func validIcon(icon string) error {
+	if name, ok := strings.CutPrefix(icon, builtinIconPrefix); ok {
+		if _, err := builtinIcons.ReadFile("icons/" + name + ".png"); err != nil {
+			return fmt.Errorf("unknown built-in icon: %s", name)
+		}
+	}
+	return nil
+}
+
+// iconFileMissing reports whether icon names a file that doesn't exist
+func iconFileMissing(icon string) bool {
+	if icon == "" || strings.HasPrefix(icon, builtinIconPrefix) {
+		return false
+	}
+	_, err := os.Stat(icon)
+	return err != nil
+}
+
+// iconPath turns an "icon" setting into an absolute path for the
+// notification daemon
+func iconPath(icon string) string {
+	name, ok := strings.CutPrefix(icon, builtinIconPrefix)
+	if !ok {
+		if abs, err := filepath.Abs(icon); err == nil && icon != "" {
+			return abs
+		}
+		return icon
+	}
+
+	iconPathsMu.Lock()
+	defer iconPathsMu.Unlock()
+	if path, ok := iconPaths[name]; ok {
+		return path
+	}
+
+	data, err := builtinIcons.ReadFile("icons/" + name + ".png")
+	if err != nil {
+		return ""
+	}
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		cacheDir = os.TempDir()
+	}
+	path := filepath.Join(cacheDir, "minimon", "icons", name+".png")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return ""
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return ""
+	}
+	iconPaths[name] = path
+	return path
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// Idle backoff modes controlling how often idle notifications repeat
+const (
+	idleBackoffFixed       = "fixed"
+	idleBackoffLinear      = "linear"
+	idleBackoffExponential = "exponential"
+)
+
+// Idle modes: an idle notification every interval, once per idle streak,
+// or on the idle_backoff schedule
+const (
+	idleModeRepeat  = "repeat"
+	idleModeOnce    = "once"
+	idleModeBackoff = "backoff"
+)
+
+// resolveIdleMode validates idle_mode and fills it in. Configs from before
+// idle_mode that only set idle_backoff keep their schedule
+func resolveIdleMode(config *NotificationConfig) error {
+	if err := validIdleBackoff(config.IdleBackoff); err != nil {
+		return err
+	}
+	backoff := config.IdleBackoff != "" && config.IdleBackoff != idleBackoffFixed
+	switch config.IdleMode {
+	case "":
+		config.IdleMode = idleModeRepeat
+		if backoff {
+			config.IdleMode = idleModeBackoff
+		}
+	case idleModeRepeat, idleModeOnce:
+		if backoff {
+			return fmt.Errorf("idle_backoff needs idle_mode %q", idleModeBackoff)
+		}
+	case idleModeBackoff:
+		if config.IdleBackoff == "" {
+			config.IdleBackoff = idleBackoffExponential
+		}
+	default:
+		return fmt.Errorf("unknown idle_mode: %s", config.IdleMode)
+	}
+	return nil
+}
+
+func validIdleBackoff(backoff string) error {
+	switch backoff {
+	case "", idleBackoffFixed, idleBackoffLinear, idleBackoffExponential:
+		return nil
+	}
+	return fmt.Errorf("unknown idle_backoff: %s", backoff)
+}
+
+// idleNotificationDue reports whether the n-th consecutive idle interval
+// (counting from 1) should produce an idle notification.
+//
+//	fixed:       every interval
+//	linear:      1, 3, 6, 10, ... (gaps grow by one interval)
+//	exponential: 1, 3, 7, 15, ... (gaps double)
+func idleNotificationDue(backoff string, n int) bool {
+	if n < 1 {
+		return false
+	}
+	switch backoff {
+	case idleBackoffLinear:
+		k := int((math.Sqrt(8*float64(n)+1) - 1) / 2)
+		return k*(k+1)/2 == n
+	case idleBackoffExponential:
+		return n&(n+1) == 0
+	default:
+		return true
+	}
+}
+
+// How exit_on_max_idle sources combine when several are configured
+const (
+	exitWhenAny = "any"
+	exitWhenAll = "all"
+)
+
+func validExitWhen(exitWhen string) error {
+	switch exitWhen {
+	case "", exitWhenAny, exitWhenAll:
+		return nil
+	}
+	return fmt.Errorf("unknown exit_when: %s", exitWhen)
+}
+
+// idleExitTracker decides when MiniMon should shut down because its
+// exit_on_max_idle sources have been idle for max_idle_time
+type idleExitTracker struct {
+	mu         sync.Mutex
+	requireAll bool
+	idle       map[string]bool
+}
+
+var idleExit = &idleExitTracker{idle: make(map[string]bool)}
+
+func (t *idleExitTracker) register(name string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.idle[name] = false
+}
+
+// unregister drops a source that didn't start, so exit_when all doesn't
+// wait for it forever
+func (t *idleExitTracker) unregister(name string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.idle, name)
+}
+
+// reached marks a source as having hit max_idle_time and reports whether
+// that completes the exit condition
+func (t *idleExitTracker) reached(name string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.idle[name] = true
+	if !t.requireAll {
+		return true
+	}
+	for _, idle := range t.idle {
+		if !idle {
+			return false
+		}
+	}
+	return true
+}
+
+func (t *idleExitTracker) reset(name string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.idle[name]; ok {
+		t.idle[name] = false
+	}
+}
+
+// exitOnIdle sends the source's final idle notification and shuts MiniMon
+// down once the exit condition is met
+func exitOnIdle(source Source, idleMinutes float64) {
+	exit := idleExit.reached(source.Name)
+	detail := fmt.Sprintf("idle for %s, waiting for the other sources", formatMinutes(idleMinutes))
+	if exit {
+		detail = fmt.Sprintf("idle for %s, exiting", formatMinutes(idleMinutes))
+	}
+	notifySource(source, MessageData{
+		Source:  source.Name,
+		Kind:    kindIdle,
+		Path:    source.Path,
+		Minutes: idleMinutes,
+		Detail:  detail,
+	}, true)
+	if exit {
+		requestShutdown(fmt.Sprintf("%s idle for %s", source.Name, formatMinutes(idleMinutes)))
+	}
+}
+
+// A tick arriving this many intervals after the previous one means the
+// machine was most likely suspended in between
+const suspendGapFactor = 3
+
+// skipAfterSuspend drops the idle notification of the first tick after a
+// suspend instead of reporting the whole night as idle time at once
+var skipAfterSuspend bool
+
+// idleClock measures idle time from the wall-clock time of the last change
+// rather than by adding up ticks, so time spent suspended is counted. The
+// clock is a field so the suspend handling can be driven by a fake one.
+type idleClock struct {
+	now      func() time.Time
+	interval time.Duration
+	since    time.Time // last change, or when monitoring started
+	lastTick time.Time
+	previous float64       // idle minutes at the tick before lastTick
+	elapsed  time.Duration // wall time between the last two ticks
+}
+
+func newIdleClock(interval time.Duration, now func() time.Time) *idleClock {
+	// Round(0) drops the monotonic reading, which stops while suspended
+	start := now().Round(0)
+	return &idleClock{now: now, interval: interval, since: start, lastTick: start}
+}
+
+func (c *idleClock) reset() {
+	c.since = c.now().Round(0)
+}
+
+// tick records a ticker tick and returns how much later than expected it
+// arrived when that points to a suspend, or zero otherwise
+func (c *idleClock) tick() time.Duration {
+	now := c.now().Round(0)
+	c.previous = c.minutes()
+	c.elapsed = now.Sub(c.lastTick)
+	c.lastTick = now
+	if c.interval > 0 && c.elapsed > suspendGapFactor*c.interval {
+		return c.elapsed - c.interval
+	}
+	return 0
+}
+
+// streak is how long the source has been idle right now
+func (c *idleClock) streak() time.Duration {
+	return c.now().Round(0).Sub(c.since)
+}
+
+// minutes is the idle time as of the last tick
+func (c *idleClock) minutes() float64 {
+	return max(c.lastTick.Sub(c.since).Minutes(), 0)
+}
+
+// crossed reports whether the last tick took the idle time to limit
+// minutes, so one-off actions fire even when a suspend jumps past it
+func (c *idleClock) crossed(limit float64) bool {
+	return c.previous < limit && c.minutes() >= limit
+}
+
+// logSuspendGap logs a detected suspend and reports whether the tick's
+// idle notification should be skipped
+func logSuspendGap(logger zerolog.Logger, gap time.Duration) bool {
+	if gap <= 0 {
+		return false
+	}
+	logger.Info().Msgf("Tick arrived %s late, the system was probably suspended", formatDuration(gap))
+	return skipAfterSuspend
+}
+
+// sendResume notifies the source's on_resume entries that changes ended an
+// idle streak. Callers only do so after at least one idle interval
+func sendResume(source Source, streak time.Duration) {
+	source.logger.Info().Msgf("Changes after %s idle", formatDuration(streak))
+	notifySource(source, MessageData{
+		Source:  source.Name,
+		Kind:    kindResume,
+		Path:    source.Path,
+		Minutes: streak.Minutes(),
+		Detail:  fmt.Sprintf("back after %s idle", formatDuration(streak)),
+	}, false)
+}
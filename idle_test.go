@@ -0,0 +1,215 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestIdleNotificationDue(t *testing.T) {
+	tests := []struct {
+		backoff string
+		due     []int // due intervals among the first 20
+	}{
+		{idleBackoffFixed, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20}},
+		{"", []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20}},
+		{idleBackoffLinear, []int{1, 3, 6, 10, 15}},
+		{idleBackoffExponential, []int{1, 3, 7, 15}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.backoff, func(t *testing.T) {
+			if idleNotificationDue(tt.backoff, 0) {
+				t.Error("due before the first idle interval")
+			}
+			var due []int
+			for n := 1; n <= 20; n++ {
+				if idleNotificationDue(tt.backoff, n) {
+					due = append(due, n)
+				}
+			}
+			if !reflect.DeepEqual(due, tt.due) {
+				t.Errorf("due at %v, want %v", due, tt.due)
+			}
+		})
+	}
+}
+
+func TestValidIdleBackoff(t *testing.T) {
+	for _, backoff := range []string{"", idleBackoffFixed, idleBackoffLinear, idleBackoffExponential} {
+		if err := validIdleBackoff(backoff); err != nil {
+			t.Errorf("validIdleBackoff(%q) = %v", backoff, err)
+		}
+	}
+	if validIdleBackoff("fibonacci") == nil {
+		t.Error("unknown idle_backoff accepted")
+	}
+}
+
+func TestResolveIdleMode(t *testing.T) {
+	tests := []struct {
+		name        string
+		mode        string
+		backoff     string
+		wantMode    string
+		wantBackoff string
+		wantErr     bool
+	}{
+		{"default", "", "", idleModeRepeat, "", false},
+		{"fixed backoff is repeat", "", idleBackoffFixed, idleModeRepeat, idleBackoffFixed, false},
+		{"legacy backoff", "", idleBackoffLinear, idleModeBackoff, idleBackoffLinear, false},
+		{"repeat", idleModeRepeat, "", idleModeRepeat, "", false},
+		{"once", idleModeOnce, "", idleModeOnce, "", false},
+		{"once with fixed backoff", idleModeOnce, idleBackoffFixed, idleModeOnce, idleBackoffFixed, false},
+		{"backoff defaults to exponential", idleModeBackoff, "", idleModeBackoff, idleBackoffExponential, false},
+		{"backoff keeps its schedule", idleModeBackoff, idleBackoffLinear, idleModeBackoff, idleBackoffLinear, false},
+		{"once with a schedule", idleModeOnce, idleBackoffExponential, "", "", true},
+		{"repeat with a schedule", idleModeRepeat, idleBackoffLinear, "", "", true},
+		{"unknown mode", "sometimes", "", "", "", true},
+		{"unknown backoff", idleModeBackoff, "fibonacci", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := NotificationConfig{IdleMode: tt.mode, IdleBackoff: tt.backoff}
+			err := resolveIdleMode(&config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if config.IdleMode != tt.wantMode || config.IdleBackoff != tt.wantBackoff {
+				t.Errorf("idle_mode %q, idle_backoff %q, want %q, %q", config.IdleMode, config.IdleBackoff, tt.wantMode, tt.wantBackoff)
+			}
+		})
+	}
+}
+
+// fakeClock is a wall clock tests move by hand
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func TestIdleClock(t *testing.T) {
+	const interval = time.Minute
+	type step struct {
+		after   time.Duration // wall time since the previous step
+		change  bool          // a change arrived before the tick
+		gap     time.Duration // tick() result, the suspend lateness
+		minutes float64
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"regular ticks", []step{
+			{interval, false, 0, 1},
+			{interval, false, 0, 2},
+			{interval, false, 0, 3},
+		}},
+		{"change resets", []step{
+			{interval, false, 0, 1},
+			{interval, true, 0, 0},
+			{interval, false, 0, 1},
+		}},
+		// A late tick still counts all the wall time
+		{"late tick", []step{
+			{interval, false, 0, 1},
+			{2*interval + 30*time.Second, false, 0, 3.5},
+		}},
+		// Ticks the ticker dropped while the machine slept
+		{"suspend", []step{
+			{interval, false, 0, 1},
+			{8 * time.Hour, false, 8*time.Hour - interval, 481},
+			{interval, false, 0, 482},
+		}},
+		{"just under the suspend gap", []step{
+			{suspendGapFactor * interval, false, 0, 3},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := &fakeClock{t: time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)}
+			idle := newIdleClock(interval, clock.now)
+			for i, s := range tt.steps {
+				clock.advance(s.after)
+				if s.change {
+					idle.reset()
+				}
+				if gap := idle.tick(); gap != s.gap {
+					t.Errorf("step %d: gap = %v, want %v", i, gap, s.gap)
+				}
+				if minutes := idle.minutes(); minutes != s.minutes {
+					t.Errorf("step %d: minutes = %v, want %v", i, minutes, s.minutes)
+				}
+			}
+		})
+	}
+}
+
+func TestIdleClockCrossed(t *testing.T) {
+	tests := []struct {
+		name    string
+		ticks   []time.Duration
+		limit   float64
+		crossed []bool
+	}{
+		{"reached on a tick", []time.Duration{time.Minute, time.Minute, time.Minute}, 2, []bool{false, true, false}},
+		// A suspend jumping past the limit still fires once
+		{"jumped past", []time.Duration{time.Minute, time.Hour, time.Minute}, 30, []bool{false, true, false}},
+		{"never reached", []time.Duration{time.Minute, time.Minute}, 5, []bool{false, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := &fakeClock{t: time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)}
+			idle := newIdleClock(time.Minute, clock.now)
+			for i, d := range tt.ticks {
+				clock.advance(d)
+				idle.tick()
+				if got := idle.crossed(tt.limit); got != tt.crossed[i] {
+					t.Errorf("tick %d: crossed = %v, want %v", i, got, tt.crossed[i])
+				}
+			}
+		})
+	}
+}
+
+func TestIdleClockStreak(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)}
+	idle := newIdleClock(time.Minute, clock.now)
+	clock.advance(time.Minute)
+	idle.tick()
+	// The streak runs between ticks, minutes only moves on a tick
+	clock.advance(30 * time.Second)
+	if streak := idle.streak(); streak != 90*time.Second {
+		t.Errorf("streak = %v, want 1m30s", streak)
+	}
+	if minutes := idle.minutes(); minutes != 1 {
+		t.Errorf("minutes = %v, want 1", minutes)
+	}
+}
+
+func TestIdleExitAll(t *testing.T) {
+	tests := []struct {
+		name       string
+		unregister []string
+		want       bool
+	}{
+		{"waits for every source", nil, false},
+		{"skips a source that didn't start", []string{"missing"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := &idleExitTracker{requireAll: true, idle: make(map[string]bool)}
+			for _, name := range []string{"thesis", "missing"} {
+				tracker.register(name)
+			}
+			for _, name := range tt.unregister {
+				tracker.unregister(name)
+			}
+			if got := tracker.reached("thesis"); got != tt.want {
+				t.Errorf("reached = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// SourceDefaults is the top-level "defaults" block, merged under every
+// source of the file it appears in
+type SourceDefaults struct {
+	NotificationConfig NotificationConfig `json:"notification_config"`
+}
+
+// readConfigFile reads path and the files it includes. Included files
+// only contribute monitor_sources, with their own defaults applied first;
+// chain holds the files currently being read to catch include cycles
+func readConfigFile(path string, chain []string) (*Config, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	if slices.Contains(chain, absPath) {
+		return nil, fmt.Errorf("circular include: %s", strings.Join(append(chain, absPath), " -> "))
+	}
+	chain = append(chain, absPath)
+
+	configData, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config Config
+	if err := json.Unmarshal(configData, &config); err != nil {
+		if len(chain) > 1 {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		return nil, err
+	}
+
+	resolveSourcePaths(config.MonitorSources, filepath.Dir(absPath))
+
+	for _, include := range config.Include {
+		include = expandPath(include)
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(filepath.Dir(absPath), include)
+		}
+		included, err := readConfigFile(include, chain)
+		if err != nil {
+			return nil, err
+		}
+		config.MonitorSources = append(config.MonitorSources, included.MonitorSources...)
+	}
+
+	if config.Defaults != nil {
+		for i := range config.MonitorSources {
+			mergeNotificationDefaults(&config.MonitorSources[i].NotificationConfig, config.Defaults.NotificationConfig)
+		}
+	}
+	return &config, nil
+}
+
+// mergeNotificationDefaults fills the fields a source left unset from the
+// defaults. A source's own notification_set replaces the default one
+// rather than adding to it
+func mergeNotificationDefaults(config *NotificationConfig, defaults NotificationConfig) {
+	if !config.intervalSet {
+		config.NotificationInterval = defaults.NotificationInterval
+		config.intervalSet = defaults.intervalSet
+	}
+	if !config.maxIdleSet {
+		config.MaxIdleTime = defaults.MaxIdleTime
+		config.maxIdleSet = defaults.maxIdleSet
+	}
+	if config.IdleMode == "" {
+		config.IdleMode = defaults.IdleMode
+	}
+	if config.IdleBackoff == "" {
+		config.IdleBackoff = defaults.IdleBackoff
+	}
+	if config.MaxNotificationsPerHour == 0 {
+		config.MaxNotificationsPerHour = defaults.MaxNotificationsPerHour
+	}
+	if config.TimeUnit == "" {
+		config.TimeUnit = defaults.TimeUnit
+	}
+	if config.OnError == "" {
+		config.OnError = defaults.OnError
+	}
+	if config.OnErrorRecover == "" {
+		config.OnErrorRecover = defaults.OnErrorRecover
+	}
+	if config.ErrorThreshold == 0 {
+		config.ErrorThreshold = defaults.ErrorThreshold
+	}
+	if len(config.NotificationSet) == 0 {
+		// Sources get their own copy since loading fills in each entry
+		config.NotificationSet = slices.Clone(defaults.NotificationSet)
+	}
+}
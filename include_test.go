@@ -0,0 +1,118 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfigFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		writeTestFile(t, dir, name, content)
+	}
+	return dir
+}
+
+func TestReadConfigFileIncludes(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"config.json": `{
+			"include": ["projects/web.json"],
+			"defaults": {"notification_config": {"notification_interval": 600, "idle_mode": "once", "notification_set": [{"on_change": "default"}]}},
+			"monitor_sources": [{"name": "main", "source_type": "dir", "path": "src", "notification_config": {"notification_interval": 0}}]
+		}`,
+		"projects/web.json": `{
+			"defaults": {"notification_config": {"idle_mode": "repeat"}},
+			"monitor_sources": [
+				{"name": "web", "source_type": "dir", "path": "web"},
+				{"name": "api", "source_type": "dir", "path": "/srv/api", "notification_config": {"notification_set": [{"on_change": "own"}]}}
+			]
+		}`,
+	})
+	config, err := readConfigFile(filepath.Join(dir, "config.json"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		path     string
+		interval int
+		idleMode string
+		set      string
+	}{
+		// An explicit 0 is a setting, not a gap the defaults fill
+		{"main", filepath.Join(dir, "src"), 0, "once", "default"},
+		// Relative to the included file, its own defaults first
+		{"web", filepath.Join(dir, "projects", "web"), 600, "repeat", "default"},
+		{"api", "/srv/api", 600, "repeat", "own"},
+	}
+	if len(config.MonitorSources) != len(tests) {
+		t.Fatalf("got %d sources, want %d", len(config.MonitorSources), len(tests))
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := config.MonitorSources[i]
+			notification := source.NotificationConfig
+			if source.Name != tt.name || source.Path != tt.path {
+				t.Errorf("source = %s at %s, want %s at %s", source.Name, source.Path, tt.name, tt.path)
+			}
+			if notification.NotificationInterval != tt.interval || notification.IdleMode != tt.idleMode {
+				t.Errorf("interval %d, idle_mode %q, want %d, %q", notification.NotificationInterval, notification.IdleMode, tt.interval, tt.idleMode)
+			}
+			if len(notification.NotificationSet) != 1 || notification.NotificationSet[0].OnChange != tt.set {
+				t.Errorf("notification_set = %+v, want only %q", notification.NotificationSet, tt.set)
+			}
+		})
+	}
+}
+
+func TestReadConfigFileIncludeErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{"self include", map[string]string{
+			"config.json": `{"include": ["config.json"]}`,
+		}, "circular include"},
+		{"cycle", map[string]string{
+			"config.json": `{"include": ["a.json"]}`,
+			"a.json":      `{"include": ["sub/b.json"]}`,
+			"sub/b.json":  `{"include": ["../a.json"]}`,
+		}, "a.json -> "},
+		{"broken include", map[string]string{
+			"config.json": `{"include": ["a.json"]}`,
+			"a.json":      `{"monitor_sources": [}`,
+		}, "a.json: "},
+		{"missing include", map[string]string{
+			"config.json": `{"include": ["gone.json"]}`,
+		}, "gone.json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeConfigFiles(t, tt.files)
+			_, err := readConfigFile(filepath.Join(dir, "config.json"), nil)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadConfigFileDiamondInclude(t *testing.T) {
+	// The same file included twice without a cycle is fine
+	dir := writeConfigFiles(t, map[string]string{
+		"config.json": `{"include": ["a.json", "b.json"]}`,
+		"a.json":      `{"include": ["shared.json"]}`,
+		"b.json":      `{"include": ["shared.json"]}`,
+		"shared.json": `{"monitor_sources": [{"name": "shared", "source_type": "dir", "path": "x"}]}`,
+	})
+	config, err := readConfigFile(filepath.Join(dir, "config.json"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.MonitorSources) != 2 {
+		t.Errorf("got %d sources, want the shared one twice", len(config.MonitorSources))
+	}
+}
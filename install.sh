@@ -23,7 +23,8 @@ go mod init minimon
 go get github.com/fsnotify/fsnotify
 go get github.com/gen2brain/beeep
 go get github.com/rs/zerolog/log
-go build -o "$MINIMON_BINARY" minimon.go
+go get github.com/eclipse/paho.mqtt.golang
+go build -ldflags "-X main.commit=$(git rev-parse --short HEAD 2>/dev/null) -X main.buildDate=$(date -u +%F)" -o "$MINIMON_BINARY" .
 
 # Ensure the build was successful
 if [ $? -ne 0 ]; then
@@ -39,10 +40,12 @@ Description=MiniMon Log Monitoring Service for $USERNAME
 After=network.target
 
 [Service]
+Type=notify
 ExecStart=$MINIMON_BINARY
 WorkingDirectory=$MINIMON_DIR
 Environment="MINIMON_CONFIG=$CONFIG_PATH"
 Restart=always
+WatchdogSec=120
 User=$USERNAME
 Group=$GROUP
 KillSignal=SIGINT
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// What happens to a desktop notification while the session is locked or
+// in do-not-disturb mode
+const (
+	whenLockedQueue = "queue"
+	whenLockedDrop  = "drop"
+	whenLockedSend  = "send"
+)
+
+// How often a held notification checks whether the session is back
+const lockPollInterval = 15 * time.Second
+
+func validWhenLocked(mode string) error {
+	switch mode {
+	case "", whenLockedQueue, whenLockedDrop, whenLockedSend:
+		return nil
+	}
+	return fmt.Errorf("unknown when_locked: %s", mode)
+}
+
+// defaultWhenLocked applies to entries without their own when_locked
+var defaultWhenLocked = whenLockedQueue
+
+type heldKey struct {
+	source string
+	entry  int
+}
+
+type heldNotification struct {
+	title   string
+	message string
+	data    MessageData
+}
+
+// lockHold keeps the most recent desktop notification of each entry while
+// the session is locked and delivers them once it isn't
+type lockHold struct {
+	mu      sync.Mutex
+	held    map[heldKey]heldNotification
+	order   []heldKey
+	polling bool
+}
+
+var lockedDesktop = &lockHold{held: make(map[heldKey]heldNotification)}
+
+// deliver sends the notification now unless the desktop is locked or in
+// do-not-disturb mode, in which case it is queued or dropped
+func (h *lockHold) deliver(title, message string, data MessageData) error {
+	mode := data.whenLocked
+	if mode == "" {
+		mode = defaultWhenLocked
+	}
+	if mode == whenLockedSend {
+		return showDesktop(title, message, data)
+	}
+	reason := desktopBlocked()
+	if reason == "" {
+		return showDesktop(title, message, data)
+	}
+	if mode == whenLockedDrop {
+		log.Debug().Msgf("Dropping desktop notification for %s, %s", data.Source, reason)
+		return nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	key := heldKey{source: data.Source, entry: data.entry}
+	if _, ok := h.held[key]; !ok {
+		h.order = append(h.order, key)
+	}
+	h.held[key] = heldNotification{title: title, message: message, data: data}
+	log.Debug().Msgf("Holding desktop notification for %s until the session is available, %s", data.Source, reason)
+	if !h.polling {
+		h.polling = true
+		go h.waitForUnlock()
+	}
+	return nil
+}
+
+func (h *lockHold) waitForUnlock() {
+	ticker := time.NewTicker(lockPollInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if desktopBlocked() != "" {
+			continue
+		}
+		h.mu.Lock()
+		held := make([]heldNotification, 0, len(h.order))
+		for _, key := range h.order {
+			held = append(held, h.held[key])
+		}
+		clear(h.held)
+		h.order = nil
+		h.polling = false
+		h.mu.Unlock()
+
+		log.Info().Msgf("Session available again, delivering %d held notifications", len(held))
+		for _, n := range held {
+			if err := guardDesktop(func() error { return showDesktop(n.title, n.message, n.data) }); err != nil {
+				log.Error().Err(err).Msgf("Failed to deliver held notification for %s", n.data.Source)
+			}
+		}
+		return
+	}
+}
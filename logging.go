@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// logFactory hands out loggers so each source can have its own level and,
+// optionally, its own file while sharing the main log output by default
+type logFactory struct {
+	level  zerolog.Level
+	out    io.Writer
+	logDir string
+	// Rotation limits for every file opened here, from monitor_props
+	maxSize int64
+	backups int
+	files   map[string]*logFile
+	// fallback explains why logs went somewhere other than log_dir
+	fallback error
+}
+
+var logs = &logFactory{level: zerolog.InfoLevel, out: os.Stderr, maxSize: defaultLogMaxSize << 20, backups: defaultLogBackups}
+
+func parseLogLevel(level string) (zerolog.Level, error) {
+	switch level {
+	case "", "info", "console":
+		return zerolog.InfoLevel, nil
+	case "debug":
+		return zerolog.DebugLevel, nil
+	case "warn":
+		return zerolog.WarnLevel, nil
+	case "error":
+		return zerolog.ErrorLevel, nil
+	}
+	return zerolog.InfoLevel, fmt.Errorf("unknown log level: %s", level)
+}
+
+func setupLogging(props MonitorProps) error {
+	logs.level, _ = parseLogLevel(props.LogLevel)
+	if props.LogMaxSize != 0 {
+		logs.maxSize = int64(props.LogMaxSize) << 20
+	}
+	if props.LogBackups != nil {
+		logs.backups = max(*props.LogBackups, 0)
+	}
+	defer func() {
+		log.Logger = zerolog.New(logs.out).Level(logs.level).With().Timestamp().Logger()
+	}()
+
+	// The dashboard owns the terminal, so logs only go to log_dir then
+	dashboard := props.ConsoleDashboard && isTerminal(os.Stdout) && props.Output == outputNone
+	if props.LogLevel == "console" && !dashboard {
+		// Keep stdout to the stream when there is one
+		out := os.Stdout
+		if props.Output != outputNone {
+			out = os.Stderr
+		}
+		logs.out = zerolog.ConsoleWriter{Out: out}
+		return nil
+	}
+	if props.LogDir == "" {
+		if dashboard {
+			logs.out = io.Discard
+		}
+		return nil
+	}
+
+	logDir := props.LogDir
+	if err := prepareLogDir(logDir, props.CreateLogDir == nil || *props.CreateLogDir); err != nil {
+		// Logging somewhere known beats finding out days later that
+		// nothing was written
+		logDir = fallbackLogDir()
+		if fallbackErr := prepareLogDir(logDir, true); fallbackErr != nil {
+			return fmt.Errorf("%v, and fallback %s failed: %v", err, logDir, fallbackErr)
+		}
+		logs.fallback = fmt.Errorf("%v, logging to %s instead", err, logDir)
+		fmt.Fprintf(os.Stderr, "WARNING: %v\n", logs.fallback)
+	}
+	logFile, err := logs.open(filepath.Join(logDir, "minimon.log"))
+	if err != nil {
+		return err
+	}
+	logs.logDir = logDir
+	logs.out = logFile
+	return nil
+}
+
+func prepareLogDir(logDir string, create bool) error {
+	if _, err := os.Stat(logDir); os.IsNotExist(err) {
+		if !create {
+			return fmt.Errorf("log directory does not exist: %s", logDir)
+		}
+		if err := os.MkdirAll(logDir, 0750); err != nil {
+			return fmt.Errorf("could not create log directory: %v", err)
+		}
+	}
+	return nil
+}
+
+// fallbackLogDir is where logs go when log_dir can't be used
+func fallbackLogDir() string {
+	if stateDir := os.Getenv("XDG_STATE_HOME"); stateDir != "" {
+		return filepath.Join(stateDir, "minimon")
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".local", "state", "minimon")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("minimon-%d", os.Getuid()))
+}
+
+// open returns the log file at path, shared by everyone logging there so
+// rotation happens once
+func (f *logFactory) open(path string) (*logFile, error) {
+	if file, ok := f.files[filepath.Clean(path)]; ok {
+		return file, nil
+	}
+	file, err := openLogFile(path, f.maxSize, f.backups)
+	if err != nil {
+		return nil, err
+	}
+	if f.files == nil {
+		f.files = make(map[string]*logFile)
+	}
+	f.files[filepath.Clean(path)] = file
+	return file, nil
+}
+
+// forSource returns the logger a monitor should use. log_file paths are
+// relative to log_dir when one is configured
+func (f *logFactory) forSource(source Source) zerolog.Logger {
+	level := f.level
+	if source.LogLevel != "" {
+		level, _ = parseLogLevel(source.LogLevel)
+	}
+
+	out := f.out
+	if source.LogFile != "" {
+		path := source.LogFile
+		if !filepath.IsAbs(path) && f.logDir != "" {
+			path = filepath.Join(f.logDir, path)
+		}
+		if file, err := f.open(path); err != nil {
+			log.Warn().Msgf("Warning: %v. Logging %s to the main log.", err, source.Name)
+		} else {
+			out = file
+		}
+	}
+
+	return zerolog.New(out).Level(level).With().Timestamp().Str("source", source.Name).Logger()
+}
+
+func (f *logFactory) Close() {
+	for _, file := range f.files {
+		file.Close()
+	}
+	f.files = nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Log files are rotated at log_max_size megabytes, keeping log_backups old
+// files as <name>.1 (newest) to <name>.N
+const (
+	defaultLogMaxSize = 10
+	defaultLogBackups = 3
+)
+
+// logFile is a log file that rotates itself once it reaches maxSize. The
+// main log is shared by every source without a log_file, so writes go
+// through mu
+type logFile struct {
+	path    string
+	maxSize int64
+	backups int
+	mu      sync.Mutex
+	file    *os.File
+	size    int64
+}
+
+func openLogFile(path string, maxSize int64, backups int) (*logFile, error) {
+	f := &logFile{path: path, maxSize: maxSize, backups: backups}
+	if err := f.reopen(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *logFile) reopen() error {
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("could not open log file: %v", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("could not open log file: %v", err)
+	}
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+func (f *logFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	// A record never straddles two files. One larger than maxSize on its
+	// own still goes into a fresh file
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			// Keep logging into the big file rather than losing entries
+			fmt.Fprintf(os.Stderr, "WARNING: could not rotate %s: %v\n", f.path, err)
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *logFile) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+// rotate shifts the backups up by one and starts a new file. Called with
+// mu held
+func (f *logFile) rotate() error {
+	if f.backups <= 0 {
+		// Nothing to keep, start over in place
+		if err := f.file.Truncate(0); err != nil {
+			return err
+		}
+		f.size = 0
+		return nil
+	}
+	os.Remove(fmt.Sprintf("%s.%d", f.path, f.backups))
+	for i := f.backups - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", f.path, i), fmt.Sprintf("%s.%d", f.path, i+1))
+	}
+	if err := os.Rename(f.path, f.path+".1"); err != nil {
+		return err
+	}
+	f.file.Close()
+	f.file = nil
+	return f.reopen()
+}
+
+func (f *logFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestLogFileRotation(t *testing.T) {
+	tests := []struct {
+		name    string
+		maxSize int64
+		backups int
+		writes  int
+		files   []string // expected contents, current file first
+	}{
+		{"under limit", 100, 2, 3, []string{"1\n2\n3\n"}},
+		{"rotates", 3, 2, 3, []string{"3\n", "2\n", "1\n"}},
+		{"drops oldest", 3, 2, 5, []string{"5\n", "4\n", "3\n"}},
+		{"no backups", 3, 0, 3, []string{"3\n"}},
+		{"never rotates", -1, 2, 3, []string{"1\n2\n3\n"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "minimon.log")
+			file, err := openLogFile(path, tt.maxSize, tt.backups)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 1; i <= tt.writes; i++ {
+				if _, err := file.WriteString(strconv.Itoa(i) + "\n"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			file.Close()
+
+			for i, want := range tt.files {
+				name := path
+				if i > 0 {
+					name = path + "." + strconv.Itoa(i)
+				}
+				got, err := os.ReadFile(name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(got) != want {
+					t.Errorf("%s = %q, want %q", filepath.Base(name), got, want)
+				}
+			}
+			if _, err := os.Stat(path + "." + strconv.Itoa(len(tt.files))); err == nil {
+				t.Errorf("more than %d backups kept", len(tt.files)-1)
+			}
+		})
+	}
+}
+
+func TestLogFileKeepsSizeAcrossRestarts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "minimon.log")
+	if err := os.WriteFile(path, []byte("old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := openLogFile(path, 6, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString("new\n")
+	file.Close()
+	if got, _ := os.ReadFile(path + ".1"); string(got) != "old\n" {
+		t.Errorf("backup = %q, want the existing log", got)
+	}
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// MessageData is the value notification templates are executed against
+type MessageData struct {
+	Source string
+	Kind   string
+	Path   string
+	// Detail is a ready-made description of a state change (a missing path,
+	// low disk space, ...) used instead of the change/idle wording
+	Detail  string
+	Changes int
+	// Events and Files are set for dir sources: raw watcher events and the
+	// distinct paths they touched. Changes mirrors Files there.
+	Events int
+	Files  int
+	// Created, Modified, Deleted and Renamed break Files down for dir
+	// sources
+	Created  int
+	Modified int
+	Deleted  int
+	Renamed  int
+	Minutes  float64
+	Added    int
+	Removed  int
+	// Velocity is the change rate over the interval's wall time in the
+	// source's velocity_unit, e.g. "24 lines/min"
+	Velocity string
+	// TopFiles names the files with the most changed lines in the interval
+	// for git sources, e.g. "src/main.go (+40 -3), README.md (+5 -0)"
+	TopFiles string
+	// Chmod counts files whose permissions alone changed and Permissions
+	// names them with their new mode, for dir sources with watch_chmod
+	Chmod       int
+	Permissions string
+	// Moved names the files moved or renamed within a dir source, e.g.
+	// "a.txt → b.txt"
+	Moved string
+	// ChangedLines are the lines of a command source's output that changed,
+	// one per line as "- gone" or "+ added"
+	ChangedLines string
+	// ChangedFiles names the files changed in the interval, for files
+	// sources
+	ChangedFiles string
+	// FirstChange and LastChange are the local times of the first and last
+	// change counted in the interval, in time_format, for dir sources
+	FirstChange string
+	LastChange  string
+	// Growing names the files counted after stable_max_wait although
+	// their size was still changing
+	Growing string
+	// Underreported is set when the watcher lost events during the
+	// interval, so the counts are too low
+	Underreported bool
+	// Size and SizeDelta are human-readable and only set for dir sources
+	// with track_size enabled
+	Size      string
+	SizeDelta string
+	// Free and Limit are set for disk_space sources
+	Free  string
+	Limit string
+	// Count and Threshold are set for dir_count sources
+	Count     int
+	Threshold int
+	// PID is set for process sources
+	PID int
+	// Age is how long ago a file_age source's file was modified
+	Age  string
+	Head string
+	Text string
+	Tail string
+	// Error is the last error of a failing source
+	Error string
+	// Version is the running build, e.g. "1.4.0 (3f2a9c1, 2026-10-01)"
+	Version string
+	// Urgency is the notification entry's urgency, normal unless set
+	Urgency string
+	Icon    string
+
+	// entry and whenLocked let the desktop notifier hold notifications
+	// while the session is locked
+	entry      int
+	whenLocked string
+	// sound is the entry's sound setting
+	sound string
+	// changeSpan is how far apart the first and last change were
+	changeSpan time.Duration
+}
+
+// setOps breaks Files down by operation
+func (d *MessageData) setOps(counts opCounts) {
+	d.Created = counts.Created
+	d.Modified = counts.Modified
+	d.Deleted = counts.Deleted
+	d.Renamed = counts.Renamed
+	d.Chmod = counts.Chmod
+}
+
+// setChangeRange records when the interval's changes happened, if known
+func (d *MessageData) setChangeRange(first, last time.Time) {
+	if first.IsZero() {
+		return
+	}
+	d.FirstChange = first.Local().Format(timeFormat)
+	d.LastChange = last.Local().Format(timeFormat)
+	d.changeSpan = last.Sub(first)
+}
+
+// changeRange says when the changes happened if they were clustered in
+// less than half the interval, e.g. "between 14:02 and 14:04" or "at
+// 14:02", and is empty otherwise. Intervals under two minutes are too
+// short for a range to say anything
+func (d MessageData) changeRange() string {
+	interval := time.Duration(d.Minutes * float64(time.Minute))
+	if d.FirstChange == "" || legacyDurations || interval < 2*time.Minute || d.changeSpan >= interval/2 {
+		return ""
+	}
+	if d.FirstChange == d.LastChange {
+		return "at " + d.FirstChange
+	}
+	return fmt.Sprintf("between %s and %s", d.FirstChange, d.LastChange)
+}
+
+// fileNotes mentions the files moved, the ones whose permissions changed,
+// the ones counted while still growing and lost events, if any
+func (d MessageData) fileNotes() string {
+	var notes []string
+	if d.ChangedFiles != "" {
+		notes = append(notes, "to "+d.ChangedFiles)
+	}
+	if d.Moved != "" {
+		notes = append(notes, "moved "+d.Moved)
+	}
+	if d.Permissions != "" {
+		notes = append(notes, "permissions changed on "+d.Permissions)
+	}
+	if d.Growing != "" {
+		notes = append(notes, "still growing: "+d.Growing)
+	}
+	if d.Underreported {
+		notes = append(notes, "counts may be underreported")
+	}
+	return strings.Join(notes, ", ")
+}
+
+func joinNotes(notes ...string) string {
+	return strings.Join(slices.DeleteFunc(notes, func(note string) bool { return note == "" }), ", ")
+}
+
+// opBreakdown renders the per-operation counts as "+3 ~8 -1", leaving out
+// the zero ones
+func (d MessageData) opBreakdown() string {
+	var parts []string
+	if d.Created > 0 {
+		parts = append(parts, fmt.Sprintf("+%d", d.Created))
+	}
+	if d.Modified > 0 {
+		parts = append(parts, fmt.Sprintf("~%d", d.Modified))
+	}
+	if d.Deleted > 0 {
+		parts = append(parts, fmt.Sprintf("-%d", d.Deleted))
+	}
+	if d.Renamed > 0 {
+		parts = append(parts, fmt.Sprintf(">%d", d.Renamed))
+	}
+	return strings.Join(parts, " ")
+}
+
+// legacyDurations keeps the old "%.2f minutes" wording for people who
+// parse notification text
+var legacyDurations bool
+
+// Default layout of {{.FirstChange}} and {{.LastChange}}
+const defaultTimeFormat = "15:04"
+
+// timeFormat is time_format from monitor_props, a Go time layout
+var timeFormat = defaultTimeFormat
+
+// parseMessageTemplate parses a template whose duration function writes
+// minutes in the source's time_unit
+func parseMessageTemplate(text, unit string) (*template.Template, error) {
+	funcs := template.FuncMap{
+		"duration": func(minutes float64) string { return formatMinutesIn(minutes, unit) },
+	}
+	return template.New("notification").Funcs(funcs).Parse(text)
+}
+
+// formatDuration renders d at the precision a person cares about: "45s",
+// "2m 30s", "25m", "2h 5m", "3d 4h"
+func formatDuration(d time.Duration) string {
+	// Round before choosing the unit so 59.9 minutes reads "1h", not "60m"
+	d = d.Round(time.Second)
+	if d < time.Minute {
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	}
+	if d < 10*time.Minute {
+		return joinUnits(int(d/time.Minute), "m", int(d%time.Minute/time.Second), "s")
+	}
+	d = d.Round(time.Minute)
+	if d < time.Hour {
+		return fmt.Sprintf("%dm", int(d/time.Minute))
+	}
+	if d < 24*time.Hour {
+		return joinUnits(int(d/time.Hour), "h", int(d%time.Hour/time.Minute), "m")
+	}
+	d = d.Round(time.Hour)
+	return joinUnits(int(d/(24*time.Hour)), "d", int(d%(24*time.Hour)/time.Hour), "h")
+}
+
+func joinUnits(major int, majorUnit string, minor int, minorUnit string) string {
+	if minor == 0 {
+		return fmt.Sprintf("%d%s", major, majorUnit)
+	}
+	return fmt.Sprintf("%d%s %d%s", major, majorUnit, minor, minorUnit)
+}
+
+// formatMinutes formats the fractional minutes MessageData carries
+func formatMinutes(minutes float64) string {
+	if legacyDurations {
+		return fmt.Sprintf("%.2f minutes", minutes)
+	}
+	return formatDuration(time.Duration(minutes * float64(time.Minute)))
+}
+
+// Units time_unit pins durations in messages to, instead of "auto"
+var timeUnits = map[string]time.Duration{"seconds": time.Second, "minutes": time.Minute, "hours": time.Hour}
+
+func validTimeUnit(unit string) error {
+	if _, ok := timeUnits[unit]; unit != "" && unit != "auto" && !ok {
+		return fmt.Errorf("unknown time_unit: %s (use auto, seconds, minutes or hours)", unit)
+	}
+	return nil
+}
+
+// formatMinutesIn formats minutes in a fixed unit, e.g. "0.50 hours" for
+// people who parse notification text, or like formatMinutes for auto
+func formatMinutesIn(minutes float64, unit string) string {
+	per, ok := timeUnits[unit]
+	if !ok {
+		return formatMinutes(minutes)
+	}
+	return fmt.Sprintf("%.2f %s", minutes*float64(time.Minute)/float64(per), unit)
+}
+
+// Units velocity_unit accepts
+var velocityUnits = map[string]time.Duration{"sec": time.Second, "min": time.Minute, "hour": time.Hour}
+
+func validVelocityUnit(unit string) error {
+	if _, ok := velocityUnits[unit]; unit != "" && !ok {
+		return fmt.Errorf("unknown velocity_unit: %s (use sec, min or hour)", unit)
+	}
+	return nil
+}
+
+// formatVelocity renders count over window per unit, e.g. "2.1 files/min".
+// A window far shorter than nominal means the clock jumped and would give
+// a huge rate, so nominal is used instead
+func formatVelocity(count int, what string, window, nominal time.Duration, unit string) string {
+	if unit == "" {
+		unit = "min"
+	}
+	if window < nominal/2 {
+		window = nominal
+	}
+	if window <= 0 {
+		return ""
+	}
+	rate := float64(count) / (float64(window) / float64(velocityUnits[unit]))
+	if rate >= 10 {
+		return fmt.Sprintf("%.0f %s/%s", rate, what, unit)
+	}
+	return fmt.Sprintf("%.1f %s/%s", rate, what, unit)
+}
+
+func renderTemplate(tmpl *template.Template, notification Notification, data MessageData) (string, error) {
+	data.Head = notification.NotificationHead
+	data.Tail = notification.NotificationTail
+	data.Text = notification.textFor(data.Kind)
+	data.Version = currentBuild().String()
+
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(sb.String()), nil
+}
+
+func (n Notification) textFor(kind string) string {
+	switch kind {
+	case kindChange:
+		return n.IsChangeText
+	case kindIdle:
+		return n.IsIdleText
+	case kindMissing:
+		return n.OnMissing
+	case kindRecover:
+		return n.OnRecover
+	case kindResume:
+		return n.OnResume
+	case kindPersonalBest:
+		return n.OnPersonalBest
+	case kindConflict:
+		return n.OnConflict
+	case kindUpstream:
+		return n.OnUpstream
+	case kindBreak:
+		return n.OnBreak
+	case kindBreakOver:
+		return n.OnBreakOver
+	case kindClean:
+		return n.OnClean
+	case kindError:
+		return n.onError
+	case kindErrorRecover:
+		return n.onErrorRecover
+	}
+	return ""
+}
+
+func joinNonEmpty(parts ...string) string {
+	nonEmpty := parts[:0:0]
+	for _, part := range parts {
+		if part != "" {
+			nonEmpty = append(nonEmpty, part)
+		}
+	}
+	return strings.Join(nonEmpty, " ")
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFormatDuration(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{0, "0s"},
+		{400 * time.Millisecond, "0s"},
+		{45 * time.Second, "45s"},
+		{59*time.Second + 600*time.Millisecond, "1m"},
+		{time.Minute, "1m"},
+		{90 * time.Second, "1m 30s"},
+		{9*time.Minute + 59*time.Second, "9m 59s"},
+		{10*time.Minute + 20*time.Second, "10m"},
+		{10*time.Minute + 40*time.Second, "11m"},
+		{59*time.Minute + 40*time.Second, "1h"},
+		{90 * time.Minute, "1h 30m"},
+		{23*time.Hour + 59*time.Minute, "23h 59m"},
+		{24 * time.Hour, "1d"},
+		{26*time.Hour + 40*time.Minute, "1d 3h"},
+		{72 * time.Hour, "3d"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := formatDuration(tt.d); got != tt.want {
+				t.Errorf("formatDuration(%v) = %q, want %q", tt.d, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatMinutes(t *testing.T) {
+	tests := []struct {
+		minutes float64
+		legacy  bool
+		want    string
+	}{
+		{0.5, false, "30s"},
+		{2.5, false, "2m 30s"},
+		{125, false, "2h 5m"},
+		{2.5, true, "2.50 minutes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			defer func(saved bool) { legacyDurations = saved }(legacyDurations)
+			legacyDurations = tt.legacy
+			if got := formatMinutes(tt.minutes); got != tt.want {
+				t.Errorf("formatMinutes(%v) = %q, want %q", tt.minutes, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatMinutesIn(t *testing.T) {
+	tests := []struct {
+		minutes float64
+		unit    string
+		want    string
+	}{
+		{30, "hours", "0.50 hours"},
+		{1.5, "seconds", "90.00 seconds"},
+		{1.5, "minutes", "1.50 minutes"},
+		{1.5, "auto", "1m 30s"},
+		{1.5, "", "1m 30s"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := formatMinutesIn(tt.minutes, tt.unit); got != tt.want {
+				t.Errorf("formatMinutesIn(%v, %q) = %q, want %q", tt.minutes, tt.unit, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChangeRange(t *testing.T) {
+	savedFormat := timeFormat
+	timeFormat = "15:04"
+	t.Cleanup(func() { timeFormat = savedFormat })
+
+	tests := []struct {
+		name     string
+		minutes  float64       // the interval
+		offset   time.Duration // from the start of the interval to the first change
+		span     time.Duration // from the first change to the last
+		changes  bool
+		legacy   bool
+		want     string
+		wantLast string
+	}{
+		{"one change", 10, 2 * time.Minute, 0, true, false, "at 14:02", "14:02"},
+		{"clustered", 10, 2 * time.Minute, 2 * time.Minute, true, false, "between 14:02 and 14:04", "14:04"},
+		{"within a minute", 10, 2*time.Minute + 10*time.Second, 30 * time.Second, true, false, "at 14:02", "14:02"},
+		{"half the interval", 10, time.Minute, 5 * time.Minute, true, false, "", "14:06"},
+		{"spread out", 10, 0, 9 * time.Minute, true, false, "", "14:09"},
+		{"short interval", 1, 0, 0, true, false, "", "14:00"},
+		{"two minute interval", 2, 30 * time.Second, 20 * time.Second, true, false, "at 14:00", "14:00"},
+		{"legacy durations", 10, 2 * time.Minute, 0, true, true, "", "14:02"},
+		{"no changes", 10, 0, 0, false, false, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			savedLegacy := legacyDurations
+			legacyDurations = tt.legacy
+			defer func() { legacyDurations = savedLegacy }()
+
+			clock := &fakeClock{t: time.Date(2024, 5, 1, 14, 0, 0, 0, time.Local)}
+			var first, last time.Time
+			if tt.changes {
+				clock.advance(tt.offset)
+				first = clock.now()
+				clock.advance(tt.span)
+				last = clock.now()
+			}
+			data := MessageData{Minutes: tt.minutes}
+			data.setChangeRange(first, last)
+			if data.LastChange != tt.wantLast {
+				t.Errorf("LastChange = %q, want %q", data.LastChange, tt.wantLast)
+			}
+			if got := data.changeRange(); got != tt.want {
+				t.Errorf("changeRange() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// startMetrics serves the sources' counters and histograms on /metrics in
+// the Prometheus text format
+func startMetrics(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("could not listen for metrics on %s: %v", address, err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", serveMetrics)
+	log.Info().Msgf("Serving metrics on http://%s/metrics", listener.Addr())
+	go func() {
+		if err := http.Serve(listener, mux); err != nil {
+			log.Error().Err(err).Msg("Metrics endpoint stopped")
+		}
+	}()
+	return nil
+}
+
+func serveMetrics(w http.ResponseWriter, r *http.Request) {
+	sources := registry.snapshot()
+	var buf bytes.Buffer
+
+	buf.WriteString("# HELP minimon_changes_total Changes seen since MiniMon started.\n# TYPE minimon_changes_total counter\n")
+	for _, source := range sources {
+		fmt.Fprintf(&buf, "minimon_changes_total{source=%s} %d\n", quoteLabel(source.Name), source.TotalChanges)
+	}
+	buf.WriteString("# HELP minimon_idle_minutes Current idle time.\n# TYPE minimon_idle_minutes gauge\n")
+	for _, source := range sources {
+		fmt.Fprintf(&buf, "minimon_idle_minutes{source=%s} %g\n", quoteLabel(source.Name), source.IdleMinutes)
+	}
+
+	buf.WriteString("# HELP minimon_interval_changes Changes per interval, today.\n# TYPE minimon_interval_changes histogram\n")
+	for _, source := range sources {
+		if source.Histograms != nil {
+			writeHistogram(&buf, "minimon_interval_changes", source.Name, source.Histograms.Changes)
+		}
+	}
+	buf.WriteString("# HELP minimon_idle_streak_minutes Length of the idle streaks that ended today.\n# TYPE minimon_idle_streak_minutes histogram\n")
+	for _, source := range sources {
+		if source.Histograms != nil {
+			writeHistogram(&buf, "minimon_idle_streak_minutes", source.Name, source.Histograms.IdleStreaks)
+		}
+	}
+
+	buf.WriteString("# HELP minimon_execs_running Git and source commands running now.\n# TYPE minimon_execs_running gauge\n")
+	fmt.Fprintf(&buf, "minimon_execs_running %d\n", len(execSlots))
+	buf.WriteString("# HELP minimon_exec_queue_depth Monitors waiting for max_concurrent_execs to free a slot.\n# TYPE minimon_exec_queue_depth gauge\n")
+	fmt.Fprintf(&buf, "minimon_exec_queue_depth %d\n", execWaiting.Load())
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(buf.Bytes())
+}
+
+// writeHistogram writes h with cumulative buckets, as Prometheus expects
+func writeHistogram(buf *bytes.Buffer, name, source string, h histogram) {
+	label := quoteLabel(source)
+	cumulative := 0
+	for i, count := range h.Counts {
+		cumulative += count
+		le := "+Inf"
+		if i < len(h.Bounds) {
+			le = strconv.FormatFloat(h.Bounds[i], 'g', -1, 64)
+		}
+		fmt.Fprintf(buf, "%s_bucket{source=%s,le=%q} %d\n", name, label, le, cumulative)
+	}
+	fmt.Fprintf(buf, "%s_sum{source=%s} %g\n", name, label, h.Sum)
+	fmt.Fprintf(buf, "%s_count{source=%s} %d\n", name, label, cumulative)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func quoteLabel(value string) string {
+	return `"` + labelEscaper.Replace(value) + `"`
+}
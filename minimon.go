@@ -1,78 +1,479 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"math"
 	"os"
-	"os/exec"
 	"os/signal"
 	"path/filepath"
+	"runtime"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
+	"text/template"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
-	"github.com/gen2brain/beeep"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
 
 type Notification struct {
-	NotificationHead string `json:"notification_head"`
-	OnChange         string `json:"on_change"`
-	OnIdle           string `json:"on_idle"`
-	NotificationTail string `json:"notification_tail"`
-	IsIdle           bool   `json:"is_idle"`
-	IsIdleText       string `json:"is_idle_text"`
-	IsChange         bool   `json:"is_change"`
-	IsChangeText     string `json:"is_change_text"`
+	NotificationHead string   `json:"notification_head"`
+	OnChange         string   `json:"on_change"`
+	OnIdle           string   `json:"on_idle"`
+	NotificationTail string   `json:"notification_tail"`
+	IsIdle           bool     `json:"is_idle"`
+	IsIdleText       string   `json:"is_idle_text"`
+	IsChange         bool     `json:"is_change"`
+	IsChangeText     string   `json:"is_change_text"`
+	OnMissing        string   `json:"on_missing"`
+	OnRecover        string   `json:"on_recover"`
+	OnResume         string   `json:"on_resume"`
+	OnPersonalBest   string   `json:"on_personal_best"`
+	OnConflict       string   `json:"on_conflict"`
+	OnUpstream       string   `json:"on_upstream"`
+	OnBreak          string   `json:"on_break"`
+	OnBreakOver      string   `json:"on_break_over"`
+	OnClean          string   `json:"on_clean"`
+	Desktop          *bool    `json:"desktop,omitempty"`
+	Template         string   `json:"template"`
+	Channels         []string `json:"channels"`
+	Fallback         []string `json:"fallback"`
+	Urgency          string   `json:"urgency"`
+	Icon             string   `json:"icon"`
+	WhenLocked       string   `json:"when_locked"`
+	Sound            string   `json:"sound"`
+
+	tmpl *template.Template
+	// entry is the index in the source's notification_set and maxPerHour
+	// its max_notifications_per_hour, both used for throttling
+	entry      int
+	maxPerHour int
+	// timeUnit is the source's time_unit for the durations in messages
+	timeUnit string
+	// onError and onErrorRecover are the source's texts for its failing
+	// state, which apply to every entry
+	onError        string
+	onErrorRecover string
 }
 
 type NotificationConfig struct {
-	NotificationInterval int            `json:"notification_interval"`
-	NotificationSet      []Notification `json:"notification_set"`
-	MaxIdleTime          int            `json:"max_idle_time"`
+	NotificationInterval    int            `json:"notification_interval"`
+	NotificationSet         []Notification `json:"notification_set"`
+	MaxIdleTime             int            `json:"max_idle_time"`
+	IdleMode                string         `json:"idle_mode"`
+	IdleBackoff             string         `json:"idle_backoff"`
+	MaxNotificationsPerHour int            `json:"max_notifications_per_hour"`
+	TimeUnit                string         `json:"time_unit"`
+	// OnError is sent once error_threshold operational failures in a row
+	// make the source fail, OnErrorRecover once it works again
+	OnError        string `json:"on_error"`
+	OnErrorRecover string `json:"on_error_recover"`
+	ErrorThreshold int    `json:"error_threshold"`
+
+	// intervalSet and maxIdleSet tell a missing field from an explicit zero
+	intervalSet bool
+	maxIdleSet  bool
+}
+
+// Used when a source leaves out notification_interval or max_idle_time, in
+// seconds
+const (
+	defaultNotificationInterval = 300
+	defaultMaxIdleTime          = 3600
+)
+
+func (c *NotificationConfig) UnmarshalJSON(data []byte) error {
+	type plain NotificationConfig
+	if err := json.Unmarshal(data, (*plain)(c)); err != nil {
+		return err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	present := func(name string) bool {
+		value, ok := fields[name]
+		return ok && string(value) != "null"
+	}
+	c.intervalSet = present("notification_interval")
+	c.maxIdleSet = present("max_idle_time")
+	return nil
 }
 
 type Source struct {
+	Name               string             `json:"name"`
 	Path               string             `json:"path"`
+	Paths              []string           `json:"paths"`
 	SourceType         string             `json:"source_type"`
 	NotificationConfig NotificationConfig `json:"notification_config"`
+	TrackSize          bool               `json:"track_size"`
+	RespectGitignore   bool               `json:"respect_gitignore"`
+	WatchChmod         bool               `json:"watch_chmod"`
+	BuiltinFilters     *bool              `json:"builtin_filters,omitempty"`
+	StableFor          string             `json:"stable_for"`
+	StableMaxWait      string             `json:"stable_max_wait"`
+	Enabled            *bool              `json:"enabled,omitempty"`
+	FollowSymlinks     *bool              `json:"follow_symlinks,omitempty"`
+	Recursive          bool               `json:"recursive"`
+	MaxDepth           int                `json:"max_depth"`
+	MaxWatchedDirs     int                `json:"max_watched_dirs"`
+	SettleTime         int                `json:"settle_time"`
+	NotifyOnSettle     bool               `json:"notify_on_settle"`
+	MaxWait            int                `json:"max_wait"`
+	ExitOnMaxIdle      bool               `json:"exit_on_max_idle"`
+	InitialScan        bool               `json:"initial_scan"`
+	Icon               string             `json:"icon"`
+	GitBase            string             `json:"git_base"`
+	IncludeUntracked   bool               `json:"include_untracked"`
+	IgnoreWhitespace   bool               `json:"ignore_whitespace"`
+	DiffFilter         []string           `json:"diff_filter"`
+	GitBackend         string             `json:"git_backend"`
+	AfterHit           string             `json:"after_hit"`
+	WatchMissing       bool               `json:"watch_missing"`
+	MissingDelay       int                `json:"missing_delay"`
+	CheckMount         bool               `json:"check_mount"`
+	MountTimeout       string             `json:"mount_timeout"`
+	MinFree            string             `json:"min_free"`
+	Hysteresis         string             `json:"hysteresis"`
+	MaxFiles           int                `json:"max_files"`
+	Pattern            string             `json:"pattern"`
+	Exclude            []string           `json:"exclude"`
+	MaxSources         int                `json:"max_sources"`
+	Schedule           *Schedule          `json:"schedule,omitempty"`
+	MaxAge             string             `json:"max_age"`
+	Repeat             bool               `json:"repeat"`
+	ProcessName        string             `json:"process_name"`
+	Headers            map[string]string  `json:"headers"`
+	Timeout            int                `json:"timeout"`
+	Command            []string           `json:"command"`
+	OnExitError        string             `json:"on_exit_error"`
+	ExtractJSON        string             `json:"extract_json"`
+	ExtractRegex       string             `json:"extract_regex"`
+	FailureThreshold   int                `json:"failure_threshold"`
+	LogLevel           string             `json:"log_level"`
+	LogFile            string             `json:"log_file"`
+	SizeRescanInterval int                `json:"size_rescan_interval"`
+	VelocityUnit       string             `json:"velocity_unit"`
+	ConflictReminder   int                `json:"conflict_reminder"`
+	Upstream           *UpstreamConfig    `json:"upstream,omitempty"`
+	Session            *WorkSessionConfig `json:"session,omitempty"`
+
+	logger zerolog.Logger
+	// configuredPath is Path as written in the config, before resolving
+	configuredPath string
+	schedule       *scheduleWindow
+	// disabled says why the source is not started, e.g. "enabled is false"
+	disabled string
 }
 
 type MonitorProps struct {
-	LogDir   string `json:"log_dir"`
-	LogLevel string `json:"log_level"`
+	LogDir             string              `json:"log_dir"`
+	CreateLogDir       *bool               `json:"create_log_dir,omitempty"`
+	LogLevel           string              `json:"log_level"`
+	LogMaxSize         int                 `json:"log_max_size"`
+	LogBackups         *int                `json:"log_backups,omitempty"`
+	Gotify             *GotifyConfig       `json:"gotify,omitempty"`
+	MQTT               *MQTTConfig         `json:"mqtt,omitempty"`
+	ControlSocket      string              `json:"control_socket"`
+	SnoozeDuration     int                 `json:"snooze_duration"`
+	LegacyDurations    bool                `json:"legacy_durations"`
+	EventLog           string              `json:"event_log"`
+	DailySummary       *DailySummaryConfig `json:"daily_summary,omitempty"`
+	WeeklyReport       *WeeklyReportConfig `json:"weekly_report,omitempty"`
+	HistoryStore       *HistoryStoreConfig `json:"history_store,omitempty"`
+	ExitOnMaxIdle      bool                `json:"exit_on_max_idle"`
+	ExitWhen           string              `json:"exit_when"`
+	DedupWindow        int                 `json:"dedup_window"`
+	DedupIgnoreNumbers bool                `json:"dedup_ignore_numbers"`
+	GitBinary          string              `json:"git_binary"`
+	GitBackend         string              `json:"git_backend"`
+	GitEnvAllowlist    []string            `json:"git_env_allowlist"`
+	SkipAfterSuspend   bool                `json:"skip_after_suspend"`
+	StateFile          string              `json:"state_file"`
+	Heartbeat          *HeartbeatConfig    `json:"heartbeat,omitempty"`
+	SystemdWatchdog    *bool               `json:"systemd_watchdog,omitempty"`
+	ConsoleDashboard   bool                `json:"console_dashboard"`
+	RecordFile         string              `json:"record_file"`
+	DryRun             bool                `json:"dry_run"`
+	Output             string              `json:"output"`
+	Retry              RetryConfig         `json:"retry"`
+	SoundPlayer        string              `json:"sound_player"`
+	DBus               bool                `json:"dbus"`
+	StatsD             *StatsDConfig       `json:"statsd,omitempty"`
+	Session            *WorkSessionConfig  `json:"session,omitempty"`
+	WhenLocked         string              `json:"when_locked"`
+	NotifyOnExit       bool                `json:"notify_on_exit"`
+	// DesktopNotifications false runs headless, see setupNotifiers
+	DesktopNotifications *bool `json:"desktop_notifications,omitempty"`
+	DesktopTimeout       int   `json:"desktop_timeout"`
+	// Histograms sets the bucket bounds of the activity histograms
+	Histograms    *HistogramConfig `json:"histograms,omitempty"`
+	MetricsListen string           `json:"metrics_listen"`
+	// MaxConcurrentExecs bounds the git commands run at once
+	MaxConcurrentExecs int    `json:"max_concurrent_execs"`
+	TimeFormat         string `json:"time_format"`
 }
 
 type Config struct {
-	MonitorSources []Source     `json:"monitor_sources"`
-	MonitorProps   MonitorProps `json:"monitor_props"`
+	Include        []string                  `json:"include"`
+	Defaults       *SourceDefaults           `json:"defaults,omitempty"`
+	MonitorSources []Source                  `json:"monitor_sources"`
+	MonitorProps   MonitorProps              `json:"monitor_props"`
+	Notifiers      map[string]NotifierConfig `json:"notifiers"`
 }
 
 func loadConfig(configPath string) (*Config, error) {
-	configData, err := os.ReadFile(configPath)
+	config, err := readConfigFile(configPath, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	var config Config
-	if err := json.Unmarshal(configData, &config); err != nil {
-		return nil, err
-	}
+	expandConfigPaths(config)
 
 	// Normalize log level to lowercase
 	config.MonitorProps.LogLevel = strings.ToLower(config.MonitorProps.LogLevel)
 
+	if config.MonitorProps.SnoozeDuration <= 0 {
+		config.MonitorProps.SnoozeDuration = defaultSnoozeDuration
+	}
+
+	if summary := config.MonitorProps.DailySummary; summary != nil {
+		if _, _, err := parseSummaryTime(summary.Time); err != nil {
+			return nil, err
+		}
+	}
+	if weekly := config.MonitorProps.WeeklyReport; weekly != nil {
+		if err := validWeeklyReport(*weekly, config.MonitorProps); err != nil {
+			return nil, err
+		}
+	}
+	if config.MonitorProps.HistoryStore != nil {
+		if _, err := historyStorePath(config.MonitorProps); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := validExitWhen(config.MonitorProps.ExitWhen); err != nil {
+		return nil, err
+	}
+	if err := validWhenLocked(config.MonitorProps.WhenLocked); err != nil {
+		return nil, err
+	}
+	if err := validOutput(config.MonitorProps.Output); err != nil {
+		return nil, err
+	}
+	if config.MonitorProps.Retry, err = config.MonitorProps.Retry.withDefaults(); err != nil {
+		return nil, err
+	}
+
+	if statsD := config.MonitorProps.StatsD; statsD != nil {
+		if err := validStatsD(statsD); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := config.MonitorProps.Histograms.withDefaults(); err != nil {
+		return nil, err
+	}
+
+	if heartbeat := config.MonitorProps.Heartbeat; heartbeat != nil && heartbeat.File == "" && heartbeat.URL == "" {
+		return nil, fmt.Errorf("heartbeat needs a file or url")
+	}
+
+	if config.MonitorProps.MaxConcurrentExecs < 0 {
+		return nil, fmt.Errorf("max_concurrent_execs must not be negative")
+	}
+
+	// Needed before validating git_base below
+	configureGit(config.MonitorProps)
+
+	if err := assignSourceNames(config.MonitorSources); err != nil {
+		return nil, err
+	}
+
 	// Set notification flags based on the configuration
 	for i := range config.MonitorSources {
+		if enabled := config.MonitorSources[i].Enabled; enabled != nil && !*enabled {
+			config.MonitorSources[i].disabled = "enabled is false"
+		}
+		if err := resolveIdleMode(&config.MonitorSources[i].NotificationConfig); err != nil {
+			return nil, fmt.Errorf("%s: %v", config.MonitorSources[i].Name, err)
+		}
+		if err := validAfterHit(config.MonitorSources[i].AfterHit); err != nil {
+			return nil, fmt.Errorf("%s: %v", config.MonitorSources[i].Name, err)
+		}
+		notificationConfig := &config.MonitorSources[i].NotificationConfig
+		if !notificationConfig.intervalSet {
+			notificationConfig.NotificationInterval = defaultNotificationInterval
+			log.Info().Msgf("%s: no notification_interval, using %ds", config.MonitorSources[i].Name, defaultNotificationInterval)
+		} else if notificationConfig.NotificationInterval <= 0 {
+			return nil, fmt.Errorf("%s: notification_interval must be positive", config.MonitorSources[i].Name)
+		}
+		if !notificationConfig.maxIdleSet {
+			notificationConfig.MaxIdleTime = defaultMaxIdleTime
+			log.Info().Msgf("%s: no max_idle_time, using %ds", config.MonitorSources[i].Name, defaultMaxIdleTime)
+		} else if notificationConfig.MaxIdleTime < 0 {
+			return nil, fmt.Errorf("%s: max_idle_time must not be negative", config.MonitorSources[i].Name)
+		}
+		if config.MonitorSources[i].NotificationConfig.MaxNotificationsPerHour < 0 {
+			return nil, fmt.Errorf("%s: max_notifications_per_hour must not be negative", config.MonitorSources[i].Name)
+		}
+		config.MonitorSources[i].LogLevel = strings.ToLower(config.MonitorSources[i].LogLevel)
+		if _, err := parseLogLevel(config.MonitorSources[i].LogLevel); err != nil || config.MonitorSources[i].LogLevel == "console" {
+			return nil, fmt.Errorf("%s: invalid log_level: %s", config.MonitorSources[i].Name, config.MonitorSources[i].LogLevel)
+		}
+		if config.MonitorProps.ExitOnMaxIdle {
+			config.MonitorSources[i].ExitOnMaxIdle = true
+		}
+		if config.MonitorSources[i].ExitOnMaxIdle && config.MonitorSources[i].NotificationConfig.MaxIdleTime <= 0 {
+			return nil, fmt.Errorf("%s: exit_on_max_idle needs max_idle_time", config.MonitorSources[i].Name)
+		}
+		if err := validDirTree(config.MonitorSources[i]); err != nil {
+			return nil, fmt.Errorf("%s: %v", config.MonitorSources[i].Name, err)
+		}
+		if err := validStableFor(config.MonitorSources[i]); err != nil {
+			return nil, fmt.Errorf("%s: %v", config.MonitorSources[i].Name, err)
+		}
+		if err := validCheckMount(config.MonitorSources[i]); err != nil {
+			return nil, fmt.Errorf("%s: %v", config.MonitorSources[i].Name, err)
+		}
+		if config.MonitorSources[i].Session == nil {
+			config.MonitorSources[i].Session = config.MonitorProps.Session
+		}
+		if err := validWorkSession(config.MonitorSources[i].Session); err != nil {
+			return nil, fmt.Errorf("%s: %v", config.MonitorSources[i].Name, err)
+		}
+		if config.MonitorSources[i].NotifyOnSettle {
+			if config.MonitorSources[i].SettleTime <= 0 {
+				config.MonitorSources[i].SettleTime = defaultBurstSettleTime
+			}
+			if config.MonitorSources[i].MaxWait <= 0 {
+				config.MonitorSources[i].MaxWait = defaultBurstMaxWait
+			}
+		}
+		if config.MonitorSources[i].SourceType == "git_file" {
+			if config.MonitorSources[i].GitBackend == "" {
+				config.MonitorSources[i].GitBackend = config.MonitorProps.GitBackend
+			}
+			if err := validGitBackend(config.MonitorSources[i].GitBackend); err != nil {
+				return nil, fmt.Errorf("%s: %v", config.MonitorSources[i].Name, err)
+			}
+			// A disabled project may not be checked out at all
+			if base := config.MonitorSources[i].GitBase; base != "" && base != gitBaseSessionStart && config.MonitorSources[i].disabled == "" {
+				native, _ := openGitBackend(config.MonitorSources[i])
+				if _, err := resolveGitBase(config.MonitorSources[i].Path, base, native); err != nil {
+					return nil, fmt.Errorf("%s: invalid git_base: %v", config.MonitorSources[i].Name, err)
+				}
+			}
+		}
+		if config.MonitorSources[i].SourceType == "process" {
+			if err := validProcessSource(config.MonitorSources[i]); err != nil {
+				return nil, fmt.Errorf("%s: %v", config.MonitorSources[i].Name, err)
+			}
+		}
+		if err := validTimeUnit(config.MonitorSources[i].NotificationConfig.TimeUnit); err != nil {
+			return nil, fmt.Errorf("%s: %v", config.MonitorSources[i].Name, err)
+		}
+		if config.MonitorSources[i].NotificationConfig.ErrorThreshold < 0 {
+			return nil, fmt.Errorf("%s: error_threshold must not be negative", config.MonitorSources[i].Name)
+		}
+		if config.MonitorSources[i].NotificationConfig.ErrorThreshold == 0 {
+			config.MonitorSources[i].NotificationConfig.ErrorThreshold = defaultErrorThreshold
+		}
+		if err := validVelocityUnit(config.MonitorSources[i].VelocityUnit); err != nil {
+			return nil, fmt.Errorf("%s: %v", config.MonitorSources[i].Name, err)
+		}
+		if config.MonitorSources[i].Upstream != nil {
+			if err := validUpstream(config.MonitorSources[i].Upstream); err != nil {
+				return nil, fmt.Errorf("%s: %v", config.MonitorSources[i].Name, err)
+			}
+		}
+		if config.MonitorSources[i].Schedule != nil {
+			window, err := parseSchedule(*config.MonitorSources[i].Schedule)
+			if err != nil {
+				return nil, fmt.Errorf("%s: schedule: %v", config.MonitorSources[i].Name, err)
+			}
+			config.MonitorSources[i].schedule = window
+		}
+		if config.MonitorSources[i].SourceType == "file_age" {
+			if err := validFileAgeSource(config.MonitorSources[i]); err != nil {
+				return nil, fmt.Errorf("%s: %v", config.MonitorSources[i].Name, err)
+			}
+		}
+		if config.MonitorSources[i].SourceType == "url" {
+			if err := validURLSource(config.MonitorSources[i]); err != nil {
+				return nil, fmt.Errorf("%s: %v", config.MonitorSources[i].Name, err)
+			}
+			if config.MonitorSources[i].Timeout <= 0 {
+				config.MonitorSources[i].Timeout = defaultURLTimeout
+			}
+			if config.MonitorSources[i].FailureThreshold <= 0 {
+				config.MonitorSources[i].FailureThreshold = defaultURLFailureThreshold
+			}
+		}
+		if config.MonitorSources[i].SourceType == "command" {
+			if err := validCommandSource(config.MonitorSources[i]); err != nil {
+				return nil, fmt.Errorf("%s: %v", config.MonitorSources[i].Name, err)
+			}
+			if config.MonitorSources[i].OnExitError == "" {
+				config.MonitorSources[i].OnExitError = exitErrorFail
+			}
+			if config.MonitorSources[i].Timeout <= 0 {
+				config.MonitorSources[i].Timeout = defaultCommandTimeout
+			}
+			if config.MonitorSources[i].FailureThreshold <= 0 {
+				config.MonitorSources[i].FailureThreshold = defaultURLFailureThreshold
+			}
+		}
+		if config.MonitorSources[i].SourceType == "files" {
+			if err := validFilesSource(config.MonitorSources[i]); err != nil {
+				return nil, fmt.Errorf("%s: %v", config.MonitorSources[i].Name, err)
+			}
+		}
+		if config.MonitorSources[i].SourceType == "discover" {
+			if err := validDiscoverSource(config.MonitorSources[i]); err != nil {
+				return nil, fmt.Errorf("%s: %v", config.MonitorSources[i].Name, err)
+			}
+			if config.MonitorSources[i].MaxSources == 0 {
+				config.MonitorSources[i].MaxSources = defaultMaxSources
+			}
+		}
+		if config.MonitorSources[i].SourceType == "dir_count" {
+			if err := validDirCountSource(config.MonitorSources[i]); err != nil {
+				return nil, fmt.Errorf("%s: %v", config.MonitorSources[i].Name, err)
+			}
+		}
+		if config.MonitorSources[i].SourceType == "disk_space" {
+			if _, err := parseByteThreshold(config.MonitorSources[i].MinFree); err != nil {
+				return nil, fmt.Errorf("%s: invalid min_free: %v", config.MonitorSources[i].Name, err)
+			}
+			if config.MonitorSources[i].Hysteresis != "" {
+				if _, err := parseByteThreshold(config.MonitorSources[i].Hysteresis); err != nil {
+					return nil, fmt.Errorf("%s: invalid hysteresis: %v", config.MonitorSources[i].Name, err)
+				}
+			}
+		}
+		if config.MonitorSources[i].MissingDelay <= 0 {
+			config.MonitorSources[i].MissingDelay = defaultMissingDelay
+		}
+		if config.MonitorSources[i].SizeRescanInterval <= 0 {
+			config.MonitorSources[i].SizeRescanInterval = defaultSizeRescanInterval
+		}
 		for j := range config.MonitorSources[i].NotificationConfig.NotificationSet {
 			notification := &config.MonitorSources[i].NotificationConfig.NotificationSet[j]
 			notification.IsChange = false
 			notification.IsIdle = false
+			notification.entry = j
+			notification.maxPerHour = config.MonitorSources[i].NotificationConfig.MaxNotificationsPerHour
+			notification.timeUnit = config.MonitorSources[i].NotificationConfig.TimeUnit
+			notification.onError = config.MonitorSources[i].NotificationConfig.OnError
+			notification.onErrorRecover = config.MonitorSources[i].NotificationConfig.OnErrorRecover
 			if notification.OnChange != "" {
 				notification.IsChange = true
 				notification.IsChangeText = notification.OnChange
@@ -81,316 +482,1221 @@ func loadConfig(configPath string) (*Config, error) {
 				notification.IsIdle = true
 				notification.IsIdleText = notification.OnIdle
 			}
+			if notification.Template != "" {
+				tmpl, err := parseMessageTemplate(notification.Template, notification.timeUnit)
+				if err != nil {
+					return nil, fmt.Errorf("invalid template in %s: %v", config.MonitorSources[i].Path, err)
+				}
+				notification.tmpl = tmpl
+			}
+			notification.Urgency = strings.ToLower(notification.Urgency)
+			if notification.Icon == "" {
+				notification.Icon = config.MonitorSources[i].Icon
+			}
+			if err := validIcon(notification.Icon); err != nil {
+				return nil, fmt.Errorf("%s: %v", config.MonitorSources[i].Name, err)
+			}
+			if iconFileMissing(notification.Icon) {
+				log.Warn().Msgf("Warning: icon %s does not exist. Using the default icon for %s.", notification.Icon, config.MonitorSources[i].Name)
+				notification.Icon = ""
+			}
+			if soundFileMissing(notification.Sound) {
+				log.Warn().Msgf("Warning: sound %s does not exist. Using the default sound for %s.", notification.Sound, config.MonitorSources[i].Name)
+				notification.Sound = ""
+			}
+			if err := validUrgency(notification.Urgency); err != nil {
+				return nil, fmt.Errorf("%s: %v", config.MonitorSources[i].Name, err)
+			}
+			if err := validWhenLocked(notification.WhenLocked); err != nil {
+				return nil, fmt.Errorf("%s: %v", config.MonitorSources[i].Name, err)
+			}
+			for _, channel := range slices.Concat(notification.Channels, notification.Fallback) {
+				if _, ok := config.Notifiers[channel]; !ok && !slices.Contains(builtinChannels(config.MonitorProps), channel) {
+					return nil, fmt.Errorf("%s: unknown notification channel %q", config.MonitorSources[i].Name, channel)
+				}
+			}
 		}
 	}
 
-	return &config, nil
+	return config, nil
 }
 
-func setupLogging(logDir, logLevel string) (*os.File, error) {
-	zerolog.SetGlobalLevel(zerolog.InfoLevel)
-
-	var logFile *os.File
-	var err error
-
-	switch logLevel {
-	case "debug":
-		zerolog.SetGlobalLevel(zerolog.DebugLevel)
-	case "warn":
-		zerolog.SetGlobalLevel(zerolog.WarnLevel)
-	case "error":
-		zerolog.SetGlobalLevel(zerolog.ErrorLevel)
-	case "console":
-		log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stdout})
-	default:
-		if logDir != "" {
-			if _, err := os.Stat(logDir); os.IsNotExist(err) {
-				return nil, fmt.Errorf("log directory does not exist: %s", logDir)
-			}
-
-			logFilePath := filepath.Join(logDir, "minimon.log")
-			logFile, err = os.OpenFile(logFilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-			if err != nil {
-				return nil, fmt.Errorf("could not open log file: %v", err)
-			}
-
-			log.Logger = log.Output(logFile)
+// assignSourceNames defaults each unnamed source to the last element of its
+// path, adding a numeric suffix when two sources would share a name
+func assignSourceNames(sources []Source) error {
+	taken := make(map[string]bool)
+	for _, source := range sources {
+		if source.Name == "" {
+			continue
 		}
+		if taken[source.Name] {
+			return fmt.Errorf("duplicate source name: %s", source.Name)
+		}
+		taken[source.Name] = true
 	}
 
-	return logFile, err
+	for i := range sources {
+		if sources[i].Name != "" {
+			continue
+		}
+		base := filepath.Base(filepath.Clean(sources[i].Path))
+		if sources[i].Path == "" && sources[i].ProcessName != "" {
+			base = sources[i].ProcessName
+		}
+		if sources[i].Path == "" && len(sources[i].Paths) > 0 {
+			base = "files"
+		}
+		if sources[i].Path == "" && len(sources[i].Command) > 0 {
+			base = filepath.Base(sources[i].Command[0])
+		}
+		name := base
+		for n := 2; taken[name]; n++ {
+			name = fmt.Sprintf("%s-%d", base, n)
+		}
+		sources[i].Name = name
+		taken[name] = true
+	}
+	return nil
 }
 
-func constructNotificationMessage(notification Notification, changeCount int, timeInterval float64, onChange bool) string {
+func constructNotificationMessage(notification Notification, data MessageData) string {
+	onChange := data.Kind == kindChange
+	if notification.tmpl != nil {
+		message, err := renderTemplate(notification.tmpl, notification, data)
+		if err == nil {
+			return message
+		}
+		log.Error().Err(err).Msg("Failed to render notification template, using default format")
+	}
+	// Sources reporting a state rather than activity describe it themselves
+	if data.Detail != "" {
+		return joinNonEmpty(notification.NotificationHead, notification.textFor(data.Kind), data.Detail, notification.NotificationTail)
+	}
 	if onChange && notification.IsChangeText != "" {
-		return fmt.Sprintf("%s %d %s %.2f minutes. %s",
-			notification.NotificationHead, changeCount, notification.IsChangeText, timeInterval, notification.NotificationTail)
-	} else if !onChange && notification.IsIdleText != "" {
-		return fmt.Sprintf("%s %s %.2f minutes %s",
-			notification.NotificationHead, notification.IsIdleText, timeInterval, notification.NotificationTail)
+		// The entry's text usually ends in "in", so the range follows
+		if note := joinNotes(data.changeRange(), data.fileNotes()); note != "" {
+			return fmt.Sprintf("%s %d %s %s, %s. %s",
+				notification.NotificationHead, data.Changes, notification.IsChangeText, formatMinutesIn(data.Minutes, notification.timeUnit), note, notification.NotificationTail)
+		}
+		return fmt.Sprintf("%s %d %s %s. %s",
+			notification.NotificationHead, data.Changes, notification.IsChangeText, formatMinutesIn(data.Minutes, notification.timeUnit), notification.NotificationTail)
+	} else if data.Kind == kindIdle && notification.IsIdleText != "" {
+		return fmt.Sprintf("%s %s %s %s",
+			notification.NotificationHead, notification.IsIdleText, formatMinutesIn(data.Minutes, notification.timeUnit), notification.NotificationTail)
 	}
 	// Default notification message if all fields are empty or absent
 	if onChange {
-		return fmt.Sprintf("activity notification: %d changes in %.2f minutes", changeCount, timeInterval)
+		message := fmt.Sprintf("activity notification: %d changes in %s", data.Changes, formatMinutesIn(data.Minutes, notification.timeUnit))
+		if clustered := data.changeRange(); clustered != "" {
+			message = fmt.Sprintf("activity notification: %d changes %s", data.Changes, clustered)
+		}
+		if breakdown := data.opBreakdown(); breakdown != "" {
+			message += " (" + breakdown + ")"
+		}
+		if note := data.fileNotes(); note != "" {
+			message += ", " + note
+		}
+		return message
+	}
+	if legacyDurations && timeUnits[notification.timeUnit] == 0 {
+		return fmt.Sprintf("idle notification: idle time: %.2f minutes", data.Minutes)
 	}
-	return fmt.Sprintf("idle notification: idle time: %.2f minutes", timeInterval)
+	return fmt.Sprintf("idle notification: idle for %s", formatMinutesIn(data.Minutes, notification.timeUnit))
 }
 
-func monitorDirectory(path string, config NotificationConfig) {
-	watcher, err := fsnotify.NewWatcher()
-	if err != nil {
-		log.Fatal().Err(err).Msg("Failed to create watcher")
+// Defaults for dir sources with notify_on_settle, in seconds
+const (
+	defaultBurstSettleTime = 30
+	defaultBurstMaxWait    = 600
+)
+
+// Events buffered between fsnotify and the monitor loop, and the most
+// events handled in one go before timers get a chance to run
+const (
+	dirEventBuffer = 4096
+	dirEventBatch  = 1024
+)
+
+// watcherReportsOverflow is whether fsnotify reports a full event queue as
+// ErrEventOverflow on this platform: inotify and ReadDirectoryChangesW do,
+// kqueue doesn't
+const watcherReportsOverflow = runtime.GOOS == "linux" || runtime.GOOS == "windows"
+
+// dirMonitor watches source.Path, or takes its events and ticks from feed
+// when one is given (see replay)
+type dirMonitor struct {
+	monitorBase
+	feed *dirFeed
+}
+
+func newDirMonitor(source Source, status *monitorStatus, feed *dirFeed) *dirMonitor {
+	return &dirMonitor{monitorBase: monitorBase{source: source, status: status}, feed: feed}
+}
+
+func (m *dirMonitor) Start(ctx context.Context) error {
+	source, status, feed := m.source, m.status, m.feed
+	logger := source.logger
+	path := source.Path
+	config := source.NotificationConfig
+
+	var watcher *fsnotify.Watcher
+	var err error
+	if feed == nil {
+		// A large checkout or npm install produces events faster than they
+		// are handled for a moment, so give the watcher some slack
+		watcher, err = fsnotify.NewBufferedWatcher(dirEventBuffer)
+		if err != nil {
+			return fmt.Errorf("failed to create watcher: %v", err)
+		}
+		defer watcher.Close()
+		feed = &dirFeed{events: watcher.Events, errors: watcher.Errors, now: time.Now}
+	}
+	var watches *watchSet
+	var tree *dirTree
+	if watcher != nil {
+		// Stopped before the watcher is closed, however Start returns
+		watchCtx, stopWatches := context.WithCancel(ctx)
+		defer stopWatches()
+		watches = newWatchSet(watchCtx, watcher, status, logger)
+		if source.Recursive {
+			tree = newDirTree(source, watches, status)
+		}
+	}
+
+	var ignoreChecker *gitIgnoreChecker
+	if source.RespectGitignore {
+		ignoreChecker, err = newGitIgnoreChecker(path)
+		if err != nil {
+			logger.Warn().Err(err).Msgf("Cannot respect .gitignore for %s", path)
+		} else {
+			defer ignoreChecker.Close()
+			logger.Info().Msgf("Ignoring paths excluded by git in %s", ignoreChecker.repoRoot)
+		}
+	}
+
+	// The watcher only sees what happens after it is added, so an initial
+	// scan lets the first tick pick up files written in between
+	var snapshot *dirSnapshot
+	if source.InitialScan {
+		scanned, err := takeDirSnapshot(path)
+		if err != nil {
+			logger.Warn().Err(err).Msgf("Initial scan of %s failed", path)
+		} else {
+			snapshot = &scanned
+			newest := "-"
+			if !scanned.Newest.IsZero() {
+				newest = scanned.Newest.Format("2006-01-02 15:04:05")
+			}
+			logger.Info().Msgf("Initial scan of %s: %d files, %s, newest modified %s", path, scanned.Files, formatBytes(scanned.Size), newest)
+		}
+	}
+
+	var sizeTracker *dirSizeTracker
+	var lastSize int64
+	rescanInterval := time.Duration(source.SizeRescanInterval) * time.Second
+	if source.TrackSize && snapshot != nil {
+		sizeTracker = newDirSizeTrackerFromSnapshot(path, *snapshot)
+		lastSize = sizeTracker.total
+		logger.Info().Msgf("Tracking size of %s, currently %s", path, formatBytes(lastSize))
+	} else if source.TrackSize {
+		sizeTracker, err = newDirSizeTracker(path)
+		if err != nil {
+			logger.Error().Err(err).Msgf("Failed to measure directory size, size tracking disabled for %s", path)
+		} else {
+			lastSize = sizeTracker.total
+			logger.Info().Msgf("Tracking size of %s, currently %s", path, formatBytes(lastSize))
+		}
 	}
-	defer watcher.Close()
 
+	// Counting and delivery run in separate goroutines, so a slow notifier
+	// can't keep the watcher's events from being read until its queue
+	// overflows. mu guards what the two share: the counts of the interval
+	// below, the trackers and pending
+	var mu sync.Mutex
 	changeCount := 0
 	totalChangeCount := 0 // Track total changes over time
-	idleTime := 0.0
-	intervalTime := float64(config.NotificationInterval) / 60.0
+	// Distinct paths touched this interval and what happened to them
+	changedFiles := make(map[string]struct{})
+	ops := newOpTracker(source.WatchChmod, feed.now)
+	stable := newStableTracker(source)
+	// Files counted while still growing, for the next notification
+	var growing []string
+	// When the first and last change of the interval or burst were seen
+	var firstChange, lastChange time.Time
+	// overflowed is set when events were lost this interval
+	overflowed := false
+	// watchErrors are the watcher errors this interval; an interval
+	// without any ends a failing state
+	watchErrors := 0
+	// pending are the events counted but not yet passed on to the engine,
+	// which the delivery goroutine is told about through activitySignal,
+	// and pendingFiles the paths among them new to the interval
+	pending := 0
+	pendingFiles := 0
+	activitySignal := make(chan struct{}, 1)
+	// caughtUp lets the delivery goroutine wait for the events already
+	// taken off the feed to be counted before it ends an interval
+	caughtUp := make(chan chan struct{})
+
+	engine := newActivityEngine(source, status, "dir", feed.now)
 	ticker := time.NewTicker(time.Duration(config.NotificationInterval) * time.Second)
+	defer ticker.Stop()
+	if feed.ticks == nil {
+		feed.ticks = ticker.C
+	}
+
+	// With notify_on_settle a burst of changes is reported once it has been
+	// quiet for settle_time, or every max_wait while it keeps going
+	settleTimer := time.NewTimer(time.Duration(source.SettleTime) * time.Second)
+	settleTimer.Stop()
+	maxWaitTimer := time.NewTimer(time.Duration(source.MaxWait) * time.Second)
+	maxWaitTimer.Stop()
+	var burstStart, burstLast time.Time
+
+	// handleEvent counts one event and reports whether it was a change.
+	// While paused only the size is kept up to date. Called with mu held
+	handleEvent := func(event fsnotify.Event, paused bool) bool {
+		recordDirEvent(source, event)
+		if ignoreChecker != nil {
+			if filepath.Base(event.Name) == ".gitignore" {
+				logger.Info().Msgf("%s changed, reloading ignore rules", event.Name)
+				if err := ignoreChecker.Reload(); err != nil {
+					logger.Error().Err(err).Msg("Failed to reload ignore rules")
+				}
+			}
+			ignored, err := ignoreChecker.Ignored(event.Name)
+			if err != nil {
+				logger.Error().Err(err).Msg("Failed to check ignore rules, restarting git check-ignore")
+				if err := ignoreChecker.Reload(); err != nil {
+					logger.Error().Err(err).Msg("Failed to reload ignore rules")
+				}
+			}
+			if ignored {
+				return false
+			}
+		}
+		if sizeTracker != nil {
+			sizeTracker.update(event.Name)
+		}
+		if tree != nil && event.Has(fsnotify.Create) {
+			tree.created(event.Name)
+		} else if tree != nil && (event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename)) {
+			tree.removed(event.Name)
+		}
+		// Permission changes alone are not a change unless watch_chmod
+		if paused || (event.Op == fsnotify.Chmod && !source.WatchChmod) {
+			return false
+		}
+		if source.builtinFilters() && isEditorArtifact(event.Name) {
+			// Still seen by the tracker, which pairs a temporary file
+			// renamed over the original into one modification
+			ops.observeArtifact(event)
+			logger.Debug().Msgf("Ignoring editor artifact %s (%s)", event.Name, event.Op)
+			return false
+		}
+		if stable != nil && stable.hold(event, feed.now()) {
+			// Counted once it has stopped changing, see release below
+			return false
+		}
+		ops.observe(event)
+		changeCount++
+		totalChangeCount++
+		if _, seen := changedFiles[event.Name]; !seen {
+			changedFiles[event.Name] = struct{}{}
+			pendingFiles++
+		}
+		lastChange = feed.now()
+		if firstChange.IsZero() {
+			firstChange = lastChange
+		}
+		return true
+	}
+
+	// intervalFiles is how many files changed so far, the unit of both the
+	// notifications and the session totals. Called with mu held
+	intervalFiles := func() (int, opCounts) {
+		counts := ops.counts()
+		// A file created and moved out of the tree left nothing to
+		// classify, but something did change
+		return max(counts.files(), min(len(changedFiles), 1)), counts
+	}
+
+	// takeInterval fills data with what was counted since the last
+	// notification and starts over. Called with mu held
+	takeInterval := func(data *MessageData) {
+		files, counts := intervalFiles()
+		// The totals got each path as it was first seen, before a create
+		// and rename or a move folded two of them into one file
+		status.correctChanges(files - len(changedFiles))
+		data.Changes = files
+		data.Events = changeCount
+		data.Files = files
+		data.setOps(counts)
+		data.Permissions = ops.permissionChanges(path)
+		data.Moved = ops.moves(path)
+		data.setChangeRange(firstChange, lastChange)
+		data.Growing = strings.Join(growing, ", ")
+		data.Underreported = overflowed
+		changeCount = 0
+		clear(changedFiles)
+		ops.reset()
+		firstChange, lastChange = time.Time{}, time.Time{}
+		growing = nil
+		overflowed = false
+	}
+
+	// Per-event logging can't keep up with a burst, so activity is logged
+	// once per second instead
+	rateTicker := time.NewTicker(time.Second)
+	recentEvents := 0
+	overflows := 0
 
+	// The counting goroutine only reads the feed and counts, it never waits
+	// for the delivery goroutine
 	go func() {
 		for {
 			select {
-			case event, ok := <-watcher.Events:
+			case <-ctx.Done():
+				return
+			case event, ok := <-feed.events:
 				if !ok {
 					return
 				}
-				if event.Op&fsnotify.Write == fsnotify.Write {
-					changeCount++
-					totalChangeCount++
-					log.Info().Msgf("Accumulating changes for directory: %d changes, total changes: %d", changeCount, totalChangeCount)
-					idleTime = 0 // Reset idle time when a change is detected
+				paused := status.paused()
+				mu.Lock()
+				changes := 0
+				if handleEvent(event, paused) {
+					changes++
+				}
+				// Take whatever else is queued before the bookkeeping below
+				emptied := false
+			drain:
+				for range dirEventBatch {
+					select {
+					case event, ok := <-feed.events:
+						if !ok {
+							mu.Unlock()
+							return
+						}
+						if handleEvent(event, paused) {
+							changes++
+						}
+					default:
+						emptied = true
+						break drain
+					}
+				}
+				// Without an overflow signal from the platform, a queue
+				// still full after a whole batch is the best hint
+				if !emptied && !watcherReportsOverflow && cap(feed.events) > 0 && len(feed.events) == cap(feed.events) && !overflowed {
+					overflowed = true
+					status.recordOverflow()
+					logger.Warn().Msgf("Event queue stayed full, some changes in %s may have been missed", path)
+				}
+				pending += changes
+				mu.Unlock()
+				if changes == 0 {
+					continue
+				}
+				recentEvents += changes
+				select {
+				case activitySignal <- struct{}{}:
+				default:
 				}
-			case err, ok := <-watcher.Errors:
+			case <-rateTicker.C:
+				if recentEvents > 0 {
+					mu.Lock()
+					logger.Debug().Msgf("%d events in the last second, %d events on %d paths this interval, %d events in total", recentEvents, changeCount, len(changedFiles), totalChangeCount)
+					mu.Unlock()
+					recentEvents = 0
+				}
+			case err, ok := <-feed.errors:
 				if !ok {
 					return
 				}
-				log.Error().Err(err).Msg("Watcher error")
-			case <-ticker.C:
-				if changeCount > 0 {
-					for _, notification := range config.NotificationSet {
-						if notification.IsChange {
-							notificationMessage := constructNotificationMessage(notification, changeCount, intervalTime, true)
-							log.Debug().Msgf("Sending dir change notification: %s", notificationMessage)
-							err := beeep.Notify("MiniMon Notification", notificationMessage, "")
-							if err != nil {
-								log.Error().Err(err).Msg("Failed to send dir change notification")
-							}
+				if errors.Is(err, fsnotify.ErrEventOverflow) {
+					overflows++
+					mu.Lock()
+					overflowed = true
+					mu.Unlock()
+					status.recordOverflow()
+					logger.Warn().Msgf("Event queue overflowed, some changes in %s were missed (%d times so far)", path, overflows)
+					continue
+				}
+				logger.Error().Err(err).Msg("Watcher error")
+				mu.Lock()
+				watchErrors++
+				mu.Unlock()
+				sourceFailed(source, status, err)
+			case done := <-caughtUp:
+				close(done)
+			}
+		}
+	}()
+
+	// noteActivity passes changes on to the engine and, with
+	// notify_on_settle, starts or extends the burst
+	noteActivity := func(changes int) {
+		engine.activity(changes)
+		if source.NotifyOnSettle {
+			burstLast = feed.now()
+			if burstStart.IsZero() {
+				burstStart = burstLast
+				maxWaitTimer.Reset(time.Duration(source.MaxWait) * time.Second)
+			}
+			settleTimer.Reset(time.Duration(source.SettleTime) * time.Second)
+		}
+	}
+	// takeActivity hands the files changed so far to noteActivity. Another
+	// event on a file already counted is still activity
+	takeActivity := func() {
+		mu.Lock()
+		changes, files := pending, pendingFiles
+		pending, pendingFiles = 0, 0
+		mu.Unlock()
+		if changes > 0 {
+			noteActivity(files)
+		}
+	}
+
+	// The delivery goroutine ends intervals and bursts and sends the
+	// notifications, however long that takes
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-activitySignal:
+				takeActivity()
+			case <-settleTimer.C:
+				maxWaitTimer.Stop()
+				takeActivity()
+				burst := burstLast.Sub(burstStart)
+				data := MessageData{
+					Source:  source.Name,
+					Kind:    kindChange,
+					Minutes: burst.Minutes(),
+				}
+				mu.Lock()
+				if sizeTracker != nil {
+					data.Size = formatBytes(sizeTracker.total)
+				}
+				takeInterval(&data)
+				logger.Info().Msgf("Changes settled: %d files changed (%d events) over %s", data.Files, data.Events, burst.Round(time.Second))
+				// Bursts shorter than settle_time are rated over settle_time
+				data.Velocity = formatVelocity(data.Files, "files", burst, time.Duration(source.SettleTime)*time.Second, source.VelocityUnit)
+				mu.Unlock()
+				engine.notifyChange(data)
+				recordEvent(eventRecord{Source: source.Name, Kind: kindChange, Events: data.Events, Files: data.Files, since: burstLast})
+				burstStart = time.Time{}
+			case <-maxWaitTimer.C:
+				takeActivity()
+				burst := feed.now().Sub(burstStart)
+				mu.Lock()
+				files, counts := intervalFiles()
+				logger.Info().Msgf("Still receiving changes after %s: %d files changed (%d events)", burst.Round(time.Second), files, changeCount)
+				data := MessageData{
+					Source:  source.Name,
+					Kind:    kindChange,
+					Changes: files,
+					Events:  changeCount,
+					Files:   files,
+					Minutes: burst.Minutes(),
+					Detail:  fmt.Sprintf("still receiving changes after %s (%d files so far)", formatDuration(burst), files),
+				}
+				// The burst goes on, so nothing is reset
+				data.setOps(counts)
+				data.Permissions = ops.permissionChanges(path)
+				data.Moved = ops.moves(path)
+				data.setChangeRange(firstChange, lastChange)
+				data.Growing = strings.Join(growing, ", ")
+				data.Underreported = overflowed
+				mu.Unlock()
+				engine.notifyChange(data)
+				maxWaitTimer.Reset(time.Duration(source.MaxWait) * time.Second)
+			case <-feed.ticks:
+				tickStart := feed.now()
+				recordObservation(observation{Source: source.Name, Type: observeTick})
+				done := make(chan struct{})
+				select {
+				case caughtUp <- done:
+					<-done
+				case <-ctx.Done():
+					return
+				}
+				takeActivity()
+				mu.Lock()
+				healthy := watchErrors == 0
+				watchErrors = 0
+				mu.Unlock()
+				// A lost mount is failing until it is watched again
+				if healthy && !status.unavailable() {
+					sourceWorks(source, status)
+				}
+				if !engine.startInterval() {
+					continue
+				}
+				if snapshot != nil {
+					catchUp, err := modifiedSince(path, snapshot.Taken)
+					if err != nil {
+						logger.Error().Err(err).Msgf("Failed to check %s for files written at startup", path)
+					}
+					missed := 0
+					mu.Lock()
+					for _, file := range catchUp {
+						if _, seen := changedFiles[file]; !seen {
+							changedFiles[file] = struct{}{}
+							ops.observe(fsnotify.Event{Name: file, Op: fsnotify.Write})
+							missed++
 						}
 					}
-					changeCount = 0
-				} else {
-					idleTime += intervalTime
-					if idleTime >= float64(config.MaxIdleTime)/60 {
-						log.Info().Msg("Max idle time reached for dir, stopping notifications.")
-						continue
+					changeCount += missed
+					totalChangeCount += missed
+					mu.Unlock()
+					if missed > 0 {
+						engine.activity(missed)
+						logger.Info().Msgf("Counted %d files written since startup", missed)
+					}
+					snapshot = nil
+				}
+				if stable != nil {
+					mu.Lock()
+					released := stable.release(feed.now())
+					newFiles := 0
+					for _, file := range released.paths {
+						if _, seen := changedFiles[file]; !seen {
+							changedFiles[file] = struct{}{}
+							newFiles++
+						}
+						ops.observe(fsnotify.Event{Name: file, Op: fsnotify.Create})
+					}
+					if len(released.paths) > 0 {
+						changeCount += released.events
+						totalChangeCount += released.events
+						if note := released.growingNote(path); note != "" {
+							growing = append(growing, note)
+						}
 					}
-					log.Info().Msgf("No dir changes detected, idle time: %.2f minutes", idleTime)
-					for _, notification := range config.NotificationSet {
-						if notification.IsIdle {
-							notificationMessage := constructNotificationMessage(notification, changeCount, idleTime, false)
-							log.Debug().Msgf("Sending dir idle notification: %s", notificationMessage)
-							err := beeep.Notify("MiniMon Notification", notificationMessage, "")
-							if err != nil {
-								log.Error().Err(err).Msg("Failed to send dir idle notification")
-							}
+					mu.Unlock()
+					if len(released.paths) > 0 {
+						noteActivity(newFiles)
+						logger.Info().Msgf("Counted %d new files once stable, %d of them still growing", len(released.paths), len(released.growing))
+					}
+				}
+				var sizeData MessageData
+				if sizeTracker != nil {
+					// Only this goroutine rescans, so the walk needs no lock
+					var sizes map[string]int64
+					var total int64
+					var err error
+					if sizeTracker.rescanDue(rescanInterval) {
+						if sizes, total, err = scanSizes(path); err != nil {
+							logger.Error().Err(err).Msgf("Failed to rescan directory size for %s", path)
 						}
 					}
+					mu.Lock()
+					if sizes != nil && err == nil {
+						sizeTracker.replace(sizes, total)
+					}
+					sizeData.Size = formatBytes(sizeTracker.total)
+					sizeData.SizeDelta = formatBytesDelta(sizeTracker.total - lastSize)
+					lastSize = sizeTracker.total
+					mu.Unlock()
+					logger.Info().Msgf("Directory size: %s (%s)", sizeData.Size, sizeData.SizeDelta)
 				}
+				mu.Lock()
+				intervalChanges := 0
+				if changeCount > 0 {
+					intervalChanges, _ = intervalFiles()
+				}
+				mu.Unlock()
+				engine.endInterval(intervalChanges)
+				if intervalChanges > 0 && source.NotifyOnSettle {
+					// The burst is reported when it settles
+					continue
+				}
+				if intervalChanges == 0 {
+					engine.idleInterval(tickStart)
+					continue
+				}
+				data := MessageData{
+					Source:    source.Name,
+					Kind:      kindChange,
+					Minutes:   engine.intervalMinutes(),
+					Size:      sizeData.Size,
+					SizeDelta: sizeData.SizeDelta,
+				}
+				mu.Lock()
+				takeInterval(&data)
+				logger.Info().Msgf("Dir changes this interval: %d files changed (%d events), total changes: %d", data.Files, data.Events, status.snapshot().TotalChanges)
+				data.Velocity = engine.velocity(data.Files, "files")
+				mu.Unlock()
+				engine.notifyChange(data)
+				recordEvent(eventRecord{Source: source.Name, Kind: kindChange, Events: data.Events, Files: data.Files, since: tickStart})
 			}
 		}
 	}()
 
-	err = watcher.Add(path)
-	if err != nil {
-		log.Fatal().Err(err).Msg("Failed to add directory to watcher")
+	if tree != nil {
+		if err := tree.add(path); err != nil {
+			return fmt.Errorf("failed to add directory to watcher: %v", err)
+		}
+	} else if watches != nil {
+		if err := watches.add(path); err != nil {
+			return fmt.Errorf("failed to add directory to watcher: %v", err)
+		}
+	}
+	status.markReady()
+
+	if source.CheckMount && watches != nil {
+		go watchMount(ctx, source, status, func() error {
+			if tree != nil {
+				return tree.rewatch()
+			}
+			return watches.add(path)
+		})
 	}
 
-	select {}
+	<-ctx.Done()
+	return nil
+}
+
+// gitMonitor diffs the repository every interval, or takes the counts and
+// ticks from feed when one is given (see replay)
+type gitMonitor struct {
+	monitorBase
+	feed *gitFeed
 }
 
-func monitorGit(filePath string, config NotificationConfig) {
+func newGitMonitor(source Source, status *monitorStatus, feed *gitFeed) *gitMonitor {
+	return &gitMonitor{monitorBase: monitorBase{source: source, status: status}, feed: feed}
+}
+
+func (m *gitMonitor) Start(ctx context.Context) error {
+	source, status, feed := m.source, m.status, m.feed
+	logger := source.logger
+	// Absolute since loadConfig, as git runs from the repository root
+	filePath := source.Path
+	config := source.NotificationConfig
+
 	ticker := time.NewTicker(time.Duration(config.NotificationInterval) * time.Second)
 	defer ticker.Stop()
 
-	var initialChangeCount int
-	var previousChangeCount int
+	var previousStat diffStat
 	var totalChangeCount int
-	idleTime := 0.0
-	intervalTime := float64(config.NotificationInterval) / 60.0
-
-	// Function to fetch the current change count using git diff
-	getChangeCount := func() (int, error) {
-		cmdGetRepoPath := exec.Command("git", "rev-parse", "--show-toplevel")
-		cmdGetRepoPath.Dir = filepath.Dir(filePath)
-		var repoPathOut bytes.Buffer
-		cmdGetRepoPath.Stdout = &repoPathOut
-		err := cmdGetRepoPath.Run()
+
+	var native *nativeRepo
+	var base string
+	var conflicts *conflictWatch
+	if feed == nil {
+		var err error
+		native, err = openGitBackend(source)
 		if err != nil {
-			log.Error().Err(err).Msg("Failed to determine Git repository path")
-			return 0, err
+			logger.Warn().Err(err).Msg("go-git cannot read the repository, running git instead")
 		}
 
-		gitRepoPath := strings.TrimSpace(repoPathOut.String())
+		// Resolved once so a moving branch or the pinned session start
+		// doesn't shift under the counts; a config reload resolves it again
+		base, err = resolveGitBase(filePath, source.GitBase, native)
+		if err != nil {
+			return err
+		}
+		if source.GitBase != "" {
+			logger.Info().Msgf("Diffing %s against %s (%s)", filePath, source.GitBase, base)
+		}
+		if wantsConflicts(source) {
+			conflicts, err = newConflictWatch(source, native)
+			if err != nil {
+				logger.Warn().Msgf("Warning: %v. Skipping conflict detection.", err)
+			}
+		}
+		if source.Upstream != nil {
+			if root, err := gitRepoRoot(filePath, native); err != nil {
+				logger.Warn().Msgf("Warning: %v. Skipping ahead/behind checks.", err)
+			} else {
+				upstream := &upstreamWatch{source: source, root: root, config: *source.Upstream}
+				go upstream.run(ctx, time.Duration(config.NotificationInterval*source.Upstream.Every)*time.Second)
+			}
+		}
+	}
 
-		if err := os.Chdir(gitRepoPath); err != nil {
-			log.Error().Err(err).Msgf("Failed to change directory to %s", gitRepoPath)
-			return 0, err
+	// Sources in the same repository share one git diff per tick
+	var batch *gitBatch
+	if feed == nil && native == nil {
+		var err error
+		batch, err = joinGitBatch(source, base)
+		if err != nil {
+			return fmt.Errorf("failed to get initial change count: %v", err)
 		}
+		defer batch.leave(filePath)
+	}
 
-		// Run git diff to check for changes
-		cmd := exec.Command("git", "diff", "--numstat", "HEAD", filePath)
-		var out bytes.Buffer
-		cmd.Stdout = &out
-		err = cmd.Run()
+	// Function to fetch the current added/removed line counts using git diff
+	getChangeCount := func() (diffStat, error) {
+		if native != nil {
+			stat, err := native.diffStat(base, filePath, source.DiffFilter, source.IgnoreWhitespace, source.IncludeUntracked)
+			if err != nil {
+				logger.Error().Err(err).Msg("Failed to diff the repository")
+			}
+			return stat, err
+		}
 
-		// Handle exit status 1 (no differences found)
+		stat, err := batch.stat(filePath, time.Now())
 		if err != nil {
-			if exitError, ok := err.(*exec.ExitError); ok && exitError.ExitCode() == 1 {
-				log.Info().Msg("No changes detected by git diff")
-				return 0, nil
-			} else {
-				log.Error().Err(err).Msg("Failed to run git diff")
-				return 0, err
-			}
+			logger.Error().Err(err).Msg("Failed to run git diff")
 		}
+		return stat, err
+	}
+	// Only running git takes an exec slot, go-git and replay don't
+	limitExecs := feed == nil && native == nil
+	// HEAD is only needed for the baseline kept in state_file
+	trackHead := feed == nil && keepState
+	currentHead := func() string {
+		head, err := headCommit(filePath, native)
+		if err != nil {
+			logger.Debug().Err(err).Msg("Failed to resolve HEAD, not saving the git baseline")
+		}
+		return head
+	}
+	if feed == nil {
+		feed = &gitFeed{ticks: ticker.C, now: time.Now, changeCount: getChangeCount}
+	}
+	engine := newActivityEngine(source, status, "git", feed.now)
 
-		// Parse the output to count the number of lines changed
-		lines := strings.Split(out.String(), "\n")
-		changeCount := 0
-		for _, line := range lines {
-			if strings.TrimSpace(line) == "" {
-				continue
-			}
-			fields := strings.Fields(line)
-			if len(fields) >= 1 {
-				added, _ := strconv.Atoi(fields[0])
-				removed, _ := strconv.Atoi(fields[1])
-				changeCount += added + removed
+	// Perform the initial check immediately
+	// There's no tick to skip yet, so this waits for a slot
+	if limitExecs && !acquireExec(ctx, 0) {
+		return nil
+	}
+	initialStat, err := feed.changeCount()
+	var head string
+	if trackHead && err == nil {
+		head = currentHead()
+	}
+	if limitExecs {
+		releaseExec()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get initial change count: %v", err)
+	}
+	status.markReady()
+	recordGitStat(source, initialStat)
+	previousStat = initialStat
+	if head != "" {
+		current := newGitBaseline(filePath, head, base, initialStat, time.Now())
+		if saved, ok := restoredState.GitBaselines[source.Name]; ok {
+			if reason := saved.invalidatedBy(current); reason != "" {
+				logger.Info().Msgf("Starting from the current diff rather than the last run's, %s", reason)
+			} else {
+				previousStat = saved.stat()
+				current = newGitBaseline(filePath, head, base, previousStat, time.Now())
+				logger.Info().Msgf("Continuing from the last run's diff (+%d/-%d)", saved.Added, saved.Removed)
 			}
 		}
-		return changeCount, nil
+		status.setGitBaseline(current)
 	}
+	clean := newCleanWatch(source, initialStat, feed.now())
+	logger.Info().Msgf("Beginning with %d changes (+%d/-%d) detected by git.", initialStat.Added+initialStat.Removed, initialStat.Added, initialStat.Removed)
 
-	go func() {
-		// Perform the initial check immediately
-		currentChangeCount, err := getChangeCount()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-feed.ticks:
+		}
+		if limitExecs && !acquireExec(ctx, time.Duration(config.NotificationInterval)*time.Second) {
+			logger.Debug().Msg("No exec slot free within the interval, skipping this check")
+			continue
+		}
+		tickStart := feed.now()
+		if conflicts != nil {
+			conflicts.check(feed.now())
+		}
+		active := engine.startInterval()
+		currentStat, err := feed.changeCount()
+		if trackHead && err == nil {
+			head = currentHead()
+		}
+		if limitExecs {
+			releaseExec()
+		}
 		if err != nil {
-			log.Error().Err(err).Msg("Failed to get initial change count")
-			return
+			sourceFailed(source, status, err)
+			continue
+		}
+		sourceWorks(source, status)
+		recordGitStat(source, currentStat)
+		if head != "" {
+			status.setGitBaseline(newGitBaseline(filePath, head, base, currentStat, time.Now()))
 		}
 
-		// Initialize counts
-		initialChangeCount = currentChangeCount
-		previousChangeCount = currentChangeCount
-		log.Info().Msgf("Beginning with %d changes detected by git.", initialChangeCount)
+		// Calculate the per-direction difference and update counts
+		added, removed := currentStat.delta(previousStat)
+		topFiles := currentStat.topFiles(previousStat)
+		previousStat = currentStat
+		clean.check(currentStat, feed.now(), active)
+		if !active {
+			// The baseline keeps moving so resuming doesn't replay
+			continue
+		}
+		changeDifference := max(added, 0) + max(removed, 0)
+		engine.endInterval(changeDifference)
+		totalChangeCount += changeDifference
+		logger.Info().Msgf("Accumulating changes for git: %d changes (added %+d, removed %+d), total changes: %d", changeDifference, added, removed, totalChangeCount)
+		if changeDifference > 0 {
+			engine.activity(changeDifference)
+			engine.notifyChange(MessageData{
+				Source:   source.Name,
+				Kind:     kindChange,
+				Changes:  changeDifference,
+				Minutes:  engine.intervalMinutes(),
+				Added:    added,
+				Removed:  removed,
+				Velocity: engine.velocity(changeDifference, "lines"),
+				TopFiles: topFiles,
+			})
+			recordEvent(eventRecord{Source: source.Name, Kind: kindChange, Events: changeDifference, Files: 1, since: tickStart})
+		} else {
+			engine.idleInterval(tickStart)
+		}
+	}
+}
 
-		for range ticker.C {
-			currentChangeCount, err := getChangeCount()
-			if err != nil {
-				continue
-			}
+type diffStat struct {
+	Added   int
+	Removed int
+	// Untracked is the number of new files included in Added
+	Untracked int
+	// Files holds the counts per file relative to the repository root
+	Files map[string]lineCounts
+}
 
-			// Calculate the difference and update counts
-			changeDifference := int(math.Abs(float64(currentChangeCount - previousChangeCount)))
-			totalChangeCount += changeDifference
-			log.Info().Msgf("Accumulating changes for git: %d changes, total changes: %d", changeDifference, totalChangeCount)
-			if changeDifference > 0 {
-				for _, notification := range config.NotificationSet {
-					if notification.IsChange {
-						notificationMessage := constructNotificationMessage(notification, changeDifference, intervalTime, true)
-						log.Debug().Msgf("Sending git change notification: %s", notificationMessage)
-						err := beeep.Notify("MiniMon Notification", notificationMessage, "")
-						if err != nil {
-							log.Error().Err(err).Msg("Failed to send git change notification")
-						}
-					}
-				}
-				idleTime = 0 // Reset idle time when changes are detected
-			} else {
-				idleTime += intervalTime
-				if idleTime >= float64(config.MaxIdleTime)/60 {
-					log.Info().Msg("Max idle time reached for git, suppressing further idle notifications.")
-					continue
-				}
-				log.Info().Msgf("No git changes detected, idle time: %.2f minutes", idleTime)
-				for _, notification := range config.NotificationSet {
-					if notification.IsIdle {
-						notificationMessage := constructNotificationMessage(notification, changeDifference, idleTime, false)
-						log.Debug().Msgf("Sending git idle notification: %s", notificationMessage)
-						err := beeep.Notify("MiniMon Notification", notificationMessage, "")
-						if err != nil {
-							log.Error().Err(err).Msg("Failed to send git idle notification")
-						}
-					}
-				}
-			}
+// delta returns the signed per-direction change since previous; negative
+// values mean lines left the diff (reverted, committed or stashed)
+func (s diffStat) delta(previous diffStat) (added, removed int) {
+	return s.Added - previous.Added, s.Removed - previous.Removed
+}
 
-			// Update the previousChangeCount
-			previousChangeCount = currentChangeCount
+func parseNumstat(output string) diffStat {
+	var stat diffStat
+	for _, line := range strings.Split(output, "\n") {
+		// The path may contain spaces, the columns are tab separated
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) < 3 {
+			continue
 		}
-	}()
+		// Binary files report "-" for both counts and are skipped
+		added, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+		removed, _ := strconv.Atoi(fields[1])
+		stat.addFile(numstatPath(fields[2]), added, removed)
+	}
+	return stat
+}
 
-	select {}
+// shutdownChan lets monitors ask main for a clean exit
+var shutdownChan = make(chan string, 1)
+
+func requestShutdown(reason string) {
+	select {
+	case shutdownChan <- reason:
+	default:
+	}
 }
 
 func main() {
-	configPath := os.Getenv("MINIMON_CONFIG")
+	configPath := expandPath(os.Getenv("MINIMON_CONFIG"))
 	if configPath == "" {
-		configPath = "/usr/minimon/config.json"
+		configPath = defaultConfigPath()
 	}
 
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "version", "-version":
+			fmt.Printf("MiniMon %s\n", currentBuild())
+			os.Exit(0)
+		case "test", "-test":
+			os.Exit(runSelfTest(configPath))
+		case "status":
+			os.Exit(runStatus(configPath, os.Args[2:]))
+		case "pause", "resume":
+			os.Exit(runSourceCommand(configPath, os.Args[1], os.Args[2:]))
+		case "replay":
+			os.Exit(runReplay(configPath, os.Args[2:]))
+		case "history":
+			os.Exit(runHistory(configPath, os.Args[2:]))
+		case "report":
+			os.Exit(runReport(configPath, os.Args[2:]))
+		}
+	}
+	flagOverrides, err := parseOverrideFlags(os.Args[1:])
+	if err != nil {
+		os.Exit(2)
+	}
+
+	started := time.Now()
 	config, err := loadConfig(configPath)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Error loading config")
 	}
-
-	logFile, err := setupLogging(config.MonitorProps.LogDir, config.MonitorProps.LogLevel)
+	overrides, err := applyOverrides(config, flagOverrides)
 	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid override")
+	}
+
+	if err := setupLogging(config.MonitorProps); err != nil {
 		log.Warn().Msgf("Warning: %v. Skipping file logging.", err)
-	} else if logFile != nil {
-		defer logFile.Close()
+	}
+	if logs.fallback != nil {
+		log.Warn().Msgf("Warning: %v.", logs.fallback)
+	}
+	if logs.logDir != "" {
+		log.Info().Msgf("Logging to %s", filepath.Join(logs.logDir, "minimon.log"))
+	}
+	defer logs.Close()
+	log.Info().Msgf("Starting MiniMon %s", currentBuild())
+	for _, override := range overrides {
+		log.Info().Msgf("Override applied: %s", override)
+	}
+
+	legacyDurations = config.MonitorProps.LegacyDurations
+	if config.MonitorProps.TimeFormat != "" {
+		timeFormat = config.MonitorProps.TimeFormat
+	}
+	skipAfterSuspend = config.MonitorProps.SkipAfterSuspend
+	dedup.configure(config.MonitorProps)
+	if config.MonitorProps.EventLog != "" {
+		events, err = startEventLog(config.MonitorProps.EventLog)
+		if err != nil {
+			log.Warn().Msgf("Warning: %v. Skipping event log.", err)
+		} else {
+			defer events.Close()
+		}
+	}
+	if config.MonitorProps.HistoryStore != nil {
+		path, _ := historyStorePath(config.MonitorProps)
+		history, err = startHistoryStore(path)
+		if err != nil {
+			log.Warn().Msgf("Warning: %v. Skipping history store.", err)
+		} else {
+			defer history.Close()
+		}
+	}
+	if config.MonitorProps.RecordFile != "" {
+		recorder, err = startRecorder(config.MonitorProps.RecordFile)
+		if err != nil {
+			log.Warn().Msgf("Warning: %v. Skipping recording.", err)
+		} else {
+			defer recorder.Close()
+		}
+	}
+	stream = startStream(config.MonitorProps.Output)
+	if config.MonitorProps.StatsD != nil {
+		statsd = startStatsD(*config.MonitorProps.StatsD)
+	}
+	setupNotifiers(config.MonitorProps, config.Notifiers)
+	if config.MonitorProps.DryRun {
+		log.Info().Msg("Dry run, notifications are printed instead of delivered")
+		dryRunChannels(time.Now)
+	}
+
+	controlListener, err := startControlSocket(config.MonitorProps)
+	if err != nil {
+		log.Warn().Msgf("Warning: %v. Snooze is only available via signal.", err)
+	} else {
+		defer controlListener.Close()
 	}
 
+	if config.MonitorProps.DBus {
+		bus, err = startDBus(config.MonitorSources)
+		if err != nil {
+			log.Warn().Msgf("Warning: %v. Skipping D-Bus signals.", err)
+		} else if bus != nil {
+			defer bus.Close()
+		}
+	}
+
+	idleExit.requireAll = config.MonitorProps.ExitWhen == exitWhenAll
+	histogramBounds, _ = config.MonitorProps.Histograms.withDefaults()
+	if config.MonitorProps.MaxConcurrentExecs > 0 {
+		execSlots = make(chan struct{}, config.MonitorProps.MaxConcurrentExecs)
+	}
+
+	if config.MonitorProps.MetricsListen != "" {
+		if err := startMetrics(config.MonitorProps.MetricsListen); err != nil {
+			log.Warn().Msgf("Warning: %v. Skipping the metrics endpoint.", err)
+		}
+	}
+
+	if config.MonitorProps.DailySummary != nil {
+		go runDailySummary(*config.MonitorProps.DailySummary)
+	}
+	if config.MonitorProps.WeeklyReport != nil {
+		go runWeeklyReport(*config.MonitorProps.WeeklyReport, config)
+	}
+
+	if stateFile := config.MonitorProps.StateFile; stateFile != "" {
+		keepState = true
+		if err := loadState(stateFile); err != nil {
+			log.Warn().Msgf("Warning: %v. Starting with empty state.", err)
+		}
+		defer func() {
+			if err := saveState(stateFile); err != nil {
+				log.Error().Err(err).Msgf("Failed to save state to %s", stateFile)
+			}
+		}()
+		go runStateSaver(stateFile)
+	}
+
+	// The heartbeat and the systemd watchdog are independent, either can
+	// be used alone
+	if config.MonitorProps.Heartbeat != nil {
+		go runHeartbeat(*config.MonitorProps.Heartbeat)
+	}
+	if watchdog := config.MonitorProps.SystemdWatchdog; watchdog == nil || *watchdog {
+		if interval := systemdWatchdogInterval(); interval > 0 {
+			go runSystemdWatchdog(interval)
+		}
+	}
+
+	snoozeChan := make(chan os.Signal, 1)
+	if len(snoozeSignals) > 0 {
+		signal.Notify(snoozeChan, snoozeSignals...)
+	}
+	go func() {
+		for range snoozeChan {
+			snooze.Toggle(time.Duration(config.MonitorProps.SnoozeDuration) * time.Second)
+		}
+	}()
+
 	stopChan := make(chan os.Signal, 1)
 	signal.Notify(stopChan, syscall.SIGINT, syscall.SIGTERM)
 
 	doneChan := make(chan struct{})
+	ctx, stopMonitors := context.WithCancel(context.Background())
 
 	go func() {
 		for _, source := range config.MonitorSources {
+			source.logger = logs.forSource(source)
+			if source.configuredPath != source.Path {
+				source.logger.Info().Msgf("Resolved path %s to %s", source.configuredPath, source.Path)
+			}
+			status := registry.register(source)
+			if source.disabled != "" {
+				source.logger.Info().Msgf("Skipping %s: %s", source.Name, source.disabled)
+				status.setState(stateDisabled)
+				status.markReady()
+				continue
+			}
+			if source.ExitOnMaxIdle {
+				idleExit.register(source.Name)
+			}
+			if source.schedule != nil {
+				startSchedule(source, status)
+			}
+			if source.WatchMissing {
+				go watchMissing(source, status)
+			}
 			switch source.SourceType {
 			case "dir":
 				if _, err := os.Stat(source.Path); os.IsNotExist(err) {
 					log.Warn().Msgf("Invalid source: %s (%s)", source.SourceType, source.Path)
+					idleExit.unregister(source.Name)
+					status.setState(stateInvalid)
+					status.markReady()
+					continue
+				}
+				startMonitor(ctx, dirSourceMonitor(source, status), status)
+
+			case "command":
+				startMonitor(ctx, newCommandMonitor(source, status), status)
+
+			case "files":
+				startMonitor(ctx, newFilesMonitor(source, status), status)
+
+			case "discover":
+				if info, err := os.Stat(source.Path); err != nil || !info.IsDir() {
+					log.Warn().Msgf("Invalid source: %s (%s)", source.SourceType, source.Path)
+					idleExit.unregister(source.Name)
+					status.setState(stateInvalid)
+					status.markReady()
 					continue
 				}
-				go monitorDirectory(source.Path, source.NotificationConfig)
+				startMonitor(ctx, newDiscoverMonitor(source, status), status)
 
 			case "git_file", "file":
 				if _, err := os.Stat(source.Path); os.IsNotExist(err) {
 					log.Warn().Msgf("Invalid source: %s (%s)", source.SourceType, source.Path)
+					idleExit.unregister(source.Name)
+					status.setState(stateInvalid)
+					status.markReady()
 					continue
 				}
 				if source.SourceType == "git_file" {
-					go monitorGit(source.Path, source.NotificationConfig)
+					startMonitor(ctx, newGitMonitor(source, status, nil), status)
+				} else {
+					// Nothing runs for it, so it never goes idle
+					idleExit.unregister(source.Name)
+					status.markReady()
 				}
 
+			case "disk_space":
+				startMonitor(ctx, newDiskSpaceMonitor(source, status), status)
+
+			case "dir_count":
+				startMonitor(ctx, newDirCountMonitor(source, status), status)
+
+			case "process":
+				startMonitor(ctx, newProcessMonitor(source, status), status)
+
+			case "url":
+				startMonitor(ctx, newURLMonitor(source, status), status)
+
+			case "file_appear":
+				// The file is expected not to exist yet, so there is nothing to validate
+				startMonitor(ctx, newFileAppearMonitor(source, status), status)
+
+			case "file_age":
+				// A missing file is reported as stale by the monitor itself
+				startMonitor(ctx, newFileAgeMonitor(source, status), status)
+
 			default:
 				log.Warn().Msgf("Unsupported source type: %s", source.SourceType)
+				idleExit.unregister(source.Name)
+				status.setState(stateInvalid)
+				status.markReady()
 			}
 		}
 
-		// Blocking wait until the stop signal is received
-		<-stopChan
+		go reportReadiness()
+		if config.MonitorProps.ConsoleDashboard && stream != nil {
+			log.Warn().Msg("Warning: stdout carries the NDJSON stream. Skipping console dashboard.")
+		} else if config.MonitorProps.ConsoleDashboard {
+			go runDashboard(config.MonitorSources)
+		}
+
+		// Blocking wait until the stop signal or a monitor asks to exit
+		select {
+		case <-stopChan:
+		case reason := <-shutdownChan:
+			log.Info().Msgf("Exit requested: %s", reason)
+		}
 		log.Info().Msg("Shutting down MiniMon...")
+		sdNotify("STOPPING=1\nSTATUS=Shutting down")
 
-		// Perform cleanup and exit
+		// Perform cleanup and exit. The session report counts what the
+		// monitors were still doing, so they are given time to finish
+		stopMonitors()
+		if !waitTimeout(&runningMonitors, monitorStopTimeout) {
+			log.Warn().Msgf("Warning: monitors still running after %s. Reporting the session without them.", monitorStopTimeout)
+		}
 		close(doneChan)
 	}()
 
 	// Wait until graceful shutdown is completed
 	<-doneChan
+	reportSession(started, config.MonitorProps.NotifyOnExit)
 	log.Info().Msg("MiniMon exited gracefully.")
 }
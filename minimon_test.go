@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/rs/zerolog"
+)
+
+func TestDiffStatDelta(t *testing.T) {
+	tests := []struct {
+		name           string
+		previous       diffStat
+		current        diffStat
+		added, removed int
+	}{
+		{"new lines", diffStat{Added: 10, Removed: 2}, diffStat{Added: 25, Removed: 2}, 15, 0},
+		{"mixed", diffStat{Added: 10, Removed: 2}, diffStat{Added: 14, Removed: 9}, 4, 7},
+		// Reverting work shrinks the diff, which is not progress
+		{"revert", diffStat{Added: 40, Removed: 5}, diffStat{Added: 10, Removed: 5}, -30, 0},
+		{"commit", diffStat{Added: 40, Removed: 12}, diffStat{}, -40, -12},
+		{"unchanged", diffStat{Added: 3, Removed: 3}, diffStat{Added: 3, Removed: 3}, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			added, removed := tt.current.delta(tt.previous)
+			if added != tt.added || removed != tt.removed {
+				t.Errorf("delta = %+d %+d, want %+d %+d", added, removed, tt.added, tt.removed)
+			}
+		})
+	}
+}
+
+func TestParseNumstat(t *testing.T) {
+	tests := []struct {
+		name           string
+		output         string
+		added, removed int
+		files          int
+	}{
+		{"empty", "", 0, 0, 0},
+		{"one file", "3\t1\tmain.go\n", 3, 1, 1},
+		{"several files", "3\t1\tmain.go\n10\t0\tREADME.md\n", 13, 1, 2},
+		{"binary skipped", "-\t-\tlogo.png\n2\t2\tmain.go\n", 2, 2, 1},
+		{"path with spaces", "1\t0\tmy notes.txt\n", 1, 0, 1},
+		{"rename", "4\t2\tdocs/{old.md => new.md}\n", 4, 2, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stat := parseNumstat(tt.output)
+			if stat.Added != tt.added || stat.Removed != tt.removed || len(stat.Files) != tt.files {
+				t.Errorf("parseNumstat = +%d -%d in %d files, want +%d -%d in %d", stat.Added, stat.Removed, len(stat.Files), tt.added, tt.removed, tt.files)
+			}
+		})
+	}
+}
+
+// TestDirMonitorFoldsFiles checks that a file created and renamed, or a
+// move, is one change in the notification and in the session totals
+func TestDirMonitorFoldsFiles(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []fsnotify.Event
+		final  string
+	}{
+		{"created and renamed", []fsnotify.Event{
+			{Name: "draft.txt", Op: fsnotify.Create},
+			{Name: "draft.txt", Op: fsnotify.Write},
+			{Name: "draft.txt", Op: fsnotify.Rename},
+			{Name: "final.txt", Op: fsnotify.Create},
+		}, "final.txt"},
+		{"renamed", []fsnotify.Event{
+			{Name: "old.txt", Op: fsnotify.Rename},
+			{Name: "new.txt", Op: fsnotify.Create},
+		}, "new.txt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := recordNotifications(t)
+			source, status := loadTestSource(t, `{"notification_interval": 60, "notification_set": [{"on_change": "changed"}]}`)
+			writeTestFile(t, source.Path, tt.final, "")
+
+			events := make(chan fsnotify.Event)
+			ticks := make(chan time.Time)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go runMonitor(ctx, newDirMonitor(source, status, &dirFeed{
+				events: events,
+				errors: make(chan error),
+				ticks:  ticks,
+				now:    time.Now,
+			}), status)
+			for _, event := range tt.events {
+				event.Name = filepath.Join(source.Path, event.Name)
+				events <- event
+			}
+			ticks <- time.Now()
+
+			var sent []MessageData
+			for deadline := time.Now().Add(5 * time.Second); len(sent) == 0 && time.Now().Before(deadline); {
+				time.Sleep(10 * time.Millisecond)
+				sent = recorder.take()
+			}
+			if len(sent) != 1 {
+				t.Fatalf("got %d notifications, want 1", len(sent))
+			}
+			if sent[0].Changes != 1 || sent[0].Files != 1 || sent[0].Events != len(tt.events) {
+				t.Errorf("changes %d, files %d, events %d, want 1, 1, %d", sent[0].Changes, sent[0].Files, sent[0].Events, len(tt.events))
+			}
+			if total := status.snapshot().TotalChanges; total != 1 {
+				t.Errorf("total changes = %d, want 1", total)
+			}
+		})
+	}
+}
+
+// sleepyNotifier holds up delivery until released, like a slow network
+// channel
+type sleepyNotifier struct {
+	recordingNotifier
+	asleep  chan struct{}
+	release chan struct{}
+}
+
+func (n *sleepyNotifier) Notify(title, message string, data MessageData) error {
+	n.asleep <- struct{}{}
+	<-n.release
+	return n.recordingNotifier.Notify(title, message, data)
+}
+
+// TestDirMonitorReadsWhileNotifying floods the feed while a notification
+// is stuck in delivery: every event must still be taken off the feed and
+// counted towards the next interval
+func TestDirMonitorReadsWhileNotifying(t *testing.T) {
+	const files, events = 100, 10000
+	source, status := loadTestSource(t, `{"notification_interval": 60, "notification_set": [{"on_change": "changed"}]}`)
+	notifier := &sleepyNotifier{asleep: make(chan struct{}), release: make(chan struct{})}
+	savedChannels, savedDefaults := channels, defaultChannels
+	channels = map[string]Notifier{"sleepy": notifier}
+	defaultChannels = []string{"sleepy"}
+	t.Cleanup(func() { channels, defaultChannels = savedChannels, savedDefaults })
+
+	names := make([]string, files)
+	for i := range names {
+		names[i] = fmt.Sprintf("file%d.txt", i)
+		writeTestFile(t, source.Path, names[i], "")
+		names[i] = filepath.Join(source.Path, names[i])
+	}
+	feed := make(chan fsnotify.Event, 16)
+	ticks := make(chan time.Time)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go runMonitor(ctx, newDirMonitor(source, status, &dirFeed{
+		events: feed,
+		errors: make(chan error),
+		ticks:  ticks,
+		now:    time.Now,
+	}), status)
+
+	feed <- fsnotify.Event{Name: names[0], Op: fsnotify.Write}
+	ticks <- time.Now()
+	select {
+	case <-notifier.asleep:
+	case <-time.After(5 * time.Second):
+		t.Fatal("first notification never sent")
+	}
+
+	flooded := make(chan struct{})
+	go func() {
+		for i := range events {
+			feed <- fsnotify.Event{Name: names[i%files], Op: fsnotify.Write}
+		}
+		close(flooded)
+	}()
+	select {
+	case <-flooded:
+	case <-time.After(10 * time.Second):
+		t.Fatal("events stopped being read while the notifier slept")
+	}
+	close(notifier.release)
+
+	// The next tick waits for the flood to be counted before it ends the
+	// interval
+	go func() { ticks <- time.Now() }()
+	select {
+	case <-notifier.asleep:
+	case <-time.After(5 * time.Second):
+		t.Fatal("second notification never sent")
+	}
+	var sent []MessageData
+	for deadline := time.Now().Add(5 * time.Second); len(sent) < 2 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		sent = append(sent, notifier.take()...)
+	}
+	if len(sent) != 2 {
+		t.Fatalf("got %d notifications, want 2", len(sent))
+	}
+	if sent[1].Events != events || sent[1].Files != files {
+		t.Errorf("second interval counted %d events in %d files, want %d in %d", sent[1].Events, sent[1].Files, events, files)
+	}
+	if total := status.snapshot().TotalChanges; total != 1+files {
+		t.Errorf("total changes = %d, want %d", total, 1+files)
+	}
+}
+
+// BenchmarkDirEventLoop measures how fast the dir monitor takes events off
+// the watcher, which decides how large a burst it can absorb before the
+// watcher's queue overflows
+func BenchmarkDirEventLoop(b *testing.B) {
+	for _, files := range []int{1, 100, 10000} {
+		b.Run(fmt.Sprintf("%d files", files), func(b *testing.B) {
+			dir := b.TempDir()
+			source := Source{Name: b.Name(), SourceType: "dir", Path: dir, logger: zerolog.Nop()}
+			source.NotificationConfig.NotificationInterval = 3600
+			status := registry.register(source)
+			defer registry.unregister(source.Name)
+
+			events := make(chan fsnotify.Event, dirEventBuffer)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go runMonitor(ctx, newDirMonitor(source, status, &dirFeed{
+				events: events,
+				errors: make(chan error),
+				ticks:  make(chan time.Time),
+				now:    time.Now,
+			}), status)
+
+			names := make([]string, files)
+			for i := range names {
+				names[i] = filepath.Join(dir, fmt.Sprintf("file%d.txt", i))
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				events <- fsnotify.Event{Name: names[i%files], Op: fsnotify.Write}
+			}
+			// Done once the loop has taken everything off the queue
+			for len(events) > 0 {
+				time.Sleep(time.Millisecond)
+			}
+		})
+	}
+}
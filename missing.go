@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	defaultMissingDelay  = 5
+	missingCheckInterval = time.Second
+)
+
+// watchMissing notifies when the source path disappears for longer than the
+// confirmation delay and again when it comes back. It runs alongside the
+// source's regular monitor.
+func watchMissing(source Source, status *monitorStatus) {
+	logger := source.logger
+	path := filepath.Clean(source.Path)
+	delay := time.Duration(source.MissingDelay) * time.Second
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		logger.Error().Err(err).Msgf("Failed to create watcher, polling %s for removal", path)
+	} else {
+		defer watcher.Close()
+		if err := watcher.Add(filepath.Dir(path)); isWatchLimitError(err) {
+			logWatchLimit(logger, filepath.Dir(path))
+		} else if err != nil {
+			logger.Warn().Err(err).Msgf("Cannot watch parent of %s, polling for removal", path)
+		}
+	}
+
+	var events chan fsnotify.Event
+	var errs chan error
+	if watcher != nil {
+		events = watcher.Events
+		errs = watcher.Errors
+	}
+
+	ticker := time.NewTicker(missingCheckInterval)
+	defer ticker.Stop()
+
+	missing := false
+	var missingSince time.Time
+
+	evaluate := func() {
+		_, err := os.Stat(path)
+		if err == nil {
+			if missing {
+				downtime := time.Since(missingSince)
+				logger.Info().Msgf("%s is back after %s", path, downtime.Round(time.Second))
+				status.setMissing(false)
+				notifySource(source, MessageData{
+					Source:  source.Name,
+					Kind:    kindRecover,
+					Minutes: downtime.Minutes(),
+					Path:    path,
+					Detail:  fmt.Sprintf("%s is back after %s", path, formatDuration(downtime)),
+				}, true)
+			} else if !missingSince.IsZero() {
+				logger.Debug().Msgf("%s reappeared within the confirmation delay", path)
+			}
+			missing = false
+			missingSince = time.Time{}
+			return
+		}
+
+		if missingSince.IsZero() {
+			missingSince = time.Now()
+			logger.Debug().Msgf("%s not found, confirming in %s", path, delay)
+		}
+		if !missing && time.Since(missingSince) >= delay {
+			missing = true
+			logger.Warn().Msgf("%s is missing", path)
+			status.setMissing(true)
+			notifySource(source, MessageData{
+				Source: source.Name,
+				Kind:   kindMissing,
+				Path:   path,
+				Detail: fmt.Sprintf("%s is missing", path),
+			}, true)
+		}
+	}
+
+	evaluate()
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			if filepath.Clean(event.Name) == path {
+				evaluate()
+			}
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			logger.Error().Err(err).Msg("Watcher error")
+		case <-ticker.C:
+			evaluate()
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Monitor is a source that runs until ctx is done. Start returns an error
+// when the source cannot be monitored at all
+type Monitor interface {
+	Start(ctx context.Context) error
+	Name() string
+	Stats() MonitorStats
+}
+
+// monitorBase holds what every Monitor has
+type monitorBase struct {
+	source Source
+	status *monitorStatus
+}
+
+func (m monitorBase) Name() string {
+	return m.source.Name
+}
+
+func (m monitorBase) Stats() MonitorStats {
+	return m.status.snapshot()
+}
+
+// dirSourceMonitor picks the monitor for a dir source: a symlinkMonitor
+// when its path is a symlink to follow
+func dirSourceMonitor(source Source, status *monitorStatus) Monitor {
+	if target, err := filepath.EvalSymlinks(source.Path); err == nil && target != source.Path && source.followSymlinks() {
+		return newSymlinkMonitor(source, status)
+	}
+	return newDirMonitor(source, status, nil)
+}
+
+// runMonitor starts monitor and marks its source invalid when it fails
+func runMonitor(ctx context.Context, monitor Monitor, status *monitorStatus) {
+	if err := monitor.Start(ctx); err != nil {
+		log.Error().Err(err).Msgf("Cannot monitor %s", monitor.Name())
+		status.setState(stateInvalid)
+		status.markReady()
+	}
+}
+
+// How long shutdown waits for the monitors to finish their last interval
+const monitorStopTimeout = 5 * time.Second
+
+// runningMonitors counts the monitors started with startMonitor, so
+// shutdown can wait for them before reporting the session
+var runningMonitors sync.WaitGroup
+
+// startMonitor runs monitor in its own goroutine until ctx is done
+func startMonitor(ctx context.Context, monitor Monitor, status *monitorStatus) {
+	runningMonitors.Add(1)
+	go func() {
+		defer runningMonitors.Done()
+		runMonitor(ctx, monitor, status)
+	}()
+}
+
+// waitTimeout waits for wg and reports whether it was done within timeout
+func waitTimeout(wg *sync.WaitGroup, timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// activityEngine is the idle and notification bookkeeping shared by the
+// monitors that count changes. They report the changes they see and how
+// each interval ended; the engine keeps the idle time, applies
+// max_idle_time, idle_mode and exit_on_max_idle, and sends the
+// notifications
+type activityEngine struct {
+	source Source
+	status *monitorStatus
+	// label names the source type in log lines
+	label         string
+	idle          *idleClock
+	idleIntervals int // Consecutive idle intervals, drives idle_backoff
+	skipIdle      bool
+	// idleSent is set once this idle streak was notified, for idle_mode once
+	idleSent bool
+	// session is the source's work session, if it has one
+	session *workSession
+}
+
+func newActivityEngine(source Source, status *monitorStatus, label string, now func() time.Time) *activityEngine {
+	interval := time.Duration(source.NotificationConfig.NotificationInterval) * time.Second
+	e := &activityEngine{source: source, status: status, label: label, idle: newIdleClock(interval, now)}
+	if source.Session != nil {
+		e.session = newWorkSession(*source.Session, interval)
+	}
+	return e
+}
+
+// startInterval is called on every tick and reports whether the interval
+// counts. While the source is paused it doesn't; the first interval after
+// a pause starts without idle time
+func (e *activityEngine) startInterval() bool {
+	e.skipIdle = logSuspendGap(e.source.logger, e.idle.tick())
+	if e.status.paused() {
+		return false
+	}
+	if e.status.takeResumed() {
+		// Time spent paused is not idle time
+		e.idle.reset()
+		e.idleIntervals = 0
+		e.idleSent = false
+	}
+	return true
+}
+
+// activity records changes as they are seen and ends an idle streak
+func (e *activityEngine) activity(changes int) {
+	e.status.recordChange(changes)
+	if e.idleIntervals > 0 {
+		sendResume(e.source, e.idle.streak())
+	}
+	e.idle.reset()
+	e.idleIntervals = 0
+	e.idleSent = false
+	idleExit.reset(e.source.Name)
+}
+
+// endInterval records the changes of the interval for the streaks, the
+// histograms and the work session
+func (e *activityEngine) endInterval(changes int) {
+	if minutes, best := e.status.recordInterval(changes); best {
+		sendPersonalBest(e.source, minutes)
+	}
+	if e.session != nil {
+		sendSessionEvent(e.source, e.session, e.session.observe(changes > 0))
+	}
+}
+
+// intervalMinutes is the wall time of the interval that just ended, for
+// the durations in change messages. Ticks come late under load and the
+// ticker drops the ones a busy monitor missed, so it can be longer than
+// notification_interval
+func (e *activityEngine) intervalMinutes() float64 {
+	if e.idle.elapsed <= 0 {
+		return e.idle.interval.Minutes()
+	}
+	return e.idle.elapsed.Minutes()
+}
+
+// velocity is count over the wall time of the interval that just ended,
+// which stays right when a suspend stretched it
+func (e *activityEngine) velocity(count int, what string) string {
+	return formatVelocity(count, what, e.idle.elapsed, e.idle.interval, e.source.VelocityUnit)
+}
+
+func (e *activityEngine) notifyChange(data MessageData) {
+	notifySource(e.source, data, false)
+}
+
+// idleInterval handles an interval without changes that began at since
+func (e *activityEngine) idleInterval(since time.Time) {
+	logger := e.source.logger
+	config := e.source.NotificationConfig
+	idleTime := e.idle.minutes()
+	e.idleIntervals++
+	e.status.recordIdle(idleTime)
+	defer func() {
+		recordEvent(eventRecord{Source: e.source.Name, Kind: kindIdle, IdleMinutes: idleTime, since: since})
+	}()
+
+	maxIdle := float64(config.MaxIdleTime) / 60
+	if idleTime >= maxIdle {
+		if e.source.ExitOnMaxIdle && e.idle.crossed(maxIdle) {
+			exitOnIdle(e.source, idleTime)
+			return
+		}
+		logger.Info().Msgf("Max idle time reached for %s, suppressing further idle notifications.", e.label)
+		suppressEntries(e.source, e.status, kindIdle, suppressMaxIdle)
+		return
+	}
+	logger.Info().Msgf("No %s changes detected, idle time: %.2f minutes", e.label, idleTime)
+	if e.skipIdle {
+		logger.Info().Msg("Skipping idle notification after suspend")
+		suppressEntries(e.source, e.status, kindIdle, suppressAfterSuspend)
+		return
+	}
+	if config.IdleMode == idleModeOnce && e.idleSent {
+		logger.Debug().Msg("Idle notification already sent, waiting for activity")
+		suppressEntries(e.source, e.status, kindIdle, suppressIdleOnce)
+		return
+	}
+	if config.IdleMode == idleModeBackoff && !idleNotificationDue(config.IdleBackoff, e.idleIntervals) {
+		logger.Debug().Msgf("Idle notification deferred by %s backoff", config.IdleBackoff)
+		suppressEntries(e.source, e.status, kindIdle, suppressIdleBackoff)
+		return
+	}
+	e.idleSent = true
+	notifySource(e.source, MessageData{
+		Source:  e.source.Name,
+		Kind:    kindIdle,
+		Path:    e.source.Path,
+		Minutes: idleTime,
+	}, false)
+}
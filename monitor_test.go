@@ -0,0 +1,378 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// blockingMonitor is a Monitor that takes linger to stop once ctx is done
+type blockingMonitor struct {
+	monitorBase
+	linger time.Duration
+}
+
+func (m blockingMonitor) Start(ctx context.Context) error {
+	<-ctx.Done()
+	time.Sleep(m.linger)
+	return nil
+}
+
+func TestWaitTimeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		linger  time.Duration
+		stopped bool
+	}{
+		{"stop in time", 0, true},
+		{"still running", time.Second, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var wg sync.WaitGroup
+			ctx, cancel := context.WithCancel(context.Background())
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				runMonitor(ctx, blockingMonitor{monitorBase{status: &monitorStatus{}}, tt.linger}, &monitorStatus{})
+			}()
+			if waitTimeout(&wg, 50*time.Millisecond) {
+				t.Fatal("returned while the monitor was running")
+			}
+			cancel()
+			if stopped := waitTimeout(&wg, 200*time.Millisecond); stopped != tt.stopped {
+				t.Errorf("waitTimeout = %v, want %v", stopped, tt.stopped)
+			}
+		})
+	}
+}
+
+func TestStartMonitorIsWaitedFor(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	startMonitor(ctx, blockingMonitor{monitorBase{status: &monitorStatus{}}, 0}, &monitorStatus{})
+	if waitTimeout(&runningMonitors, 50*time.Millisecond) {
+		t.Fatal("shutdown would not wait for the monitor")
+	}
+	cancel()
+	if !waitTimeout(&runningMonitors, time.Second) {
+		t.Error("monitor not done after its context was")
+	}
+}
+
+// recordingNotifier is a channel that keeps what it was asked to deliver
+type recordingNotifier struct {
+	mu   sync.Mutex
+	sent []MessageData
+}
+
+func (r *recordingNotifier) Name() string {
+	return "recording"
+}
+
+func (r *recordingNotifier) Notify(title, message string, data MessageData) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sent = append(r.sent, data)
+	return nil
+}
+
+func (r *recordingNotifier) take() []MessageData {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sent := r.sent
+	r.sent = nil
+	return sent
+}
+
+// recordNotifications makes the recording channel the only one for the
+// rest of the test
+func recordNotifications(t *testing.T) *recordingNotifier {
+	t.Helper()
+	recorder := &recordingNotifier{}
+	savedChannels, savedDefaults := channels, defaultChannels
+	channels = map[string]Notifier{"recording": recorder}
+	defaultChannels = []string{"recording"}
+	t.Cleanup(func() { channels, defaultChannels = savedChannels, savedDefaults })
+	return recorder
+}
+
+// loadTestSource loads a dir source with the given notification_config
+// through loadConfig and registers it
+func loadTestSource(t *testing.T, notificationConfig string) (Source, *monitorStatus) {
+	t.Helper()
+	dir := t.TempDir()
+	config := fmt.Sprintf(`{"monitor_sources": [{"name": %q, "source_type": "dir", "path": %q, "notification_config": %s}]}`,
+		t.Name(), filepath.ToSlash(dir), notificationConfig)
+	writeTestFile(t, dir, "config.json", config)
+	loaded, err := loadConfig(filepath.Join(dir, "config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := loaded.MonitorSources[0]
+	source.logger = zerolog.Nop()
+	status := registry.register(source)
+	t.Cleanup(func() { registry.unregister(source.Name) })
+	return source, status
+}
+
+const engineEntries = `"notification_set": [{"on_change": "changed", "on_idle": "idle", "on_resume": "back"}]`
+
+// runEngine drives an engine the way the monitors do, one interval per
+// step: a number of changes, "." for none, "p" to pause for the interval
+// and "r" to resume before it. It returns the kinds notified per step
+func runEngine(t *testing.T, engine *activityEngine, status *monitorStatus, clock *fakeClock, recorder *recordingNotifier, steps string) []string {
+	t.Helper()
+	interval := time.Duration(engine.source.NotificationConfig.NotificationInterval) * time.Second
+	var kinds []string
+	for _, step := range strings.Fields(steps) {
+		switch step {
+		case "p":
+			status.pause()
+		case "r":
+			status.resume()
+		}
+		changes := 0
+		fmt.Sscan(step, &changes)
+		clock.advance(interval / 2)
+		if changes > 0 && !status.paused() {
+			engine.activity(changes)
+		}
+		clock.advance(interval / 2)
+		start := clock.now().Add(-interval)
+		if engine.startInterval() {
+			engine.endInterval(changes)
+			if changes == 0 {
+				engine.idleInterval(start)
+			} else {
+				engine.notifyChange(MessageData{Source: engine.source.Name, Kind: kindChange, Changes: changes, Minutes: engine.intervalMinutes()})
+			}
+		}
+		var notified []string
+		for _, data := range recorder.take() {
+			notified = append(notified, data.Kind)
+		}
+		kinds = append(kinds, strings.Join(notified, "+"))
+	}
+	return kinds
+}
+
+func TestActivityEngine(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		steps  string
+		want   []string
+	}{
+		{"idle every interval",
+			`{"notification_interval": 60, "max_idle_time": 3600, ` + engineEntries + `}`,
+			". . .", []string{"idle", "idle", "idle"}},
+		{"change, then resume after idle",
+			`{"notification_interval": 60, "max_idle_time": 3600, ` + engineEntries + `}`,
+			"2 . 1 1", []string{"change", "idle", "resume+change", "change"}},
+		{"idle_mode once",
+			`{"notification_interval": 60, "max_idle_time": 3600, "idle_mode": "once", ` + engineEntries + `}`,
+			". . . 1 . .", []string{"idle", "", "", "resume+change", "idle", ""}},
+		{"exponential backoff",
+			`{"notification_interval": 60, "max_idle_time": 3600, "idle_backoff": "exponential", ` + engineEntries + `}`,
+			". . . . . . . .", []string{"idle", "", "idle", "", "", "", "idle", ""}},
+		{"linear backoff restarts after activity",
+			`{"notification_interval": 60, "max_idle_time": 3600, "idle_mode": "backoff", "idle_backoff": "linear", ` + engineEntries + `}`,
+			". . . 1 . .", []string{"idle", "", "idle", "resume+change", "idle", ""}},
+		{"max_idle_time stops idle notifications",
+			`{"notification_interval": 60, "max_idle_time": 180, ` + engineEntries + `}`,
+			". . . . 1 .", []string{"idle", "idle", "", "", "resume+change", "idle"}},
+		{"paused intervals are skipped",
+			`{"notification_interval": 60, "max_idle_time": 3600, ` + engineEntries + `}`,
+			". p 3 r . 1", []string{"idle", "", "", "idle", "idle", "resume+change"}},
+		{"no resume without an entry for it",
+			`{"notification_interval": 60, "max_idle_time": 3600, "notification_set": [{"on_change": "changed", "on_idle": "idle"}]}`,
+			". 1", []string{"idle", "change"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := recordNotifications(t)
+			source, status := loadTestSource(t, tt.config)
+			clock := &fakeClock{t: time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)}
+			engine := newActivityEngine(source, status, "dir", clock.now)
+			if got := runEngine(t, engine, status, clock, recorder, tt.steps); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("notified %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestActivityEngineIdleTime(t *testing.T) {
+	defer func(saved bool) { skipAfterSuspend = saved }(skipAfterSuspend)
+	skipAfterSuspend = true
+	recorder := recordNotifications(t)
+	source, status := loadTestSource(t, `{"notification_interval": 60, "max_idle_time": 36000, `+engineEntries+`}`)
+	clock := &fakeClock{t: time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)}
+	engine := newActivityEngine(source, status, "dir", clock.now)
+	idleMinutes := func() []float64 {
+		var minutes []float64
+		for _, data := range recorder.take() {
+			minutes = append(minutes, data.Minutes)
+		}
+		return minutes
+	}
+
+	// Time spent paused is not idle time
+	runEngine(t, engine, status, clock, recorder, ". . p . r .")
+	if got := status.snapshot().IdleMinutes; got != 1 {
+		t.Errorf("idle minutes after a pause = %v, want 1", got)
+	}
+
+	// The night is idle time, but its notification is skipped
+	clock.advance(8 * time.Hour)
+	if engine.startInterval() {
+		engine.endInterval(0)
+		engine.idleInterval(clock.now())
+	}
+	if got := idleMinutes(); len(got) != 0 {
+		t.Errorf("notified %v right after a suspend", got)
+	}
+	runEngine(t, engine, status, clock, recorder, ".")
+	if got := status.snapshot().IdleMinutes; got != 482 {
+		t.Errorf("idle minutes after a suspend = %v, want 482", got)
+	}
+	idleMinutes()
+
+	// The tick after a late one reports the wall time of its interval
+	runEngine(t, engine, status, clock, recorder, "1")
+	clock.advance(150 * time.Second)
+	engine.startInterval()
+	if got := engine.intervalMinutes(); got != 2.5 {
+		t.Errorf("interval minutes of a late tick = %v, want 2.5", got)
+	}
+}
+
+func TestActivityEngineIntervalMinutes(t *testing.T) {
+	tests := []struct {
+		name  string
+		ticks []time.Duration // wall time before each tick
+		want  float64
+	}{
+		{"before the first tick", nil, 1},
+		{"on time", []time.Duration{time.Minute}, 1},
+		{"late", []time.Duration{150 * time.Second}, 2.5},
+		{"early", []time.Duration{45 * time.Second}, 0.75},
+		{"only the last interval counts", []time.Duration{3 * time.Minute, time.Minute}, 1},
+		{"late after a missed tick", []time.Duration{time.Minute, 2 * time.Minute}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source, status := loadTestSource(t, `{"notification_interval": 60, "max_idle_time": 3600, `+engineEntries+`}`)
+			clock := &fakeClock{t: time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)}
+			engine := newActivityEngine(source, status, "dir", clock.now)
+			for _, gap := range tt.ticks {
+				clock.advance(gap)
+				engine.startInterval()
+			}
+			if got := engine.intervalMinutes(); got != tt.want {
+				t.Errorf("intervalMinutes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestActivityEngineExitOnMaxIdle(t *testing.T) {
+	recorder := recordNotifications(t)
+	source, status := loadTestSource(t, `{"notification_interval": 60, "max_idle_time": 120, `+engineEntries+`}`)
+	source.ExitOnMaxIdle = true
+	idleExit.register(source.Name)
+	defer func() {
+		select {
+		case <-shutdownChan:
+		default:
+		}
+	}()
+	clock := &fakeClock{t: time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)}
+	engine := newActivityEngine(source, status, "dir", clock.now)
+
+	runEngine(t, engine, status, clock, recorder, ".")
+	select {
+	case reason := <-shutdownChan:
+		t.Fatalf("shut down before max_idle_time: %s", reason)
+	default:
+	}
+	runEngine(t, engine, status, clock, recorder, ".")
+	select {
+	case <-shutdownChan:
+	default:
+		t.Fatal("no shutdown at max_idle_time")
+	}
+}
+
+func TestMonitorsStartAndStop(t *testing.T) {
+	dir := t.TempDir()
+	missing := filepath.Join(dir, "missing")
+	tests := []struct {
+		name    string
+		monitor func(Source, *monitorStatus) Monitor
+		source  Source
+		invalid bool
+	}{
+		{"command", func(s Source, st *monitorStatus) Monitor { return newCommandMonitor(s, st) },
+			Source{Command: []string{"true"}, Timeout: 5}, false},
+		{"command not found", func(s Source, st *monitorStatus) Monitor { return newCommandMonitor(s, st) },
+			Source{Command: []string{"minimon-no-such-command"}, Timeout: 5}, true},
+		{"disk_space", func(s Source, st *monitorStatus) Monitor { return newDiskSpaceMonitor(s, st) },
+			Source{Path: dir, MinFree: "1%"}, false},
+		{"disk_space missing", func(s Source, st *monitorStatus) Monitor { return newDiskSpaceMonitor(s, st) },
+			Source{Path: missing, MinFree: "1%"}, true},
+		{"dir_count", func(s Source, st *monitorStatus) Monitor { return newDirCountMonitor(s, st) },
+			Source{Path: dir, MaxFiles: 10}, false},
+		{"dir_count missing", func(s Source, st *monitorStatus) Monitor { return newDirCountMonitor(s, st) },
+			Source{Path: missing, MaxFiles: 10}, true},
+		{"file_age", func(s Source, st *monitorStatus) Monitor { return newFileAgeMonitor(s, st) },
+			Source{Path: missing, MaxAge: "1h"}, false},
+		{"file_appear", func(s Source, st *monitorStatus) Monitor { return newFileAppearMonitor(s, st) },
+			Source{Path: missing}, false},
+		{"url", func(s Source, st *monitorStatus) Monitor { return newURLMonitor(s, st) },
+			Source{Path: "http://127.0.0.1:1/", Timeout: 1, FailureThreshold: 3}, false},
+		{"process", func(s Source, st *monitorStatus) Monitor { return newProcessMonitor(s, st) },
+			Source{ProcessName: "^minimon-no-such-process$"}, false},
+	}
+	recordNotifications(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.name == "process" && !processSupported {
+				t.Skip("process sources are Linux only")
+			}
+			source := tt.source
+			source.Name = t.Name()
+			source.logger = zerolog.Nop()
+			source.NotificationConfig.NotificationInterval = 60
+			source.NotificationConfig.MaxIdleTime = 3600
+			status := registry.register(source)
+			defer registry.unregister(source.Name)
+
+			var wg sync.WaitGroup
+			ctx, cancel := context.WithCancel(context.Background())
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				runMonitor(ctx, tt.monitor(source, status), status)
+			}()
+			select {
+			case <-status.ready:
+			case <-time.After(5 * time.Second):
+				t.Fatal("monitor never became ready")
+			}
+			if invalid := status.snapshot().State == stateInvalid; invalid != tt.invalid {
+				t.Errorf("invalid = %v, want %v", invalid, tt.invalid)
+			}
+			cancel()
+			if !waitTimeout(&wg, 5*time.Second) {
+				t.Error("monitor still running after it was stopped")
+			}
+		})
+	}
+}
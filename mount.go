@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+const defaultMountTimeout = 5 * time.Second
+
+func validCheckMount(source Source) error {
+	if source.MountTimeout != "" {
+		if !source.CheckMount {
+			return fmt.Errorf("mount_timeout needs check_mount")
+		}
+		timeout, err := time.ParseDuration(source.MountTimeout)
+		if err != nil || timeout <= 0 {
+			return fmt.Errorf("invalid mount_timeout: %s", source.MountTimeout)
+		}
+	}
+	if source.CheckMount && source.SourceType != "dir" {
+		return fmt.Errorf("check_mount needs a dir source")
+	}
+	return nil
+}
+
+type statResult struct {
+	info os.FileInfo
+	err  error
+}
+
+// mountCheck stats a dir source's path with a deadline, so a hung network
+// mount shows up as unavailable instead of blocking its caller
+type mountCheck struct {
+	path    string
+	timeout time.Duration
+	// device is the filesystem the path was on at startup, if the platform
+	// reports one
+	device    uint64
+	hasDevice bool
+	// inflight is a stat that has not returned yet. The next check waits
+	// for it rather than piling up another
+	inflight chan statResult
+}
+
+func newMountCheck(source Source) *mountCheck {
+	check := &mountCheck{path: source.Path, timeout: defaultMountTimeout}
+	if source.MountTimeout != "" {
+		check.timeout, _ = time.ParseDuration(source.MountTimeout)
+	}
+	if info, err := check.stat(); err == nil {
+		check.device, check.hasDevice = deviceID(info)
+	}
+	return check
+}
+
+func (c *mountCheck) stat() (os.FileInfo, error) {
+	if c.inflight == nil {
+		result := make(chan statResult, 1)
+		go func() {
+			info, err := os.Stat(c.path)
+			result <- statResult{info, err}
+		}()
+		c.inflight = result
+	}
+	timer := time.NewTimer(c.timeout)
+	defer timer.Stop()
+	select {
+	case result := <-c.inflight:
+		c.inflight = nil
+		return result.info, result.err
+	case <-timer.C:
+		return nil, fmt.Errorf("stat did not return within %s", c.timeout)
+	}
+}
+
+// problem says why the path is unavailable, or is empty when it is fine
+func (c *mountCheck) problem() string {
+	info, err := c.stat()
+	if err != nil {
+		return err.Error()
+	}
+	if device, ok := deviceID(info); ok && c.hasDevice && device != c.device {
+		// Usually the mount went away and this is the empty mount point
+		return "no longer on the filesystem it was on at startup"
+	}
+	return ""
+}
+
+// watchMount checks every interval that a dir source's filesystem is still
+// mounted, notifying when it goes away and when it returns. rewatch adds
+// the watches again once it is back, since the old ones went with the mount
+func watchMount(ctx context.Context, source Source, status *monitorStatus, rewatch func() error) {
+	logger := source.logger
+	check := newMountCheck(source)
+	if !check.hasDevice {
+		logger.Debug().Msgf("No device ID for %s, only checking that it can be read", source.Path)
+	}
+
+	ticker := time.NewTicker(time.Duration(source.NotificationConfig.NotificationInterval) * time.Second)
+	defer ticker.Stop()
+
+	var unavailableSince time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		problem := check.problem()
+		if problem != "" {
+			sourceFailed(source, status, errors.New(problem))
+		}
+		switch {
+		case problem != "" && unavailableSince.IsZero():
+			unavailableSince = time.Now()
+			logger.Error().Msgf("%s is unavailable: %s", source.Path, problem)
+			status.setUnavailable(problem)
+			notifySource(source, MessageData{
+				Source: source.Name,
+				Kind:   kindMissing,
+				Path:   source.Path,
+				Detail: fmt.Sprintf("%s is unavailable: %s", source.Path, problem),
+			}, true)
+		case problem == "" && !unavailableSince.IsZero():
+			// Still unavailable until it is watched again, so a failure
+			// here is retried next interval
+			if err := rewatch(); err != nil {
+				logger.Error().Err(err).Msgf("Failed to watch %s again", source.Path)
+				sourceFailed(source, status, err)
+				continue
+			}
+			downtime := time.Since(unavailableSince)
+			unavailableSince = time.Time{}
+			logger.Info().Msgf("%s is available again after %s", source.Path, downtime.Round(time.Second))
+			status.setUnavailable("")
+			notifySource(source, MessageData{
+				Source:  source.Name,
+				Kind:    kindRecover,
+				Minutes: downtime.Minutes(),
+				Path:    source.Path,
+				Detail:  fmt.Sprintf("%s is available again after %s", source.Path, formatDuration(downtime)),
+			}, true)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	defaultMQTTTopicPrefix = "minimon"
+	defaultMQTTBufferSize  = 100
+	defaultMQTTTimeout     = 10
+	mqttMaxReconnectDelay  = 2 * time.Minute
+)
+
+type MQTTTLSConfig struct {
+	CAFile             string `json:"ca_file"`
+	CertFile           string `json:"cert_file"`
+	KeyFile            string `json:"key_file"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"`
+}
+
+type MQTTConfig struct {
+	Broker      string         `json:"broker"`
+	TopicPrefix string         `json:"topic_prefix"`
+	QoS         byte           `json:"qos"`
+	Retain      bool           `json:"retain"`
+	ClientID    string         `json:"client_id"`
+	Username    string         `json:"username"`
+	Password    string         `json:"password"`
+	TLS         *MQTTTLSConfig `json:"tls,omitempty"`
+	BufferSize  int            `json:"buffer_size"`
+	Timeout     int            `json:"timeout"`
+}
+
+type mqttEvent struct {
+	Source      string    `json:"source"`
+	Kind        string    `json:"kind"`
+	Changes     int       `json:"changes"`
+	IdleMinutes float64   `json:"idle_minutes"`
+	Message     string    `json:"message"`
+	Urgency     string    `json:"urgency,omitempty"`
+	Timestamp   time.Time `json:"ts"`
+}
+
+type mqttMessage struct {
+	topic   string
+	payload []byte
+}
+
+type mqttNotifier struct {
+	config MQTTConfig
+	client paho.Client
+	queue  chan mqttMessage
+}
+
+func newMQTTNotifier(config MQTTConfig) (*mqttNotifier, error) {
+	if config.Broker == "" {
+		return nil, fmt.Errorf("mqtt requires a broker url")
+	}
+	if config.QoS > 2 {
+		return nil, fmt.Errorf("invalid mqtt qos: %d", config.QoS)
+	}
+	if config.TopicPrefix == "" {
+		config.TopicPrefix = defaultMQTTTopicPrefix
+	}
+	if config.BufferSize <= 0 {
+		config.BufferSize = defaultMQTTBufferSize
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaultMQTTTimeout
+	}
+	if config.ClientID == "" {
+		hostname, _ := os.Hostname()
+		config.ClientID = fmt.Sprintf("minimon-%s-%d", hostname, os.Getpid())
+	}
+
+	opts := paho.NewClientOptions().
+		AddBroker(config.Broker).
+		SetClientID(config.ClientID).
+		SetUsername(config.Username).
+		SetPassword(config.Password).
+		SetConnectTimeout(time.Duration(config.Timeout) * time.Second).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetMaxReconnectInterval(mqttMaxReconnectDelay).
+		SetConnectionLostHandler(func(_ paho.Client, err error) {
+			log.Warn().Err(err).Msg("MQTT connection lost, reconnecting")
+		}).
+		SetOnConnectHandler(func(_ paho.Client) {
+			log.Info().Msgf("Connected to MQTT broker %s", config.Broker)
+		})
+
+	if config.TLS != nil {
+		tlsConfig, err := mqttTLSConfig(*config.TLS)
+		if err != nil {
+			return nil, err
+		}
+		opts.SetTLSConfig(tlsConfig)
+	}
+
+	m := &mqttNotifier{
+		config: config,
+		client: paho.NewClient(opts),
+		queue:  make(chan mqttMessage, config.BufferSize),
+	}
+
+	// With ConnectRetry the client keeps retrying in the background, so
+	// startup is never blocked on an unreachable broker
+	m.client.Connect()
+	go m.publishLoop()
+
+	return m, nil
+}
+
+func mqttTLSConfig(config MQTTTLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: config.InsecureSkipVerify}
+
+	if config.CAFile != "" {
+		ca, err := os.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read mqtt ca file: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in %s", config.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if config.CertFile != "" || config.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not load mqtt client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+func (m *mqttNotifier) Name() string {
+	return "mqtt"
+}
+
+// Notify only queues the event; delivery happens in publishLoop so a slow or
+// unreachable broker never blocks the monitor loops
+func (m *mqttNotifier) Notify(title, message string, data MessageData) error {
+	msg, err := m.message(message, data)
+	if err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case m.queue <- msg:
+			return nil
+		default:
+		}
+		// Buffer is full: drop the oldest event to make room for the newest
+		select {
+		case dropped := <-m.queue:
+			log.Warn().Msgf("MQTT buffer full, dropped event for %s", dropped.topic)
+		default:
+		}
+	}
+}
+
+func (m *mqttNotifier) message(message string, data MessageData) (mqttMessage, error) {
+	event := mqttEvent{
+		Source:    data.Source,
+		Kind:      data.Kind,
+		Changes:   data.Changes,
+		Message:   message,
+		Urgency:   data.Urgency,
+		Timestamp: time.Now(),
+	}
+	if data.Kind == kindIdle {
+		event.IdleMinutes = data.Minutes
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return mqttMessage{}, err
+	}
+
+	return mqttMessage{
+		topic:   strings.Join([]string{m.config.TopicPrefix, mqttTopicSegment(data.Source), data.Kind}, "/"),
+		payload: payload,
+	}, nil
+}
+
+func (m *mqttNotifier) NotifySync(title, message string, data MessageData, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for !m.client.IsConnectionOpen() {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("not connected to %s", m.config.Broker)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	msg, err := m.message(message, data)
+	if err != nil {
+		return err
+	}
+	token := m.client.Publish(msg.topic, m.config.QoS, m.config.Retain, msg.payload)
+	if !token.WaitTimeout(time.Until(deadline)) {
+		return fmt.Errorf("timed out publishing to %s", msg.topic)
+	}
+	return token.Error()
+}
+
+func (m *mqttNotifier) publishLoop() {
+	timeout := time.Duration(m.config.Timeout) * time.Second
+	for msg := range m.queue {
+		for !m.client.IsConnectionOpen() {
+			time.Sleep(time.Second)
+		}
+
+		token := m.client.Publish(msg.topic, m.config.QoS, m.config.Retain, msg.payload)
+		if !token.WaitTimeout(timeout) {
+			log.Error().Msgf("Timed out publishing MQTT event to %s", msg.topic)
+			continue
+		}
+		if err := token.Error(); err != nil {
+			log.Error().Err(err).Msgf("Failed to publish MQTT event to %s", msg.topic)
+			continue
+		}
+		log.Debug().Msgf("Published MQTT event to %s", msg.topic)
+	}
+}
+
+// mqttTopicSegment keeps source names from introducing extra topic levels
+// or wildcards
+func mqttTopicSegment(name string) string {
+	return strings.NewReplacer("/", "_", "+", "_", "#", "_").Replace(name)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Notification daemons and Windows toasts cut long messages off wherever
+// they like, so the desktop channel has a limit unless max_length says
+// otherwise. Other channels take any length
+const defaultDesktopMaxLength = 200
+
+// Shorter than this, the text between head and tail is not worth keeping
+const minBodyLength = 20
+
+const ellipsis = "…"
+
+// maxLengths is each channel's max_length in characters, 0 for no limit
+var maxLengths map[string]int
+
+// fitMessage shortens message to the channel's max_length. The file lists
+// in data give way first, then the text between the entry's head and tail
+// is cut at a word boundary, so both stay readable
+func fitMessage(channel string, notification Notification, data MessageData, message string) string {
+	limit := maxLengths[channel]
+	if limit <= 0 || utf8.RuneCountInString(message) <= limit {
+		return message
+	}
+
+	// Each list in the message is first cut to its first item, then to a
+	// count of files
+	lists := []string{data.TopFiles, data.ChangedFiles, data.Moved, data.Permissions, data.Growing}
+	for step := range 2 {
+		for i, list := range lists {
+			if list == "" || !strings.Contains(message, list) {
+				continue
+			}
+			first, count := listItems(list)
+			var short string
+			switch {
+			case step == 0 && count == 1:
+				continue
+			case step == 0:
+				short = fmt.Sprintf("%s and %d more", first, count-1)
+			case count == 1:
+				short = "1 file"
+			default:
+				short = fmt.Sprintf("%d files", count)
+			}
+			message = strings.Replace(message, list, short, 1)
+			lists[i] = short
+		}
+		if utf8.RuneCountInString(message) <= limit {
+			return message
+		}
+	}
+
+	head := strings.TrimSpace(notification.NotificationHead)
+	tail := strings.TrimSpace(notification.NotificationTail)
+	// With room for the body, the message is longer than head and tail
+	// together, so they don't overlap
+	room := limit - utf8.RuneCountInString(head) - utf8.RuneCountInString(tail) - 2
+	if (head != "" || tail != "") && room >= minBodyLength && strings.HasPrefix(message, head) && strings.HasSuffix(message, tail) {
+		body := strings.TrimSpace(message[len(head) : len(message)-len(tail)])
+		return joinNonEmpty(head, truncateWords(body, room), tail)
+	}
+	return truncateWords(message, limit)
+}
+
+// listItems returns the first item of a list like "a, b, 3 more" or
+// "a and 4 more" and how many files it names
+func listItems(list string) (string, int) {
+	if first, more, ok := strings.Cut(list, " and "); ok {
+		var count int
+		if _, err := fmt.Sscanf(more, "%d more", &count); err == nil {
+			return first, count + 1
+		}
+	}
+	items := strings.Split(list, ", ")
+	count := len(items)
+	var more int
+	if _, err := fmt.Sscanf(items[len(items)-1], "%d more", &more); err == nil && count > 1 {
+		count += more - 1
+	}
+	return items[0], count
+}
+
+// truncateWords cuts text to limit characters at the last word boundary,
+// ending it with an ellipsis. A single long word is cut where it must be,
+// and a limit that leaves no room next to the ellipsis cuts without one
+func truncateWords(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+	room := limit - utf8.RuneCountInString(ellipsis)
+	if room < 1 {
+		return string(runes[:max(limit, 0)])
+	}
+	cut := string(runes[:room])
+	if space := strings.LastIndexByte(cut, ' '); space > len(cut)/2 {
+		cut = cut[:space]
+	}
+	return strings.TrimRight(cut, " ,.;:-") + ellipsis
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+	"unicode/utf8"
+)
+
+func TestFitMessageSmallLimit(t *testing.T) {
+	saved := maxLengths
+	t.Cleanup(func() { maxLengths = saved })
+
+	tests := []struct {
+		name    string
+		limit   int
+		head    string
+		tail    string
+		message string
+		want    string
+	}{
+		{"below the ellipsis", 1, "", "", "thesis changed", "t"},
+		{"just above the ellipsis", 2, "", "", "thesis changed", "t…"},
+		{"overlapping head and tail", 1, "ab", "b c", "ab c", "a"},
+		{"head and tail without room", 5, "Changes in", "Keep going", "Changes in thesis Keep going", "Chan…"},
+		{"word boundary", 12, "", "", "thesis changed a lot", "thesis…"},
+		{"room for the body", 40, "Changes:", "Keep going", "Changes: 12 files in thesis, notes and drafts Keep going", "Changes: 12 files in… Keep going"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			maxLengths = map[string]int{"desktop": tt.limit}
+			notification := Notification{NotificationHead: tt.head, NotificationTail: tt.tail}
+			got := fitMessage("desktop", notification, MessageData{}, tt.message)
+			if got != tt.want {
+				t.Errorf("fitMessage = %q, want %q", got, tt.want)
+			}
+			if n := utf8.RuneCountInString(got); n > tt.limit {
+				t.Errorf("%d characters, limit %d", n, tt.limit)
+			}
+		})
+	}
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/rs/zerolog/log"
+)
+
+const notificationTitle = "MiniMon Notification"
+
+// Notification kinds passed to notifiers so they can adapt presentation
+const (
+	kindChange = "change"
+	kindIdle   = "idle"
+	kindTest   = "test"
+
+	kindMissing = "missing"
+	kindRecover = "recover"
+	kindSummary = "summary"
+	kindSession = "session"
+	kindResume  = "resume"
+
+	kindConflict = "conflict"
+	kindUpstream = "upstream"
+
+	kindSuppressed = "suppressed"
+
+	kindPersonalBest = "personal_best"
+
+	kindBreak     = "break"
+	kindBreakOver = "break_over"
+
+	kindClean = "clean"
+
+	kindError        = "error"
+	kindErrorRecover = "error_recover"
+)
+
+// Notification urgencies. Desktop notifications use them as the urgency
+// hint where supported; critical ones also use beeep.Alert
+const (
+	urgencyLow      = "low"
+	urgencyNormal   = "normal"
+	urgencyCritical = "critical"
+)
+
+func validUrgency(urgency string) error {
+	switch urgency {
+	case "", urgencyLow, urgencyNormal, urgencyCritical:
+		return nil
+	}
+	return fmt.Errorf("unknown urgency: %s", urgency)
+}
+
+type Notifier interface {
+	Name() string
+	Notify(title, message string, data MessageData) error
+}
+
+type desktopNotifier struct{}
+
+func (desktopNotifier) Name() string {
+	return "desktop"
+}
+
+func (desktopNotifier) Notify(title, message string, data MessageData) error {
+	if !desktopState.available() {
+		return errDesktopBackoff
+	}
+	err := guardDesktop(func() error { return lockedDesktop.deliver(title, message, data) })
+	desktopState.record(err)
+	return err
+}
+
+// NotifierConfig is one entry of the top-level "notifiers" map. Everything
+// besides "type" is decoded into that notifier's own config
+type NotifierConfig struct {
+	Type string `json:"type"`
+	// MaxLength caps the messages sent through the channel, see fitMessage
+	MaxLength *int `json:"max_length,omitempty"`
+	raw       json.RawMessage
+}
+
+func (c *NotifierConfig) UnmarshalJSON(data []byte) error {
+	var head struct {
+		Type      string `json:"type"`
+		MaxLength *int   `json:"max_length"`
+	}
+	if err := json.Unmarshal(data, &head); err != nil {
+		return err
+	}
+	c.Type = head.Type
+	c.MaxLength = head.MaxLength
+	c.raw = append(json.RawMessage(nil), data...)
+	return nil
+}
+
+func newNotifier(name string, config NotifierConfig) (Notifier, error) {
+	switch config.Type {
+	case "desktop":
+		return desktopNotifier{}, nil
+	case "gotify":
+		var gotify GotifyConfig
+		if err := json.Unmarshal(config.raw, &gotify); err != nil {
+			return nil, err
+		}
+		return newGotifyNotifier(gotify)
+	case "mqtt":
+		var mqtt MQTTConfig
+		if err := json.Unmarshal(config.raw, &mqtt); err != nil {
+			return nil, err
+		}
+		return newMQTTNotifier(mqtt)
+	case "file":
+		var file FileNotifierConfig
+		if err := json.Unmarshal(config.raw, &file); err != nil {
+			return nil, err
+		}
+		return newFileNotifier(name, file)
+	case "discord":
+		var discord DiscordConfig
+		if err := json.Unmarshal(config.raw, &discord); err != nil {
+			return nil, err
+		}
+		return newDiscordNotifier(discord)
+	case "pushover":
+		var pushover PushoverConfig
+		if err := json.Unmarshal(config.raw, &pushover); err != nil {
+			return nil, err
+		}
+		return newPushoverNotifier(pushover)
+	}
+	return nil, fmt.Errorf("unknown notifier type: %q", config.Type)
+}
+
+// channels holds every configured notifier by name. Notification entries
+// without "channels" use defaultChannels: desktop plus the gotify/mqtt
+// notifiers configured in monitor_props. headlessChannels are the desktop
+// channels left out with "desktop_notifications": false, which entries
+// skip without an error
+var (
+	channels         map[string]Notifier
+	defaultChannels  []string
+	headlessChannels map[string]bool
+)
+
+// builtinChannels are the channel names available without a "notifiers"
+// entry
+func builtinChannels(props MonitorProps) []string {
+	names := []string{"desktop", "console"}
+	if props.Gotify != nil {
+		names = append(names, "gotify")
+	}
+	if props.MQTT != nil {
+		names = append(names, "mqtt")
+	}
+	return names
+}
+
+func setupNotifiers(props MonitorProps, configs map[string]NotifierConfig) {
+	channels = map[string]Notifier{"console": consoleNotifier{}}
+	defaultWhenLocked = whenLockedQueue
+	if props.WhenLocked != "" {
+		defaultWhenLocked = props.WhenLocked
+	}
+	defaultChannels = nil
+	maxLengths = make(map[string]int)
+	headlessChannels = make(map[string]bool)
+	// Headless, nothing reaches the desktop code, so no notification
+	// daemon or session bus is ever looked for
+	headless := props.DesktopNotifications != nil && !*props.DesktopNotifications
+	if headless {
+		log.Info().Msg("Desktop notifications are off")
+		headlessChannels["desktop"] = true
+	} else {
+		channels["desktop"] = desktopNotifier{}
+		defaultChannels = append(defaultChannels, "desktop")
+		maxLengths["desktop"] = defaultDesktopMaxLength
+	}
+	auditLogs = nil
+	retries.configure(props.Retry)
+	soundPlayer = strings.Fields(props.SoundPlayer)
+	desktopTimeout = defaultDesktopTimeout * time.Second
+	if props.DesktopTimeout > 0 {
+		desktopTimeout = time.Duration(props.DesktopTimeout) * time.Second
+	}
+
+	if props.Gotify != nil {
+		gotify, err := newGotifyNotifier(*props.Gotify)
+		if err != nil {
+			log.Warn().Msgf("Warning: %v. Skipping Gotify notifications.", err)
+		} else {
+			channels["gotify"] = gotify
+			defaultChannels = append(defaultChannels, "gotify")
+		}
+	}
+
+	if props.MQTT != nil {
+		mqtt, err := newMQTTNotifier(*props.MQTT)
+		if err != nil {
+			log.Warn().Msgf("Warning: %v. Skipping MQTT notifications.", err)
+		} else {
+			channels["mqtt"] = mqtt
+			defaultChannels = append(defaultChannels, "mqtt")
+		}
+	}
+
+	for name, config := range configs {
+		if headless && config.Type == "desktop" {
+			headlessChannels[name] = true
+			continue
+		}
+		notifier, err := newNotifier(name, config)
+		if err != nil {
+			log.Warn().Msgf("Warning: %v. Skipping notifier %s.", err, name)
+			continue
+		}
+		channels[name] = notifier
+		switch {
+		case config.MaxLength != nil:
+			maxLengths[name] = *config.MaxLength
+		case config.Type == "desktop":
+			maxLengths[name] = defaultDesktopMaxLength
+		default:
+			delete(maxLengths, name)
+		}
+		if file, ok := notifier.(*fileNotifier); ok && file.config.Audit {
+			auditLogs = append(auditLogs, file)
+		}
+	}
+}
+
+func (n Notification) desktopEnabled() bool {
+	return n.Desktop == nil || *n.Desktop
+}
+
+func sendNotification(notification Notification, data MessageData, message string) error {
+	status := registry.lookup(data.Source)
+	suppressed := func(reason string) {
+		if status != nil {
+			status.recordSuppressed(notification.entry, data.Kind, reason)
+		}
+	}
+	if snooze.Active() {
+		log.Debug().Msgf("Notifications snoozed until %s, skipping delivery", snooze.Until().Format("15:04:05"))
+		suppressed(suppressSnoozed)
+		return nil
+	}
+	if status != nil && status.paused() {
+		log.Debug().Msgf("%s is paused, skipping delivery", data.Source)
+		suppressed(status.pauseReason())
+		return nil
+	}
+	if !throttle.allow(notification, data) {
+		suppressed(suppressMaxPerHour)
+		return nil
+	}
+
+	data.Urgency = urgencyNormal
+	if notification.Urgency != "" {
+		data.Urgency = notification.Urgency
+	}
+	data.Icon = notification.Icon
+	data.entry = notification.entry
+	data.whenLocked = notification.WhenLocked
+	data.sound = notification.Sound
+
+	targets := notification.Channels
+	if len(targets) == 0 {
+		targets = defaultChannels
+	}
+	if len(headlessChannels) > 0 {
+		targets = slices.DeleteFunc(slices.Clone(targets), func(name string) bool { return headlessChannels[name] })
+		if len(targets) == 0 {
+			// Headless and nowhere else to go: the log is the output
+			log.Info().Msgf("Notification for %s: %s", data.Source, message)
+			return nil
+		}
+	}
+
+	// One failing channel must not keep the others from delivering
+	var errs []error
+	var delivered []string
+	// fellBack is the fallback channel that already delivered, so several
+	// failing channels don't repeat the message there
+	fellBack := ""
+	// Why nothing was delivered, should that be the case
+	failed, duplicate := false, false
+	for _, name := range targets {
+		notifier, ok := channels[name]
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: channel is not available", name))
+			continue
+		}
+		if _, ok := notifier.(desktopNotifier); ok && !notification.desktopEnabled() {
+			continue
+		}
+		if dedup.duplicate(name, data.Source, notificationTitle, message) {
+			duplicate = true
+			continue
+		}
+		// Channels may get a shortened message, the log and audit the full one
+		sent := fitMessage(name, notification, data, message)
+		if sent != message {
+			log.Debug().Msgf("Shortened the message for %s to %d characters", name, utf8.RuneCountInString(sent))
+		}
+		err := notifier.Notify(notificationTitle, sent, data)
+		failed = failed || err != nil
+		if !errors.Is(err, errDesktopBackoff) {
+			auditDelivery(name, data, message, err)
+		}
+		if err != nil && fellBack == "" {
+			if fellBack = deliverFallback(notification, name, data, message); fellBack != "" {
+				delivered = append(delivered, fellBack)
+			}
+		}
+		if err != nil && fellBack != "" {
+			// Desktop failures are expected while no daemon runs and have
+			// their own back-off warning
+			if _, ok := notifier.(desktopNotifier); ok {
+				log.Debug().Msgf("Desktop notification failed, delivered through %s instead: %v", fellBack, err)
+			} else {
+				log.Warn().Msgf("Warning: %s: %v. Delivered through %s instead.", name, err, fellBack)
+			}
+			continue
+		}
+		if err != nil && retries.enabled() {
+			delay := retries.add(name, data, message, sent, err)
+			if !errors.Is(err, errDesktopBackoff) {
+				log.Warn().Msgf("Warning: %s: %v. Retrying in %s.", name, err, formatDuration(delay))
+			}
+			continue
+		}
+		if errors.Is(err, errDesktopBackoff) {
+			// Warned about once when the back-off started
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", name, err))
+			continue
+		}
+		dedup.delivered(name, data.Source, notificationTitle, message)
+		retries.supersede(name, data)
+		delivered = append(delivered, name)
+	}
+	switch {
+	case status == nil:
+	case len(delivered) > 0:
+		status.recordNotification(data.Kind, delivered, message)
+		status.recordDelivered(notification.entry)
+	case failed:
+		suppressed(suppressDeliveryFailed)
+	case duplicate:
+		suppressed(suppressDuplicate)
+	}
+	return errors.Join(errs...)
+}
+
+// notifySource delivers data to every notification entry of the source that
+// has text for data.Kind. When no entry does and the kind is required, the
+// default message is delivered instead so the event is never silently lost.
+func notifySource(source Source, data MessageData, required bool) {
+	sent := false
+	for _, notification := range source.NotificationConfig.NotificationSet {
+		if notification.textFor(data.Kind) == "" {
+			continue
+		}
+		sent = true
+		deliverToEntry(source, notification, data)
+	}
+	if !sent && required {
+		deliverToEntry(source, Notification{entry: fallbackEntry, maxPerHour: source.NotificationConfig.MaxNotificationsPerHour}, data)
+	}
+}
+
+func deliverToEntry(source Source, notification Notification, data MessageData) {
+	notificationMessage := constructNotificationMessage(notification, data)
+	source.logger.Debug().Msgf("Sending %s %s notification: %s", source.SourceType, data.Kind, notificationMessage)
+	if err := sendNotification(notification, data, notificationMessage); err != nil {
+		source.logger.Error().Err(err).Msgf("Failed to send %s %s notification", source.SourceType, data.Kind)
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// overrideSetting is a config setting that can be changed without editing
+// the config file, e.g. in a container. A flag wins over the environment
+// variable, which wins over the file
+type overrideSetting struct {
+	flag  string
+	env   string
+	usage string
+	apply func(config *Config, value string) error
+}
+
+var overrideSettings = []overrideSetting{
+	{
+		flag:  "log-level",
+		env:   "MINIMON_LOG_LEVEL",
+		usage: "log level: debug, info, warn, error or console",
+		apply: func(config *Config, value string) error {
+			level := strings.ToLower(value)
+			if _, err := parseLogLevel(level); err != nil {
+				return err
+			}
+			config.MonitorProps.LogLevel = level
+			return nil
+		},
+	},
+	{
+		flag:  "log-dir",
+		env:   "MINIMON_LOG_DIR",
+		usage: "directory for minimon.log and per-source log files",
+		apply: func(config *Config, value string) error {
+			if strings.TrimSpace(value) == "" {
+				return fmt.Errorf("log directory is empty")
+			}
+			config.MonitorProps.LogDir = expandPath(value)
+			return nil
+		},
+	},
+	{
+		flag:  "dry-run",
+		env:   "MINIMON_DRY_RUN",
+		usage: "print notifications instead of delivering them (true or false)",
+		apply: func(config *Config, value string) error {
+			dryRun, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("expected true or false")
+			}
+			config.MonitorProps.DryRun = dryRun
+			return nil
+		},
+	},
+	{
+		flag:  "output",
+		env:   "MINIMON_OUTPUT",
+		usage: "write every interval result to stdout: ndjson",
+		apply: func(config *Config, value string) error {
+			output := strings.ToLower(strings.TrimSpace(value))
+			if err := validOutput(output); err != nil {
+				return err
+			}
+			config.MonitorProps.Output = output
+			return nil
+		},
+	},
+	{
+		flag:  "only",
+		env:   "MINIMON_ONLY",
+		usage: "comma-separated names of the only sources to start, even disabled ones",
+		apply: func(config *Config, value string) error {
+			names, err := sourceNames(config, value)
+			if err != nil {
+				return err
+			}
+			for i := range config.MonitorSources {
+				if slices.Contains(names, config.MonitorSources[i].Name) {
+					config.MonitorSources[i].disabled = ""
+				} else if config.MonitorSources[i].disabled == "" {
+					config.MonitorSources[i].disabled = "not selected by only"
+				}
+			}
+			return nil
+		},
+	},
+	{
+		flag:  "skip",
+		env:   "MINIMON_SKIP",
+		usage: "comma-separated names of sources not to start",
+		apply: func(config *Config, value string) error {
+			names, err := sourceNames(config, value)
+			if err != nil {
+				return err
+			}
+			for i := range config.MonitorSources {
+				if slices.Contains(names, config.MonitorSources[i].Name) {
+					config.MonitorSources[i].disabled = "skipped by skip"
+				}
+			}
+			return nil
+		},
+	},
+	{
+		flag:  "notification-interval",
+		env:   "MINIMON_NOTIFICATION_INTERVAL",
+		usage: "notification interval of every source: seconds, or a multiplier like 0.5x",
+		apply: applyIntervalOverride,
+	},
+}
+
+// applyIntervalOverride sets every source's notification interval to value
+// seconds, or scales it when value ends in "x"
+func applyIntervalOverride(config *Config, value string) error {
+	value = strings.TrimSpace(value)
+	scale := func(interval int) int { return interval }
+	if factor, ok := strings.CutSuffix(value, "x"); ok {
+		multiplier, err := strconv.ParseFloat(factor, 64)
+		if err != nil || multiplier <= 0 {
+			return fmt.Errorf("expected a positive multiplier like 2x")
+		}
+		scale = func(interval int) int { return max(int(math.Round(float64(interval)*multiplier)), 1) }
+	} else {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds <= 0 {
+			return fmt.Errorf("expected a positive number of seconds or a multiplier like 2x")
+		}
+		scale = func(int) int { return seconds }
+	}
+	for i := range config.MonitorSources {
+		config.MonitorSources[i].NotificationConfig.NotificationInterval = scale(config.MonitorSources[i].NotificationConfig.NotificationInterval)
+	}
+	return nil
+}
+
+// sourceNames splits a comma-separated list of source names, all of which
+// must exist
+func sourceNames(config *Config, value string) ([]string, error) {
+	var names []string
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !slices.ContainsFunc(config.MonitorSources, func(source Source) bool { return source.Name == name }) {
+			return nil, fmt.Errorf("unknown source %q", name)
+		}
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no source names given")
+	}
+	return names, nil
+}
+
+// parseOverrideFlags parses the command line of a normal run
+func parseOverrideFlags(args []string) (map[string]string, error) {
+	flags := flag.NewFlagSet("minimon", flag.ContinueOnError)
+	values := make(map[string]*string)
+	for _, setting := range overrideSettings {
+		values[setting.flag] = flags.String(setting.flag, "", fmt.Sprintf("%s (overrides %s)", setting.usage, setting.env))
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if flags.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected argument: %s", flags.Arg(0))
+	}
+	set := make(map[string]string)
+	flags.Visit(func(f *flag.Flag) {
+		set[f.Name] = *values[f.Name]
+	})
+	return set, nil
+}
+
+// applyOverrides applies flags and environment variables over the loaded
+// config and describes each one applied, for logging once logging is set up
+func applyOverrides(config *Config, flags map[string]string) ([]string, error) {
+	var applied []string
+	for _, setting := range overrideSettings {
+		origin := "-" + setting.flag
+		value, ok := flags[setting.flag]
+		if !ok {
+			origin = setting.env
+			value, ok = os.LookupEnv(setting.env)
+		}
+		if !ok {
+			continue
+		}
+		if err := setting.apply(config, value); err != nil {
+			return nil, fmt.Errorf("%s=%q: %v", origin, value, err)
+		}
+		applied = append(applied, fmt.Sprintf("%s=%s", origin, value))
+	}
+	return applied, nil
+}
+
+// dryRunChannels replaces every channel with one that prints instead
+func dryRunChannels(now func() time.Time) {
+	for name := range channels {
+		channels[name] = dryRunNotifier{channel: name, now: now}
+	}
+}
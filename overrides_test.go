@@ -0,0 +1,146 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestApplyOverridesPrecedence(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string // log_level in the config file
+		env      string
+		flag     string
+		want     string
+		wantFrom string
+	}{
+		{"file only", "warn", "", "", "warn", ""},
+		{"env over file", "warn", "debug", "", "debug", "MINIMON_LOG_LEVEL"},
+		{"flag over env", "warn", "debug", "error", "error", "-log-level"},
+		{"flag over file", "warn", "", "ERROR", "error", "-log-level"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{MonitorProps: MonitorProps{LogLevel: tt.file}}
+			if tt.env != "" {
+				t.Setenv("MINIMON_LOG_LEVEL", tt.env)
+			}
+			var args []string
+			if tt.flag != "" {
+				args = []string{"-log-level", tt.flag}
+			}
+			flags, err := parseOverrideFlags(args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			applied, err := applyOverrides(config, flags)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if config.MonitorProps.LogLevel != tt.want {
+				t.Errorf("log_level = %q, want %q", config.MonitorProps.LogLevel, tt.want)
+			}
+			if tt.wantFrom == "" && len(applied) != 0 {
+				t.Errorf("applied %q, want nothing", applied)
+			}
+			if tt.wantFrom != "" && (len(applied) != 1 || !strings.Contains(applied[0], tt.wantFrom)) {
+				t.Errorf("applied %q, want one from %s", applied, tt.wantFrom)
+			}
+		})
+	}
+}
+
+func TestApplyOverridesErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		flags map[string]string
+		want  string
+	}{
+		{"bad level", map[string]string{"log-level": "loud"}, `-log-level="loud"`},
+		{"empty log dir", map[string]string{"log-dir": " "}, "log directory is empty"},
+		{"bad bool", map[string]string{"dry-run": "maybe"}, "expected true or false"},
+		{"unknown source", map[string]string{"only": "nope"}, `unknown source "nope"`},
+		{"no names", map[string]string{"skip": " , "}, "no source names given"},
+		{"bad interval", map[string]string{"notification-interval": "0"}, "positive number of seconds"},
+		{"bad multiplier", map[string]string{"notification-interval": "-2x"}, "positive multiplier"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{MonitorSources: []Source{{Name: "a"}}}
+			_, err := applyOverrides(config, tt.flags)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSourceSelection(t *testing.T) {
+	tests := []struct {
+		name     string
+		flags    map[string]string
+		disabled []string // per source a, b, c
+	}{
+		{"only", map[string]string{"only": "a,c"}, []string{"", "disabled in config", ""}},
+		// only enables a source the config disabled
+		{"only enables", map[string]string{"only": "b"}, []string{"not selected by only", "", "not selected by only"}},
+		{"skip", map[string]string{"skip": "a"}, []string{"skipped by skip", "disabled in config", ""}},
+		{"only then skip", map[string]string{"only": "a,b", "skip": "b"}, []string{"", "skipped by skip", "not selected by only"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{MonitorSources: []Source{{Name: "a"}, {Name: "b", disabled: "disabled in config"}, {Name: "c"}}}
+			if _, err := applyOverrides(config, tt.flags); err != nil {
+				t.Fatal(err)
+			}
+			var disabled []string
+			for _, source := range config.MonitorSources {
+				disabled = append(disabled, source.disabled)
+			}
+			if !reflect.DeepEqual(disabled, tt.disabled) {
+				t.Errorf("disabled = %q, want %q", disabled, tt.disabled)
+			}
+		})
+	}
+}
+
+func TestApplyIntervalOverride(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []int
+	}{
+		{"30", []int{30, 30}},
+		{"2x", []int{120, 600}},
+		{"0.5x", []int{30, 150}},
+		// Never scaled down to nothing
+		{"0.001x", []int{1, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			config := &Config{MonitorSources: []Source{{}, {}}}
+			config.MonitorSources[0].NotificationConfig.NotificationInterval = 60
+			config.MonitorSources[1].NotificationConfig.NotificationInterval = 300
+			if err := applyIntervalOverride(config, tt.value); err != nil {
+				t.Fatal(err)
+			}
+			got := []int{config.MonitorSources[0].NotificationConfig.NotificationInterval, config.MonitorSources[1].NotificationConfig.NotificationInterval}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("intervals = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseOverrideFlags(t *testing.T) {
+	flags, err := parseOverrideFlags([]string{"-dry-run", "true", "--only=a,b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"dry-run": "true", "only": "a,b"}; !reflect.DeepEqual(flags, want) {
+		t.Errorf("flags = %v, want %v", flags, want)
+	}
+	if _, err := parseOverrideFlags([]string{"stray"}); err == nil {
+		t.Error("stray argument accepted")
+	}
+}
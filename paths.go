@@ -0,0 +1,107 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// legacyConfigPath was the only default before per-user config dirs
+const legacyConfigPath = "/usr/minimon/config.json"
+
+// defaultConfigPath is minimon/config.json in the user config dir
+// (%APPDATA% on Windows, ~/.config on Linux). Installs that still have the
+// old /usr/minimon config keep using it
+func defaultConfigPath() string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return legacyConfigPath
+	}
+	path := filepath.Join(configDir, "minimon", "config.json")
+	if runtime.GOOS != "windows" {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			if _, err := os.Stat(legacyConfigPath); err == nil {
+				return legacyConfigPath
+			}
+		}
+	}
+	return path
+}
+
+// expandPath expands a leading ~ to the home directory and cleans the
+// path, which on Windows also turns forward slashes into backslashes.
+// Empty paths stay empty
+func expandPath(path string) string {
+	if path == "" {
+		return ""
+	}
+	if path == "~" || strings.HasPrefix(path, "~/") || strings.HasPrefix(path, `~\`) {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = home + path[1:]
+		}
+	}
+	return filepath.Clean(path)
+}
+
+func expandIconPath(icon string) string {
+	if strings.HasPrefix(icon, builtinIconPrefix) {
+		return icon
+	}
+	return expandPath(icon)
+}
+
+// resolveSourcePaths makes the paths of sources read from a config file in
+// dir absolute, so they don't depend on where MiniMon was started
+func resolveSourcePaths(sources []Source, dir string) {
+	for i := range sources {
+		source := &sources[i]
+		for j, path := range source.Paths {
+			source.Paths[j] = expandPath(path)
+			if !filepath.IsAbs(source.Paths[j]) {
+				source.Paths[j] = filepath.Join(dir, source.Paths[j])
+			}
+		}
+		if source.SourceType == "url" || source.Path == "" {
+			continue
+		}
+		source.configuredPath = source.Path
+		source.Path = expandPath(source.Path)
+		if !filepath.IsAbs(source.Path) {
+			source.Path = filepath.Join(dir, source.Path)
+		}
+	}
+}
+
+// expandConfigPaths applies expandPath to the other paths in the config
+func expandConfigPaths(config *Config) {
+	props := &config.MonitorProps
+	props.LogDir = expandPath(props.LogDir)
+	props.EventLog = expandPath(props.EventLog)
+	props.ControlSocket = expandPath(props.ControlSocket)
+	props.StateFile = expandPath(props.StateFile)
+	props.RecordFile = expandPath(props.RecordFile)
+	if props.Heartbeat != nil {
+		props.Heartbeat.File = expandPath(props.Heartbeat.File)
+	}
+	if props.WeeklyReport != nil {
+		props.WeeklyReport.Dir = expandPath(props.WeeklyReport.Dir)
+	}
+	if props.HistoryStore != nil {
+		props.HistoryStore.Path = expandPath(props.HistoryStore.Path)
+	}
+	// A bare "git" is looked up in PATH
+	if strings.ContainsAny(props.GitBinary, `/\~`) {
+		props.GitBinary = expandPath(props.GitBinary)
+	}
+
+	for i := range config.MonitorSources {
+		source := &config.MonitorSources[i]
+		source.LogFile = expandPath(source.LogFile)
+		source.Icon = expandIconPath(source.Icon)
+		for j := range source.NotificationConfig.NotificationSet {
+			notification := &source.NotificationConfig.NotificationSet[j]
+			notification.Icon = expandIconPath(notification.Icon)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestExpandPath(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"", ""},
+		{"~", home},
+		{"~/logs", filepath.Join(home, "logs")},
+		{"~/logs/../state/", filepath.Join(home, "state")},
+		// Only the current user's home is expanded
+		{"~other/logs", filepath.Clean("~other/logs")},
+		{"/var/log/minimon/", filepath.Clean("/var/log/minimon")},
+		{"relative/./dir", filepath.Join("relative", "dir")},
+		{"a~/b", filepath.Join("a~", "b")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := expandPath(tt.path); got != tt.want {
+				t.Errorf("expandPath(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandIconPath(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	tests := []struct {
+		icon string
+		want string
+	}{
+		{"builtin:alert", "builtin:alert"},
+		{"~/icons/alert.png", filepath.Join(home, "icons", "alert.png")},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.icon, func(t *testing.T) {
+			if got := expandIconPath(tt.icon); got != tt.want {
+				t.Errorf("expandIconPath(%q) = %q, want %q", tt.icon, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveSourcePaths(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	dir := filepath.Join(home, "config")
+	sources := []Source{
+		{SourceType: "dir", Path: "projects/app"},
+		{SourceType: "git", Path: "~/src/repo"},
+		{SourceType: "url", Path: "https://example.com/status"},
+		{SourceType: "files", Paths: []string{"a.log", "~/b.log", "/var/log/c.log"}},
+	}
+	resolveSourcePaths(sources, dir)
+
+	want := []string{filepath.Join(dir, "projects", "app"), filepath.Join(home, "src", "repo"), "https://example.com/status", ""}
+	for i, source := range sources {
+		if source.Path != want[i] {
+			t.Errorf("source %d: path = %q, want %q", i, source.Path, want[i])
+		}
+	}
+	if sources[0].configuredPath != "projects/app" {
+		t.Errorf("configured path = %q, want it kept for messages", sources[0].configuredPath)
+	}
+	wantPaths := []string{filepath.Join(dir, "a.log"), filepath.Join(home, "b.log"), filepath.Clean("/var/log/c.log")}
+	if !reflect.DeepEqual(sources[3].Paths, wantPaths) {
+		t.Errorf("paths = %q, want %q", sources[3].Paths, wantPaths)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// processInfo identifies one process instance. The start time tells a live
+// process apart from an unrelated one that later got the same PID
+type processInfo struct {
+	PID       int
+	StartTick uint64
+	Started   time.Time
+}
+
+func (p processInfo) same(other processInfo) bool {
+	return p.PID == other.PID && p.StartTick == other.StartTick
+}
+
+func validProcessSource(source Source) error {
+	if !processSupported {
+		return fmt.Errorf("process sources are only supported on Linux")
+	}
+	if source.Path == "" && source.ProcessName == "" {
+		return fmt.Errorf("process source needs a pid file path or process_name")
+	}
+	if source.ProcessName != "" {
+		if _, err := regexp.Compile(source.ProcessName); err != nil {
+			return fmt.Errorf("invalid process_name: %v", err)
+		}
+	}
+	return nil
+}
+
+func readPIDFile(path string) (int, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("invalid pid in %s", path)
+	}
+	return pid, nil
+}
+
+// processMonitor alerts when the process it watches dies and when it is
+// running again
+type processMonitor struct {
+	monitorBase
+}
+
+func newProcessMonitor(source Source, status *monitorStatus) *processMonitor {
+	return &processMonitor{monitorBase: monitorBase{source: source, status: status}}
+}
+
+func (m *processMonitor) Start(ctx context.Context) error {
+	source, status := m.source, m.status
+	logger := source.logger
+	config := source.NotificationConfig
+	var pattern *regexp.Regexp
+	if source.ProcessName != "" {
+		pattern = regexp.MustCompile(source.ProcessName)
+	}
+	target := source.Path
+	if pattern != nil {
+		target = source.ProcessName
+	}
+
+	// find returns the process being watched, preferring the one already
+	// known so a name pattern with several matches doesn't hop between them
+	find := func(known *processInfo) (processInfo, bool) {
+		if pattern != nil {
+			if known != nil {
+				if current, err := lookupProcess(known.PID); err == nil && current.same(*known) {
+					return current, true
+				}
+			}
+			found, err := findProcessByName(pattern)
+			if err != nil {
+				logger.Error().Err(err).Msgf("Failed to look for processes matching %s", target)
+			}
+			return found, err == nil && found.PID != 0
+		}
+
+		pid, err := readPIDFile(source.Path)
+		if err != nil {
+			logger.Debug().Msgf("No usable pid file at %s: %v", source.Path, err)
+			return processInfo{}, false
+		}
+		current, err := lookupProcess(pid)
+		return current, err == nil
+	}
+
+	ticker := time.NewTicker(time.Duration(config.NotificationInterval) * time.Second)
+	defer ticker.Stop()
+
+	var last *processInfo
+	if current, ok := find(nil); ok {
+		last = &current
+		status.setState(stateActive)
+		logger.Info().Msgf("Watching %s (pid %d)", target, current.PID)
+	} else {
+		status.setState(stateAlert)
+		logger.Info().Msgf("%s is not running, waiting for it to start", target)
+	}
+	status.markReady()
+
+	notify := func(detail string, pid int) {
+		status.recordChange(1)
+		data := MessageData{
+			Source:  source.Name,
+			Kind:    kindChange,
+			Changes: 1,
+			Path:    source.Path,
+			PID:     pid,
+			Detail:  detail,
+		}
+		notifySource(source, data, true)
+	}
+
+	died := func(previous processInfo) {
+		uptime := formatDuration(time.Since(previous.Started))
+		logger.Warn().Msgf("%s (pid %d) died after running %s", target, previous.PID, uptime)
+		notify(fmt.Sprintf("%s (pid %d) died after running %s", target, previous.PID, uptime), previous.PID)
+		status.setState(stateAlert)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		current, running := find(last)
+		switch {
+		case last != nil && (!running || !current.same(*last)):
+			// A different process under the same PID or name means the
+			// watched one is gone, even if something is running again
+			died(*last)
+			last = nil
+			if running {
+				logger.Info().Msgf("%s is running again (pid %d)", target, current.PID)
+				notify(fmt.Sprintf("%s is running again (pid %d)", target, current.PID), current.PID)
+				last = &current
+			}
+		case last == nil && running:
+			logger.Info().Msgf("%s is running (pid %d)", target, current.PID)
+			notify(fmt.Sprintf("%s is running (pid %d)", target, current.PID), current.PID)
+			last = &current
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const processSupported = true
+
+// USER_HZ is 100 on every Linux platform Go supports
+const clockTicksPerSecond = 100
+
+var (
+	bootTimeOnce sync.Once
+	bootTime     time.Time
+)
+
+func systemBootTime() time.Time {
+	bootTimeOnce.Do(func() {
+		content, err := os.ReadFile("/proc/stat")
+		if err != nil {
+			return
+		}
+		for _, line := range strings.Split(string(content), "\n") {
+			if value, ok := strings.CutPrefix(line, "btime "); ok {
+				if seconds, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64); err == nil {
+					bootTime = time.Unix(seconds, 0)
+				}
+				return
+			}
+		}
+	})
+	return bootTime
+}
+
+func lookupProcess(pid int) (processInfo, error) {
+	content, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return processInfo{}, err
+	}
+	// The command name is in parentheses and may itself contain spaces or
+	// parentheses, so parse the fields after its closing paren
+	end := bytes.LastIndexByte(content, ')')
+	if end < 0 {
+		return processInfo{}, fmt.Errorf("malformed /proc/%d/stat", pid)
+	}
+	fields := strings.Fields(string(content[end+1:]))
+	// starttime is field 22 overall, 20 after pid and comm
+	if len(fields) < 20 {
+		return processInfo{}, fmt.Errorf("malformed /proc/%d/stat", pid)
+	}
+	if fields[0] == "Z" {
+		return processInfo{}, fmt.Errorf("process %d is a zombie", pid)
+	}
+	ticks, err := strconv.ParseUint(fields[19], 10, 64)
+	if err != nil {
+		return processInfo{}, fmt.Errorf("malformed /proc/%d/stat", pid)
+	}
+
+	return processInfo{
+		PID:       pid,
+		StartTick: ticks,
+		Started:   systemBootTime().Add(time.Duration(ticks) * time.Second / clockTicksPerSecond),
+	}, nil
+}
+
+// findProcessByName returns the oldest process whose name or command line
+// matches pattern, or a zero processInfo when none does
+func findProcessByName(pattern *regexp.Regexp) (processInfo, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return processInfo{}, err
+	}
+
+	self := os.Getpid()
+	var matches []processInfo
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || pid == self {
+			continue
+		}
+		dir := filepath.Join("/proc", entry.Name())
+		comm, _ := os.ReadFile(filepath.Join(dir, "comm"))
+		cmdline, _ := os.ReadFile(filepath.Join(dir, "cmdline"))
+		cmdline = bytes.TrimRight(bytes.ReplaceAll(cmdline, []byte{0}, []byte{' '}), " ")
+		if !pattern.Match(bytes.TrimSpace(comm)) && !pattern.Match(cmdline) {
+			continue
+		}
+		if info, err := lookupProcess(pid); err == nil {
+			matches = append(matches, info)
+		}
+	}
+	if len(matches) == 0 {
+		return processInfo{}, nil
+	}
+
+	sort.Slice(matches, func(i, j int) bool { return matches[i].StartTick < matches[j].StartTick })
+	return matches[0], nil
+}
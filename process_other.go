@@ -0,0 +1,19 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Process sources read /proc, so they are rejected when the config loads
+const processSupported = false
+
+func lookupProcess(pid int) (processInfo, error) {
+	return processInfo{}, fmt.Errorf("process sources are only supported on Linux")
+}
+
+func findProcessByName(pattern *regexp.Regexp) (processInfo, error) {
+	return processInfo{}, fmt.Errorf("process sources are only supported on Linux")
+}
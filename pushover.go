@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	pushoverAPI            = "https://api.pushover.net/1/messages.json"
+	defaultPushoverTimeout = 10
+	// Pushover priorities: 2 is an emergency, repeated until acknowledged
+	pushoverLowPriority       = -1
+	pushoverNormalPriority    = 0
+	pushoverHighPriority      = 1
+	pushoverEmergencyPriority = 2
+	// Emergency retry and expire limits of the API, in seconds
+	pushoverMinRetry      = 30
+	pushoverMaxExpire     = 10800
+	defaultPushoverRetry  = 60
+	defaultPushoverExpire = 3600
+)
+
+// PushoverConfig is a "pushover" notifier. Urgency maps to low (-1), normal
+// (0) and critical_priority, which defaults to high (1) and may be set to
+// emergency (2)
+type PushoverConfig struct {
+	Token            string `json:"token"`
+	User             string `json:"user"`
+	Device           string `json:"device"`
+	CriticalPriority *int   `json:"critical_priority,omitempty"`
+	Retry            int    `json:"retry"`
+	Expire           int    `json:"expire"`
+	Timeout          int    `json:"timeout"`
+	// URL replaces the API endpoint, e.g. for a proxy
+	URL string `json:"url"`
+}
+
+type pushoverNotifier struct {
+	config PushoverConfig
+	client *http.Client
+}
+
+func newPushoverNotifier(config PushoverConfig) (*pushoverNotifier, error) {
+	if config.Token == "" || config.User == "" {
+		return nil, fmt.Errorf("pushover requires both token and user")
+	}
+	if config.CriticalPriority == nil {
+		high := pushoverHighPriority
+		config.CriticalPriority = &high
+	}
+	if *config.CriticalPriority < pushoverLowPriority || *config.CriticalPriority > pushoverEmergencyPriority {
+		return nil, fmt.Errorf("invalid pushover critical_priority: %d", *config.CriticalPriority)
+	}
+	if config.Retry == 0 {
+		config.Retry = defaultPushoverRetry
+	}
+	if config.Expire == 0 {
+		config.Expire = defaultPushoverExpire
+	}
+	if config.Retry < pushoverMinRetry || config.Expire < 0 || config.Expire > pushoverMaxExpire {
+		return nil, fmt.Errorf("pushover retry must be at least %ds and expire at most %ds", pushoverMinRetry, pushoverMaxExpire)
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaultPushoverTimeout
+	}
+	if config.URL == "" {
+		config.URL = pushoverAPI
+	}
+	return &pushoverNotifier{
+		config: config,
+		client: &http.Client{Timeout: time.Duration(config.Timeout) * time.Second},
+	}, nil
+}
+
+func (p *pushoverNotifier) Name() string {
+	return "pushover"
+}
+
+func (p *pushoverNotifier) priority(urgency string) int {
+	switch urgency {
+	case urgencyLow:
+		return pushoverLowPriority
+	case urgencyCritical:
+		return *p.config.CriticalPriority
+	}
+	return pushoverNormalPriority
+}
+
+func (p *pushoverNotifier) Notify(title, message string, data MessageData) error {
+	priority := p.priority(data.Urgency)
+	form := url.Values{
+		"token":    {p.config.Token},
+		"user":     {p.config.User},
+		"title":    {fmt.Sprintf("%s: %s", title, data.Source)},
+		"message":  {strings.TrimSpace(message)},
+		"priority": {strconv.Itoa(priority)},
+	}
+	if p.config.Device != "" {
+		form.Set("device", p.config.Device)
+	}
+	if priority == pushoverEmergencyPriority {
+		form.Set("retry", strconv.Itoa(p.config.Retry))
+		form.Set("expire", strconv.Itoa(p.config.Expire))
+	}
+
+	resp, err := p.client.PostForm(p.config.URL, form)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	var result struct {
+		Status int `json:"status"`
+	}
+	if resp.StatusCode != http.StatusOK || json.Unmarshal(body, &result) != nil || result.Status != 1 {
+		return fmt.Errorf("pushover returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
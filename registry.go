@@ -0,0 +1,472 @@
+package main
+
+import (
+	"maps"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Monitor states reported through the status socket
+const (
+	stateStarting = "starting"
+	stateWatching = "watching"
+	stateActive   = "active"
+	stateIdle     = "idle"
+	stateInvalid  = "invalid"
+	stateDisabled = "disabled"
+	stateOK       = "ok"
+	stateAlert    = "alert"
+)
+
+type MonitorStats struct {
+	Name          string         `json:"name"`
+	Type          string         `json:"type"`
+	Path          string         `json:"path"`
+	Interval      int            `json:"interval"`
+	State         string         `json:"state"`
+	Missing       bool           `json:"missing,omitempty"`
+	Unavailable   string         `json:"unavailable,omitempty"`
+	Unwatched     []string       `json:"unwatched,omitempty"`
+	Truncated     []string       `json:"truncated,omitempty"`
+	Overflows     int            `json:"overflows,omitempty"`
+	Dropped       int            `json:"dropped_notifications,omitempty"`
+	Streaks       StreakStats    `json:"streaks"`
+	PausedSince   time.Time      `json:"paused_since,omitzero"`
+	OffSchedule   bool           `json:"off_schedule,omitempty"`
+	LastChange    time.Time      `json:"last_change,omitzero"`
+	LastNotified  time.Time      `json:"last_notified,omitzero"`
+	IdleMinutes   float64        `json:"idle_minutes"`
+	TotalChanges  int            `json:"total_changes"`
+	Notifications map[string]int `json:"notifications"`
+	Entries       []EntryStats   `json:"entries,omitempty"`
+	// Failures counts operational errors in a row, LastError is the last
+	// one and FailingSince when they reached error_threshold
+	Failures     int       `json:"failures,omitempty"`
+	LastError    string    `json:"last_error,omitempty"`
+	FailingSince time.Time `json:"failing_since,omitzero"`
+	// FileChanges are the changes per file of a files source
+	FileChanges map[string]int `json:"file_changes,omitempty"`
+	// Histograms are today's, once the source finished an interval
+	Histograms *activityHistograms `json:"histograms,omitempty"`
+}
+
+type monitorStatus struct {
+	mu      sync.Mutex
+	stats   MonitorStats
+	daily   dailyStats
+	streaks streakTracker
+	session sessionCounters
+	// resumed is set when counting starts again after a pause, so the
+	// monitor can drop the idle time from before
+	resumed bool
+	// ready is closed once the monitor is watching, or was skipped
+	ready     chan struct{}
+	readyOnce sync.Once
+	// recent are the last notifications, for the interval records
+	recent []sentNotification
+	// entries is keyed by notification entry
+	entries map[int]*EntryStats
+	// histograms are today's activity histograms
+	histograms activityHistograms
+	// gitBaseline is the last diff of a git_file source, for state_file
+	gitBaseline *gitBaseline
+}
+
+// How many delivered notifications a source keeps for its interval records
+const recentNotifications = 16
+
+type sentNotification struct {
+	at       time.Time
+	channels []string
+	message  string
+}
+
+// markReady reports the monitor as started. Until its first interval the
+// state moves from starting to watching
+func (s *monitorStatus) markReady() {
+	s.readyOnce.Do(func() {
+		s.mu.Lock()
+		if s.stats.State == stateStarting {
+			s.stats.State = stateWatching
+		}
+		s.mu.Unlock()
+		close(s.ready)
+	})
+}
+
+func (s *monitorStatus) recordChange(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats.State = stateActive
+	s.stats.LastChange = time.Now()
+	s.stats.TotalChanges += n
+	s.stats.IdleMinutes = 0
+	s.daily.Changes += n
+	s.daily.HourlyChanges[s.stats.LastChange.Hour()] += n
+}
+
+// correctChanges revises the change totals by n once an interval's files
+// are classified, without marking the source active
+func (s *monitorStatus) correctChanges(n int) {
+	if n == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats.TotalChanges = max(s.stats.TotalChanges+n, 0)
+	s.daily.Changes = max(s.daily.Changes+n, 0)
+	if !s.stats.LastChange.IsZero() {
+		hour := s.stats.LastChange.Hour()
+		s.daily.HourlyChanges[hour] = max(s.daily.HourlyChanges[hour]+n, 0)
+	}
+}
+
+func (s *monitorStatus) recordIdle(minutes float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats.State = stateIdle
+	// minutes is the running idle time, so only the increase is new
+	s.daily.IdleMinutes += max(minutes-s.stats.IdleMinutes, 0)
+	s.session.idleMinutes += max(minutes-s.stats.IdleMinutes, 0)
+	s.stats.IdleMinutes = minutes
+}
+
+func (s *monitorStatus) recordNotification(kind string, channels []string, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats.Notifications[kind]++
+	s.daily.Notifications++
+	if statsd != nil {
+		statsd.notified(s.stats.Name, kind)
+	}
+	s.stats.LastNotified = time.Now()
+	s.recent = append(s.recent, sentNotification{at: s.stats.LastNotified, channels: channels, message: message})
+	if len(s.recent) > recentNotifications {
+		s.recent = s.recent[len(s.recent)-recentNotifications:]
+	}
+}
+
+// recordInterval feeds one finished interval with changes into the
+// streaks and histograms and returns the new record length when it is a
+// personal best
+func (s *monitorStatus) recordInterval(changes int) (float64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	active := changes > 0
+	s.histograms.rollover(time.Now())
+	s.histograms.Changes.observe(float64(changes))
+	if active && s.streaks.idle > 0 {
+		s.histograms.IdleStreaks.observe(float64(s.streaks.idle) * s.streaks.interval)
+	}
+	if active {
+		s.session.activeIntervals++
+	} else {
+		s.session.idleIntervals++
+	}
+	if s.streaks.observe(active) {
+		return s.streaks.AllTime.LongestActive, true
+	}
+	return 0, false
+}
+
+func (s *monitorStatus) allTimeStreaks() (string, streakRecords) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats.Name, s.streaks.AllTime
+}
+
+func (s *monitorStatus) todaysHistograms() activityHistograms {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.histograms.rollover(time.Now())
+	return s.histograms.clone()
+}
+
+// recordDropped counts a notification the retry queue gave up on
+func (s *monitorStatus) recordDropped() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats.Dropped++
+}
+
+// notificationsSince returns the channels that delivered a notification
+// after t and the message of the latest one
+func (s *monitorStatus) notificationsSince(t time.Time) ([]string, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var channels []string
+	var message string
+	for _, sent := range s.recent {
+		if sent.at.Before(t) {
+			continue
+		}
+		for _, channel := range sent.channels {
+			if !slices.Contains(channels, channel) {
+				channels = append(channels, channel)
+			}
+		}
+		message = sent.message
+	}
+	return channels, message
+}
+
+func (s *monitorStatus) setState(state string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats.State = state
+}
+
+func (s *monitorStatus) setMissing(missing bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats.Missing = missing
+}
+
+// setUnavailable records why a check_mount source's filesystem can't be
+// reached, or clears it with ""
+func (s *monitorStatus) setUnavailable(reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats.Unavailable = reason
+}
+
+func (s *monitorStatus) unavailable() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats.Unavailable != ""
+}
+
+// setUnwatched records paths that could not be watched, e.g. because the
+// inotify watch limit was reached
+func (s *monitorStatus) setUnwatched(paths []string) {
+	sort.Strings(paths)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats.Unwatched = paths
+}
+
+// recordFileChanges adds an interval's changes per file, for files sources
+func (s *monitorStatus) recordFileChanges(changed map[string]int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stats.FileChanges == nil {
+		s.stats.FileChanges = make(map[string]int)
+	}
+	for name, count := range changed {
+		s.stats.FileChanges[name] += count
+	}
+}
+
+func (s *monitorStatus) setGitBaseline(baseline gitBaseline) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.gitBaseline = &baseline
+}
+
+func (s *monitorStatus) savedGitBaseline() (gitBaseline, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.gitBaseline == nil {
+		return gitBaseline{}, false
+	}
+	return *s.gitBaseline, true
+}
+
+// setTruncated records the subtrees of a recursive source left out by
+// max_depth or max_watched_dirs
+func (s *monitorStatus) setTruncated(paths []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats.Truncated = paths
+}
+
+// recordOverflow counts a watcher queue overflow, after which some events
+// were lost
+func (s *monitorStatus) recordOverflow() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats.Overflows++
+	if statsd != nil {
+		statsd.send(s.stats.Name, "overflows", "1", "c")
+	}
+}
+
+// pause stops the monitor from counting and notifying while its watcher
+// stays alive; resume picks up from the current state without replaying
+func (s *monitorStatus) pause() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stats.PausedSince.IsZero() {
+		s.stats.PausedSince = time.Now()
+	}
+}
+
+func (s *monitorStatus) resume() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.stats.PausedSince.IsZero() && !s.stats.OffSchedule {
+		s.resumed = true
+	}
+	s.stats.PausedSince = time.Time{}
+}
+
+// setOffSchedule pauses or resumes the source for its schedule and reports
+// whether that changed anything
+func (s *monitorStatus) setOffSchedule(off bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stats.OffSchedule == off {
+		return false
+	}
+	s.stats.OffSchedule = off
+	if !off && s.stats.PausedSince.IsZero() {
+		s.resumed = true
+	}
+	return true
+}
+
+func (s *monitorStatus) paused() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return !s.stats.PausedSince.IsZero() || s.stats.OffSchedule
+}
+
+// pauseReason says why paused is true, as a suppression reason
+func (s *monitorStatus) pauseReason() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stats.PausedSince.IsZero() && s.stats.OffSchedule {
+		return suppressOffSchedule
+	}
+	return suppressPaused
+}
+
+// takeResumed reports once whether counting resumed since the last call
+func (s *monitorStatus) takeResumed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	resumed := s.resumed
+	s.resumed = false
+	return resumed
+}
+
+// sessionTotals returns what the source did since MiniMon started
+func (s *monitorStatus) sessionTotals() SourceSession {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	notifications := 0
+	for _, count := range s.stats.Notifications {
+		notifications += count
+	}
+	return SourceSession{
+		Name:            s.stats.Name,
+		Type:            s.stats.Type,
+		Changes:         s.stats.TotalChanges,
+		IdleMinutes:     s.session.idleMinutes,
+		ActiveIntervals: s.session.activeIntervals,
+		IdleIntervals:   s.session.idleIntervals,
+		Notifications:   notifications,
+	}
+}
+
+// takeDaily returns the daily counters and starts a new day
+func (s *monitorStatus) takeDaily() (string, dailyStats) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	daily := s.daily
+	daily.Streaks = s.streaks.newDay()
+	s.daily = dailyStats{Since: time.Now()}
+	return s.stats.Name, daily
+}
+
+func (s *monitorStatus) snapshot() MonitorStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := s.stats
+	stats.Streaks = s.streaks.stats()
+	stats.Unwatched = append([]string(nil), s.stats.Unwatched...)
+	stats.Notifications = make(map[string]int, len(s.stats.Notifications))
+	for kind, count := range s.stats.Notifications {
+		stats.Notifications[kind] = count
+	}
+	stats.Entries = s.entrySnapshot()
+	stats.FileChanges = maps.Clone(s.stats.FileChanges)
+	if s.histograms.Changes.count() > 0 {
+		histograms := s.histograms.clone()
+		stats.Histograms = &histograms
+	}
+	return stats
+}
+
+// monitorRegistry is the shared view of every configured source that the
+// status socket reports from
+type monitorRegistry struct {
+	mu       sync.Mutex
+	monitors []*monitorStatus
+	byName   map[string]*monitorStatus
+}
+
+var registry = &monitorRegistry{byName: make(map[string]*monitorStatus)}
+
+func (r *monitorRegistry) register(source Source) *monitorStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	status := &monitorStatus{stats: MonitorStats{
+		Name:          source.Name,
+		Type:          source.SourceType,
+		Path:          source.Path,
+		Interval:      source.NotificationConfig.NotificationInterval,
+		State:         stateStarting,
+		Notifications: make(map[string]int),
+	}, daily: dailyStats{Since: time.Now()}, ready: make(chan struct{})}
+	status.streaks.interval = float64(source.NotificationConfig.NotificationInterval) / 60
+	status.streaks.AllTime = restoredState.Streaks[source.Name]
+	status.histograms = restoreHistograms(restoredState.Histograms[source.Name], time.Now())
+	r.monitors = append(r.monitors, status)
+	r.byName[source.Name] = status
+	return status
+}
+
+// unregister drops a source that stopped for good, e.g. a discovered
+// subdirectory that was removed
+func (r *monitorRegistry) unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	status := r.byName[name]
+	delete(r.byName, name)
+	r.monitors = slices.DeleteFunc(r.monitors, func(s *monitorStatus) bool { return s == status })
+}
+
+func (r *monitorRegistry) lookup(name string) *monitorStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.byName[name]
+}
+
+func (r *monitorRegistry) all() []*monitorStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*monitorStatus(nil), r.monitors...)
+}
+
+// waitReady blocks until every registered monitor has started or been
+// skipped
+func (r *monitorRegistry) waitReady() {
+	for _, status := range r.all() {
+		<-status.ready
+	}
+}
+
+func (r *monitorRegistry) snapshot() []MonitorStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stats := make([]MonitorStats, 0, len(r.monitors))
+	for _, status := range r.monitors {
+		stats = append(stats, status.snapshot())
+	}
+	return stats
+}
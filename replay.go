@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// Observation types in a record_file
+const (
+	observeEvent = "event"
+	observeTick  = "tick"
+	observeGit   = "git"
+)
+
+// How long replay waits after the last observation for the monitors to
+// finish sending
+const replayGrace = time.Second
+
+// observation is one raw input to a monitor: an fsnotify event, an interval
+// tick or the line counts git reported. At is seconds since recording began
+type observation struct {
+	At        float64 `json:"at"`
+	Source    string  `json:"source"`
+	Type      string  `json:"type"`
+	Op        string  `json:"op,omitempty"`
+	Path      string  `json:"path,omitempty"`
+	Added     int     `json:"added,omitempty"`
+	Removed   int     `json:"removed,omitempty"`
+	Untracked int     `json:"untracked,omitempty"`
+	// Files are the per-file git counts
+	Files map[string]lineCounts `json:"files,omitempty"`
+}
+
+// observationRecorder appends every observation to record_file as JSONL so
+// the session can be replayed later
+type observationRecorder struct {
+	mu      sync.Mutex
+	started time.Time
+	file    *os.File
+	writer  *bufio.Writer
+	encoder *json.Encoder
+}
+
+var recorder *observationRecorder
+
+func startRecorder(path string) (*observationRecorder, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("could not open record file: %v", err)
+	}
+	writer := bufio.NewWriter(file)
+	log.Info().Msgf("Recording observations to %s", path)
+	return &observationRecorder{started: time.Now(), file: file, writer: writer, encoder: json.NewEncoder(writer)}, nil
+}
+
+func (r *observationRecorder) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.writer.Flush()
+	r.file.Close()
+}
+
+// recordObservation is a no-op unless record_file is configured
+func recordObservation(obs observation) {
+	if recorder == nil {
+		return
+	}
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	obs.At = time.Since(recorder.started).Seconds()
+	if err := recorder.encoder.Encode(obs); err != nil {
+		log.Error().Err(err).Msg("Failed to write observation")
+		return
+	}
+	// Events come in bursts, the tick after them flushes
+	if obs.Type != observeEvent {
+		recorder.writer.Flush()
+	}
+}
+
+func recordDirEvent(source Source, event fsnotify.Event) {
+	if recorder == nil {
+		return
+	}
+	path := event.Name
+	if rel, err := filepath.Rel(source.Path, event.Name); err == nil {
+		path = filepath.ToSlash(rel)
+	}
+	recordObservation(observation{Source: source.Name, Type: observeEvent, Op: event.Op.String(), Path: path})
+}
+
+func recordGitStat(source Source, stat diffStat) {
+	recordObservation(observation{Source: source.Name, Type: observeGit, Added: stat.Added, Removed: stat.Removed, Untracked: stat.Untracked, Files: stat.Files})
+}
+
+// dirFeed is where dirMonitor gets its input: the watcher and a
+// ticker normally, recorded observations during replay
+type dirFeed struct {
+	events <-chan fsnotify.Event
+	errors <-chan error
+	ticks  <-chan time.Time
+	now    func() time.Time
+}
+
+// gitFeed is the same for gitMonitor
+type gitFeed struct {
+	ticks       <-chan time.Time
+	now         func() time.Time
+	changeCount func() (diffStat, error)
+}
+
+// replayClock is the recorded time replay has reached
+type replayClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *replayClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *replayClock) set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = t
+}
+
+// dryRunNotifier prints what would have been delivered
+type dryRunNotifier struct {
+	channel string
+	now     func() time.Time
+}
+
+func (dryRunNotifier) Name() string {
+	return "dry-run"
+}
+
+func (n dryRunNotifier) Notify(title, message string, data MessageData) error {
+	fmt.Printf("%s %s %s [%s]: %s\n", n.now().Format("15:04:05"), n.channel, data.Source, data.Kind, message)
+	return nil
+}
+
+func parseSpeed(value string) (float64, error) {
+	speed, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(value), "x"), 64)
+	if err != nil || speed <= 0 {
+		return 0, fmt.Errorf("invalid speed: %s", value)
+	}
+	return speed, nil
+}
+
+func parseOp(value string) fsnotify.Op {
+	var op fsnotify.Op
+	for _, name := range strings.Split(value, "|") {
+		switch name {
+		case "CREATE":
+			op |= fsnotify.Create
+		case "WRITE":
+			op |= fsnotify.Write
+		case "REMOVE":
+			op |= fsnotify.Remove
+		case "RENAME":
+			op |= fsnotify.Rename
+		case "CHMOD":
+			op |= fsnotify.Chmod
+		}
+	}
+	return op
+}
+
+func readObservations(path string) ([]observation, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var observations []observation
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var obs observation
+		if err := json.Unmarshal(scanner.Bytes(), &obs); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+		observations = append(observations, obs)
+	}
+	sort.SliceStable(observations, func(i, j int) bool { return observations[i].At < observations[j].At })
+	return observations, scanner.Err()
+}
+
+// runReplay drives the dir and git_file monitors from a record_file with a
+// fake clock, delivering through the configured channels or, with
+// -dry-run, printing instead
+func runReplay(configPath string, args []string) int {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	speedFlag := flags.String("speed", "1x", "replay speed, e.g. 10x")
+	dryRun := flags.Bool("dry-run", false, "print notifications instead of delivering them")
+	// The file may come before the flags
+	var path string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		path, args = args[0], args[1:]
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if path == "" {
+		path = flags.Arg(0)
+	}
+	if path == "" {
+		fmt.Fprintln(os.Stderr, "usage: minimon replay <record-file> [-speed 10x] [-dry-run]")
+		return 2
+	}
+	speed, err := parseSpeed(*speedFlag)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	config, err := loadConfig(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config %s: %v\n", configPath, err)
+		return 1
+	}
+	observations, err := readObservations(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", path, err)
+		return 1
+	}
+
+	logs.level, _ = parseLogLevel(config.MonitorProps.LogLevel)
+	logs.out = zerolog.ConsoleWriter{Out: os.Stderr}
+	log.Logger = zerolog.New(logs.out).Level(logs.level).With().Timestamp().Logger()
+	logs.logDir = config.MonitorProps.LogDir
+	defer logs.Close()
+	legacyDurations = config.MonitorProps.LegacyDurations
+	if config.MonitorProps.TimeFormat != "" {
+		timeFormat = config.MonitorProps.TimeFormat
+	}
+	dedup.configure(config.MonitorProps)
+	setupNotifiers(config.MonitorProps, config.Notifiers)
+
+	start := time.Now()
+	clock := &replayClock{now: start}
+	if *dryRun {
+		dryRunChannels(clock.Now)
+	}
+
+	// Recorded input goes to the monitors through these channels
+	dirEvents := make(map[string]chan fsnotify.Event)
+	ticks := make(map[string]chan time.Time)
+	gitStats := make(map[string]chan diffStat)
+	for _, source := range config.MonitorSources {
+		if source.SourceType != "dir" && source.SourceType != "git_file" {
+			continue
+		}
+		source.logger = logs.forSource(source)
+		// Both would read the current filesystem, not the recorded one
+		source.TrackSize = false
+		source.InitialScan = false
+		status := registry.register(source)
+		ticks[source.Name] = make(chan time.Time)
+		if source.SourceType == "dir" {
+			dirEvents[source.Name] = make(chan fsnotify.Event)
+			go runMonitor(context.Background(), newDirMonitor(source, status, &dirFeed{
+				events: dirEvents[source.Name],
+				errors: make(chan error),
+				ticks:  ticks[source.Name],
+				now:    clock.Now,
+			}), status)
+			continue
+		}
+		stats := make(chan diffStat)
+		gitStats[source.Name] = stats
+		go runMonitor(context.Background(), newGitMonitor(source, status, &gitFeed{
+			ticks: ticks[source.Name],
+			now:   clock.Now,
+			changeCount: func() (diffStat, error) {
+				return <-stats, nil
+			},
+		}), status)
+	}
+
+	sources := make(map[string]Source)
+	for _, source := range config.MonitorSources {
+		sources[source.Name] = source
+	}
+	log.Info().Msgf("Replaying %d observations from %s at %gx", len(observations), path, speed)
+	gitStarted := make(map[string]bool)
+	skipped := make(map[string]bool)
+	previous := 0.0
+	for _, obs := range observations {
+		if _, ok := ticks[obs.Source]; !ok {
+			if !skipped[obs.Source] {
+				log.Warn().Msgf("Warning: %s is not a dir or git_file source in the config. Skipping its observations.", obs.Source)
+				skipped[obs.Source] = true
+			}
+			continue
+		}
+		time.Sleep(time.Duration((obs.At - previous) / speed * float64(time.Second)))
+		previous = obs.At
+		now := start.Add(time.Duration(obs.At * float64(time.Second)))
+		clock.set(now)
+
+		switch obs.Type {
+		case observeEvent:
+			events, ok := dirEvents[obs.Source]
+			if !ok {
+				continue
+			}
+			name := filepath.Join(sources[obs.Source].Path, filepath.FromSlash(obs.Path))
+			events <- fsnotify.Event{Name: name, Op: parseOp(obs.Op)}
+		case observeTick:
+			if _, ok := dirEvents[obs.Source]; ok {
+				ticks[obs.Source] <- now
+			}
+		case observeGit:
+			if _, ok := gitStats[obs.Source]; !ok {
+				continue
+			}
+			stat := diffStat{Added: obs.Added, Removed: obs.Removed, Untracked: obs.Untracked, Files: obs.Files}
+			// The first count is the baseline gitMonitor reads on start
+			if gitStarted[obs.Source] {
+				ticks[obs.Source] <- now
+			}
+			gitStarted[obs.Source] = true
+			gitStats[obs.Source] <- stat
+		}
+	}
+	time.Sleep(replayGrace)
+
+	report := currentStatus()
+	for _, source := range report.Sources {
+		fmt.Fprintf(os.Stderr, "%s: %d changes, notifications %s\n", source.Name, source.TotalChanges, formatCounts(source.Notifications))
+	}
+	return 0
+}
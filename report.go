@@ -0,0 +1,340 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Heat grid cells from the fewest to the most changes in an hour. An hour
+// without any record, when MiniMon wasn't running, is left blank
+var heatLevels = []string{"·", "▁", "▂", "▃", "▄", "▅", "▆", "▇", "█"}
+
+// reportHour is one hour of one source, nil in a reportDay when nothing
+// was recorded then
+type reportHour struct {
+	Changes   int `json:"changes"`
+	Intervals int `json:"intervals"`
+	Active    int `json:"active"`
+}
+
+type reportDay struct {
+	Date  string          `json:"date"`
+	Hours [24]*reportHour `json:"hours"`
+}
+
+// sourceReport is a source's hours over the report's days and their totals
+type sourceReport struct {
+	Source string      `json:"source"`
+	Days   []reportDay `json:"days"`
+	Totals reportTotal `json:"totals"`
+}
+
+type reportTotal struct {
+	Changes      int `json:"changes"`
+	Intervals    int `json:"intervals"`
+	Active       int `json:"active"`
+	DaysWithData int `json:"days_with_data"`
+	// BusiestHour and BusiestDay are empty without any changes
+	BusiestHour string `json:"busiest_hour,omitempty"`
+	BusiestDay  string `json:"busiest_day,omitempty"`
+}
+
+// buildReport lays the hourly history rows out per source and day, from
+// first to last inclusive. The sources in names are included even without
+// any rows, so a source MiniMon never recorded shows up as missing
+func buildReport(rows []historyRow, names []string, first, last time.Time) []sourceReport {
+	var dates []string
+	for day := first; !day.After(last); day = day.AddDate(0, 0, 1) {
+		dates = append(dates, day.Format(time.DateOnly))
+	}
+	bySource := make(map[string]map[string]*reportDay)
+	for _, row := range rows {
+		date, hourText, _ := strings.Cut(row.Period, " ")
+		hour, err := strconv.Atoi(strings.TrimSuffix(hourText, ":00"))
+		if err != nil || hour < 0 || hour > 23 {
+			continue
+		}
+		days := bySource[row.Source]
+		if days == nil {
+			days = make(map[string]*reportDay)
+			bySource[row.Source] = days
+		}
+		day := days[date]
+		if day == nil {
+			day = &reportDay{Date: date}
+			days[date] = day
+		}
+		day.Hours[hour] = &reportHour{Changes: row.Changes, Intervals: row.Intervals, Active: row.Active}
+	}
+
+	for name := range bySource {
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	reports := make([]sourceReport, 0, len(names))
+	for _, name := range names {
+		report := sourceReport{Source: name}
+		var hourly [24]int
+		busiestDay := 0
+		for _, date := range dates {
+			day := reportDay{Date: date}
+			if recorded := bySource[name][date]; recorded != nil {
+				day = *recorded
+				report.Totals.DaysWithData++
+			}
+			dayChanges := 0
+			for hour, h := range day.Hours {
+				if h == nil {
+					continue
+				}
+				report.Totals.Changes += h.Changes
+				report.Totals.Intervals += h.Intervals
+				report.Totals.Active += h.Active
+				hourly[hour] += h.Changes
+				dayChanges += h.Changes
+			}
+			if dayChanges > busiestDay {
+				busiestDay = dayChanges
+				report.Totals.BusiestDay = date
+			}
+			report.Days = append(report.Days, day)
+		}
+		busiestHour := 0
+		for hour, changes := range hourly {
+			if changes > hourly[busiestHour] {
+				busiestHour = hour
+			}
+		}
+		if hourly[busiestHour] > 0 {
+			report.Totals.BusiestHour = fmt.Sprintf("%02d:00-%02d:00", busiestHour, (busiestHour+1)%24)
+		}
+		reports = append(reports, report)
+	}
+	return reports
+}
+
+// heatCell picks the block for changes, scaled to the source's busiest hour
+func heatCell(h *reportHour, busiest int) string {
+	if h == nil {
+		return " "
+	}
+	if h.Changes == 0 || busiest == 0 {
+		return heatLevels[0]
+	}
+	// Rounded up, so any change shows as at least the lowest block
+	level := (h.Changes*(len(heatLevels)-1) + busiest - 1) / busiest
+	return heatLevels[min(level, len(heatLevels)-1)]
+}
+
+func writeHeatGrid(out io.Writer, report sourceReport) {
+	busiest := 0
+	for _, day := range report.Days {
+		for _, h := range day.Hours {
+			if h != nil {
+				busiest = max(busiest, h.Changes)
+			}
+		}
+	}
+	// Day labels are "Mon 2006-01-02" and two spaces
+	indent := strings.Repeat(" ", len("Mon 2006-01-02")+2)
+	fmt.Fprintf(out, "%s\n", report.Source)
+	header := indent
+	for hour := 0; hour < 24; hour += 3 {
+		header += fmt.Sprintf("%-6s", fmt.Sprintf("%02d", hour))
+	}
+	fmt.Fprintln(out, strings.TrimRight(header, " "))
+	for _, day := range report.Days {
+		date, _ := time.Parse(time.DateOnly, day.Date)
+		label := fmt.Sprintf("%s %s", date.Format("Mon"), day.Date)
+		var cells strings.Builder
+		recorded := false
+		for _, h := range day.Hours {
+			cell := heatCell(h, busiest)
+			cells.WriteString(cell + cell)
+			recorded = recorded || h != nil
+		}
+		if !recorded {
+			fmt.Fprintf(out, "%s  (no data)\n", label)
+			continue
+		}
+		fmt.Fprintf(out, "%s  %s\n", label, strings.TrimRight(cells.String(), " "))
+	}
+	fmt.Fprintf(out, "%s%s none  %s %d changes\n\n", indent, heatLevels[0], heatLevels[len(heatLevels)-1], busiest)
+}
+
+func writeReportTotals(out io.Writer, reports []sourceReport) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SOURCE\tCHANGES\tACTIVE\tINTERVALS\tDAYS\tBUSIEST HOUR\tBUSIEST DAY")
+	for _, report := range reports {
+		t := report.Totals
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d/%d\t%s\t%s\n", report.Source, t.Changes, t.Active, t.Intervals,
+			t.DaysWithData, len(report.Days), dashIfEmpty(t.BusiestHour), dashIfEmpty(t.BusiestDay))
+	}
+	w.Flush()
+}
+
+func dashIfEmpty(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+// writeReportCSV writes one line per source and hour, leaving the counts
+// empty for the hours without any record
+func writeReportCSV(out io.Writer, reports []sourceReport) error {
+	w := csv.NewWriter(out)
+	w.Write([]string{"source", "date", "hour", "changes", "active", "intervals"})
+	for _, report := range reports {
+		for _, day := range report.Days {
+			for hour, h := range day.Hours {
+				line := []string{report.Source, day.Date, strconv.Itoa(hour), "", "", ""}
+				if h != nil {
+					line[3], line[4], line[5] = strconv.Itoa(h.Changes), strconv.Itoa(h.Active), strconv.Itoa(h.Intervals)
+				}
+				w.Write(line)
+			}
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// readReportRows sums the history from first to last by hour
+func readReportRows(props MonitorProps, source string, first, last time.Time) ([]historyRow, error) {
+	sums := newHistorySums("hour")
+	if err := forEachRecord(props, source, first, last.AddDate(0, 0, 1), sums.add); err != nil {
+		return nil, err
+	}
+	return sums.rows(), nil
+}
+
+// reportSources names the sources the report lays out: the ones with
+// interval records, which buildReport finds in the rows, and the one asked
+// for, so it shows up as missing when it has none
+func reportSources(source string) []string {
+	if source == "" {
+		return nil
+	}
+	return []string{source}
+}
+
+// runReport shows when each source was active between two dates, from the
+// history store or else the files of event_log. It doesn't need MiniMon to
+// be running
+func runReport(configPath string, args []string) int {
+	flags := flag.NewFlagSet("report", flag.ContinueOnError)
+	source := flags.String("source", "", "only this source")
+	sinceFlag := flags.String("since", "7d", "first day: days like 7d or a date")
+	untilFlag := flags.String("until", "", "last day, a date (default today)")
+	format := flags.String("format", "text", "output format: text, csv or json")
+	weekly := flags.Bool("weekly", false, "the Markdown report of the last finished week, like weekly_report writes")
+	outPath := flags.String("out", "", "write to this file instead of stdout")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *format != "text" && *format != "csv" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "invalid format: %s (expected text, csv or json)\n", *format)
+		return 2
+	}
+	now := time.Now()
+	since, err := parseSince(*sinceFlag, now)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	first := time.Date(since.Year(), since.Month(), since.Day(), 0, 0, 0, 0, time.Local)
+	last := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	if *untilFlag != "" {
+		last, err = time.ParseInLocation(time.DateOnly, *untilFlag, time.Local)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid until: %s (expected a date like 2024-05-07)\n", *untilFlag)
+			return 2
+		}
+	}
+	if last.Before(first) {
+		fmt.Fprintln(os.Stderr, "until is before since")
+		return 2
+	}
+
+	config, err := loadConfig(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config %s: %v\n", configPath, err)
+		return 1
+	}
+	if config.MonitorProps.HistoryStore == nil && config.MonitorProps.EventLog == "" {
+		fmt.Fprintln(os.Stderr, "No history: set history_store or event_log in monitor_props to record it")
+		return 1
+	}
+	if *weekly {
+		weeklyConfig := WeeklyReportConfig{}
+		if config.MonitorProps.WeeklyReport != nil {
+			weeklyConfig = *config.MonitorProps.WeeklyReport
+		}
+		first, last = reportWeek(now, weeklyConfig.weekday())
+		report, err := generateWeeklyReport(config, first, last)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading history: %v\n", err)
+			return 1
+		}
+		if *outPath == "" {
+			fmt.Print(report)
+			return 0
+		}
+		if err := os.WriteFile(*outPath, []byte(report), 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing report: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+	rows, err := readReportRows(config.MonitorProps, *source, first, last)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading history: %v\n", err)
+		return 1
+	}
+	reports := buildReport(rows, reportSources(*source), first, last)
+	end := last.Format(time.DateOnly)
+	out := os.Stdout
+	if *outPath != "" {
+		out, err = os.Create(*outPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing report: %v\n", err)
+			return 1
+		}
+		defer out.Close()
+	}
+
+	switch *format {
+	case "json":
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(reports)
+	case "csv":
+		if err := writeReportCSV(out, reports); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing CSV: %v\n", err)
+			return 1
+		}
+	default:
+		if len(reports) == 0 {
+			fmt.Fprintf(out, "No history between %s and %s\n", first.Format(time.DateOnly), end)
+			return 0
+		}
+		for _, report := range reports {
+			writeHeatGrid(out, report)
+		}
+		writeReportTotals(out, reports)
+	}
+	return 0
+}
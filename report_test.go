@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// writeFixtureHistory records the given records into a new event log or
+// history store and returns the monitor_props to read them back with
+func writeFixtureHistory(t *testing.T, store string, records []eventRecord) MonitorProps {
+	t.Helper()
+	dir := t.TempDir()
+	if store == "history_store" {
+		path := filepath.Join(dir, "history.db")
+		db, err := openHistoryDB(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		if err := insertHistory(db, records); err != nil {
+			t.Fatal(err)
+		}
+		return MonitorProps{HistoryStore: &HistoryStoreConfig{Path: path}}
+	}
+	props := MonitorProps{EventLog: filepath.Join(dir, "events.jsonl")}
+	daily := &eventLog{path: props.EventLog}
+	for _, record := range records {
+		line, err := json.Marshal(record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file, err := os.OpenFile(daily.fileFor(record.Timestamp.Local()), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file.Write(append(line, '\n'))
+		file.Close()
+	}
+	return props
+}
+
+// reportFixture is three days of two sources, a files source among them,
+// with records before, after and between them that the report leaves out
+func reportFixture() []eventRecord {
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2024, 5, day, hour, minute, 0, 0, time.Local)
+	}
+	return []eventRecord{
+		{Timestamp: at(5, 23, 55), Source: "thesis", Kind: kindChange, Events: 50},
+		{Timestamp: at(6, 10, 0), Source: "thesis", Kind: kindChange, Events: 3, Files: 1},
+		{Timestamp: at(6, 10, 5), Source: "thesis", Kind: kindChange, Events: 2, Files: 2},
+		{Timestamp: at(6, 10, 10), Source: "thesis", Kind: kindIdle, IdleMinutes: 5},
+		{Timestamp: at(7, 14, 0), Source: "thesis", Kind: kindChange, Events: 7, Files: 1},
+		{Timestamp: at(7, 18, 0), Source: "minimon", Kind: kindSession, Session: &SessionReport{}},
+		{Timestamp: at(8, 9, 0), Source: "notes", Kind: kindChange, Events: 1, Files: 1},
+		{Timestamp: at(9, 8, 0), Source: "thesis", Kind: kindChange, Events: 100},
+	}
+}
+
+func TestReport(t *testing.T) {
+	first := time.Date(2024, 5, 6, 0, 0, 0, 0, time.Local)
+	last := time.Date(2024, 5, 8, 0, 0, 0, 0, time.Local)
+	tests := []struct {
+		name   string
+		source string
+		want   map[string]reportTotal
+	}{
+		{"all sources", "", map[string]reportTotal{
+			"notes":  {Changes: 1, Intervals: 1, Active: 1, DaysWithData: 1, BusiestHour: "09:00-10:00", BusiestDay: "2024-05-08"},
+			"thesis": {Changes: 12, Intervals: 4, Active: 3, DaysWithData: 2, BusiestHour: "14:00-15:00", BusiestDay: "2024-05-07"},
+		}},
+		{"one source", "notes", map[string]reportTotal{
+			"notes": {Changes: 1, Intervals: 1, Active: 1, DaysWithData: 1, BusiestHour: "09:00-10:00", BusiestDay: "2024-05-08"},
+		}},
+		{"source without records", "drafts", map[string]reportTotal{
+			"drafts": {},
+		}},
+	}
+	for _, store := range []string{"event_log", "history_store"} {
+		props := writeFixtureHistory(t, store, reportFixture())
+		for _, tt := range tests {
+			t.Run(store+"/"+tt.name, func(t *testing.T) {
+				rows, err := readReportRows(props, tt.source, first, last)
+				if err != nil {
+					t.Fatal(err)
+				}
+				totals := make(map[string]reportTotal)
+				for _, report := range buildReport(rows, reportSources(tt.source), first, last) {
+					totals[report.Source] = report.Totals
+					if len(report.Days) != 3 {
+						t.Errorf("%s has %d days, want 3", report.Source, len(report.Days))
+					}
+				}
+				if !reflect.DeepEqual(totals, tt.want) {
+					t.Errorf("totals = %+v, want %+v", totals, tt.want)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	defaultRetryAttempts  = 5
+	defaultRetryMaxAge    = 900
+	defaultRetryQueueSize = 20
+	// The first retry waits this long, each further one twice as long
+	retryBaseDelay     = 15 * time.Second
+	retryCheckInterval = 5 * time.Second
+)
+
+// RetryConfig bounds how failed deliveries are retried. MaxAttempts counts
+// the first delivery too, so 1 turns retrying off. MaxAge is in seconds
+type RetryConfig struct {
+	MaxAttempts int `json:"max_attempts"`
+	MaxAge      int `json:"max_age"`
+	QueueSize   int `json:"queue_size"`
+}
+
+func (c RetryConfig) withDefaults() (RetryConfig, error) {
+	if c.MaxAttempts < 0 || c.MaxAge < 0 || c.QueueSize < 0 {
+		return c, fmt.Errorf("retry settings must not be negative")
+	}
+	if c.MaxAttempts == 0 {
+		c.MaxAttempts = defaultRetryAttempts
+	}
+	if c.MaxAge == 0 {
+		c.MaxAge = defaultRetryMaxAge
+	}
+	if c.QueueSize == 0 {
+		c.QueueSize = defaultRetryQueueSize
+	}
+	return c, nil
+}
+
+// pendingDelivery is a message a channel failed to deliver
+type pendingDelivery struct {
+	data     MessageData
+	message  string
+	first    time.Time
+	next     time.Time
+	attempts int
+	lastErr  error
+	// sent is message as shortened for the channel
+	sent string
+}
+
+// retryQueue holds failed deliveries per channel and retries them oldest
+// first with exponential backoff, so a channel's messages stay in order
+type retryQueue struct {
+	mu      sync.Mutex
+	config  RetryConfig
+	pending map[string][]*pendingDelivery
+	running bool
+}
+
+var retries = &retryQueue{pending: make(map[string][]*pendingDelivery)}
+
+func (q *retryQueue) configure(config RetryConfig) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.config = config
+	clear(q.pending)
+}
+
+func (q *retryQueue) enabled() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.config.MaxAttempts > 1
+}
+
+func retryDelay(attempts int) time.Duration {
+	return retryBaseDelay << min(attempts-1, 10)
+}
+
+// add queues a delivery that just failed its first attempt. A queued idle
+// reminder of the same entry is stale then and replaced in place
+func (q *retryQueue) add(channel string, data MessageData, message, sent string, err error) time.Duration {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := time.Now()
+	delay := retryDelay(1)
+	delivery := &pendingDelivery{data: data, message: message, sent: sent, first: now, next: now.Add(delay), attempts: 1, lastErr: err}
+
+	queue := q.pending[channel]
+	replaced := false
+	if data.Kind == kindIdle {
+		for i, queued := range queue {
+			if queued.data.Kind == kindIdle && queued.data.Source == data.Source && queued.data.entry == data.entry {
+				delivery.next = queued.next
+				queue[i] = delivery
+				replaced = true
+				break
+			}
+		}
+	}
+	if !replaced {
+		if len(queue) >= q.config.QueueSize {
+			q.drop(channel, queue[0], "the retry queue is full")
+			queue = queue[1:]
+		}
+		queue = append(queue, delivery)
+	}
+	q.pending[channel] = queue
+
+	if !q.running {
+		q.running = true
+		go q.run()
+	}
+	return delay
+}
+
+// supersede removes queued idle reminders of the entry once a newer one
+// was delivered on the channel
+func (q *retryQueue) supersede(channel string, data MessageData) {
+	if data.Kind != kindIdle {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	queue := q.pending[channel]
+	for i := 0; i < len(queue); i++ {
+		if queue[i].data.Kind == kindIdle && queue[i].data.Source == data.Source && queue[i].data.entry == data.entry {
+			queue = append(queue[:i], queue[i+1:]...)
+			i--
+		}
+	}
+	q.pending[channel] = queue
+}
+
+// drop gives up on a delivery. The caller holds the lock
+func (q *retryQueue) drop(channel string, delivery *pendingDelivery, reason string) {
+	log.Warn().Msgf("Warning: %s notification for %s was not delivered after %d attempts (%v). Dropping it, %s.",
+		channel, delivery.data.Source, delivery.attempts, delivery.lastErr, reason)
+	if status := registry.lookup(delivery.data.Source); status != nil {
+		status.recordDropped()
+	}
+}
+
+func (q *retryQueue) run() {
+	ticker := time.NewTicker(retryCheckInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if !q.retryDue(time.Now()) {
+			return
+		}
+	}
+}
+
+// retryDue retries the head of every channel's queue that is due and
+// reports whether anything is left to retry
+func (q *retryQueue) retryDue(now time.Time) bool {
+	q.mu.Lock()
+	names := make([]string, 0, len(q.pending))
+	for name := range q.pending {
+		names = append(names, name)
+	}
+	q.mu.Unlock()
+
+	for _, name := range names {
+		q.retryChannel(name, now)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for name, queue := range q.pending {
+		if len(queue) == 0 {
+			delete(q.pending, name)
+		}
+	}
+	q.running = len(q.pending) > 0
+	return q.running
+}
+
+func (q *retryQueue) retryChannel(name string, now time.Time) {
+	notifier, ok := channels[name]
+	for {
+		q.mu.Lock()
+		queue := q.pending[name]
+		if len(queue) == 0 {
+			q.mu.Unlock()
+			return
+		}
+		head := queue[0]
+		if !ok || now.Sub(head.first) > time.Duration(q.config.MaxAge)*time.Second {
+			q.drop(name, head, "it is too old")
+			q.pending[name] = queue[1:]
+			q.mu.Unlock()
+			continue
+		}
+		q.mu.Unlock()
+
+		// Held back, not failed: don't spend an attempt
+		if now.Before(head.next) || snooze.Active() {
+			return
+		}
+		if status := registry.lookup(head.data.Source); status != nil && status.paused() {
+			return
+		}
+		if _, desktop := notifier.(desktopNotifier); desktop && !desktopState.available() {
+			return
+		}
+
+		err := notifier.Notify(notificationTitle, head.sent, head.data)
+		auditDelivery(name, head.data, head.message, err)
+
+		q.mu.Lock()
+		// The entry may have been replaced or superseded meanwhile
+		queue = q.pending[name]
+		if len(queue) == 0 || queue[0] != head {
+			q.mu.Unlock()
+			continue
+		}
+		if err == nil {
+			q.pending[name] = queue[1:]
+			q.mu.Unlock()
+			log.Info().Msgf("Delivered %s notification for %s on attempt %d", name, head.data.Source, head.attempts+1)
+			dedup.delivered(name, head.data.Source, notificationTitle, head.message)
+			if status := registry.lookup(head.data.Source); status != nil {
+				status.recordNotification(head.data.Kind, []string{name}, head.message)
+			}
+			continue
+		}
+		head.attempts++
+		head.lastErr = err
+		if head.attempts >= q.config.MaxAttempts {
+			q.drop(name, head, "no attempts left")
+			q.pending[name] = queue[1:]
+		} else {
+			head.next = now.Add(retryDelay(head.attempts))
+		}
+		q.mu.Unlock()
+		return
+	}
+}
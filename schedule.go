@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	// Timezones must resolve on systems without a zoneinfo database
+	_ "time/tzdata"
+)
+
+// How often a source's schedule is re-evaluated
+const scheduleCheckInterval = 30 * time.Second
+
+// Schedule limits when a source counts and notifies. Days are the days the
+// window starts on; an End before Start runs past midnight
+type Schedule struct {
+	Days     []string `json:"days"`
+	Start    string   `json:"start"`
+	End      string   `json:"end"`
+	Timezone string   `json:"timezone"`
+}
+
+type scheduleWindow struct {
+	days  [7]bool
+	start int // Minutes after midnight
+	end   int
+	loc   *time.Location
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+func parseSchedule(s Schedule) (*scheduleWindow, error) {
+	w := &scheduleWindow{loc: time.Local}
+	if s.Timezone != "" {
+		loc, err := time.LoadLocation(s.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("unknown timezone: %s", s.Timezone)
+		}
+		w.loc = loc
+	}
+	if len(s.Days) == 0 {
+		w.days = [7]bool{true, true, true, true, true, true, true}
+	}
+	for _, day := range s.Days {
+		weekday, ok := weekdays[strings.ToLower(day)[:min(3, len(day))]]
+		if !ok {
+			return nil, fmt.Errorf("unknown day: %s", day)
+		}
+		w.days[weekday] = true
+	}
+	var err error
+	if w.start, err = parseClock(s.Start, 0); err != nil {
+		return nil, err
+	}
+	if w.end, err = parseClock(s.End, 24*60); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func parseClock(value string, fallback int) (int, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func (w *scheduleWindow) active(now time.Time) bool {
+	now = now.In(w.loc)
+	minute := now.Hour()*60 + now.Minute()
+	today := now.Weekday()
+	if w.start < w.end {
+		return w.days[today] && minute >= w.start && minute < w.end
+	}
+	if w.start == w.end {
+		return w.days[today]
+	}
+	// Overnight: the evening of a listed day or the morning after one
+	yesterday := (today + 6) % 7
+	return (w.days[today] && minute >= w.start) || (w.days[yesterday] && minute < w.end)
+}
+
+// startSchedule pauses the source outside its window. The watcher stays
+// attached; counting starts fresh when the window opens. The first check
+// runs before returning so a monitor never counts outside the window
+func startSchedule(source Source, status *monitorStatus) {
+	logger := source.logger
+	check := func() {
+		inWindow := source.schedule.active(time.Now())
+		if status.setOffSchedule(!inWindow) {
+			if inWindow {
+				logger.Info().Msg("Schedule window started, counting from now")
+			} else {
+				logger.Info().Msg("Outside the schedule window, pausing counting and notifications")
+			}
+		}
+	}
+	check()
+	go func() {
+		for range time.Tick(scheduleCheckInterval) {
+			check()
+		}
+	}()
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+const selfTestTimeout = 15 * time.Second
+
+// syncNotifier is implemented by notifiers that normally deliver in the
+// background, so the self-test can report the real delivery result
+type syncNotifier interface {
+	NotifySync(title, message string, data MessageData, timeout time.Duration) error
+}
+
+func runSelfTest(configPath string) int {
+	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
+	zerolog.SetGlobalLevel(zerolog.WarnLevel)
+
+	config, err := loadConfig(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config %s: %v\n", configPath, err)
+		return 1
+	}
+	// File notifiers resolve relative paths against log_dir
+	logs.logDir = config.MonitorProps.LogDir
+	defer logs.Close()
+	setupNotifiers(config.MonitorProps, config.Notifiers)
+
+	names := make([]string, 0, len(channels))
+	for name := range channels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	build := currentBuild().String()
+	data := MessageData{Source: "self-test", Kind: kindTest, Version: build}
+	failed := 0
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, name := range names {
+		notifier := channels[name]
+		message := fmt.Sprintf("MiniMon %s test notification via %s", build, name)
+
+		var err error
+		if n, ok := notifier.(syncNotifier); ok {
+			err = n.NotifySync(notificationTitle, message, data, selfTestTimeout)
+		} else {
+			err = notifier.Notify(notificationTitle, message, data)
+		}
+
+		if err != nil {
+			failed++
+			fmt.Fprintf(w, "%s\t%s\tFAILED\t%v\n", name, notifier.Name(), err)
+		} else {
+			fmt.Fprintf(w, "%s\t%s\tok\t\n", name, notifier.Name())
+		}
+	}
+	w.Flush()
+
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
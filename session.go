@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// sessionCounters are the per-source totals only the shutdown report uses;
+// the rest comes from MonitorStats
+type sessionCounters struct {
+	idleMinutes     float64
+	activeIntervals int
+	idleIntervals   int
+}
+
+type SourceSession struct {
+	Name            string  `json:"name"`
+	Type            string  `json:"type"`
+	Changes         int     `json:"changes"`
+	IdleMinutes     float64 `json:"idle_minutes"`
+	ActiveIntervals int     `json:"active_intervals"`
+	IdleIntervals   int     `json:"idle_intervals"`
+	Notifications   int     `json:"notifications"`
+}
+
+// SessionReport summarizes a whole run of MiniMon, from start to shutdown
+type SessionReport struct {
+	Started        time.Time       `json:"started"`
+	Ended          time.Time       `json:"ended"`
+	RuntimeMinutes float64         `json:"runtime_minutes"`
+	Sources        []SourceSession `json:"sources"`
+}
+
+func buildSessionReport(started time.Time) SessionReport {
+	report := SessionReport{Started: started, Ended: time.Now()}
+	report.RuntimeMinutes = report.Ended.Sub(started).Minutes()
+	for _, status := range registry.all() {
+		report.Sources = append(report.Sources, status.sessionTotals())
+	}
+	return report
+}
+
+func (r SessionReport) lines() []string {
+	lines := []string{fmt.Sprintf("Session ran for %s", formatMinutes(r.RuntimeMinutes))}
+	for _, source := range r.Sources {
+		lines = append(lines, fmt.Sprintf("%s: %d changes, idle %s, %d active and %d idle intervals, %d notifications",
+			source.Name, source.Changes, formatMinutes(source.IdleMinutes), source.ActiveIntervals, source.IdleIntervals, source.Notifications))
+	}
+	return lines
+}
+
+// reportSession logs the session summary, records it in the event log and,
+// with notify_on_exit, sends it as a notification. The monitors keep their
+// counters in the registry, so this only reads it
+func reportSession(started time.Time, notify bool) {
+	report := buildSessionReport(started)
+	lines := report.lines()
+	for _, line := range lines {
+		log.Info().Msg(line)
+	}
+	recordEvent(eventRecord{Timestamp: report.Ended, Source: "minimon", Kind: kindSession, Session: &report})
+
+	if !notify {
+		return
+	}
+	message := "Session summary\n" + strings.Join(lines, "\n")
+	data := MessageData{Source: "minimon", Kind: kindSession, Minutes: report.RuntimeMinutes, Detail: message}
+	if err := sendNotification(Notification{}, data, message); err != nil {
+		log.Error().Err(err).Msg("Failed to send session summary")
+	}
+}
@@ -0,0 +1,8 @@
+//go:build windows
+
+package main
+
+import "os"
+
+// Windows has no SIGUSR1; snoozing is only available through the control socket
+var snoozeSignals []os.Signal
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const defaultSnoozeDuration = 1800
+
+type snoozeState struct {
+	mu    sync.Mutex
+	until time.Time
+	timer *time.Timer
+}
+
+var snooze snoozeState
+
+func (s *snoozeState) Snooze(d time.Duration) time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	s.until = time.Now().Add(d)
+	until := s.until
+	s.timer = time.AfterFunc(d, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		// A newer snooze or an explicit resume owns the state now
+		if !s.until.Equal(until) {
+			return
+		}
+		s.until = time.Time{}
+		s.timer = nil
+		log.Info().Msg("Snooze ended, notifications resumed")
+	})
+	log.Info().Msgf("Notifications snoozed until %s", s.until.Format("15:04:05"))
+	return s.until
+}
+
+func (s *snoozeState) Resume() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.timer == nil {
+		return
+	}
+	s.timer.Stop()
+	s.timer = nil
+	s.until = time.Time{}
+	log.Info().Msg("Snooze ended, notifications resumed")
+}
+
+func (s *snoozeState) Toggle(d time.Duration) {
+	if s.Active() {
+		s.Resume()
+		return
+	}
+	s.Snooze(d)
+}
+
+func (s *snoozeState) Active() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return !s.until.IsZero() && time.Now().Before(s.until)
+}
+
+func (s *snoozeState) Until() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.until
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Values of a notification entry's "sound" besides a file path. Without
+// one, only critical notifications beep
+const (
+	soundNone    = "none"
+	soundDefault = "default"
+)
+
+// How long a sound file may play before the player is stopped
+const soundTimeout = 10 * time.Second
+
+// soundPlayer is the sound_player command from monitor_props, if set
+var soundPlayer []string
+
+// soundFailed is set after the first failed playback, which is the only
+// one logged as a warning
+var soundFailed atomic.Bool
+
+// soundFile reports whether sound names a file to play
+func soundFile(sound string) bool {
+	return sound != "" && sound != soundNone && sound != soundDefault
+}
+
+// soundFileMissing reports whether sound names a file that doesn't exist
+func soundFileMissing(sound string) bool {
+	if !soundFile(sound) {
+		return false
+	}
+	_, err := os.Stat(sound)
+	return err != nil
+}
+
+// beeps reports whether the desktop notification should beep
+func (d MessageData) beeps() bool {
+	switch d.sound {
+	case soundDefault:
+		return true
+	case "":
+		return d.Urgency == urgencyCritical
+	}
+	return false
+}
+
+// sendDesktop is desktopNotify, replaced in tests
+var sendDesktop = desktopNotify
+
+// showDesktop shows the notification and starts its sound file, if any,
+// without waiting for it
+func showDesktop(title, message string, data MessageData) error {
+	err := sendDesktop(title, message, data.Urgency, iconPath(data.Icon), data.beeps())
+	if err == nil && soundFile(data.sound) {
+		go playSound(data.sound)
+	}
+	return err
+}
+
+// soundCommand returns the command that plays path: sound_player when
+// set, otherwise the usual player of the platform
+func soundCommand(path string) ([]string, error) {
+	if len(soundPlayer) > 0 {
+		return append(append([]string(nil), soundPlayer...), path), nil
+	}
+	switch runtime.GOOS {
+	case "darwin":
+		return []string{"afplay", path}, nil
+	case "windows":
+		script := fmt.Sprintf("(New-Object Media.SoundPlayer '%s').PlaySync()", strings.ReplaceAll(path, "'", "''"))
+		return []string{"powershell", "-NoProfile", "-NonInteractive", "-Command", script}, nil
+	}
+	for _, player := range [][]string{{"paplay"}, {"pw-play"}, {"aplay", "-q"}} {
+		if _, err := exec.LookPath(player[0]); err == nil {
+			return append(player, path), nil
+		}
+	}
+	return nil, fmt.Errorf("no sound player found, set sound_player in monitor_props")
+}
+
+// playSound plays a sound file. A failure only costs the sound, the
+// notification is already shown
+func playSound(path string) {
+	command, err := soundCommand(path)
+	if err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), soundTimeout)
+		defer cancel()
+		var out []byte
+		out, err = exec.CommandContext(ctx, command[0], command[1:]...).CombinedOutput()
+		if err != nil && len(out) > 0 {
+			err = fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+		}
+	}
+	if err == nil {
+		return
+	}
+	if soundFailed.CompareAndSwap(false, true) {
+		log.Warn().Msgf("Warning: cannot play %s: %v. Notifications stay silent.", path, err)
+	} else {
+		log.Debug().Msgf("Cannot play %s: %v", path, err)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Operational failures in a row before a source counts as failing, unless
+// error_threshold says otherwise
+const defaultErrorThreshold = 3
+
+// recordFailure counts a failure and reports whether it made the source
+// start failing
+func (s *monitorStatus) recordFailure(err error, threshold int) (failures int, started bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats.Failures++
+	s.stats.LastError = err.Error()
+	if s.stats.Failures >= threshold && s.stats.FailingSince.IsZero() {
+		s.stats.FailingSince = time.Now()
+		return s.stats.Failures, true
+	}
+	return s.stats.Failures, false
+}
+
+// recordSuccess clears the failures and returns when the source started
+// failing, zero if it wasn't
+func (s *monitorStatus) recordSuccess() (failures int, since time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	failures, since = s.stats.Failures, s.stats.FailingSince
+	s.stats.Failures = 0
+	s.stats.LastError = ""
+	s.stats.FailingSince = time.Time{}
+	return failures, since
+}
+
+// sourceFailed counts an operational failure of a source: a watcher error,
+// a git command or fetch that failed, a lost mount. After error_threshold
+// in a row the source is failing and on_error is sent, once until it
+// works again
+func sourceFailed(source Source, status *monitorStatus, err error) {
+	config := source.NotificationConfig
+	failures, started := status.recordFailure(err, config.ErrorThreshold)
+	if !started {
+		return
+	}
+	source.logger.Error().Msgf("Failing after %d errors in a row, last: %v", failures, err)
+	if config.OnError == "" {
+		return
+	}
+	notifySource(source, MessageData{
+		Source:  source.Name,
+		Kind:    kindError,
+		Path:    source.Path,
+		Changes: failures,
+		Error:   err.Error(),
+		Detail:  fmt.Sprintf("%d errors in a row, last: %v", failures, err),
+	}, true)
+}
+
+// sourceWorks ends a run of failures, sending on_error_recover if the
+// source was failing
+func sourceWorks(source Source, status *monitorStatus) {
+	failures, since := status.recordSuccess()
+	if since.IsZero() {
+		return
+	}
+	config := source.NotificationConfig
+	downtime := time.Since(since)
+	source.logger.Info().Msgf("Working again after %d errors over %s", failures, downtime.Round(time.Second))
+	if config.OnErrorRecover == "" {
+		return
+	}
+	notifySource(source, MessageData{
+		Source:  source.Name,
+		Kind:    kindErrorRecover,
+		Path:    source.Path,
+		Changes: failures,
+		Minutes: downtime.Minutes(),
+		Detail:  fmt.Sprintf("working again after %d errors over %s", failures, formatDuration(downtime)),
+	}, true)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Used when stable_for is set without stable_max_wait
+const defaultStableMaxWait = 10 * time.Minute
+
+func validStableFor(source Source) error {
+	if source.StableFor == "" {
+		if source.StableMaxWait != "" {
+			return fmt.Errorf("stable_max_wait needs stable_for")
+		}
+		return nil
+	}
+	stableFor, err := time.ParseDuration(source.StableFor)
+	if err != nil || stableFor <= 0 {
+		return fmt.Errorf("invalid stable_for: %s", source.StableFor)
+	}
+	if source.StableMaxWait != "" {
+		maxWait, err := time.ParseDuration(source.StableMaxWait)
+		if err != nil || maxWait < stableFor {
+			return fmt.Errorf("invalid stable_max_wait: %s (must be at least stable_for)", source.StableMaxWait)
+		}
+	}
+	return nil
+}
+
+// pendingFile is a created file that hasn't been stable for long enough
+type pendingFile struct {
+	firstSeen  time.Time
+	lastChange time.Time
+	size       int64
+	events     int
+}
+
+// releasedFiles are the pending files ready to count, with the ones that
+// were still growing when they hit the max wait
+type releasedFiles struct {
+	paths   []string
+	events  int
+	growing []string
+}
+
+// stableTracker holds back files created in a dir source, e.g. by rsync or
+// a download, until their size hasn't changed for stable_for, so half
+// written files don't count. A file still growing after the max wait
+// counts anyway
+type stableTracker struct {
+	stableFor time.Duration
+	maxWait   time.Duration
+	pending   map[string]*pendingFile
+}
+
+func newStableTracker(source Source) *stableTracker {
+	if source.StableFor == "" {
+		return nil
+	}
+	stableFor, _ := time.ParseDuration(source.StableFor)
+	maxWait := defaultStableMaxWait
+	if source.StableMaxWait != "" {
+		maxWait, _ = time.ParseDuration(source.StableMaxWait)
+	}
+	return &stableTracker{stableFor: stableFor, maxWait: max(maxWait, stableFor), pending: make(map[string]*pendingFile)}
+}
+
+// hold reports whether the event is held back: it created a file, or
+// touched one that is still pending
+func (t *stableTracker) hold(event fsnotify.Event, now time.Time) bool {
+	file, ok := t.pending[event.Name]
+	if !ok {
+		if !event.Has(fsnotify.Create) {
+			return false
+		}
+		info, err := os.Lstat(event.Name)
+		if err != nil || !info.Mode().IsRegular() {
+			return false
+		}
+		file = &pendingFile{firstSeen: now, size: info.Size()}
+		t.pending[event.Name] = file
+	}
+	if event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+		// Gone before it counted, e.g. a download's temporary name
+		delete(t.pending, event.Name)
+		return true
+	}
+	file.lastChange = now
+	file.events++
+	return true
+}
+
+// release returns the files that have been stable for stable_for, or
+// waited for longer than the max wait, and stops tracking them
+func (t *stableTracker) release(now time.Time) releasedFiles {
+	var released releasedFiles
+	for path, file := range t.pending {
+		info, err := os.Lstat(path)
+		if err != nil {
+			delete(t.pending, path)
+			continue
+		}
+		// Not every write is reported, so the size is checked as well
+		if info.Size() != file.size {
+			file.size = info.Size()
+			file.lastChange = now
+		}
+		switch {
+		case now.Sub(file.lastChange) >= t.stableFor:
+		case now.Sub(file.firstSeen) >= t.maxWait:
+			released.growing = append(released.growing, path)
+		default:
+			continue
+		}
+		released.paths = append(released.paths, path)
+		released.events += file.events
+		delete(t.pending, path)
+	}
+	sort.Strings(released.paths)
+	sort.Strings(released.growing)
+	return released
+}
+
+// growingNote names the files counted while still growing, relative to
+// root
+func (r releasedFiles) growingNote(root string) string {
+	var names []string
+	for _, path := range r.growing {
+		name := path
+		if rel, err := filepath.Rel(root, path); err == nil {
+			name = filepath.ToSlash(rel)
+		}
+		names = append(names, name)
+	}
+	return strings.Join(names, ", ")
+}
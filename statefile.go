@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const stateSaveInterval = 5 * time.Minute
+
+// savedState is what MiniMon keeps across restarts in state_file, keyed by
+// source name
+type savedState struct {
+	Streaks map[string]streakRecords `json:"streaks"`
+	// Histograms are the current day's, so a restart doesn't lose them
+	Histograms map[string]activityHistograms `json:"histograms,omitempty"`
+	// GitBaselines are the diffs git_file sources last saw
+	GitBaselines map[string]gitBaseline `json:"git_baselines,omitempty"`
+}
+
+// restoredState is applied to sources as they are registered. keepState
+// is set with state_file, for what is only worth tracking to be saved
+var (
+	restoredState savedState
+	stateMu       sync.Mutex
+	keepState     bool
+)
+
+func loadState(path string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &restoredState); err != nil {
+		return fmt.Errorf("invalid state file %s: %v", path, err)
+	}
+	return nil
+}
+
+// saveState writes the state through a temporary file so a crash never
+// leaves a truncated state file behind
+func saveState(path string) error {
+	state := savedState{Streaks: make(map[string]streakRecords), Histograms: make(map[string]activityHistograms), GitBaselines: make(map[string]gitBaseline)}
+	for _, status := range registry.all() {
+		name, records := status.allTimeStreaks()
+		state.Streaks[name] = records
+		state.Histograms[name] = status.todaysHistograms()
+		if baseline, ok := status.savedGitBaseline(); ok {
+			state.GitBaselines[name] = baseline
+		}
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func runStateSaver(path string) {
+	for range time.Tick(stateSaveInterval) {
+		if err := saveState(path); err != nil {
+			log.Error().Err(err).Msgf("Failed to save state to %s", path)
+		}
+	}
+}
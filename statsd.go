@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	defaultStatsDPrefix = "minimon"
+	// Metrics waiting to be sent. When the sender falls behind, new ones
+	// are dropped rather than holding up a monitor
+	statsDBuffer = 256
+	// How often the address is resolved again, so a restarted agent on a
+	// new IP is picked up
+	statsDResolveInterval = time.Minute
+)
+
+// StatsDConfig sends per-interval metrics over UDP to a StatsD agent at
+// Address (host:port). With DogStatsD the source is a tag and Tags are
+// added to every metric; plain StatsD has the source in the metric name
+type StatsDConfig struct {
+	Address   string            `json:"address"`
+	Prefix    string            `json:"prefix"`
+	DogStatsD bool              `json:"dogstatsd"`
+	Tags      map[string]string `json:"tags"`
+}
+
+func validStatsD(config *StatsDConfig) error {
+	if _, _, err := net.SplitHostPort(config.Address); err != nil {
+		return fmt.Errorf("invalid statsd address %q: %v", config.Address, err)
+	}
+	if len(config.Tags) > 0 && !config.DogStatsD {
+		return fmt.Errorf("statsd tags need dogstatsd")
+	}
+	if config.Prefix == "" {
+		config.Prefix = defaultStatsDPrefix
+	}
+	return nil
+}
+
+// statsDSink formats metrics for the monitors and sends them from its own
+// goroutine
+type statsDSink struct {
+	config StatsDConfig
+	// tags is the configured tags in DogStatsD form, e.g. "env:dev,team:x"
+	tags    string
+	packets chan string
+}
+
+// statsd is nil unless monitor_props configures it
+var statsd *statsDSink
+
+func startStatsD(config StatsDConfig) *statsDSink {
+	s := &statsDSink{config: config, packets: make(chan string, statsDBuffer)}
+	var tags []string
+	for key, value := range config.Tags {
+		tags = append(tags, statsDName(key)+":"+statsDName(value))
+	}
+	sort.Strings(tags)
+	s.tags = strings.Join(tags, ",")
+	log.Info().Msgf("Sending metrics to StatsD at %s", config.Address)
+	go s.run()
+	return s
+}
+
+// statsDName keeps metric names and tags to characters every agent takes
+func statsDName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-' || r == '.' || r == '/' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// send queues one metric of the given StatsD type ("c" or "g") and never
+// blocks. tags are already in "key:value" form
+func (s *statsDSink) send(source, name, value, kind string, tags ...string) {
+	var line string
+	if s.config.DogStatsD {
+		all := append([]string{"source:" + statsDName(source)}, tags...)
+		if s.tags != "" {
+			all = append(all, s.tags)
+		}
+		line = fmt.Sprintf("%s.%s:%s|%s|#%s", s.config.Prefix, name, value, kind, strings.Join(all, ","))
+	} else {
+		line = fmt.Sprintf("%s.%s.%s:%s|%s", s.config.Prefix, statsDName(source), name, value, kind)
+	}
+	select {
+	case s.packets <- line:
+	default:
+		log.Debug().Msgf("StatsD queue full, dropping %s", line)
+	}
+}
+
+// interval reports a monitor's interval result
+func (s *statsDSink) interval(record eventRecord) {
+	switch record.Kind {
+	case kindChange:
+		s.send(record.Source, "changes", fmt.Sprint(record.Events), "c")
+		s.send(record.Source, "idle_minutes", "0", "g")
+	case kindIdle:
+		s.send(record.Source, "idle_minutes", fmt.Sprintf("%.2f", record.IdleMinutes), "g")
+	}
+}
+
+// notified counts a delivered notification
+func (s *statsDSink) notified(source, kind string) {
+	if s.config.DogStatsD {
+		s.send(source, "notifications", "1", "c", "kind:"+statsDName(kind))
+	} else {
+		s.send(source, "notifications."+statsDName(kind), "1", "c")
+	}
+}
+
+func (s *statsDSink) run() {
+	var conn net.Conn
+	var dialed time.Time
+	failing := false
+	for line := range s.packets {
+		if conn != nil && time.Since(dialed) >= statsDResolveInterval {
+			conn.Close()
+			conn = nil
+		}
+		if conn == nil {
+			var err error
+			if conn, err = net.Dial("udp", s.config.Address); err != nil {
+				if !failing {
+					log.Warn().Msgf("Warning: cannot reach StatsD at %s: %v. Dropping metrics until it is back.", s.config.Address, err)
+				}
+				failing = true
+				continue
+			}
+			dialed = time.Now()
+		}
+		if _, err := conn.Write([]byte(line)); err != nil {
+			// E.g. the agent went away; dial again for the next metric
+			if !failing {
+				log.Warn().Msgf("Warning: cannot send to StatsD at %s: %v. Dropping metrics until it is back.", s.config.Address, err)
+			}
+			failing = true
+			conn.Close()
+			conn = nil
+			continue
+		}
+		if failing {
+			log.Info().Msgf("Sending metrics to StatsD at %s again", s.config.Address)
+		}
+		failing = false
+	}
+}
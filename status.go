@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"net"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+)
+
+type statusReport struct {
+	Build        buildInfo      `json:"build"`
+	Snoozed      bool           `json:"snoozed"`
+	SnoozedUntil time.Time      `json:"snoozed_until,omitzero"`
+	Sources      []MonitorStats `json:"sources"`
+}
+
+func currentStatus() *statusReport {
+	report := &statusReport{Build: currentBuild(), Sources: registry.snapshot()}
+	if snooze.Active() {
+		report.Snoozed = true
+		report.SnoozedUntil = snooze.Until()
+	}
+	return report
+}
+
+func runStatus(configPath string, args []string) int {
+	flags := flag.NewFlagSet("status", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print the raw status as JSON")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	socketPath := controlSocketFor(configPath)
+	response, err := controlRequest(socketPath, "status")
+	if err != nil {
+		printControlError(socketPath, err)
+		return 1
+	}
+	if !response.OK || response.Status == nil {
+		fmt.Fprintf(os.Stderr, "MiniMon returned an error: %s\n", response.Error)
+		return 1
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(response.Status)
+		return 0
+	}
+
+	printStatus(response.Status)
+	return 0
+}
+
+// runSourceCommand sends "pause <source>" or "resume <source>"
+func runSourceCommand(configPath, command string, args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "usage: minimon %s <source-name>\n", command)
+		return 2
+	}
+
+	socketPath := controlSocketFor(configPath)
+	response, err := controlRequest(socketPath, command+" "+args[0])
+	if err != nil {
+		printControlError(socketPath, err)
+		return 1
+	}
+	if !response.OK {
+		fmt.Fprintf(os.Stderr, "MiniMon returned an error: %s\n", response.Error)
+		return 1
+	}
+	return 0
+}
+
+func controlSocketFor(configPath string) string {
+	if config, err := loadConfig(configPath); err == nil && config.MonitorProps.ControlSocket != "" {
+		return config.MonitorProps.ControlSocket
+	}
+	return defaultControlSocket()
+}
+
+func printControlError(socketPath string, err error) {
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ENOENT) {
+		fmt.Fprintf(os.Stderr, "MiniMon is not running (no listener on %s)\n", socketPath)
+	} else {
+		fmt.Fprintf(os.Stderr, "Failed to query MiniMon: %v\n", err)
+	}
+}
+
+func controlRequest(socketPath, command string) (*controlResponse, error) {
+	conn, err := net.DialTimeout("unix", socketPath, 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	if _, err := fmt.Fprintln(conn, command); err != nil {
+		return nil, err
+	}
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	var response controlResponse
+	if err := json.Unmarshal(line, &response); err != nil {
+		return nil, fmt.Errorf("invalid response: %v", err)
+	}
+	return &response, nil
+}
+
+func printStatus(report *statusReport) {
+	fmt.Printf("MiniMon %s\n\n", report.Build)
+	if report.Snoozed {
+		fmt.Printf("Notifications snoozed until %s\n\n", report.SnoozedUntil.Local().Format("15:04:05"))
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tTYPE\tSTATE\tLAST CHANGE\tIDLE\tCHANGES\tNOTIFICATIONS")
+	for _, source := range report.Sources {
+		lastChange := "-"
+		if !source.LastChange.IsZero() {
+			lastChange = source.LastChange.Local().Format("2006-01-02 15:04:05")
+		}
+		state := source.State
+		if source.Missing {
+			state += " (missing)"
+		}
+		if len(source.Unwatched) > 0 || source.Unavailable != "" {
+			state += " (degraded)"
+		}
+		if len(source.Truncated) > 0 {
+			state += " (truncated)"
+		}
+		if !source.FailingSince.IsZero() {
+			state += " (failing)"
+		}
+		if source.Overflows > 0 {
+			state += fmt.Sprintf(" (%d overflows)", source.Overflows)
+		}
+		if source.Dropped > 0 {
+			state += fmt.Sprintf(" (%d dropped notifications)", source.Dropped)
+		}
+		if source.OffSchedule {
+			state = "off schedule"
+		}
+		if !source.PausedSince.IsZero() {
+			state = fmt.Sprintf("paused since %s", source.PausedSince.Local().Format("15:04"))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%.1fm\t%d\t%s\n",
+			source.Name, source.Type, state, lastChange, source.IdleMinutes, source.TotalChanges, formatCounts(source.Notifications))
+	}
+	w.Flush()
+
+	var unwatched []string
+	for _, source := range report.Sources {
+		for _, path := range source.Unwatched {
+			unwatched = append(unwatched, fmt.Sprintf("  %s: %s", source.Name, path))
+		}
+	}
+	if len(unwatched) > 0 {
+		fmt.Printf("\nNot watched (inotify watch limit reached):\n%s\n", strings.Join(unwatched, "\n"))
+	}
+
+	var failing []string
+	for _, source := range report.Sources {
+		if !source.FailingSince.IsZero() {
+			failing = append(failing, fmt.Sprintf("  %s: %d errors since %s, last: %s",
+				source.Name, source.Failures, source.FailingSince.Local().Format("15:04:05"), source.LastError))
+		}
+	}
+	if len(failing) > 0 {
+		fmt.Printf("\nFailing:\n%s\n", strings.Join(failing, "\n"))
+	}
+
+	var files []string
+	for _, source := range report.Sources {
+		for _, name := range slices.Sorted(maps.Keys(source.FileChanges)) {
+			files = append(files, fmt.Sprintf("  %s: %s %d", source.Name, name, source.FileChanges[name]))
+		}
+	}
+	if len(files) > 0 {
+		fmt.Printf("\nChanges per file:\n%s\n", strings.Join(files, "\n"))
+	}
+
+	var entries []string
+	for _, source := range report.Sources {
+		for _, entry := range source.Entries {
+			if entry.LastSuppressed.IsZero() || entry.LastSuppressed.Before(entry.LastDelivered) {
+				continue
+			}
+			lastDelivered := "never"
+			if !entry.LastDelivered.IsZero() {
+				lastDelivered = entry.LastDelivered.Local().Format("15:04:05")
+			}
+			entries = append(entries, fmt.Sprintf("  %s %s: %s %s at %s, last delivered %s",
+				source.Name, entryLabel(entry.Entry), entry.Kind, entry.Reason, entry.LastSuppressed.Local().Format("15:04:05"), lastDelivered))
+		}
+	}
+	if len(entries) > 0 {
+		fmt.Printf("\nLast notification suppressed:\n%s\n", strings.Join(entries, "\n"))
+	}
+
+	var unavailable []string
+	for _, source := range report.Sources {
+		if source.Unavailable != "" {
+			unavailable = append(unavailable, fmt.Sprintf("  %s: %s (%s)", source.Name, source.Path, source.Unavailable))
+		}
+	}
+	if len(unavailable) > 0 {
+		fmt.Printf("\nUnavailable (check_mount):\n%s\n", strings.Join(unavailable, "\n"))
+	}
+
+	var truncated []string
+	for _, source := range report.Sources {
+		for _, path := range source.Truncated {
+			truncated = append(truncated, fmt.Sprintf("  %s: %s", source.Name, path))
+		}
+	}
+	if len(truncated) > 0 {
+		fmt.Printf("\nNot watched (max_depth or max_watched_dirs reached):\n%s\n", strings.Join(truncated, "\n"))
+	}
+}
+
+func entryLabel(entry int) string {
+	if entry == fallbackEntry {
+		return "default message"
+	}
+	return fmt.Sprintf("entry %d", entry)
+}
+
+func formatCounts(counts map[string]int) string {
+	if len(counts) == 0 {
+		return "-"
+	}
+	kinds := make([]string, 0, len(counts))
+	for kind := range counts {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	parts := make([]string, 0, len(kinds))
+	for _, kind := range kinds {
+		parts = append(parts, fmt.Sprintf("%s=%d", kind, counts[kind]))
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,95 @@
+package main
+
+import "fmt"
+
+// streakRecords are the longest runs of active (changes every interval)
+// and idle intervals, in minutes like idle_minutes
+type streakRecords struct {
+	LongestActive float64 `json:"longest_active_minutes"`
+	LongestIdle   float64 `json:"longest_idle_minutes"`
+}
+
+// streakTracker follows the current streak of a source interval by
+// interval and keeps the daily and all-time records
+type streakTracker struct {
+	interval float64 // minutes
+	active   int     // consecutive intervals with changes
+	idle     int     // consecutive intervals without
+	// toBeat is the all-time record when the current active streak began,
+	// set by an earlier streak. celebrated is set once the streak beat it,
+	// so a personal best is announced once per streak
+	toBeat     float64
+	celebrated bool
+
+	Today   streakRecords
+	AllTime streakRecords
+}
+
+// observe records one interval and reports whether the current active
+// streak just became a new all-time record. The very first streak of a
+// source doesn't count, there is nothing to beat yet
+func (t *streakTracker) observe(active bool) (personalBest bool) {
+	if active {
+		if t.active == 0 {
+			t.toBeat = t.AllTime.LongestActive
+		}
+		t.active++
+		t.idle = 0
+	} else {
+		t.idle++
+		t.active = 0
+		t.celebrated = false
+	}
+
+	activeLen := float64(t.active) * t.interval
+	idleLen := float64(t.idle) * t.interval
+	t.Today.LongestActive = max(t.Today.LongestActive, activeLen)
+	t.Today.LongestIdle = max(t.Today.LongestIdle, idleLen)
+	t.AllTime.LongestIdle = max(t.AllTime.LongestIdle, idleLen)
+
+	if activeLen > t.AllTime.LongestActive {
+		t.AllTime.LongestActive = activeLen
+	}
+	if t.toBeat > 0 && activeLen > t.toBeat && !t.celebrated {
+		personalBest = true
+		t.celebrated = true
+	}
+	return personalBest
+}
+
+// newDay starts the daily records over and returns the finished day's
+func (t *streakTracker) newDay() streakRecords {
+	today := t.Today
+	t.Today = streakRecords{}
+	return today
+}
+
+// StreakStats is the streak part of MonitorStats
+type StreakStats struct {
+	CurrentActive float64       `json:"current_active_minutes"`
+	CurrentIdle   float64       `json:"current_idle_minutes"`
+	Today         streakRecords `json:"today"`
+	AllTime       streakRecords `json:"all_time"`
+}
+
+func (t *streakTracker) stats() StreakStats {
+	return StreakStats{
+		CurrentActive: float64(t.active) * t.interval,
+		CurrentIdle:   float64(t.idle) * t.interval,
+		Today:         t.Today,
+		AllTime:       t.AllTime,
+	}
+}
+
+// sendPersonalBest tells the source's on_personal_best entries about a new
+// longest active streak
+func sendPersonalBest(source Source, minutes float64) {
+	source.logger.Info().Msgf("New longest active streak: %s", formatMinutes(minutes))
+	notifySource(source, MessageData{
+		Source:  source.Name,
+		Kind:    kindPersonalBest,
+		Path:    source.Path,
+		Minutes: minutes,
+		Detail:  fmt.Sprintf("new personal best: active for %s", formatMinutes(minutes)),
+	}, false)
+}
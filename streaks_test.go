@@ -0,0 +1,78 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStreakTracker(t *testing.T) {
+	tests := []struct {
+		name      string
+		intervals string // a for an active interval, i for an idle one
+		best      []int  // intervals that set a new personal best
+		today     streakRecords
+		current   StreakStats
+	}{
+		{"first streak is no record", "aaa", nil, streakRecords{LongestActive: 15}, StreakStats{CurrentActive: 15}},
+		{"beaten once", "aaiaaaa", []int{5}, streakRecords{LongestActive: 20, LongestIdle: 5}, StreakStats{CurrentActive: 20}},
+		{"tie is no record", "aaiaa", nil, streakRecords{LongestActive: 10, LongestIdle: 5}, StreakStats{CurrentActive: 10}},
+		{"idle streak", "aiiia", nil, streakRecords{LongestActive: 5, LongestIdle: 15}, StreakStats{CurrentActive: 5}},
+		{"new streak celebrates again", "aiaaiaaa", []int{3, 7}, streakRecords{LongestActive: 15, LongestIdle: 5}, StreakStats{CurrentActive: 15}},
+		{"ends idle", "aaii", nil, streakRecords{LongestActive: 10, LongestIdle: 10}, StreakStats{CurrentIdle: 10}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := &streakTracker{interval: 5}
+			var best []int
+			for i, c := range tt.intervals {
+				if tracker.observe(c == 'a') {
+					best = append(best, i)
+				}
+			}
+			if !reflect.DeepEqual(best, tt.best) {
+				t.Errorf("personal bests at %v, want %v", best, tt.best)
+			}
+			if tracker.Today != tt.today {
+				t.Errorf("today = %+v, want %+v", tracker.Today, tt.today)
+			}
+			stats := tracker.stats()
+			if stats.CurrentActive != tt.current.CurrentActive || stats.CurrentIdle != tt.current.CurrentIdle {
+				t.Errorf("current = %v active, %v idle, want %v, %v", stats.CurrentActive, stats.CurrentIdle, tt.current.CurrentActive, tt.current.CurrentIdle)
+			}
+		})
+	}
+}
+
+func TestStreakTrackerNewDay(t *testing.T) {
+	tracker := &streakTracker{interval: 1}
+	for _, active := range []bool{true, true, false} {
+		tracker.observe(active)
+	}
+	finished := tracker.newDay()
+	if finished != (streakRecords{LongestActive: 2, LongestIdle: 1}) {
+		t.Errorf("finished day = %+v", finished)
+	}
+	if tracker.Today != (streakRecords{}) {
+		t.Errorf("today not reset: %+v", tracker.Today)
+	}
+	// The all-time records and the running streak carry over
+	tracker.observe(false)
+	if tracker.AllTime.LongestActive != 2 || tracker.Today.LongestIdle != 2 {
+		t.Errorf("all time = %+v, today = %+v", tracker.AllTime, tracker.Today)
+	}
+}
+
+func TestStreakRecordBeatsRestoredRecord(t *testing.T) {
+	// A record restored from the state file is beaten like one set in
+	// this run, even by the first streak
+	tracker := &streakTracker{interval: 5, AllTime: streakRecords{LongestActive: 10}}
+	var best []int
+	for i := 0; i < 4; i++ {
+		if tracker.observe(true) {
+			best = append(best, i)
+		}
+	}
+	if !reflect.DeepEqual(best, []int{2}) {
+		t.Errorf("personal bests at %v, want [2]", best)
+	}
+}
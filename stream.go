@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Values of the output setting
+const (
+	outputNone   = ""
+	outputNDJSON = "ndjson"
+)
+
+// streamVersion is bumped whenever a field of streamRecord changes meaning
+// or goes away. New fields may be added without a bump
+const streamVersion = 1
+
+// streamRecord is one line of the --output ndjson stream
+type streamRecord struct {
+	Version          int       `json:"v"`
+	Timestamp        time.Time `json:"ts"`
+	Source           string    `json:"source"`
+	Type             string    `json:"type"`
+	Changes          int       `json:"changes"`
+	Files            int       `json:"files"`
+	IdleMinutes      float64   `json:"idle_minutes"`
+	Message          string    `json:"message"`
+	NotifiedChannels []string  `json:"notified_channels"`
+}
+
+// eventStream writes interval results to stdout. Each record is one Write
+// under the lock, so lines from different monitors never interleave
+type eventStream struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+var stream *eventStream
+
+func validOutput(output string) error {
+	switch output {
+	case outputNone, outputNDJSON:
+		return nil
+	}
+	return fmt.Errorf("invalid output: %s (expected ndjson)", output)
+}
+
+func startStream(output string) *eventStream {
+	if output != outputNDJSON {
+		return nil
+	}
+	log.Info().Msg("Writing interval results to stdout as NDJSON")
+	return &eventStream{out: os.Stdout}
+}
+
+func (s *eventStream) write(record eventRecord) {
+	channels := record.channels
+	if channels == nil {
+		channels = []string{}
+	}
+	line, err := json.Marshal(streamRecord{
+		Version:          streamVersion,
+		Timestamp:        record.Timestamp,
+		Source:           record.Source,
+		Type:             record.Kind,
+		Changes:          record.Events,
+		Files:            record.Files,
+		IdleMinutes:      record.IdleMinutes,
+		Message:          strings.TrimSpace(record.message),
+		NotifiedChannels: channels,
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to encode stream record")
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.out.Write(append(line, '\n')); err != nil {
+		log.Error().Err(err).Msg("Failed to write stream record")
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+type DailySummaryConfig struct {
+	// Time is the local time of day the summary is sent, as "HH:MM"
+	Time    string `json:"time"`
+	Desktop *bool  `json:"desktop,omitempty"`
+}
+
+// dailyStats are the per-source counters a daily summary reports. They are
+// reset every time a summary is sent
+type dailyStats struct {
+	Since         time.Time
+	Changes       int
+	HourlyChanges [24]int
+	IdleMinutes   float64
+	Notifications int
+	Streaks       streakRecords
+}
+
+func (d dailyStats) busiestHour() (int, bool) {
+	busiest := 0
+	for hour, changes := range d.HourlyChanges {
+		if changes > d.HourlyChanges[busiest] {
+			busiest = hour
+		}
+	}
+	return busiest, d.HourlyChanges[busiest] > 0
+}
+
+func parseSummaryTime(value string) (hour, minute int, err error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid daily_summary time %q, expected HH:MM", value)
+	}
+	return t.Hour(), t.Minute(), nil
+}
+
+// nextSummary returns the next local occurrence of hour:minute after now.
+// time.Date normalizes across DST changes
+func nextSummary(now time.Time, hour, minute int) time.Time {
+	next := time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, time.Local)
+	if !next.After(now) {
+		next = time.Date(now.Year(), now.Month(), now.Day()+1, hour, minute, 0, 0, time.Local)
+	}
+	return next
+}
+
+func runDailySummary(config DailySummaryConfig) {
+	hour, minute, _ := parseSummaryTime(config.Time)
+	for {
+		next := nextSummary(time.Now(), hour, minute)
+		log.Debug().Msgf("Next daily summary at %s", next.Format("2006-01-02 15:04"))
+		time.Sleep(time.Until(next))
+		sendDailySummary(config)
+	}
+}
+
+func sendDailySummary(config DailySummaryConfig) {
+	lines := []string{}
+	for _, status := range registry.all() {
+		name, stats := status.takeDaily()
+		line := fmt.Sprintf("%s: %d changes", name, stats.Changes)
+		if hour, ok := stats.busiestHour(); ok {
+			line += fmt.Sprintf(" (busiest %02d:00-%02d:00)", hour, (hour+1)%24)
+		}
+		line += fmt.Sprintf(", idle %s, %d notifications", formatMinutes(stats.IdleMinutes), stats.Notifications)
+		if stats.Streaks.LongestActive > 0 {
+			line += fmt.Sprintf(", longest active streak %s", formatMinutes(stats.Streaks.LongestActive))
+		}
+		if histograms := status.todaysHistograms().summary(); histograms != "" {
+			line += ", " + histograms
+		}
+		// A summary covering less than a day says so, e.g. after a mid-day start
+		if time.Since(stats.Since) < 23*time.Hour {
+			line += fmt.Sprintf(" since %s", stats.Since.Local().Format("15:04"))
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 {
+		return
+	}
+
+	message := "Daily summary\n" + strings.Join(lines, "\n")
+	log.Info().Msgf("Daily summary: %s", strings.Join(lines, "; "))
+	data := MessageData{Source: "minimon", Kind: kindSummary, Detail: message}
+	if err := sendNotification(Notification{Desktop: config.Desktop}, data, message); err != nil {
+		log.Error().Err(err).Msg("Failed to send daily summary")
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"sort"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Why a notification entry did not deliver, as reported in the status
+const (
+	suppressSnoozed        = "snoozed"
+	suppressPaused         = "paused"
+	suppressOffSchedule    = "off_schedule"
+	suppressMaxPerHour     = "max_per_hour"
+	suppressDuplicate      = "duplicate"
+	suppressMaxIdle        = "max_idle"
+	suppressIdleBackoff    = "idle_backoff"
+	suppressIdleOnce       = "idle_once"
+	suppressAfterSuspend   = "after_suspend"
+	suppressDeliveryFailed = "delivery_failed"
+)
+
+// EntryStats tracks one notification entry of a source, so the status can
+// tell why a notification never arrived. Entry is the index in
+// notification_set, or -1 for the default message
+type EntryStats struct {
+	Entry          int       `json:"entry"`
+	LastDelivered  time.Time `json:"last_delivered,omitzero"`
+	LastSuppressed time.Time `json:"last_suppressed,omitzero"`
+	// Kind and Reason describe the last suppression
+	Kind   string `json:"kind,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+func (s *monitorStatus) entryStats(entry int) *EntryStats {
+	if s.entries == nil {
+		s.entries = make(map[int]*EntryStats)
+	}
+	stats := s.entries[entry]
+	if stats == nil {
+		stats = &EntryStats{Entry: entry}
+		s.entries[entry] = stats
+	}
+	return stats
+}
+
+func (s *monitorStatus) recordDelivered(entry int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entryStats(entry).LastDelivered = time.Now()
+}
+
+func (s *monitorStatus) recordSuppressed(entry int, kind, reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := s.entryStats(entry)
+	stats.LastSuppressed = time.Now()
+	stats.Kind = kind
+	stats.Reason = reason
+	log.Debug().Msgf("%s: %s notification for entry %d not delivered: %s", s.stats.Name, kind, entry, reason)
+}
+
+// entrySnapshot returns the entries in notification_set order. The caller
+// holds s.mu
+func (s *monitorStatus) entrySnapshot() []EntryStats {
+	entries := make([]EntryStats, 0, len(s.entries))
+	for _, stats := range s.entries {
+		entries = append(entries, *stats)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Entry < entries[j].Entry })
+	return entries
+}
+
+// suppressEntries records reason for every entry of the source that has
+// text for kind, for suppressions decided before an entry is picked
+func suppressEntries(source Source, status *monitorStatus, kind, reason string) {
+	for _, notification := range source.NotificationConfig.NotificationSet {
+		if notification.textFor(kind) != "" {
+			status.recordSuppressed(notification.entry, kind, reason)
+		}
+	}
+}
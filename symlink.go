@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"time"
+)
+
+// followSymlinks reports whether a dir source on a symlink watches the
+// link's target, which it does unless follow_symlinks is false
+func (s Source) followSymlinks() bool {
+	return s.FollowSymlinks == nil || *s.FollowSymlinks
+}
+
+// symlinkMonitor watches the target of a dir source whose path is a
+// symlink, e.g. ~/current-project, and starts over on the new target when
+// the link is pointed elsewhere
+type symlinkMonitor struct {
+	monitorBase
+}
+
+func newSymlinkMonitor(source Source, status *monitorStatus) *symlinkMonitor {
+	return &symlinkMonitor{monitorBase: monitorBase{source: source, status: status}}
+}
+
+func (m *symlinkMonitor) Start(ctx context.Context) error {
+	link := m.source.Path
+	logger := m.source.logger
+	target, err := filepath.EvalSymlinks(link)
+	if err != nil {
+		return err
+	}
+	for {
+		logger.Info().Msgf("Watching %s, the target of %s", target, link)
+		source := m.source
+		source.Path = target
+		targetCtx, stop := context.WithCancel(ctx)
+		changed := make(chan string, 1)
+		go watchLinkTarget(targetCtx, source, link, func(target string) {
+			changed <- target
+			stop()
+		})
+		err := newDirMonitor(source, m.status, nil).Start(targetCtx)
+		stop()
+		if err != nil || ctx.Err() != nil {
+			return err
+		}
+		previous := target
+		target = <-changed
+		logger.Info().Msgf("%s now points to %s instead of %s, watching the new target", link, target, previous)
+	}
+}
+
+// watchLinkTarget checks every interval where link points and calls
+// retarget once that changes to a path that exists
+func watchLinkTarget(ctx context.Context, source Source, link string, retarget func(string)) {
+	logger := source.logger
+	ticker := time.NewTicker(time.Duration(source.NotificationConfig.NotificationInterval) * time.Second)
+	defer ticker.Stop()
+	dangling := false
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		target, err := filepath.EvalSymlinks(link)
+		if err != nil {
+			// Keep watching the old target until the link is usable again
+			if !dangling {
+				logger.Warn().Msgf("Warning: cannot resolve %s: %v. Still watching %s.", link, err, source.Path)
+			}
+			dangling = true
+			continue
+		}
+		dangling = false
+		if target != source.Path {
+			retarget(target)
+			return
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// How often STATUS= is refreshed while running under systemd
+const systemdStatusInterval = 30 * time.Second
+
+// sdNotify sends state to systemd's notification socket. It does nothing
+// when not started by systemd
+func sdNotify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	if socket[0] == '@' {
+		// Abstract namespace socket
+		socket = "\x00" + socket[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// reportReadiness sends READY=1 once every source is watching or has been
+// skipped, so units ordered after MiniMon start after the watchers exist,
+// then keeps STATUS= up to date
+func reportReadiness() {
+	registry.waitReady()
+	log.Info().Msgf("All sources started: %s", sourceCounts())
+	if os.Getenv("NOTIFY_SOCKET") == "" {
+		return
+	}
+	if err := sdNotify("READY=1\nSTATUS=" + sourceCounts()); err != nil {
+		log.Warn().Msgf("Warning: %v. Could not notify systemd.", err)
+		return
+	}
+	for range time.Tick(systemdStatusInterval) {
+		if err := sdNotify("STATUS=" + sourceCounts()); err != nil {
+			log.Debug().Err(err).Msg("Failed to update systemd status")
+		}
+	}
+}
+
+// sourceCounts summarizes the sources by state, e.g. "4 sources: 2 active,
+// 1 idle, 1 invalid"
+func sourceCounts() string {
+	stats := registry.snapshot()
+	counts := make(map[string]int)
+	for _, s := range stats {
+		state := s.State
+		if !s.PausedSince.IsZero() || s.OffSchedule {
+			state = "paused"
+		}
+		counts[state]++
+	}
+	var parts []string
+	for _, state := range []string{stateStarting, stateWatching, stateActive, stateIdle, stateOK, stateAlert, "paused", stateInvalid, stateDisabled} {
+		if counts[state] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[state], state))
+		}
+	}
+	summary := fmt.Sprintf("%d sources", len(stats))
+	if len(parts) > 0 {
+		summary += ": " + strings.Join(parts, ", ")
+	}
+	return summary
+}
+
+// systemdWatchdogInterval returns how often to send WATCHDOG=1, half of the
+// unit's WatchdogSec, or 0 when the watchdog isn't enabled for this process
+func systemdWatchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond / 2
+}
+
+func runSystemdWatchdog(interval time.Duration) {
+	log.Info().Msgf("systemd watchdog enabled, notifying every %s", interval)
+	for range time.Tick(interval) {
+		if err := sdNotify("WATCHDOG=1"); err != nil {
+			log.Error().Err(err).Msg("Failed to notify the systemd watchdog")
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import "path/filepath"
+
+// editorArtifacts match the base names of files editors and downloaders
+// write while saving: vim swap files, emacs autosaves and lock links,
+// JetBrains safe-write files and partial downloads
+var editorArtifacts = []string{
+	".*.swp",
+	".*.swo",
+	".*.swx",
+	"#*#",
+	".#*",
+	"*___jb_tmp___",
+	"*___jb_old___",
+	"*.tmp",
+	"*.part",
+}
+
+// isEditorArtifact reports whether path is a temporary file that a save
+// or download leaves behind for a moment, rather than a real change
+func isEditorArtifact(path string) bool {
+	name := filepath.Base(path)
+	for _, pattern := range editorArtifacts {
+		if matched, _ := filepath.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// builtinFilters reports whether the source drops editor artifacts, which
+// it does unless builtin_filters is false
+func (s Source) builtinFilters() bool {
+	return s.BuiltinFilters == nil || *s.BuiltinFilters
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestIsEditorArtifact(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/work/.main.go.swp", true},
+		{"/work/.main.go.swo", true},
+		{"/work/.main.go.swx", true},
+		{"/work/#notes.org#", true},
+		{"/work/.#notes.org", true},
+		{"/work/Main.java___jb_tmp___", true},
+		{"/work/Main.java___jb_old___", true},
+		{"/downloads/data.tmp", true},
+		{"/downloads/video.mp4.part", true},
+		{filepath.Join("nested", "dir", ".x.swp"), true},
+		{"/work/main.go", false},
+		{"/work/main.swp", false}, // vim swap files are hidden
+		{"/work/.gitignore", false},
+		{"/work/notes.org#", false},
+		{"/work/#notes.org", false},
+		{"/work/.swp/main.go", false}, // only the base name counts
+		{"/work/data.tmp.bak", false},
+		{"/work/partial", false},
+		{"/work/Main.java___jb_tmp", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := isEditorArtifact(tt.path); got != tt.want {
+				t.Errorf("isEditorArtifact(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuiltinFilters(t *testing.T) {
+	off, on := false, true
+	tests := []struct {
+		name   string
+		filter *bool
+		want   bool
+	}{
+		{"default", nil, true},
+		{"on", &on, true},
+		{"off", &off, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (Source{BuiltinFilters: tt.filter}).builtinFilters(); got != tt.want {
+				t.Errorf("builtinFilters() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const throttleWindow = time.Hour
+
+// The fallback entry notifySource uses when no configured entry has text
+const fallbackEntry = -1
+
+type throttleKey struct {
+	source string
+	entry  int
+}
+
+// entryBudget is the delivery history of one notification entry over the
+// last throttleWindow
+type entryBudget struct {
+	sent       []time.Time
+	suppressed int
+	// reset fires when the oldest delivery leaves the window and reports
+	// what was suppressed in the meantime
+	reset *time.Timer
+}
+
+// throttler enforces max_notifications_per_hour per entry per source on a
+// rolling window, so a busy source can't produce a popup every interval
+type throttler struct {
+	mu      sync.Mutex
+	budgets map[throttleKey]*entryBudget
+}
+
+var throttle = &throttler{budgets: make(map[throttleKey]*entryBudget)}
+
+// allow reports whether notification may be delivered now, counting it
+// against the entry's budget when it may
+func (t *throttler) allow(notification Notification, data MessageData) bool {
+	if notification.maxPerHour <= 0 {
+		return true
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := throttleKey{source: data.Source, entry: notification.entry}
+	budget := t.budgets[key]
+	if budget == nil {
+		budget = &entryBudget{}
+		t.budgets[key] = budget
+	}
+	now := time.Now()
+	budget.prune(now)
+	// While a reset is pending the summary goes out first
+	if budget.reset == nil && len(budget.sent) < notification.maxPerHour {
+		budget.sent = append(budget.sent, now)
+		return true
+	}
+
+	budget.suppressed++
+	log.Debug().Msgf("Notification budget of %d per hour used up for %s, suppressing: %s", notification.maxPerHour, data.Source, data.Kind)
+	if budget.reset == nil {
+		wait := budget.sent[0].Add(throttleWindow).Sub(now)
+		budget.reset = time.AfterFunc(wait, func() {
+			t.flush(key, notification, data)
+		})
+	}
+	return false
+}
+
+func (b *entryBudget) prune(now time.Time) {
+	kept := b.sent[:0]
+	for _, sent := range b.sent {
+		if now.Sub(sent) < throttleWindow {
+			kept = append(kept, sent)
+		}
+	}
+	b.sent = kept
+}
+
+// flush delivers the "suppressed N notifications" message once the budget
+// has room again. It counts against the new window like any delivery
+func (t *throttler) flush(key throttleKey, notification Notification, last MessageData) {
+	t.mu.Lock()
+	budget := t.budgets[key]
+	suppressed := budget.suppressed
+	budget.suppressed = 0
+	budget.reset = nil
+	now := time.Now()
+	budget.prune(now)
+	budget.sent = append(budget.sent, now)
+	t.mu.Unlock()
+
+	data := MessageData{
+		Source:  last.Source,
+		Kind:    kindSuppressed,
+		Path:    last.Path,
+		Changes: suppressed,
+		Detail:  fmt.Sprintf("suppressed %d notifications in the last hour", suppressed),
+	}
+	// The entry's own wording is for the kinds it was written for
+	notification.tmpl = nil
+	notification.maxPerHour = 0
+	message := constructNotificationMessage(notification, data)
+	log.Info().Msgf("%s: %s", data.Source, data.Detail)
+	if err := sendNotification(notification, data, message); err != nil {
+		log.Error().Err(err).Msgf("Failed to send suppressed notification summary for %s", data.Source)
+	}
+}
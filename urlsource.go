@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultURLTimeout          = 10
+	defaultURLFailureThreshold = 3
+	urlMaxBodySize             = 10 << 20
+)
+
+type urlFetcher struct {
+	url          string
+	client       *http.Client
+	headers      map[string]string
+	jsonPath     []string
+	regex        *regexp.Regexp
+	etag         string
+	lastModified string
+}
+
+func validURLSource(source Source) error {
+	if !strings.HasPrefix(source.Path, "http://") && !strings.HasPrefix(source.Path, "https://") {
+		return fmt.Errorf("url source path must be an http(s) url")
+	}
+	if source.ExtractRegex != "" {
+		if _, err := regexp.Compile(source.ExtractRegex); err != nil {
+			return fmt.Errorf("invalid extract_regex: %v", err)
+		}
+	}
+	return nil
+}
+
+func newURLFetcher(source Source) *urlFetcher {
+	f := &urlFetcher{
+		url:     source.Path,
+		client:  &http.Client{Timeout: time.Duration(source.Timeout) * time.Second},
+		headers: source.Headers,
+	}
+	if source.ExtractJSON != "" {
+		path := strings.TrimPrefix(strings.TrimPrefix(source.ExtractJSON, "$"), ".")
+		if path != "" {
+			f.jsonPath = strings.Split(path, ".")
+		}
+	}
+	if source.ExtractRegex != "" {
+		f.regex = regexp.MustCompile(source.ExtractRegex)
+	}
+	return f
+}
+
+// fetch returns the hash of the (extracted) body, or modified=false when the
+// server answered 304 Not Modified
+func (f *urlFetcher) fetch(ctx context.Context) (hash [sha256.Size]byte, modified bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.url, nil)
+	if err != nil {
+		return hash, false, err
+	}
+	for key, value := range f.headers {
+		req.Header.Set(key, value)
+	}
+	if f.etag != "" {
+		req.Header.Set("If-None-Match", f.etag)
+	}
+	if f.lastModified != "" {
+		req.Header.Set("If-Modified-Since", f.lastModified)
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return hash, false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return hash, false, nil
+	}
+	if resp.StatusCode >= 400 {
+		return hash, false, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, urlMaxBodySize))
+	if err != nil {
+		return hash, false, err
+	}
+	content, err := f.extract(body)
+	if err != nil {
+		return hash, false, err
+	}
+
+	f.etag = resp.Header.Get("ETag")
+	f.lastModified = resp.Header.Get("Last-Modified")
+	return sha256.Sum256(content), true, nil
+}
+
+// rebaseline drops the validators of the last response, so the next fetch
+// gets the full content even if the server thinks it has not changed
+func (f *urlFetcher) rebaseline() {
+	f.etag = ""
+	f.lastModified = ""
+}
+
+func (f *urlFetcher) extract(body []byte) ([]byte, error) {
+	if f.jsonPath != nil {
+		var value any
+		if err := json.Unmarshal(body, &value); err != nil {
+			return nil, fmt.Errorf("response is not json: %v", err)
+		}
+		for _, key := range f.jsonPath {
+			switch node := value.(type) {
+			case map[string]any:
+				next, ok := node[key]
+				if !ok {
+					return nil, fmt.Errorf("json path %s not found", key)
+				}
+				value = next
+			case []any:
+				index, err := strconv.Atoi(key)
+				if err != nil || index < 0 || index >= len(node) {
+					return nil, fmt.Errorf("json index %s out of range", key)
+				}
+				value = node[index]
+			default:
+				return nil, fmt.Errorf("json path %s not found", key)
+			}
+		}
+		// Re-encoding gives a stable form regardless of server formatting
+		var err error
+		body, err = json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if f.regex != nil {
+		match := f.regex.FindSubmatch(body)
+		if match == nil {
+			return nil, fmt.Errorf("extract_regex did not match")
+		}
+		// The first capture group if there is one, the whole match otherwise
+		if len(match) > 1 {
+			return match[1], nil
+		}
+		return match[0], nil
+	}
+	return body, nil
+}
+
+// urlMonitor fetches a url every interval and counts a change when the
+// (extracted) content differs from the previous fetch
+type urlMonitor struct {
+	monitorBase
+}
+
+func newURLMonitor(source Source, status *monitorStatus) *urlMonitor {
+	return &urlMonitor{monitorBase: monitorBase{source: source, status: status}}
+}
+
+func (m *urlMonitor) Start(ctx context.Context) error {
+	source, status := m.source, m.status
+	logger := source.logger
+	config := source.NotificationConfig
+	fetcher := newURLFetcher(source)
+
+	ticker := time.NewTicker(time.Duration(config.NotificationInterval) * time.Second)
+	defer ticker.Stop()
+
+	var previous [sha256.Size]byte
+	haveBaseline := false
+	failures := 0
+	unreachable := false
+	engine := newActivityEngine(source, status, "url", time.Now)
+
+	check := func() {
+		checkStart := time.Now()
+		if !engine.startInterval() {
+			// Fetch a fresh baseline on resume instead of replaying. It
+			// must be unconditional: a 304 for content that changed while
+			// paused would make the first change after it the baseline
+			haveBaseline = false
+			fetcher.rebaseline()
+			return
+		}
+		hash, modified, err := fetcher.fetch(ctx)
+		if ctx.Err() != nil {
+			// Stopped mid-fetch, which is no failure
+			return
+		}
+		if err != nil {
+			// Failures are neither changes nor idle time
+			failures++
+			logger.Warn().Msgf("Failed to fetch %s (%d in a row): %v", source.Path, failures, err)
+			sourceFailed(source, status, err)
+			if failures >= source.FailureThreshold && !unreachable {
+				unreachable = true
+				notifySource(source, MessageData{
+					Source: source.Name,
+					Kind:   kindMissing,
+					Path:   source.Path,
+					Detail: fmt.Sprintf("%s failed %d times in a row: %v", source.Path, failures, err),
+				}, true)
+			}
+			return
+		}
+		if unreachable {
+			notifySource(source, MessageData{
+				Source: source.Name,
+				Kind:   kindRecover,
+				Path:   source.Path,
+				Detail: fmt.Sprintf("%s is reachable again", source.Path),
+			}, true)
+		}
+		failures = 0
+		unreachable = false
+		sourceWorks(source, status)
+
+		if !haveBaseline {
+			if modified {
+				previous = hash
+				haveBaseline = true
+				logger.Info().Msgf("Fetched initial content of %s", source.Path)
+			}
+			return
+		}
+
+		changed := modified && hash != previous
+		changes := 0
+		if changed {
+			changes = 1
+		}
+		engine.endInterval(changes)
+		if !changed {
+			engine.idleInterval(checkStart)
+			return
+		}
+		previous = hash
+		logger.Info().Msgf("Content of %s changed", source.Path)
+		engine.activity(1)
+		engine.notifyChange(MessageData{
+			Source:   source.Name,
+			Kind:     kindChange,
+			Path:     source.Path,
+			Changes:  1,
+			Minutes:  engine.intervalMinutes(),
+			Velocity: engine.velocity(1, "changes"),
+		})
+		recordEvent(eventRecord{Source: source.Name, Kind: kindChange, Events: 1, since: checkStart})
+	}
+
+	check()
+	status.markReady()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		check()
+	}
+}
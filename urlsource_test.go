@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestURLFetcherRebaseline(t *testing.T) {
+	body := "v1"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		etag := fmt.Sprintf("%q", body)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		fmt.Fprint(w, body)
+	}))
+	defer server.Close()
+
+	fetcher := newURLFetcher(Source{Path: server.URL, Timeout: 5})
+	first, modified, err := fetcher.fetch(context.Background())
+	if err != nil || !modified {
+		t.Fatalf("first fetch: modified=%v err=%v", modified, err)
+	}
+	if _, modified, _ := fetcher.fetch(context.Background()); modified {
+		t.Error("unchanged content fetched again despite the ETag")
+	}
+
+	fetcher.rebaseline()
+	again, modified, err := fetcher.fetch(context.Background())
+	if err != nil || !modified {
+		t.Fatalf("fetch after rebaseline: modified=%v err=%v, want the full content", modified, err)
+	}
+	if again != first {
+		t.Error("same content hashed differently")
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"runtime/debug"
+	"strings"
+)
+
+// Set at build time, e.g.
+//
+//	go build -ldflags "-X main.version=1.4.0 -X main.commit=$(git rev-parse --short HEAD) -X main.buildDate=$(date -u +%F)"
+var (
+	version   = "dev"
+	commit    = ""
+	buildDate = ""
+)
+
+// buildInfo tells which build of MiniMon is running
+type buildInfo struct {
+	Version string `json:"version"`
+	Commit  string `json:"commit,omitempty"`
+	Date    string `json:"date,omitempty"`
+}
+
+// currentBuild returns the ldflags values. Without them, the commit and
+// its date come from the VCS stamp go build adds in a checkout
+func currentBuild() buildInfo {
+	build := buildInfo{Version: version, Commit: commit, Date: buildDate}
+	if build.Commit != "" {
+		return build
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return build
+	}
+	modified := false
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			build.Commit = shortSHA(setting.Value)
+		case "vcs.time":
+			if build.Date == "" {
+				build.Date, _, _ = strings.Cut(setting.Value, "T")
+			}
+		case "vcs.modified":
+			modified = setting.Value == "true"
+		}
+	}
+	if modified && build.Commit != "" {
+		build.Commit += "-dirty"
+	}
+	return build
+}
+
+// String is e.g. "1.4.0 (3f2a9c1, 2026-10-01)", or just the version when
+// nothing else is known
+func (b buildInfo) String() string {
+	var details []string
+	for _, detail := range []string{b.Commit, b.Date} {
+		if detail != "" {
+			details = append(details, detail)
+		}
+	}
+	if len(details) == 0 {
+		return b.Version
+	}
+	return fmt.Sprintf("%s (%s)", b.Version, strings.Join(details, ", "))
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/rs/zerolog"
+)
+
+const watchRetryInterval = time.Minute
+
+var watchLimitOnce sync.Once
+
+// isWatchLimitError reports whether err means the inotify watch limit
+// (fs.inotify.max_user_watches) is exhausted
+func isWatchLimitError(err error) bool {
+	return errors.Is(err, syscall.ENOSPC)
+}
+
+func logWatchLimit(logger zerolog.Logger, path string) {
+	logger.Warn().Msgf("Cannot watch %s: inotify watch limit reached, will retry", path)
+	watchLimitOnce.Do(func() {
+		logger.Warn().Msg("Raise the limit with `sysctl fs.inotify.max_user_watches=524288` (add it to /etc/sysctl.conf to persist)")
+	})
+}
+
+// watchSet adds paths to a watcher, parking the ones that hit the watch
+// limit and retrying them periodically so one exhausted limit degrades a
+// source instead of killing MiniMon
+type watchSet struct {
+	mu      sync.Mutex
+	watcher *fsnotify.Watcher
+	status  *monitorStatus
+	logger  zerolog.Logger
+	pending map[string]bool
+}
+
+// newWatchSet retries parked paths until ctx is done, which the monitor
+// owning the watcher does before closing it
+func newWatchSet(ctx context.Context, watcher *fsnotify.Watcher, status *monitorStatus, logger zerolog.Logger) *watchSet {
+	w := &watchSet{watcher: watcher, status: status, logger: logger, pending: make(map[string]bool)}
+	go w.retryLoop(ctx)
+	return w
+}
+
+// add returns an error only for failures other than the watch limit
+func (w *watchSet) add(path string) error {
+	err := w.watcher.Add(path)
+	if err == nil || !isWatchLimitError(err) {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.pending[path] {
+		logWatchLimit(w.logger, path)
+		w.pending[path] = true
+		w.status.setUnwatched(w.pendingPaths())
+	}
+	return nil
+}
+
+func (w *watchSet) retryLoop(ctx context.Context) {
+	ticker := time.NewTicker(watchRetryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		w.mu.Lock()
+		for path := range w.pending {
+			err := w.watcher.Add(path)
+			if err == nil {
+				w.logger.Info().Msgf("Now watching %s", path)
+				delete(w.pending, path)
+			} else if !isWatchLimitError(err) {
+				w.logger.Warn().Err(err).Msgf("Giving up on watching %s", path)
+				delete(w.pending, path)
+			}
+		}
+		w.status.setUnwatched(w.pendingPaths())
+		w.mu.Unlock()
+	}
+}
+
+func (w *watchSet) pendingPaths() []string {
+	paths := make([]string, 0, len(w.pending))
+	for path := range w.pending {
+		paths = append(paths, path)
+	}
+	return paths
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// WeeklyReportConfig writes a Markdown report of the past week from the
+// history store or event log into Dir every week
+type WeeklyReportConfig struct {
+	Dir string `json:"dir"`
+	// Day and Time are when the report is written, Monday 08:00 unless
+	// set. It covers the seven days before
+	Day  string `json:"day"`
+	Time string `json:"time"`
+}
+
+// How many hours "Top active hours" lists
+const weeklyTopHours = 5
+
+func validWeeklyReport(config WeeklyReportConfig, props MonitorProps) error {
+	if config.Dir == "" {
+		return fmt.Errorf("weekly_report needs a dir")
+	}
+	if props.HistoryStore == nil && props.EventLog == "" {
+		return fmt.Errorf("weekly_report needs history_store or event_log to read the history from")
+	}
+	if config.Day != "" {
+		if _, ok := weekdays[strings.ToLower(config.Day)[:min(3, len(config.Day))]]; !ok {
+			return fmt.Errorf("invalid weekly_report day: %s", config.Day)
+		}
+	}
+	if config.Time != "" {
+		if _, err := time.Parse("15:04", config.Time); err != nil {
+			return fmt.Errorf("invalid weekly_report time %q, expected HH:MM", config.Time)
+		}
+	}
+	return nil
+}
+
+func (c WeeklyReportConfig) weekday() time.Weekday {
+	if day, ok := weekdays[strings.ToLower(c.Day)[:min(3, len(c.Day))]]; ok {
+		return day
+	}
+	return time.Monday
+}
+
+func (c WeeklyReportConfig) clock() (hour, minute int) {
+	t, err := time.Parse("15:04", c.Time)
+	if err != nil {
+		return 8, 0
+	}
+	return t.Hour(), t.Minute()
+}
+
+// reportWeek returns the first and last day of the week a report written at
+// now covers: the seven days before the latest report day, today included
+func reportWeek(now time.Time, day time.Weekday) (first, last time.Time) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	reportDay := today.AddDate(0, 0, -((int(today.Weekday()) - int(day) + 7) % 7))
+	return reportDay.AddDate(0, 0, -7), reportDay.AddDate(0, 0, -1)
+}
+
+// weeklyReportPath names the report by its first day, so a report that
+// exists was already written for that week
+func weeklyReportPath(dir string, first time.Time) string {
+	return filepath.Join(dir, fmt.Sprintf("minimon-week-%s.md", first.Format(time.DateOnly)))
+}
+
+// runWeeklyReport writes the report every week. A report that is due but
+// missing, e.g. because MiniMon wasn't running then, is written at startup
+func runWeeklyReport(config WeeklyReportConfig, minimon *Config) {
+	hour, minute := config.clock()
+	for {
+		now := time.Now()
+		first, last := reportWeek(now, config.weekday())
+		due := time.Date(last.Year(), last.Month(), last.Day()+1, hour, minute, 0, 0, time.Local)
+		if !now.Before(due) {
+			writeWeeklyReport(config, minimon, first, last)
+			due = time.Date(due.Year(), due.Month(), due.Day()+7, hour, minute, 0, 0, time.Local)
+		}
+		log.Debug().Msgf("Next weekly report at %s", due.Format("2006-01-02 15:04"))
+		time.Sleep(time.Until(due))
+	}
+}
+
+func writeWeeklyReport(config WeeklyReportConfig, minimon *Config, first, last time.Time) {
+	path := weeklyReportPath(config.Dir, first)
+	if _, err := os.Stat(path); err == nil {
+		log.Debug().Msgf("Weekly report %s exists, not writing it again", path)
+		return
+	}
+	report, err := generateWeeklyReport(minimon, first, last)
+	if err != nil {
+		log.Warn().Msgf("Warning: %v. Skipping weekly report.", err)
+		return
+	}
+	if err := os.MkdirAll(config.Dir, 0755); err != nil {
+		log.Warn().Msgf("Warning: %v. Skipping weekly report.", err)
+		return
+	}
+	// Written aside and renamed, so a crash leaves no half report that
+	// would count as written
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(report), 0644); err != nil {
+		log.Warn().Msgf("Warning: %v. Skipping weekly report.", err)
+		return
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		log.Warn().Msgf("Warning: %v. Skipping weekly report.", err)
+		return
+	}
+	log.Info().Msgf("Wrote weekly report %s", path)
+}
+
+// generateWeeklyReport renders the week from first to last from the same
+// hourly aggregation as minimon report
+func generateWeeklyReport(config *Config, first, last time.Time) (string, error) {
+	rows, err := readReportRows(config.MonitorProps, "", first, last)
+	if err != nil {
+		return "", err
+	}
+	reports := buildReport(rows, reportSources(""), first, last)
+	intervals := make(map[string]float64)
+	for _, source := range config.MonitorSources {
+		intervals[source.Name] = float64(source.NotificationConfig.NotificationInterval) / 60
+	}
+	streaks, err := readStreaks(config.MonitorProps, first, last, intervals)
+	if err != nil {
+		return "", err
+	}
+	return weeklyMarkdown(reports, streaks, first, last), nil
+}
+
+// readStreaks finds each source's longest run of active intervals from
+// first to last, in minutes. A gap of more than two intervals between
+// records, when MiniMon wasn't running, ends a run
+func readStreaks(props MonitorProps, first, last time.Time, intervals map[string]float64) (map[string]float64, error) {
+	trackers := make(map[string]*streakTracker)
+	seen := make(map[string]time.Time)
+	err := forEachRecord(props, "", first, last.AddDate(0, 0, 1), func(record eventRecord) {
+		interval := intervals[record.Source]
+		if interval <= 0 {
+			return
+		}
+		tracker := trackers[record.Source]
+		if tracker == nil {
+			tracker = &streakTracker{interval: interval}
+			trackers[record.Source] = tracker
+		}
+		if gap := record.Timestamp.Sub(seen[record.Source]); gap.Minutes() > 2*interval {
+			tracker.active, tracker.idle = 0, 0
+		}
+		seen[record.Source] = record.Timestamp
+		tracker.observe(record.Kind == kindChange)
+	})
+	if err != nil {
+		return nil, err
+	}
+	streaks := make(map[string]float64, len(trackers))
+	for name, tracker := range trackers {
+		streaks[name] = tracker.AllTime.LongestActive
+	}
+	return streaks, nil
+}
+
+// markdownCell keeps a value from breaking the table it is in
+func markdownCell(value string) string {
+	return strings.ReplaceAll(value, "|", `\|`)
+}
+
+func weeklyMarkdown(reports []sourceReport, streaks map[string]float64, first, last time.Time) string {
+	var b strings.Builder
+	year, week := first.ISOWeek()
+	fmt.Fprintf(&b, "# MiniMon week %d-W%02d\n\n", year, week)
+	fmt.Fprintf(&b, "%s to %s\n\n", first.Format("Mon 2006-01-02"), last.Format("Mon 2006-01-02"))
+	if len(reports) == 0 {
+		b.WriteString("No history recorded this week.\n")
+		return b.String()
+	}
+
+	b.WriteString("## Totals\n\n")
+	b.WriteString("| Source | Changes | Active intervals | Intervals | Days | Longest active streak | Busiest hour | Busiest day |\n")
+	b.WriteString("|---|--:|--:|--:|--:|--:|---|---|\n")
+	for _, report := range reports {
+		t := report.Totals
+		streak := "-"
+		if minutes := streaks[report.Source]; minutes > 0 {
+			streak = formatMinutes(minutes)
+		}
+		fmt.Fprintf(&b, "| %s | %d | %d | %d | %d/%d | %s | %s | %s |\n", markdownCell(report.Source), t.Changes, t.Active, t.Intervals,
+			t.DaysWithData, len(report.Days), streak, dashIfEmpty(t.BusiestHour), dashIfEmpty(t.BusiestDay))
+	}
+
+	b.WriteString("\n## Changes per day\n\n| Source |")
+	for _, day := range reports[0].Days {
+		date, _ := time.Parse(time.DateOnly, day.Date)
+		fmt.Fprintf(&b, " %s |", date.Format("Mon 01-02"))
+	}
+	b.WriteString("\n|---|" + strings.Repeat("--:|", len(reports[0].Days)) + "\n")
+	var hourly [24]int
+	for _, report := range reports {
+		fmt.Fprintf(&b, "| %s |", markdownCell(report.Source))
+		for _, day := range report.Days {
+			changes, recorded := 0, false
+			for hour, h := range day.Hours {
+				if h != nil {
+					changes += h.Changes
+					hourly[hour] += h.Changes
+					recorded = true
+				}
+			}
+			// A day without any record is told apart from a quiet one
+			if !recorded {
+				b.WriteString(" - |")
+				continue
+			}
+			fmt.Fprintf(&b, " %d |", changes)
+		}
+		b.WriteString("\n")
+	}
+
+	hours := make([]int, 0, 24)
+	for hour, changes := range hourly {
+		if changes > 0 {
+			hours = append(hours, hour)
+		}
+	}
+	sort.SliceStable(hours, func(i, j int) bool { return hourly[hours[i]] > hourly[hours[j]] })
+	b.WriteString("\n## Top active hours\n\n")
+	if len(hours) == 0 {
+		b.WriteString("No changes this week.\n")
+		return b.String()
+	}
+	b.WriteString("| Hour | Changes |\n|---|--:|\n")
+	for _, hour := range hours[:min(len(hours), weeklyTopHours)] {
+		fmt.Fprintf(&b, "| %02d:00-%02d:00 | %d |\n", hour, (hour+1)%24, hourly[hour])
+	}
+	return b.String()
+}
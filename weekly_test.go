@@ -0,0 +1,84 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadStreaks(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2024, 5, 6, hour, minute, 0, 0, time.Local)
+	}
+	change := func(hour, minute int) eventRecord {
+		return eventRecord{Timestamp: at(hour, minute), Source: "thesis", Kind: kindChange, Events: 1}
+	}
+	idle := eventRecord{Timestamp: at(10, 15), Source: "thesis", Kind: kindIdle, IdleMinutes: 5}
+	tests := []struct {
+		name    string
+		records []eventRecord
+		want    float64
+	}{
+		{"idle interval ends a run", []eventRecord{change(10, 0), change(10, 5), change(10, 10), idle, change(10, 20)}, 15},
+		{"gap ends a run", []eventRecord{change(14, 0), change(14, 5), change(14, 35), change(14, 40)}, 10},
+		{"longest run wins", []eventRecord{change(10, 0), idle, change(12, 0), change(12, 5), change(12, 10), change(12, 15)}, 20},
+		{"before the week", []eventRecord{
+			{Timestamp: at(10, 0).AddDate(0, 0, -1), Source: "thesis", Kind: kindChange},
+			{Timestamp: at(10, 5).AddDate(0, 0, -1), Source: "thesis", Kind: kindChange},
+			change(10, 0),
+		}, 5},
+	}
+	first, last := at(0, 0), at(0, 0).AddDate(0, 0, 6)
+	intervals := map[string]float64{"thesis": 5}
+	for _, store := range []string{"event_log", "history_store"} {
+		for _, tt := range tests {
+			t.Run(store+"/"+tt.name, func(t *testing.T) {
+				records := append(append([]eventRecord{}, tt.records...), eventRecord{Timestamp: at(11, 0), Source: "unconfigured", Kind: kindChange})
+				streaks, err := readStreaks(writeFixtureHistory(t, store, records), first, last, intervals)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := streaks["thesis"]; got != tt.want {
+					t.Errorf("longest streak = %v, want %v", got, tt.want)
+				}
+				if _, ok := streaks["unconfigured"]; ok {
+					t.Errorf("source without an interval got a streak")
+				}
+			})
+		}
+	}
+}
+
+func TestWriteWeeklyReport(t *testing.T) {
+	first := time.Date(2024, 5, 6, 0, 0, 0, 0, time.Local)
+	last := first.AddDate(0, 0, 6)
+	minimon := &Config{
+		MonitorProps:   writeFixtureHistory(t, "event_log", reportFixture()),
+		MonitorSources: []Source{{Name: "thesis", NotificationConfig: NotificationConfig{NotificationInterval: 300}}},
+	}
+	config := WeeklyReportConfig{Dir: t.TempDir()}
+	path := weeklyReportPath(config.Dir, first)
+
+	// A half report left by a crash is replaced
+	writeTestFile(t, config.Dir, filepath.Base(path)+".tmp", "half")
+	writeWeeklyReport(config, minimon, first, last)
+	report, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(report), "# MiniMon week 2024-W19") || !strings.Contains(string(report), "| thesis |") {
+		t.Errorf("unexpected report:\n%s", report)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary file left behind: %v", err)
+	}
+
+	// An existing report is kept
+	writeTestFile(t, config.Dir, filepath.Base(path), "edited")
+	writeWeeklyReport(config, minimon, first, last)
+	if report, _ := os.ReadFile(path); string(report) != "edited" {
+		t.Errorf("existing report was rewritten: %q", report)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// WorkSessionConfig turns a source's activity into pomodoro-style
+// reminders: a break is suggested after Work of activity and, once the
+// source has been idle for Break, it is time to get back to work
+type WorkSessionConfig struct {
+	Work  string `json:"work"`
+	Break string `json:"break"`
+}
+
+func validWorkSession(config *WorkSessionConfig) error {
+	if config == nil {
+		return nil
+	}
+	for _, value := range []string{config.Work, config.Break} {
+		if duration, err := time.ParseDuration(value); err != nil || duration <= 0 {
+			return fmt.Errorf("invalid session duration: %q", value)
+		}
+	}
+	return nil
+}
+
+// What a work session reports after an interval
+type sessionEvent int
+
+const (
+	sessionNone sessionEvent = iota
+	sessionBreakDue
+	sessionBreakOver
+)
+
+type sessionState int
+
+const (
+	// Counting active intervals towards a break
+	sessionWorking sessionState = iota
+	// A break was suggested and the source should go idle
+	sessionBreak
+	// The break is over; the next activity starts a new work session
+	sessionRested
+)
+
+// workSession is the pomodoro state machine. It only sees whether each
+// interval was active, so it can be driven by any monitor and kept apart
+// from the idle notifications
+type workSession struct {
+	// workIntervals active intervals make a work session
+	workIntervals int
+	breakTime     time.Duration
+	interval      time.Duration
+
+	state  sessionState
+	active int
+	// idle is the idle time since the last active interval
+	idle time.Duration
+}
+
+func newWorkSession(config WorkSessionConfig, interval time.Duration) *workSession {
+	work, _ := time.ParseDuration(config.Work)
+	breakTime, _ := time.ParseDuration(config.Break)
+	return &workSession{
+		workIntervals: max(int(math.Ceil(float64(work)/float64(interval))), 1),
+		breakTime:     breakTime,
+		interval:      interval,
+	}
+}
+
+// observe advances the session by one interval. A short pause while
+// working doesn't restart the count, an idle stretch as long as a break
+// does
+func (w *workSession) observe(active bool) sessionEvent {
+	if active {
+		w.idle = 0
+		switch w.state {
+		case sessionWorking:
+			w.active++
+			if w.active >= w.workIntervals {
+				w.state = sessionBreak
+				w.active = 0
+				return sessionBreakDue
+			}
+		case sessionRested:
+			w.state = sessionWorking
+			w.active = 1
+		}
+		return sessionNone
+	}
+
+	w.idle += w.interval
+	if w.idle < w.breakTime {
+		return sessionNone
+	}
+	switch w.state {
+	case sessionWorking:
+		// Took a break without being told to
+		w.active = 0
+	case sessionBreak:
+		w.state = sessionRested
+		return sessionBreakOver
+	}
+	return sessionNone
+}
+
+// workMinutes is the length of a work session as counted, in minutes
+func (w *workSession) workMinutes() float64 {
+	return (time.Duration(w.workIntervals) * w.interval).Minutes()
+}
+
+func sendSessionEvent(source Source, session *workSession, event sessionEvent) {
+	data := MessageData{Source: source.Name, Path: source.Path}
+	switch event {
+	case sessionBreakDue:
+		data.Kind = kindBreak
+		data.Minutes = session.workMinutes()
+		data.Detail = fmt.Sprintf("active for %s, time for a break", formatMinutes(data.Minutes))
+	case sessionBreakOver:
+		data.Kind = kindBreakOver
+		data.Minutes = session.idle.Minutes()
+		data.Detail = fmt.Sprintf("idle for %s, break is over", formatMinutes(data.Minutes))
+	default:
+		return
+	}
+	source.logger.Info().Msgf("Work session: %s", data.Detail)
+	notifySource(source, data, true)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWorkSession(t *testing.T) {
+	tests := []struct {
+		name      string
+		intervals string // a for an active interval, i for an idle one
+		events    string // b when a break is due, o when it is over
+	}{
+		{"break after work", "aaa", "..b"},
+		{"break over", "aaaii", "..b.o"},
+		{"short pause keeps counting", "aiaa", "...b"},
+		{"idle stretch restarts the count", "aiiaaa", ".....b"},
+		{"break over only once", "aaaiiii", "..b.o.."},
+		{"activity during the break", "aaaiaiia", "..b...o."},
+		{"next session", "aaaiiaaa", "..b.o..b"},
+		{"idle from the start", "iiiaaa", ".....b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 15m of work is 3 intervals, a 10m break is 2
+			session := newWorkSession(WorkSessionConfig{Work: "15m", Break: "10m"}, 5*time.Minute)
+			events := ""
+			for _, c := range tt.intervals {
+				switch session.observe(c == 'a') {
+				case sessionBreakDue:
+					events += "b"
+				case sessionBreakOver:
+					events += "o"
+				default:
+					events += "."
+				}
+			}
+			if events != tt.events {
+				t.Errorf("events = %q, want %q", events, tt.events)
+			}
+		})
+	}
+}
+
+func TestNewWorkSession(t *testing.T) {
+	tests := []struct {
+		work      string
+		interval  time.Duration
+		intervals int
+		minutes   float64
+	}{
+		{"25m", 5 * time.Minute, 5, 25},
+		{"12m", 5 * time.Minute, 3, 15},
+		{"30s", time.Minute, 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.work, func(t *testing.T) {
+			session := newWorkSession(WorkSessionConfig{Work: tt.work, Break: "5m"}, tt.interval)
+			if session.workIntervals != tt.intervals || session.workMinutes() != tt.minutes {
+				t.Errorf("%d intervals, %v minutes, want %d, %v", session.workIntervals, session.workMinutes(), tt.intervals, tt.minutes)
+			}
+		})
+	}
+}
+
+func TestValidWorkSession(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *WorkSessionConfig
+		valid  bool
+	}{
+		{"unset", nil, true},
+		{"valid", &WorkSessionConfig{Work: "25m", Break: "5m"}, true},
+		{"missing break", &WorkSessionConfig{Work: "25m"}, false},
+		{"zero work", &WorkSessionConfig{Work: "0s", Break: "5m"}, false},
+		{"not a duration", &WorkSessionConfig{Work: "25", Break: "5m"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validWorkSession(tt.config); (err == nil) != tt.valid {
+				t.Errorf("validWorkSession = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}